@@ -0,0 +1,207 @@
+// Package attachments stores receipt photos and PDFs for transactions in a
+// blob store, deduplicated by content hash, with a thumbnail for images.
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expense-app-backend/blobstore"
+	"expense-app-backend/models"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultMaxSize = 10 << 20
+
+var (
+	ErrEmpty           = errors.New("attachment is empty")
+	ErrTooLarge        = errors.New("attachment is too large")
+	ErrUnsupportedType = errors.New("attachment type is not supported")
+)
+
+// allowedTypes are the content types accepted, as sniffed from the file
+// rather than taken from the upload.
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// MaxSize is the largest file accepted, ATTACHMENT_MAX_BYTES or 10MB.
+func MaxSize() int64 {
+	if value := os.Getenv("ATTACHMENT_MAX_BYTES"); value != "" {
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil && size > 0 {
+			return size
+		}
+		log.Printf("attachments: ignoring invalid ATTACHMENT_MAX_BYTES %q", value)
+	}
+	return defaultMaxSize
+}
+
+// BlobKey is where the file with the given SHA-256 is stored.
+func BlobKey(sha string) string {
+	return "blobs/" + sha[:2] + "/" + sha
+}
+
+// ThumbnailKey is where the thumbnail of the file with the given SHA-256 is
+// stored. Thumbnails are always JPEG.
+func ThumbnailKey(sha string) string {
+	return "thumbnails/" + sha[:2] + "/" + sha + ".jpg"
+}
+
+// Save stores the file read from r and attaches it to the transaction.
+// Attaching the same file to the same transaction again returns the existing
+// attachment.
+//
+// The blob and its thumbnail are written on every upload, even when another
+// attachment shares them: Put is idempotent per content hash, and checking
+// for the blob first would race with Release deleting it. They are written
+// inside the transaction that inserts the row, so Release, which locks the
+// rows with the same hash, either sees the new row or finishes deleting
+// before the blob is written again.
+func Save(ctx context.Context, db *gorm.DB, store blobstore.BlobStore, userID, transactionID uuid.UUID, filename string, r io.Reader) (*models.Attachment, error) {
+	maxSize := MaxSize()
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := sniff(data)
+	if !allowedTypes[contentType] {
+		return nil, ErrUnsupportedType
+	}
+
+	sum := sha256.Sum256(data)
+	sha := hex.EncodeToString(sum[:])
+
+	var existing models.Attachment
+	err = db.Where("transaction_id = ? AND sha256 = ?", transactionID, sha).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	thumbnail := makeThumbnail(sha, contentType, data)
+	attachment := models.Attachment{
+		UserID:        userID,
+		TransactionID: transactionID,
+		Filename:      cleanFilename(filename),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		SHA256:        sha,
+		HasThumbnail:  thumbnail != nil,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attachment).Error; err != nil {
+			return err
+		}
+		if err := store.Put(ctx, BlobKey(sha), bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			return err
+		}
+		if thumbnail != nil {
+			return store.Put(ctx, ThumbnailKey(sha), bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// makeThumbnail returns the thumbnail of an image, or nil. Formats the
+// standard library cannot decode, and images too large to decode safely, go
+// without.
+func makeThumbnail(sha, contentType string, data []byte) []byte {
+	if !canThumbnail(contentType) {
+		return nil
+	}
+	thumbnail, err := Thumbnail(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("attachments: no thumbnail for %s: %v", sha, err)
+		return nil
+	}
+	return thumbnail
+}
+
+// Release deletes the blob with the given SHA-256, and its thumbnail, once
+// no attachment refers to it any more. It is called after the attachment
+// rows are gone. The rows with the hash stay locked until the blobs are
+// deleted, so a Save of the same file waits rather than losing its blob.
+func Release(ctx context.Context, db *gorm.DB, store blobstore.BlobStore, sha string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		if err := tx.Model(&models.Attachment{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("sha256 = ?", sha).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			return nil
+		}
+		if err := store.Delete(ctx, ThumbnailKey(sha)); err != nil {
+			return err
+		}
+		return store.Delete(ctx, BlobKey(sha))
+	})
+}
+
+// Open returns the file of an attachment, or its thumbnail, with the content
+// type to serve it as.
+func Open(ctx context.Context, store blobstore.BlobStore, attachment *models.Attachment, thumbnail bool) (io.ReadCloser, string, error) {
+	if thumbnail {
+		if !attachment.HasThumbnail {
+			return nil, "", blobstore.ErrNotFound
+		}
+		body, err := store.Get(ctx, ThumbnailKey(attachment.SHA256))
+		return body, "image/jpeg", err
+	}
+	body, err := store.Get(ctx, BlobKey(attachment.SHA256))
+	return body, attachment.ContentType, err
+}
+
+// sniff detects the content type from the first bytes of the file. The
+// standard library does not know WebP's RIFF signature under its own name.
+func sniff(data []byte) string {
+	if len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
+		return "image/webp"
+	}
+	contentType := http.DetectContentType(data)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// cleanFilename keeps only the base name of an uploaded file, as browsers
+// on some systems send the full client path.
+func cleanFilename(filename string) string {
+	filename = path.Base(strings.ReplaceAll(strings.TrimSpace(filename), `\`, "/"))
+	if filename == "." || filename == "/" {
+		return "attachment"
+	}
+	if len(filename) > 255 {
+		filename = filename[:255]
+	}
+	return filename
+}
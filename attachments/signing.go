@@ -0,0 +1,97 @@
+package attachments
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Download variants.
+const (
+	VariantOriginal  = "original"
+	VariantThumbnail = "thumbnail"
+)
+
+const defaultURLTTL = 15 * time.Minute
+
+var (
+	urlKeyOnce sync.Once
+	urlKey     []byte
+)
+
+// signingKey is ATTACHMENT_URL_SECRET. Without one, a random key is made at
+// start-up, so links stop working on restart and differ between instances.
+func signingKey() []byte {
+	urlKeyOnce.Do(func() {
+		if secret := os.Getenv("ATTACHMENT_URL_SECRET"); secret != "" {
+			urlKey = []byte(secret)
+			return
+		}
+		log.Printf("attachments: ATTACHMENT_URL_SECRET is not set, download links will not survive a restart")
+		urlKey = make([]byte, 32)
+		if _, err := rand.Read(urlKey); err != nil {
+			panic(err)
+		}
+	})
+	return urlKey
+}
+
+// URLTTL is how long a download link stays valid, ATTACHMENT_URL_TTL (a Go
+// duration such as "1h") or 15 minutes.
+func URLTTL() time.Duration {
+	if value := os.Getenv("ATTACHMENT_URL_TTL"); value != "" {
+		if ttl, err := time.ParseDuration(value); err == nil && ttl > 0 {
+			return ttl
+		}
+		log.Printf("attachments: ignoring invalid ATTACHMENT_URL_TTL %q", value)
+	}
+	return defaultURLTTL
+}
+
+func signature(id uuid.UUID, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte(id.String() + "\n" + variant + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURL returns a download link for the attachment that needs no login
+// and expires after URLTTL, so it can be put straight into an <img> tag.
+func SignedURL(id uuid.UUID, variant string, now time.Time) string {
+	expires := now.Add(URLTTL()).Unix()
+	query := url.Values{}
+	if variant == VariantThumbnail {
+		query.Set("variant", variant)
+	}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", signature(id, variant, expires))
+	return "/api/attachments/" + id.String() + "/download?" + query.Encode()
+}
+
+// VerifySignedURL checks the query of a download link made by SignedURL and
+// returns the variant it grants.
+func VerifySignedURL(id uuid.UUID, query url.Values, now time.Time) (string, bool) {
+	variant := query.Get("variant")
+	if variant == "" {
+		variant = VariantOriginal
+	}
+	if variant != VariantOriginal && variant != VariantThumbnail {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature(id, variant, expires)), []byte(query.Get("signature"))) {
+		return "", false
+	}
+	return variant, true
+}
@@ -0,0 +1,90 @@
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	thumbnailSize    = 256
+	thumbnailQuality = 80
+	// maxPixels keeps a small file claiming huge dimensions from being
+	// decoded into gigabytes of memory.
+	maxPixels = 50_000_000
+)
+
+func canThumbnail(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/gif"
+}
+
+// Thumbnail decodes an image and returns a JPEG no larger than 256 pixels on
+// either side, averaging the pixels each thumbnail pixel covers.
+// Transparent areas become white.
+func Thumbnail(r io.ReadSeeker) ([]byte, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, errors.New("image dimensions out of range")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	source, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(source), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func downscale(source image.Image) image.Image {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	thumbWidth, thumbHeight := width, height
+	if width > thumbnailSize || height > thumbnailSize {
+		if width >= height {
+			thumbWidth, thumbHeight = thumbnailSize, max(1, height*thumbnailSize/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*thumbnailSize/height), thumbnailSize
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for ty := 0; ty < thumbHeight; ty++ {
+		y0 := bounds.Min.Y + ty*height/thumbHeight
+		y1 := max(y0+1, bounds.Min.Y+(ty+1)*height/thumbHeight)
+		for tx := 0; tx < thumbWidth; tx++ {
+			x0 := bounds.Min.X + tx*width/thumbWidth
+			x1 := max(x0+1, bounds.Min.X+(tx+1)*width/thumbWidth)
+
+			var r, g, b, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					// Colours are alpha-premultiplied, so adding the
+					// missing alpha composites onto white.
+					cr, cg, cb, ca := source.At(x, y).RGBA()
+					white := 0xffff - uint64(ca)
+					r += uint64(cr) + white
+					g += uint64(cg) + white
+					b += uint64(cb) + white
+					n++
+				}
+			}
+			thumb.SetRGBA(tx, ty, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff})
+		}
+	}
+	return thumb
+}
@@ -0,0 +1,496 @@
+// Package backup writes everything a user owns to a versioned ZIP archive
+// and restores such an archive, on this or another instance. Each section is
+// a JSON array in its own file; manifest.json names the format version.
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"expense-app-backend/attachments"
+	"expense-app-backend/blobstore"
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Version is the archive format version written by this build. Restore
+// accepts archives up to this version.
+const Version = 1
+
+const formatName = "expense-app-backup"
+
+// batchSize is how many records of a section are held in memory at a time.
+const batchSize = 500
+
+// Section files, in the order they are restored.
+const (
+	fileManifest            = "manifest.json"
+	fileProfile             = "profile.json"
+	fileCategories          = "categories.json"
+	fileAccounts            = "accounts.json"
+	fileTags                = "tags.json"
+	filePayees              = "payees.json"
+	fileImportProfiles      = "import_profiles.json"
+	fileImportBatches       = "import_batches.json"
+	fileTransfers           = "transfers.json"
+	fileRecurring           = "recurring.json"
+	fileTransactions        = "transactions.json"
+	fileAttachments         = "attachments.json"
+	fileBills               = "bills.json"
+	fileBudgets             = "budgets.json"
+	fileEnvelopeAssignments = "envelope_assignments.json"
+	fileEnvelopeMoves       = "envelope_moves.json"
+	fileRules               = "rules.json"
+	fileExchangeRates       = "exchange_rates.json"
+
+	// Only in data exports.
+	fileJournal             = "journal.json"
+	fileDeletedTransactions = "deleted_transactions.json"
+)
+
+// blobDir holds the attachment files, one per SHA-256, after the sections.
+const blobDir = "attachments/"
+
+// Archive kinds. A data export holds everything stored about the user, for
+// them to read rather than to restore, and leaves out the password hash.
+const (
+	KindBackup     = "backup"
+	KindDataExport = "data-export"
+)
+
+var (
+	ErrNotBackup          = errors.New("not a backup archive")
+	ErrUnsupportedVersion = errors.New("backup archive version is not supported")
+)
+
+// Manifest describes an archive: its format version and how many records
+// each section holds.
+type Manifest struct {
+	Format    string         `json:"format"`
+	Kind      string         `json:"kind"`
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// profileRecord is the user's profile. The password hash is kept so the
+// user can log in with the same password after moving to another instance.
+type profileRecord struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	PasswordHash  string     `json:"password_hash,omitempty"`
+	Locale        string     `json:"locale"`
+	BaseCurrency  string     `json:"base_currency"`
+	BudgetMode    string     `json:"budget_mode"`
+	EnvelopeStart *time.Time `json:"envelope_start"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeleteAfter   *time.Time `json:"delete_after,omitempty"`
+}
+
+// categoryRecord is a category or sub-category. Global categories the user
+// can see are included so references to them can be resolved on an
+// instance where their IDs differ.
+type categoryRecord struct {
+	ID           uuid.UUID  `json:"id"`
+	Global       bool       `json:"global"`
+	ParentID     *uuid.UUID `json:"parent_id"`
+	Name         string     `json:"name"`
+	CategoryType string     `json:"category_type"`
+	Position     int        `json:"position"`
+	ArchivedAt   *time.Time `json:"archived_at"`
+	DeletedAt    *time.Time `json:"deleted_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type transactionRecord struct {
+	ID             uuid.UUID                 `json:"id"`
+	AccountID      uuid.UUID                 `json:"account_id"`
+	CategoryID     *uuid.UUID                `json:"category_id"`
+	TransferID     *uuid.UUID                `json:"transfer_id"`
+	PayeeID        *uuid.UUID                `json:"payee_id"`
+	RecurringID    *uuid.UUID                `json:"recurring_id"`
+	OccurrenceDate *time.Time                `json:"occurrence_date"`
+	ImportBatchID  *uuid.UUID                `json:"import_batch_id"`
+	ImportHash     string                    `json:"import_hash"`
+	Type           string                    `json:"type"`
+	Amount         models.Money              `json:"amount"`
+	Date           time.Time                 `json:"date"`
+	Note           string                    `json:"note"`
+	Splits         []models.TransactionSplit `json:"splits"`
+	TagIDs         []uuid.UUID               `json:"tag_ids"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	DeletedAt      *time.Time                `json:"deleted_at,omitempty"`
+}
+
+type recurringRecord struct {
+	models.RecurringTransaction
+	Exceptions []models.RecurringException `json:"exceptions"`
+}
+
+type billRecord struct {
+	models.Bill
+	Payments []models.BillPayment `json:"payments"`
+}
+
+// Write streams the user's backup archive to w, with the attachment files
+// read from store. Deleted transactions, budgets, bills and recurring
+// transactions are left out; deleted categories are kept so the category
+// trash survives the move.
+func Write(db *gorm.DB, store blobstore.BlobStore, w io.Writer, userID uuid.UUID) error {
+	return write(db, store, w, userID, KindBackup)
+}
+
+// WriteDataExport streams everything stored about the user: the backup
+// sections, the journal and the deleted transactions that have not been
+// purged yet, with their attachments.
+func WriteDataExport(db *gorm.DB, store blobstore.BlobStore, w io.Writer, userID uuid.UUID) error {
+	return write(db, store, w, userID, KindDataExport)
+}
+
+func write(db *gorm.DB, store blobstore.BlobStore, w io.Writer, userID uuid.UUID, kind string) error {
+	var user models.User
+	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	manifest := Manifest{Format: formatName, Kind: kind, Version: Version, CreatedAt: time.Now(), Counts: map[string]int{}}
+	profile := profileRecord{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		PasswordHash:  user.Password,
+		Locale:        user.Locale,
+		BaseCurrency:  user.BaseCurrency,
+		BudgetMode:    user.BudgetMode,
+		EnvelopeStart: user.EnvelopeStart,
+		CreatedAt:     user.CreatedAt,
+	}
+	if kind == KindDataExport {
+		profile.PasswordHash = ""
+		profile.DeleteAfter = user.DeleteAfter
+	}
+	if err := writeJSON(archive, fileProfile, profile); err != nil {
+		return err
+	}
+
+	owned := func(model interface{}) *gorm.DB {
+		return db.Model(model).Where("user_id = ?", userID)
+	}
+	// A backup leaves out the attachments of deleted transactions along
+	// with the transactions.
+	ownedAttachments := func() *gorm.DB {
+		query := owned(&models.Attachment{})
+		if kind == KindBackup {
+			query = query.Where("transaction_id IN (?)", owned(&models.Transaction{}).Select("id"))
+		}
+		return query
+	}
+	sections := []struct {
+		name  string
+		write func(io.Writer) (int, error)
+	}{
+		{fileCategories, func(file io.Writer) (int, error) {
+			query := db.Unscoped().Model(&models.Category{}).Where("(user_id = ? OR user_id IS NULL)", userID)
+			return writeSection(file, query, categoryRecords)
+		}},
+		{fileAccounts, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Account{}), same[models.Account])
+		}},
+		{fileTags, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Tag{}), same[models.Tag])
+		}},
+		{filePayees, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Payee{}).Preload("Aliases"), same[models.Payee])
+		}},
+		{fileImportProfiles, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.ImportProfile{}), same[models.ImportProfile])
+		}},
+		{fileImportBatches, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.ImportBatch{}), same[models.ImportBatch])
+		}},
+		{fileTransfers, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Transfer{}), same[models.Transfer])
+		}},
+		{fileRecurring, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.RecurringTransaction{}), func(batch []models.RecurringTransaction) ([]interface{}, error) {
+				return recurringRecords(db, batch)
+			})
+		}},
+		{fileTransactions, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Transaction{}), func(batch []models.Transaction) ([]interface{}, error) {
+				return transactionRecords(db, batch)
+			})
+		}},
+		{fileAttachments, func(file io.Writer) (int, error) {
+			return writeSection(file, ownedAttachments(), same[models.Attachment])
+		}},
+		{fileBills, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Bill{}), func(batch []models.Bill) ([]interface{}, error) {
+				return billRecords(db, batch)
+			})
+		}},
+		{fileBudgets, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Budget{}), same[models.Budget])
+		}},
+		{fileEnvelopeAssignments, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.EnvelopeAssignment{}), same[models.EnvelopeAssignment])
+		}},
+		{fileEnvelopeMoves, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.EnvelopeMove{}), same[models.EnvelopeMove])
+		}},
+		{fileRules, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.Rule{}), same[models.Rule])
+		}},
+		{fileExchangeRates, func(file io.Writer) (int, error) {
+			return writeSection(file, owned(&models.ExchangeRate{}), same[models.ExchangeRate])
+		}},
+	}
+	if kind == KindDataExport {
+		sections = append(sections, []struct {
+			name  string
+			write func(io.Writer) (int, error)
+		}{
+			{fileJournal, func(file io.Writer) (int, error) {
+				return writeSection(file, owned(&models.JournalEntry{}).Preload("Postings"), same[models.JournalEntry])
+			}},
+			{fileDeletedTransactions, func(file io.Writer) (int, error) {
+				query := db.Unscoped().Model(&models.Transaction{}).Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+				return writeSection(file, query, func(batch []models.Transaction) ([]interface{}, error) {
+					return transactionRecords(db, batch)
+				})
+			}},
+		}...)
+	}
+	for _, section := range sections {
+		file, err := archive.Create(section.name)
+		if err != nil {
+			return err
+		}
+		count, err := section.write(file)
+		if err != nil {
+			return err
+		}
+		manifest.Counts[section.name] = count
+	}
+
+	var shas []string
+	if err := ownedAttachments().Distinct("sha256").Pluck("sha256", &shas).Error; err != nil {
+		return err
+	}
+	for _, sha := range shas {
+		if err := writeBlob(archive, store, sha); err != nil {
+			return err
+		}
+	}
+
+	if err := writeJSON(archive, fileManifest, manifest); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeBlob copies an attachment file into the archive uncompressed, since
+// photos and PDFs are compressed already. A file missing from the store is
+// left out, and restoring skips the attachments that refer to it.
+func writeBlob(archive *zip.Writer, store blobstore.BlobStore, sha string) error {
+	body, err := store.Get(context.Background(), attachments.BlobKey(sha))
+	if errors.Is(err, blobstore.ErrNotFound) {
+		log.Printf("backup: attachment file %s is missing from the blob store", sha)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: blobDir + sha, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, body)
+	return err
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// writeSection writes the rows of query as a JSON array, one record per
+// line, turning each batch of rows into records with convert.
+func writeSection[T any](file io.Writer, query *gorm.DB, convert func([]T) ([]interface{}, error)) (int, error) {
+	if _, err := io.WriteString(file, "["); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var batch []T
+	err := query.FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		records, err := convert(batch)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			separator := "\n"
+			if count > 0 {
+				separator = ",\n"
+			}
+			if _, err := io.WriteString(file, separator+string(data)); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = io.WriteString(file, "\n]\n")
+	return count, err
+}
+
+func same[T any](batch []T) ([]interface{}, error) {
+	records := make([]interface{}, len(batch))
+	for i := range batch {
+		records[i] = batch[i]
+	}
+	return records, nil
+}
+
+func categoryRecords(batch []models.Category) ([]interface{}, error) {
+	records := make([]interface{}, len(batch))
+	for i, category := range batch {
+		record := categoryRecord{
+			ID:           category.ID,
+			Global:       category.UserID == nil,
+			ParentID:     category.ParentID,
+			Name:         category.Name,
+			CategoryType: category.CategoryType,
+			Position:     category.Position,
+			ArchivedAt:   category.ArchivedAt,
+			CreatedAt:    category.CreatedAt,
+		}
+		if category.DeletedAt.Valid {
+			deletedAt := category.DeletedAt.Time
+			record.DeletedAt = &deletedAt
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// transactionRecords adds the split lines and tags of a batch of
+// transactions.
+func transactionRecords(db *gorm.DB, batch []models.Transaction) ([]interface{}, error) {
+	ids := make([]uuid.UUID, len(batch))
+	for i, transaction := range batch {
+		ids[i] = transaction.ID
+	}
+
+	var splits []models.TransactionSplit
+	if err := db.Where("transaction_id IN ?", ids).Order("position").Find(&splits).Error; err != nil {
+		return nil, err
+	}
+	splitsOf := map[uuid.UUID][]models.TransactionSplit{}
+	for _, split := range splits {
+		splitsOf[split.TransactionID] = append(splitsOf[split.TransactionID], split)
+	}
+
+	var links []models.TransactionTag
+	if err := db.Where("transaction_id IN ?", ids).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	tagsOf := map[uuid.UUID][]uuid.UUID{}
+	for _, link := range links {
+		tagsOf[link.TransactionID] = append(tagsOf[link.TransactionID], link.TagID)
+	}
+
+	records := make([]interface{}, len(batch))
+	for i, transaction := range batch {
+		record := transactionRecord{
+			ID:             transaction.ID,
+			AccountID:      transaction.AccountID,
+			CategoryID:     transaction.CategoryID,
+			TransferID:     transaction.TransferID,
+			PayeeID:        transaction.PayeeID,
+			RecurringID:    transaction.RecurringID,
+			OccurrenceDate: transaction.OccurrenceDate,
+			ImportBatchID:  transaction.ImportBatchID,
+			ImportHash:     transaction.ImportHash,
+			Type:           transaction.Type,
+			Amount:         transaction.Amount,
+			Date:           transaction.Date,
+			Note:           transaction.Note,
+			Splits:         splitsOf[transaction.ID],
+			TagIDs:         tagsOf[transaction.ID],
+			CreatedAt:      transaction.CreatedAt,
+		}
+		if transaction.DeletedAt.Valid {
+			deletedAt := transaction.DeletedAt.Time
+			record.DeletedAt = &deletedAt
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+func recurringRecords(db *gorm.DB, batch []models.RecurringTransaction) ([]interface{}, error) {
+	ids := make([]uuid.UUID, len(batch))
+	for i, recurring := range batch {
+		ids[i] = recurring.ID
+	}
+	var exceptions []models.RecurringException
+	if err := db.Where("recurring_id IN ?", ids).Find(&exceptions).Error; err != nil {
+		return nil, err
+	}
+	exceptionsOf := map[uuid.UUID][]models.RecurringException{}
+	for _, exception := range exceptions {
+		exceptionsOf[exception.RecurringID] = append(exceptionsOf[exception.RecurringID], exception)
+	}
+
+	records := make([]interface{}, len(batch))
+	for i, recurring := range batch {
+		records[i] = recurringRecord{RecurringTransaction: recurring, Exceptions: exceptionsOf[recurring.ID]}
+	}
+	return records, nil
+}
+
+func billRecords(db *gorm.DB, batch []models.Bill) ([]interface{}, error) {
+	ids := make([]uuid.UUID, len(batch))
+	for i, bill := range batch {
+		ids[i] = bill.ID
+	}
+	var payments []models.BillPayment
+	if err := db.Where("bill_id IN ?", ids).Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	paymentsOf := map[uuid.UUID][]models.BillPayment{}
+	for _, payment := range payments {
+		paymentsOf[payment.BillID] = append(paymentsOf[payment.BillID], payment)
+	}
+
+	records := make([]interface{}, len(batch))
+	for i, bill := range batch {
+		records[i] = billRecord{Bill: bill, Payments: paymentsOf[bill.ID]}
+	}
+	return records, nil
+}
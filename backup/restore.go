@@ -0,0 +1,986 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"expense-app-backend/attachments"
+	"expense-app-backend/blobstore"
+	"expense-app-backend/ledger"
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Conflict strategies decide what happens to an archived account, rule or
+// import profile whose name the user already uses. Categories, tags and
+// payees are labels rather than records with a history: they are always
+// matched to the existing one by name.
+const (
+	// StrategyFail refuses to restore anything when there is a conflict.
+	StrategyFail = "fail"
+	// StrategySkip keeps the existing record. Everything booked on a skipped
+	// account, such as its transactions, is skipped with it, so an archive
+	// can be restored twice without doubling anything.
+	StrategySkip = "skip"
+	// StrategyRename restores the archived record under a new name, e.g.
+	// "Wallet (2)".
+	StrategyRename = "rename"
+)
+
+var (
+	ErrUnknownStrategy = errors.New("unknown conflict strategy")
+	// ErrNoPassword is returned when a data export, which leaves out the
+	// password hash, would have to create the user it is restored into.
+	ErrNoPassword = errors.New("archive has no password; restore it into an existing user")
+)
+
+// ConflictError lists the names that clash when restoring with StrategyFail.
+type ConflictError struct {
+	Conflicts []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%d archived records conflict with existing ones", len(e.Conflicts))
+}
+
+// Options choose the user to restore into and the conflict strategy. With
+// a nil UserID the user is looked up by the archived email, and created
+// from the archived profile when there is none.
+type Options struct {
+	UserID   uuid.UUID
+	Strategy string
+}
+
+// Result counts, per section, the records created, those matched to an
+// existing record, and those skipped.
+type Result struct {
+	UserID  uuid.UUID      `json:"user_id"`
+	Created map[string]int `json:"created"`
+	Matched map[string]int `json:"matched"`
+	Skipped map[string]int `json:"skipped"`
+}
+
+func IsValidStrategy(strategy string) bool {
+	return strategy == StrategyFail || strategy == StrategySkip || strategy == StrategyRename
+}
+
+// ReadManifest opens an archive and checks that this build can restore it.
+func ReadManifest(r io.ReaderAt, size int64) (*Manifest, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotBackup
+	}
+	return readManifest(archive)
+}
+
+func readManifest(archive *zip.Reader) (*Manifest, error) {
+	var manifest Manifest
+	found, err := readJSON(archive, fileManifest, &manifest)
+	if err != nil || !found || manifest.Format != formatName {
+		return nil, ErrNotBackup
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, ErrUnsupportedVersion
+	}
+	return &manifest, nil
+}
+
+// Restore imports an archive in a single database transaction. Every
+// restored record gets a new ID and references between records are
+// remapped, so an archive can be restored next to the data it came from.
+// The journal is booked afresh, and each restored account gets an opening
+// balance that brings it back to its archived balance. Attachment files are
+// written to store as they are read; if the restore fails, those not
+// already there are left behind unused.
+func Restore(db *gorm.DB, store blobstore.BlobStore, r io.ReaderAt, size int64, options Options) (*Result, error) {
+	if options.Strategy == "" {
+		options.Strategy = StrategyFail
+	}
+	if !IsValidStrategy(options.Strategy) {
+		return nil, ErrUnknownStrategy
+	}
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotBackup
+	}
+	if _, err := readManifest(archive); err != nil {
+		return nil, err
+	}
+
+	result := &Result{Created: map[string]int{}, Matched: map[string]int{}, Skipped: map[string]int{}}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		restore := &restorer{
+			tx:       tx,
+			store:    store,
+			archive:  archive,
+			strategy: options.Strategy,
+			result:   result,
+			ids:      map[uuid.UUID]uuid.UUID{},
+			skipped:  map[uuid.UUID]bool{},
+		}
+		return restore.run(options.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// opening is an account created by the restore with the balance it had in
+// the archive.
+type opening struct {
+	account models.Account
+	balance models.Money
+}
+
+type restorer struct {
+	tx       *gorm.DB
+	store    blobstore.BlobStore
+	archive  *zip.Reader
+	strategy string
+	result   *Result
+	userID   uuid.UUID
+	// ids maps archived IDs to the IDs of the records that took their place.
+	ids map[uuid.UUID]uuid.UUID
+	// skipped holds archived accounts, and records belonging to them, that
+	// were not restored. A skipped account still maps to the existing
+	// account, so rules and payee defaults keep pointing at it.
+	skipped  map[uuid.UUID]bool
+	openings []opening
+}
+
+func (r *restorer) run(userID uuid.UUID) error {
+	if err := r.user(userID); err != nil {
+		return err
+	}
+	if r.strategy == StrategyFail {
+		if err := r.checkConflicts(); err != nil {
+			return err
+		}
+	}
+
+	steps := []func() error{
+		r.categories,
+		r.accounts,
+		r.tags,
+		r.payees,
+		r.importProfiles,
+		r.importBatches,
+		r.transfers,
+		r.recurring,
+		r.transactions,
+		r.attachments,
+		r.bills,
+		r.budgets,
+		r.envelopes,
+		r.rules,
+		r.exchangeRates,
+		r.openAccounts,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// user picks the user to restore into. An existing user keeps their name,
+// email and password; the archived settings are applied.
+func (r *restorer) user(userID uuid.UUID) error {
+	var profile profileRecord
+	if found, err := readJSON(r.archive, fileProfile, &profile); err != nil || !found {
+		return ErrNotBackup
+	}
+
+	var user models.User
+	switch {
+	case userID != uuid.Nil:
+		if err := r.tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+	default:
+		err := r.tx.Where("email = ?", profile.Email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if profile.PasswordHash == "" {
+				return ErrNoPassword
+			}
+			user = models.User{
+				Name:          profile.Name,
+				Email:         profile.Email,
+				Password:      profile.PasswordHash,
+				Locale:        profile.Locale,
+				BaseCurrency:  profile.BaseCurrency,
+				BudgetMode:    profile.BudgetMode,
+				EnvelopeStart: profile.EnvelopeStart,
+			}
+			if err := r.tx.Create(&user).Error; err != nil {
+				return err
+			}
+			r.userID = user.ID
+			r.ids[profile.ID] = user.ID
+			r.result.UserID = user.ID
+			r.result.Created["profile"]++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if r.strategy == StrategyFail {
+			return &ConflictError{Conflicts: []string{"user " + profile.Email}}
+		}
+	}
+
+	r.userID = user.ID
+	r.ids[profile.ID] = user.ID
+	r.result.UserID = user.ID
+	r.result.Matched["profile"]++
+	if !models.IsValidBudgetMode(profile.BudgetMode) {
+		profile.BudgetMode = models.BudgetModeCategory
+	}
+	return r.tx.Model(&user).Updates(map[string]interface{}{
+		"locale":         profile.Locale,
+		"base_currency":  profile.BaseCurrency,
+		"budget_mode":    profile.BudgetMode,
+		"envelope_start": profile.EnvelopeStart,
+	}).Error
+}
+
+// checkConflicts lists every archived account, rule and import profile
+// whose name is taken.
+func (r *restorer) checkConflicts() error {
+	var conflicts []string
+	check := func(file, kind string, model interface{}) error {
+		return readSection(r.archive, file, func(record *struct{ Name string }) error {
+			_, found, err := r.named(model, record.Name)
+			if found {
+				conflicts = append(conflicts, kind+" "+record.Name)
+			}
+			return err
+		})
+	}
+	if err := check(fileAccounts, "account", &models.Account{}); err != nil {
+		return err
+	}
+	if err := check(fileRules, "rule", &models.Rule{}); err != nil {
+		return err
+	}
+	if err := check(fileImportProfiles, "import profile", &models.ImportProfile{}); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// named finds the user's record of the given model with the given name.
+func (r *restorer) named(model interface{}, name string) (uuid.UUID, bool, error) {
+	var ids []uuid.UUID
+	if err := r.tx.Model(model).Where("user_id = ? AND name = ?", r.userID, name).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return uuid.Nil, false, err
+	}
+	if len(ids) == 0 {
+		return uuid.Nil, false, nil
+	}
+	return ids[0], true, nil
+}
+
+// resolveName applies the conflict strategy to an archived name. It returns
+// the name to restore under, or the existing record's ID when the archived
+// record is skipped.
+func (r *restorer) resolveName(model interface{}, name string) (string, *uuid.UUID, error) {
+	existing, found, err := r.named(model, name)
+	if err != nil || !found {
+		return name, nil, err
+	}
+	if r.strategy == StrategySkip {
+		return name, &existing, nil
+	}
+	for i := 2; ; i++ {
+		candidate := name + " (" + strconv.Itoa(i) + ")"
+		if _, found, err := r.named(model, candidate); err != nil || !found {
+			return candidate, nil, err
+		}
+	}
+}
+
+// ref maps an optional reference. References to records that were not
+// restored become nil.
+func (r *restorer) ref(id *uuid.UUID) *uuid.UUID {
+	if id == nil {
+		return nil
+	}
+	if mapped, found := r.ids[*id]; found {
+		return &mapped
+	}
+	return nil
+}
+
+// owner maps a reference to one of the user's accounts, reporting false
+// when the account, and so whatever refers to it, was skipped.
+func (r *restorer) owner(accountID uuid.UUID) (uuid.UUID, bool) {
+	mapped, found := r.ids[accountID]
+	return mapped, found && !r.skipped[accountID]
+}
+
+// categories restores the category tree parents first. A category matches
+// an existing one with the same name, type and parent; global categories
+// keep their ID when this instance has them.
+func (r *restorer) categories() error {
+	var records []categoryRecord
+	if err := readSection(r.archive, fileCategories, func(record *categoryRecord) error {
+		records = append(records, *record)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	byID := make(map[uuid.UUID]categoryRecord, len(records))
+	for _, record := range records {
+		byID[record.ID] = record
+	}
+	depth := func(record categoryRecord) int {
+		depth := 0
+		for record.ParentID != nil && depth <= len(records) {
+			parent, found := byID[*record.ParentID]
+			if !found {
+				break
+			}
+			record = parent
+			depth++
+		}
+		return depth
+	}
+	sort.SliceStable(records, func(i, j int) bool { return depth(records[i]) < depth(records[j]) })
+
+	for _, record := range records {
+		if record.Global {
+			var count int64
+			if err := r.tx.Model(&models.Category{}).Where("id = ? AND user_id IS NULL", record.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				r.ids[record.ID] = record.ID
+				r.result.Matched["categories"]++
+				continue
+			}
+		}
+
+		parentID := r.ref(record.ParentID)
+		if record.DeletedAt == nil {
+			query := r.tx.Model(&models.Category{}).
+				Where("(user_id = ? OR user_id IS NULL) AND name = ? AND category_type = ?", r.userID, record.Name, record.CategoryType).
+				Order("user_id IS NULL")
+			if parentID == nil {
+				query = query.Where("parent_id IS NULL")
+			} else {
+				query = query.Where("parent_id = ?", *parentID)
+			}
+			var ids []uuid.UUID
+			if err := query.Limit(1).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				r.ids[record.ID] = ids[0]
+				r.result.Matched["categories"]++
+				continue
+			}
+		}
+
+		// Global categories missing from this instance become the user's own.
+		userID := r.userID
+		category := models.Category{
+			UserID:       &userID,
+			ParentID:     parentID,
+			Name:         record.Name,
+			CategoryType: record.CategoryType,
+			Position:     record.Position,
+			ArchivedAt:   record.ArchivedAt,
+			CreatedAt:    record.CreatedAt,
+		}
+		if record.DeletedAt != nil {
+			category.DeletedAt = gorm.DeletedAt{Time: *record.DeletedAt, Valid: true}
+		}
+		if err := r.tx.Create(&category).Error; err != nil {
+			return err
+		}
+		r.ids[record.ID] = category.ID
+		r.result.Created["categories"]++
+	}
+	return nil
+}
+
+// accounts restores accounts with a zero balance. Booking their history
+// moves the balance, and openAccounts books the rest.
+func (r *restorer) accounts() error {
+	return readSection(r.archive, fileAccounts, func(record *models.Account) error {
+		name, existing, err := r.resolveName(&models.Account{}, record.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			r.ids[record.ID] = *existing
+			r.skipped[record.ID] = true
+			r.result.Skipped["accounts"]++
+			return nil
+		}
+
+		account := models.Account{Name: name, UserID: r.userID, Currency: record.Currency, CreatedAt: record.CreatedAt}
+		if err := r.tx.Create(&account).Error; err != nil {
+			return err
+		}
+		r.ids[record.ID] = account.ID
+		r.openings = append(r.openings, opening{account: account, balance: models.NewMoney(record.Balance.Amount, account.Currency)})
+		r.result.Created["accounts"]++
+		return nil
+	})
+}
+
+func (r *restorer) tags() error {
+	return readSection(r.archive, fileTags, func(record *models.Tag) error {
+		name := models.NormalizeTagName(record.Name)
+		var existing models.Tag
+		err := r.tx.Where("user_id = ? AND name = ?", r.userID, name).First(&existing).Error
+		if err == nil {
+			r.ids[record.ID] = existing.ID
+			r.result.Matched["tags"]++
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		tag := models.Tag{UserID: r.userID, Name: name, Color: record.Color, CreatedAt: record.CreatedAt}
+		if models.NormalizeTagColor(tag.Color) == "" {
+			tag.Color = models.DefaultTagColor
+		}
+		if err := r.tx.Create(&tag).Error; err != nil {
+			return err
+		}
+		r.ids[record.ID] = tag.ID
+		r.result.Created["tags"]++
+		return nil
+	})
+}
+
+// payees restores payees and their aliases. An alias another payee of the
+// user already answers to is left out.
+func (r *restorer) payees() error {
+	return readSection(r.archive, filePayees, func(record *models.Payee) error {
+		var payeeID uuid.UUID
+		var existing models.Payee
+		err := r.tx.Where("user_id = ? AND name_key = ?", r.userID, models.PayeeKey(record.Name)).First(&existing).Error
+		switch {
+		case err == nil:
+			payeeID = existing.ID
+			r.result.Matched["payees"]++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			payee := models.Payee{
+				UserID:            r.userID,
+				Name:              record.Name,
+				DefaultCategoryID: r.ref(record.DefaultCategoryID),
+				DefaultAccountID:  r.ref(record.DefaultAccountID),
+				UsageCount:        record.UsageCount,
+				LastUsedAt:        record.LastUsedAt,
+				CreatedAt:         record.CreatedAt,
+			}
+			if err := r.tx.Create(&payee).Error; err != nil {
+				return err
+			}
+			payeeID = payee.ID
+			r.result.Created["payees"]++
+		default:
+			return err
+		}
+		r.ids[record.ID] = payeeID
+
+		for _, alias := range record.Aliases {
+			var count int64
+			if err := r.tx.Model(&models.PayeeAlias{}).Where("user_id = ? AND alias_key = ?", r.userID, models.PayeeKey(alias.Alias)).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := r.tx.Create(&models.PayeeAlias{UserID: r.userID, PayeeID: payeeID, Alias: alias.Alias, CreatedAt: alias.CreatedAt}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *restorer) importProfiles() error {
+	return readSection(r.archive, fileImportProfiles, func(record *models.ImportProfile) error {
+		name, existing, err := r.resolveName(&models.ImportProfile{}, record.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			r.ids[record.ID] = *existing
+			r.result.Skipped["import_profiles"]++
+			return nil
+		}
+
+		profile := *record
+		profile.ID = uuid.Nil
+		profile.UserID = r.userID
+		profile.Name = name
+		if err := r.tx.Create(&profile).Error; err != nil {
+			return err
+		}
+		// A false column with a default is left out of the insert.
+		if !record.HasHeader {
+			if err := r.tx.Model(&profile).Update("has_header", false).Error; err != nil {
+				return err
+			}
+		}
+		r.ids[record.ID] = profile.ID
+		r.result.Created["import_profiles"]++
+		return nil
+	})
+}
+
+func (r *restorer) importBatches() error {
+	return readSection(r.archive, fileImportBatches, func(record *models.ImportBatch) error {
+		accountID, ok := r.owner(record.AccountID)
+		if !ok {
+			r.skipped[record.ID] = true
+			r.result.Skipped["import_batches"]++
+			return nil
+		}
+
+		batch := *record
+		batch.ID = uuid.Nil
+		batch.UserID = r.userID
+		batch.AccountID = accountID
+		batch.ProfileID = r.ref(record.ProfileID)
+		if err := r.tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		r.ids[record.ID] = batch.ID
+		r.result.Created["import_batches"]++
+		return nil
+	})
+}
+
+// transfers restores transfers between two restored accounts and books
+// them. Their legs are restored with the transactions.
+func (r *restorer) transfers() error {
+	return readSection(r.archive, fileTransfers, func(record *models.Transfer) error {
+		fromAccountID, fromOK := r.owner(record.FromAccountID)
+		toAccountID, toOK := r.owner(record.ToAccountID)
+		if !fromOK || !toOK {
+			r.skipped[record.ID] = true
+			r.result.Skipped["transfers"]++
+			return nil
+		}
+
+		transfer := *record
+		transfer.ID = uuid.Nil
+		transfer.UserID = r.userID
+		transfer.FromAccountID = fromAccountID
+		transfer.ToAccountID = toAccountID
+		transfer.FeeCategoryID = r.ref(record.FeeCategoryID)
+		if err := r.tx.Create(&transfer).Error; err != nil {
+			return err
+		}
+		if err := ledger.RecordTransfer(r.tx, &transfer); err != nil {
+			return err
+		}
+		r.ids[record.ID] = transfer.ID
+		r.result.Created["transfers"]++
+		return nil
+	})
+}
+
+func (r *restorer) recurring() error {
+	return readSection(r.archive, fileRecurring, func(record *recurringRecord) error {
+		accountID, ok := r.owner(record.AccountID)
+		if !ok {
+			r.skipped[record.ID] = true
+			r.result.Skipped["recurring"]++
+			return nil
+		}
+
+		recurring := record.RecurringTransaction
+		recurring.ID = uuid.Nil
+		recurring.UserID = r.userID
+		recurring.AccountID = accountID
+		recurring.CategoryID = r.ref(record.CategoryID)
+		if err := r.tx.Create(&recurring).Error; err != nil {
+			return err
+		}
+		r.ids[record.ID] = recurring.ID
+
+		for _, exception := range record.Exceptions {
+			exception.ID = uuid.Nil
+			exception.RecurringID = recurring.ID
+			exception.CategoryID = r.ref(exception.CategoryID)
+			if err := r.tx.Create(&exception).Error; err != nil {
+				return err
+			}
+		}
+		r.result.Created["recurring"]++
+		return nil
+	})
+}
+
+// transactions restores transactions with their split lines and tags, and
+// books them. Transactions of a skipped account or transfer are skipped.
+func (r *restorer) transactions() error {
+	return readSection(r.archive, fileTransactions, func(record *transactionRecord) error {
+		accountID, ok := r.owner(record.AccountID)
+		if ok && record.TransferID != nil {
+			_, ok = r.ids[*record.TransferID]
+		}
+		if !ok {
+			r.result.Skipped["transactions"]++
+			return nil
+		}
+
+		transaction := models.Transaction{
+			UserID:         r.userID,
+			AccountID:      accountID,
+			CategoryID:     r.ref(record.CategoryID),
+			TransferID:     r.ref(record.TransferID),
+			PayeeID:        r.ref(record.PayeeID),
+			RecurringID:    r.ref(record.RecurringID),
+			ImportBatchID:  r.ref(record.ImportBatchID),
+			ImportHash:     record.ImportHash,
+			Type:           record.Type,
+			Amount:         record.Amount,
+			Currency:       record.Amount.Currency,
+			Date:           record.Date,
+			Note:           record.Note,
+			CreatedAt:      record.CreatedAt,
+			OccurrenceDate: record.OccurrenceDate,
+		}
+		if transaction.RecurringID == nil {
+			transaction.OccurrenceDate = nil
+		}
+		if err := r.tx.Create(&transaction).Error; err != nil {
+			return err
+		}
+		r.ids[record.ID] = transaction.ID
+
+		for i, split := range record.Splits {
+			line := models.TransactionSplit{
+				TransactionID: transaction.ID,
+				CategoryID:    r.ref(split.CategoryID),
+				Amount:        split.Amount,
+				Note:          split.Note,
+				Position:      i,
+			}
+			if err := r.tx.Create(&line).Error; err != nil {
+				return err
+			}
+		}
+		for _, tagID := range record.TagIDs {
+			if mapped, found := r.ids[tagID]; found {
+				if err := r.tx.Create(&models.TransactionTag{TransactionID: transaction.ID, TagID: mapped}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := ledger.RecordTransaction(r.tx, &transaction); err != nil {
+			return err
+		}
+		r.result.Created["transactions"]++
+		return nil
+	})
+}
+
+// attachments restores the attachments of restored transactions from the
+// files stored in the archive. Attachments whose file is missing, or that
+// this instance does not accept, are skipped.
+func (r *restorer) attachments() error {
+	return readSection(r.archive, fileAttachments, func(record *models.Attachment) error {
+		transactionID, found := r.ids[record.TransactionID]
+		if !found {
+			r.result.Skipped["attachments"]++
+			return nil
+		}
+		file, err := r.archive.Open(blobDir + record.SHA256)
+		if err != nil {
+			r.result.Skipped["attachments"]++
+			return nil
+		}
+		defer file.Close()
+
+		attachment, err := attachments.Save(context.Background(), r.tx, r.store, r.userID, transactionID, record.Filename, file)
+		if errors.Is(err, attachments.ErrEmpty) || errors.Is(err, attachments.ErrTooLarge) || errors.Is(err, attachments.ErrUnsupportedType) {
+			r.result.Skipped["attachments"]++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.tx.Model(attachment).Update("created_at", record.CreatedAt).Error; err != nil {
+			return err
+		}
+		r.result.Created["attachments"]++
+		return nil
+	})
+}
+
+// bills restores bills and the payments whose transaction was restored.
+func (r *restorer) bills() error {
+	return readSection(r.archive, fileBills, func(record *billRecord) error {
+		accountID, ok := r.owner(record.AccountID)
+		if !ok {
+			r.result.Skipped["bills"]++
+			return nil
+		}
+
+		bill := record.Bill
+		bill.ID = uuid.Nil
+		bill.UserID = r.userID
+		bill.AccountID = accountID
+		bill.CategoryID = r.ref(record.CategoryID)
+		if err := r.tx.Create(&bill).Error; err != nil {
+			return err
+		}
+		if record.RemindDays == 0 {
+			if err := r.tx.Model(&bill).Update("remind_days", 0).Error; err != nil {
+				return err
+			}
+		}
+		r.ids[record.ID] = bill.ID
+
+		for _, payment := range record.Payments {
+			transactionID, found := r.ids[payment.TransactionID]
+			if !found {
+				continue
+			}
+			payment.ID = uuid.Nil
+			payment.BillID = bill.ID
+			payment.TransactionID = transactionID
+			if err := r.tx.Create(&payment).Error; err != nil {
+				return err
+			}
+		}
+		r.result.Created["bills"]++
+		return nil
+	})
+}
+
+func (r *restorer) budgets() error {
+	return readSection(r.archive, fileBudgets, func(record *models.Budget) error {
+		categoryID := r.ref(&record.CategoryID)
+		if categoryID == nil {
+			r.result.Skipped["budgets"]++
+			return nil
+		}
+
+		budget := *record
+		budget.ID = uuid.Nil
+		budget.UserID = r.userID
+		budget.CategoryID = *categoryID
+		if err := r.tx.Create(&budget).Error; err != nil {
+			return err
+		}
+		r.result.Created["budgets"]++
+		return nil
+	})
+}
+
+// envelopes restores envelope assignments, leaving out months the user
+// already assigned, and the moves between envelopes.
+func (r *restorer) envelopes() error {
+	err := readSection(r.archive, fileEnvelopeAssignments, func(record *models.EnvelopeAssignment) error {
+		categoryID := r.ref(&record.CategoryID)
+		if categoryID == nil {
+			r.result.Skipped["envelope_assignments"]++
+			return nil
+		}
+		var count int64
+		if err := r.tx.Model(&models.EnvelopeAssignment{}).
+			Where("user_id = ? AND category_id = ? AND month = ?", r.userID, *categoryID, record.Month).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			r.result.Skipped["envelope_assignments"]++
+			return nil
+		}
+
+		assignment := *record
+		assignment.ID = uuid.Nil
+		assignment.UserID = r.userID
+		assignment.CategoryID = *categoryID
+		if err := r.tx.Create(&assignment).Error; err != nil {
+			return err
+		}
+		r.result.Created["envelope_assignments"]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return readSection(r.archive, fileEnvelopeMoves, func(record *models.EnvelopeMove) error {
+		// A nil category is the "ready to assign" pool, not a lost reference.
+		from, to := r.ref(record.FromCategoryID), r.ref(record.ToCategoryID)
+		if (record.FromCategoryID != nil && from == nil) || (record.ToCategoryID != nil && to == nil) {
+			r.result.Skipped["envelope_moves"]++
+			return nil
+		}
+
+		move := *record
+		move.ID = uuid.Nil
+		move.UserID = r.userID
+		move.FromCategoryID = from
+		move.ToCategoryID = to
+		if err := r.tx.Create(&move).Error; err != nil {
+			return err
+		}
+		r.result.Created["envelope_moves"]++
+		return nil
+	})
+}
+
+// rules restores rules with their account conditions and actions pointing
+// at the restored records. Actions on records that were not restored are
+// dropped.
+func (r *restorer) rules() error {
+	return readSection(r.archive, fileRules, func(record *models.Rule) error {
+		name, existing, err := r.resolveName(&models.Rule{}, record.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			r.result.Skipped["rules"]++
+			return nil
+		}
+
+		rule := *record
+		rule.ID = uuid.Nil
+		rule.UserID = r.userID
+		rule.Name = name
+		rule.Conditions = make(models.RuleConditions, len(record.Conditions))
+		for i, condition := range record.Conditions {
+			if condition.Field == models.RuleFieldAccount {
+				if id, err := uuid.Parse(condition.Value); err == nil {
+					if mapped, found := r.ids[id]; found {
+						condition.Value = mapped.String()
+					}
+				}
+			}
+			rule.Conditions[i] = condition
+		}
+		rule.Actions = models.RuleActions{
+			CategoryID: r.ref(record.Actions.CategoryID),
+			PayeeID:    r.ref(record.Actions.PayeeID),
+		}
+		for _, tagID := range record.Actions.TagIDs {
+			if mapped, found := r.ids[tagID]; found {
+				rule.Actions.TagIDs = append(rule.Actions.TagIDs, mapped)
+			}
+		}
+		if err := r.tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		if !record.Enabled {
+			if err := r.tx.Model(&rule).Update("enabled", false).Error; err != nil {
+				return err
+			}
+		}
+		r.result.Created["rules"]++
+		return nil
+	})
+}
+
+// exchangeRates restores the user's own rates, leaving out days the user
+// already has a rate for.
+func (r *restorer) exchangeRates() error {
+	return readSection(r.archive, fileExchangeRates, func(record *models.ExchangeRate) error {
+		var count int64
+		if err := r.tx.Model(&models.ExchangeRate{}).
+			Where("user_id = ? AND base_currency = ? AND quote_currency = ? AND date = ?", r.userID, record.BaseCurrency, record.QuoteCurrency, record.Date).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			r.result.Skipped["exchange_rates"]++
+			return nil
+		}
+
+		userID := r.userID
+		rate := *record
+		rate.ID = uuid.Nil
+		rate.UserID = &userID
+		if err := r.tx.Create(&rate).Error; err != nil {
+			return err
+		}
+		r.result.Created["exchange_rates"]++
+		return nil
+	})
+}
+
+// openAccounts books, for every restored account, whatever part of its
+// archived balance the restored history does not explain.
+func (r *restorer) openAccounts() error {
+	ids := make([]uuid.UUID, len(r.openings))
+	for i, opening := range r.openings {
+		ids[i] = opening.account.ID
+	}
+	balances, err := ledger.Balances(r.tx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, opening := range r.openings {
+		difference := opening.balance.Sub(models.NewMoney(balances[opening.account.ID], opening.account.Currency))
+		if err := ledger.OpenAccount(r.tx, &opening.account, difference); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJSON(archive *zip.Reader, name string, target interface{}) (bool, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return false, nil
+	}
+	defer file.Close()
+	return true, json.NewDecoder(file).Decode(target)
+}
+
+// readSection decodes a section one record at a time. A section missing
+// from the archive is empty.
+func readSection[T any](archive *zip.Reader, name string, visit func(*T) error) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return fmt.Errorf("%s: %w", name, ErrNotBackup)
+	}
+	for decoder.More() {
+		var record T
+		if err := decoder.Decode(&record); err != nil {
+			return fmt.Errorf("%s: %v", strings.TrimSuffix(name, ".json"), err)
+		}
+		if err := visit(&record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"expense-app-backend/blobstore"
+	"expense-app-backend/ledger"
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MySQL has no INSERT ... RETURNING. Leave it out here too, or columns
+	// with a default are read back into Money without their currency.
+	db.Callback().Create().Replace("gorm:create", callbacks.Create(&callbacks.Config{CreateClauses: []string{"INSERT", "VALUES", "ON CONFLICT"}}))
+	if err := db.AutoMigrate(&models.Category{}, &models.User{}, &models.Account{}, &models.Transaction{}, &models.TransactionSplit{}, &models.Tag{}, &models.TransactionTag{}, &models.Payee{}, &models.PayeeAlias{}, &models.Rule{}, &models.ExchangeRate{}, &models.Transfer{}, &models.JournalEntry{}, &models.Posting{}, &models.Budget{}, &models.EnvelopeAssignment{}, &models.EnvelopeMove{}, &models.RecurringTransaction{}, &models.RecurringException{}, &models.Bill{}, &models.BillPayment{}, &models.ImportProfile{}, &models.ImportBatch{}, &models.Attachment{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, values ...interface{}) {
+	t.Helper()
+	for _, value := range values {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// seed gives the user a small but complete set of books: a category tree,
+// two accounts in different currencies, a tagged transaction with a payee,
+// a split transaction, a transfer, a rule and an exchange rate.
+func seed(t *testing.T, db *gorm.DB, user *models.User) {
+	t.Helper()
+	date := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+	food := &models.Category{UserID: &user.ID, Name: "Food", CategoryType: models.TransactionTypeExpense}
+	mustCreate(t, db, food)
+	coffee := &models.Category{UserID: &user.ID, ParentID: &food.ID, Name: "Coffee", CategoryType: models.TransactionTypeExpense}
+	mustCreate(t, db, coffee)
+
+	wallet := &models.Account{Name: "Wallet", UserID: user.ID, Currency: "USD"}
+	savings := &models.Account{Name: "Savings", UserID: user.ID, Currency: "EUR"}
+	tag := &models.Tag{UserID: user.ID, Name: "work"}
+	payee := &models.Payee{UserID: user.ID, Name: "Corner Cafe", NameKey: models.PayeeKey("Corner Cafe"), DefaultCategoryID: &coffee.ID}
+	mustCreate(t, db, wallet, savings, tag, payee)
+	if err := ledger.OpenAccount(db, wallet, models.NewMoney(10000, "USD")); err != nil {
+		t.Fatal(err)
+	}
+
+	latte := &models.Transaction{UserID: user.ID, AccountID: wallet.ID, CategoryID: &coffee.ID, PayeeID: &payee.ID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(450, "USD"), Date: date, Note: "Latte"}
+	groceries := &models.Transaction{UserID: user.ID, AccountID: wallet.ID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(3000, "USD"), Date: date, Note: "Groceries"}
+	mustCreate(t, db, latte, groceries)
+	mustCreate(t, db,
+		&models.TransactionTag{TransactionID: latte.ID, TagID: tag.ID},
+		&models.TransactionSplit{TransactionID: groceries.ID, CategoryID: &food.ID, Amount: models.NewMoney(2000, "USD"), Position: 0},
+		&models.TransactionSplit{TransactionID: groceries.ID, CategoryID: &coffee.ID, Amount: models.NewMoney(1000, "USD"), Position: 1},
+	)
+	for _, transaction := range []*models.Transaction{latte, groceries} {
+		if err := ledger.RecordTransaction(db, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transfer := &models.Transfer{UserID: user.ID, FromAccountID: wallet.ID, ToAccountID: savings.ID, FromAmount: models.NewMoney(2000, "USD"), ToAmount: models.NewMoney(1840, "EUR"), Date: date}
+	mustCreate(t, db, transfer)
+	if err := ledger.RecordTransfer(db, transfer); err != nil {
+		t.Fatal(err)
+	}
+
+	mustCreate(t, db,
+		&models.Rule{UserID: user.ID, Name: "Cafe", Conditions: models.RuleConditions{{Field: models.RuleFieldAccount, Operator: "equals", Value: wallet.ID.String()}}, Actions: models.RuleActions{CategoryID: &coffee.ID, PayeeID: &payee.ID, TagIDs: []uuid.UUID{tag.ID}}},
+		&models.ExchangeRate{UserID: &user.ID, BaseCurrency: "USD", QuoteCurrency: "EUR", Rate: "0.920000000000", Date: date, Source: "manual"},
+	)
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	store, err := blobstore.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &models.User{Name: "Source", Email: "source@example.com", Password: "hash"}
+	target := &models.User{Name: "Target", Email: "target@example.com", Password: "hash"}
+	mustCreate(t, db, source, target)
+	seed(t, db, source)
+
+	var archive bytes.Buffer
+	if err := Write(db, store, &archive, source.ID); err != nil {
+		t.Fatal(err)
+	}
+	reader := bytes.NewReader(archive.Bytes())
+
+	result, err := Restore(db, store, reader, reader.Size(), Options{UserID: target.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"categories": 2, "accounts": 2, "tags": 1, "payees": 1, "transfers": 1, "transactions": 2, "rules": 1, "exchange_rates": 1}
+	for section, count := range want {
+		if result.Created[section] != count {
+			t.Errorf("created %d %s, want %d", result.Created[section], section, count)
+		}
+	}
+
+	// Everything restored belongs to the target and refers to the target's
+	// records only.
+	var categories []models.Category
+	db.Where("user_id = ?", target.ID).Find(&categories)
+	categoryIDs := map[uuid.UUID]string{}
+	for _, category := range categories {
+		categoryIDs[category.ID] = category.Name
+	}
+	var coffeeID, foodID uuid.UUID
+	for _, category := range categories {
+		switch category.Name {
+		case "Coffee":
+			coffeeID = category.ID
+			if category.ParentID == nil || categoryIDs[*category.ParentID] != "Food" {
+				t.Errorf("Coffee restored under %v, want the restored Food", category.ParentID)
+			}
+		case "Food":
+			foodID = category.ID
+		}
+	}
+
+	var accounts []models.Account
+	db.Where("user_id = ?", target.ID).Order("name").Find(&accounts)
+	if len(accounts) != 2 || accounts[0].Name != "Savings" || accounts[0].Balance.Amount != 1840 || accounts[1].Name != "Wallet" || accounts[1].Balance.Amount != 10000-450-3000-2000 {
+		t.Fatalf("restored accounts = %+v, want Savings 18.40 EUR and Wallet 45.50 USD", accounts)
+	}
+	wallet := accounts[1]
+
+	var latte models.Transaction
+	if err := db.Where("user_id = ? AND note = ?", target.ID, "Latte").First(&latte).Error; err != nil {
+		t.Fatal(err)
+	}
+	if latte.AccountID != wallet.ID || latte.CategoryID == nil || *latte.CategoryID != coffeeID {
+		t.Errorf("latte restored on account %s, category %v, want %s and %s", latte.AccountID, latte.CategoryID, wallet.ID, coffeeID)
+	}
+	var payee models.Payee
+	db.Where("user_id = ?", target.ID).First(&payee)
+	if latte.PayeeID == nil || *latte.PayeeID != payee.ID || payee.DefaultCategoryID == nil || *payee.DefaultCategoryID != coffeeID {
+		t.Errorf("latte payee %v, payee default category %v, want %s and %s", latte.PayeeID, payee.DefaultCategoryID, payee.ID, coffeeID)
+	}
+	var tag models.Tag
+	db.Where("user_id = ?", target.ID).First(&tag)
+	var tagIDs []uuid.UUID
+	db.Model(&models.TransactionTag{}).Where("transaction_id = ?", latte.ID).Pluck("tag_id", &tagIDs)
+	if len(tagIDs) != 1 || tagIDs[0] != tag.ID {
+		t.Errorf("latte tags = %v, want %s", tagIDs, tag.ID)
+	}
+
+	var groceries models.Transaction
+	db.Preload("Splits").Where("user_id = ? AND note = ?", target.ID, "Groceries").First(&groceries)
+	if len(groceries.Splits) != 2 || *groceries.Splits[0].CategoryID != foodID || *groceries.Splits[1].CategoryID != coffeeID {
+		t.Errorf("groceries splits = %+v, want Food then Coffee", groceries.Splits)
+	}
+
+	var rule models.Rule
+	db.Where("user_id = ?", target.ID).First(&rule)
+	if rule.Conditions[0].Value != wallet.ID.String() || *rule.Actions.CategoryID != coffeeID || *rule.Actions.PayeeID != payee.ID || rule.Actions.TagIDs[0] != tag.ID {
+		t.Errorf("rule = %+v %+v, want it pointing at the restored records", rule.Conditions, rule.Actions)
+	}
+
+	var rates int64
+	db.Model(&models.ExchangeRate{}).Where("user_id = ? AND rate = ?", target.ID, "0.920000000000").Count(&rates)
+	if rates != 1 {
+		t.Errorf("restored %d exchange rates, want 1", rates)
+	}
+
+	report, err := ledger.Check(db, &target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent() {
+		t.Errorf("restored journal is not consistent: %+v", report)
+	}
+
+	// A second restore into the same user clashes on every account and rule.
+	var conflict *ConflictError
+	if _, err := Restore(db, store, reader, reader.Size(), Options{UserID: target.ID}); !errors.As(err, &conflict) || len(conflict.Conflicts) != 3 {
+		t.Errorf("second restore error = %v, want 3 conflicts", err)
+	}
+
+	// Skipping the conflicts restores nothing twice.
+	result, err = Restore(db, store, reader, reader.Size(), Options{UserID: target.ID, Strategy: StrategySkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Created["transactions"] != 0 || result.Skipped["transactions"] != 2 || result.Skipped["accounts"] != 2 || result.Skipped["exchange_rates"] != 1 {
+		t.Errorf("skip restore created %v, skipped %v", result.Created, result.Skipped)
+	}
+	var transactions int64
+	db.Model(&models.Transaction{}).Where("user_id = ?", target.ID).Count(&transactions)
+	if transactions != 2 {
+		t.Errorf("target has %d transactions after restoring twice, want 2", transactions)
+	}
+}
@@ -0,0 +1,56 @@
+// Package blobstore keeps uploaded files, such as receipt photos, outside the
+// database. The backend is chosen with BLOB_STORE: "local" (the default)
+// writes to a directory, "s3" to an S3-compatible bucket.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque blobs under slash-separated keys. Putting a key
+// that exists replaces it.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv builds the store configured by the environment:
+//
+//	BLOB_STORE=local  BLOB_DIR (data/blobs)
+//	BLOB_STORE=s3     S3_ENDPOINT, S3_REGION (us-east-1), S3_BUCKET,
+//	                  S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY,
+//	                  S3_PATH_STYLE ("true" for MinIO and most self-hosted servers)
+func FromEnv() (BlobStore, error) {
+	switch strings.ToLower(os.Getenv("BLOB_STORE")) {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return NewLocal(dir)
+	case "s3":
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          region,
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("blobstore: unknown BLOB_STORE %q", os.Getenv("BLOB_STORE"))
+	}
+}
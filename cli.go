@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"expense-app-backend/backup"
+	"expense-app-backend/models"
+)
+
+// runCommand runs a maintenance command instead of starting the server:
+//
+//	backup -email user@example.com [-out backup.zip]
+//	restore -in backup.zip [-email user@example.com] [-strategy fail|skip|rename]
+//
+// restore without -email restores into the user with the archived email,
+// creating them when this instance has no such user.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "backup":
+		return backupCommand(args[1:])
+	case "restore":
+		return restoreCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, expected backup or restore", args[0])
+	}
+}
+
+func backupCommand(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	email := flags.String("email", "", "email of the user to back up")
+	out := flags.String("out", "backup-"+time.Now().Format("2006-01-02")+".zip", "archive to write")
+	flags.Parse(args)
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	var user models.User
+	if err := db.Where("email = ?", *email).First(&user).Error; err != nil {
+		return fmt.Errorf("user %s: %v", *email, err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := backup.Write(db, store, file, user.ID); err != nil {
+		file.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Backup of %s written to %s\n", *email, *out)
+	return nil
+}
+
+func restoreCommand(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := flags.String("in", "", "archive to restore")
+	email := flags.String("email", "", "email of an existing user to restore into")
+	strategy := flags.String("strategy", backup.StrategyFail, "what to do with names already taken: fail, skip or rename")
+	flags.Parse(args)
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	options := backup.Options{Strategy: *strategy}
+	if *email != "" {
+		var user models.User
+		if err := db.Where("email = ?", *email).First(&user).Error; err != nil {
+			return fmt.Errorf("user %s: %v", *email, err)
+		}
+		options.UserID = user.ID
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	result, err := backup.Restore(db, store, file, info.Size(), options)
+	var conflict *backup.ConflictError
+	if errors.As(err, &conflict) {
+		for _, name := range conflict.Conflicts {
+			fmt.Fprintf(os.Stderr, "conflict: %s\n", name)
+		}
+		return fmt.Errorf("%v; use -strategy skip or rename", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored into user %s\n", result.UserID)
+	for _, counts := range []struct {
+		label  string
+		counts map[string]int
+	}{{"created", result.Created}, {"matched", result.Matched}, {"skipped", result.Skipped}} {
+		for section, count := range counts.counts {
+			fmt.Printf("  %s %s: %d\n", counts.label, section, count)
+		}
+	}
+	return nil
+}
@@ -1 +1,386 @@
 package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/exchange"
+	"expense-app-backend/ledger"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type accountResponse struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Currency  string       `json:"currency"`
+	Balance   models.Money `json:"balance"`
+	CreatedAt string       `json:"created_at"`
+	UpdatedAt string       `json:"updated_at"`
+}
+
+func newAccountResponse(account models.Account) accountResponse {
+	return accountResponse{
+		ID:        account.ID.String(),
+		Name:      account.Name,
+		Currency:  account.Currency,
+		Balance:   account.Balance,
+		CreatedAt: account.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: account.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// findOwnedAccount resolves the {id} route variable to one of the caller's
+// accounts, writing a 404 response when there is none.
+func findOwnedAccount(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Account, bool) {
+	var account models.Account
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&account).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Account not found",
+		})
+		return nil, false
+	}
+	return &account, true
+}
+
+// deriveBalances replaces the cached balances with the ones derived from the
+// journal, which is the source of truth.
+func deriveBalances(db *gorm.DB, accounts []models.Account) error {
+	ids := make([]uuid.UUID, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
+	}
+
+	balances, err := ledger.Balances(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range accounts {
+		accounts[i].Balance = models.NewMoney(balances[accounts[i].ID], accounts[i].Currency)
+	}
+	return nil
+}
+
+func GetAccounts(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var accounts []models.Account
+		if err := db.Where("user_id = ?", middleware.CurrentUserID(r)).Order("name").Find(&accounts).Error; err != nil {
+			http.Error(w, "Failed to retrieve accounts", http.StatusInternalServerError)
+			return
+		}
+
+		if err := deriveBalances(db, accounts); err != nil {
+			http.Error(w, "Failed to retrieve accounts", http.StatusInternalServerError)
+			return
+		}
+
+		response := []accountResponse{}
+		for _, account := range accounts {
+			response = append(response, newAccountResponse(account))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int               `json:"status_code"`
+			Data       []accountResponse `json:"data"`
+			Message    string            `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Accounts successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+// GetAccountTotal adds up the caller's balances in their base currency, or
+// in ?currency, using the rates of ?date (today by default).
+func GetAccountTotal(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		params := r.URL.Query()
+
+		currency := user.Currency()
+		if value := params.Get("currency"); value != "" {
+			currency = models.NormalizeCurrency(value)
+		}
+		if !models.IsValidCurrency(currency) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Currency must be an ISO-4217 code",
+			})
+			return
+		}
+
+		date := time.Now()
+		if value := params.Get("date"); value != "" {
+			parsed, err := parseDate(value)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid date",
+				})
+				return
+			}
+			date = parsed
+		}
+
+		var accounts []models.Account
+		if err := db.Where("user_id = ?", user.ID).Find(&accounts).Error; err != nil {
+			http.Error(w, "Failed to retrieve accounts", http.StatusInternalServerError)
+			return
+		}
+		if err := deriveBalances(db, accounts); err != nil {
+			http.Error(w, "Failed to retrieve accounts", http.StatusInternalServerError)
+			return
+		}
+
+		converter := exchange.NewConverter(db, user.ID)
+		total := models.NewMoney(0, currency)
+		byCurrency := map[string]models.Money{}
+		missing := []string{}
+		for _, account := range accounts {
+			subtotal, found := byCurrency[account.Currency]
+			if !found {
+				subtotal = models.NewMoney(0, account.Currency)
+			}
+			byCurrency[account.Currency] = subtotal.Add(account.Balance)
+		}
+		for accountCurrency, subtotal := range byCurrency {
+			converted, err := converter.Convert(subtotal, currency, date)
+			if err != nil {
+				missing = append(missing, accountCurrency)
+				continue
+			}
+			total = total.Add(converted)
+		}
+		sort.Strings(missing)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Account total successfully retrieved",
+			"data": map[string]interface{}{
+				"total":             total,
+				"date":              date.Format(dateLayout),
+				"by_currency":       byCurrency,
+				"missing_rates_for": missing,
+			},
+		})
+	}
+}
+
+func GetAccountById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, ok := findOwnedAccount(db, w, r)
+		if !ok {
+			return
+		}
+
+		accounts := []models.Account{*account}
+		if err := deriveBalances(db, accounts); err != nil {
+			http.Error(w, "Failed to retrieve account", http.StatusInternalServerError)
+			return
+		}
+		account = &accounts[0]
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Account successfully retrieved",
+			"data":        newAccountResponse(*account),
+		})
+	}
+}
+
+func CreateAccount(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var accountRequest struct {
+			Name     string      `json:"name"`
+			Currency string      `json:"currency"`
+			Balance  json.Number `json:"balance"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&accountRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		if accountRequest.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Name is required",
+			})
+			return
+		}
+
+		currency := models.NormalizeCurrency(accountRequest.Currency)
+		if currency == "" {
+			currency = middleware.CurrentUser(r).Currency()
+		}
+		if !models.IsValidCurrency(currency) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Currency must be an ISO-4217 code",
+			})
+			return
+		}
+
+		balance := models.NewMoney(0, currency)
+		if accountRequest.Balance != "" {
+			parsed, err := models.ParseMoney(accountRequest.Balance.String(), balance.Currency)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid balance",
+				})
+				return
+			}
+			balance = parsed
+		}
+
+		// The balance starts at zero and the opening balance is booked in the
+		// journal, which moves the cached balance along with it.
+		account := models.Account{
+			Name:     accountRequest.Name,
+			UserID:   middleware.CurrentUserID(r),
+			Currency: currency,
+			Balance:  models.NewMoney(0, currency),
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&account).Error; err != nil {
+				return err
+			}
+			return ledger.OpenAccount(tx, &account, balance)
+		})
+		account.Balance = balance
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create account",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Account created successfully",
+			"data":        newAccountResponse(account),
+		})
+	}
+}
+
+func UpdateAccount(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var accountRequest struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&accountRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		if accountRequest.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Name is required",
+			})
+			return
+		}
+
+		account, ok := findOwnedAccount(db, w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.Model(account).Update("name", accountRequest.Name).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update account",
+			})
+			return
+		}
+
+		accounts := []models.Account{*account}
+		if err := deriveBalances(db, accounts); err == nil {
+			account = &accounts[0]
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Account updated successfully",
+			"data":        newAccountResponse(*account),
+		})
+	}
+}
+
+func DeleteAccount(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, ok := findOwnedAccount(db, w, r)
+		if !ok {
+			return
+		}
+
+		var transactionCount int64
+		db.Model(&models.Transaction{}).Where("account_id = ?", account.ID).Count(&transactionCount)
+		if transactionCount > 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "Account still has transactions",
+			})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := ledger.Remove(tx, models.JournalSourceOpening, account.ID); err != nil {
+				return err
+			}
+			return tx.Delete(account).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete account",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Account deleted successfully",
+		})
+	}
+}
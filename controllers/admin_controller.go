@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type adminUserResponse struct {
+	ID                string  `json:"id"`
+	Name              string  `json:"name"`
+	Email             string  `json:"email"`
+	Role              string  `json:"role"`
+	Disabled          bool    `json:"disabled"`
+	MustResetPassword bool    `json:"must_reset_password"`
+	DeleteAfter       *string `json:"delete_after"`
+	CreatedAt         string  `json:"created_at"`
+	UpdatedAt         string  `json:"updated_at"`
+}
+
+func newAdminUserResponse(user models.User) adminUserResponse {
+	var deleteAfter *string
+	if user.DeleteAfter != nil {
+		value := user.DeleteAfter.Format(time.RFC3339)
+		deleteAfter = &value
+	}
+	return adminUserResponse{
+		ID:                user.ID.String(),
+		Name:              user.Name,
+		Email:             user.Email,
+		Role:              user.Role,
+		Disabled:          user.Disabled,
+		MustResetPassword: user.MustResetPassword,
+		DeleteAfter:       deleteAfter,
+		CreatedAt:         user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         user.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func ListUsers(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		search := r.URL.Query().Get("search")
+		role := r.URL.Query().Get("role")
+		disabled := r.URL.Query().Get("disabled")
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		query := db.Model(&models.User{}).Where("deleted_at IS NULL")
+		if search != "" {
+			like := "%" + search + "%"
+			query = query.Where("name LIKE ? OR email LIKE ?", like, like)
+		}
+		if role != "" {
+			query = query.Where("role = ?", role)
+		}
+		if disabled != "" {
+			isDisabled, err := strconv.ParseBool(disabled)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid disabled filter",
+				})
+				return
+			}
+			query = query.Where("disabled = ?", isDisabled)
+		}
+
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+			return
+		}
+
+		var users []models.User
+		if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&users).Error; err != nil {
+			http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+			return
+		}
+
+		response := []adminUserResponse{}
+		for _, user := range users {
+			response = append(response, newAdminUserResponse(user))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                 `json:"status_code"`
+			Data       []adminUserResponse `json:"data"`
+			Message    string              `json:"message"`
+			Count      int64               `json:"count"`
+			Page       int                 `json:"page"`
+			Limit      int                 `json:"limit"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Users successfully retrieved",
+			Count:      count,
+			Page:       page,
+			Limit:      limit,
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func DisableUser(db *gorm.DB) http.HandlerFunc {
+	return setUserDisabled(db, true, "User disabled successfully")
+}
+
+func EnableUser(db *gorm.DB) http.HandlerFunc {
+	return setUserDisabled(db, false, "User enabled successfully")
+}
+
+func setUserDisabled(db *gorm.DB, disabled bool, message string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		if disabled && id == middleware.CurrentUserID(r).String() {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "You cannot disable your own account",
+			})
+			return
+		}
+
+		var user models.User
+		if err := db.Where("id = ? AND deleted_at IS NULL", id).First(&user).Error; err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "User not found",
+			})
+			return
+		}
+
+		if err := db.Model(&user).Update("disabled", disabled).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update user",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     message,
+			"data":        newAdminUserResponse(user),
+		})
+	}
+}
+
+func UpdateUserRole(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		var roleRequest struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		if !models.IsValidRole(roleRequest.Role) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Role must be user or admin",
+			})
+			return
+		}
+
+		if roleRequest.Role != models.RoleAdmin && id == middleware.CurrentUserID(r).String() {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "You cannot remove your own admin role",
+			})
+			return
+		}
+
+		var user models.User
+		if err := db.Where("id = ? AND deleted_at IS NULL", id).First(&user).Error; err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "User not found",
+			})
+			return
+		}
+
+		if err := db.Model(&user).Update("role", roleRequest.Role).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update user",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "User role updated successfully",
+			"data":        newAdminUserResponse(user),
+		})
+	}
+}
+
+// ForcePasswordReset replaces the user's password with a one-time temporary
+// password and flags the account so every protected route except the
+// password change endpoint is refused until the user picks a new one.
+func ForcePasswordReset(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		var user models.User
+		if err := db.Where("id = ? AND deleted_at IS NULL", id).First(&user).Error; err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "User not found",
+			})
+			return
+		}
+
+		temporaryPassword, err := generateTemporaryPassword()
+		if err != nil {
+			http.Error(w, "Failed to generate password", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := user.HashPassword(temporaryPassword); err != nil {
+			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"password":            user.Password,
+			"must_reset_password": true,
+		}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to reset password",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Password reset successfully",
+			"data": map[string]interface{}{
+				"id":                 user.ID.String(),
+				"temporary_password": temporaryPassword,
+			},
+		})
+	}
+}
+
+func generateTemporaryPassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-app-backend/attachments"
+	"expense-app-backend/blobstore"
+	"expense-app-backend/models"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type attachmentResponse struct {
+	models.Attachment
+	URL          string  `json:"url"`
+	ThumbnailURL *string `json:"thumbnail_url"`
+}
+
+// newAttachmentResponse adds signed download links, which expire, so they
+// are made fresh on every response.
+func newAttachmentResponse(attachment models.Attachment, now time.Time) attachmentResponse {
+	response := attachmentResponse{
+		Attachment: attachment,
+		URL:        attachments.SignedURL(attachment.ID, attachments.VariantOriginal, now),
+	}
+	if attachment.HasThumbnail {
+		thumbnailURL := attachments.SignedURL(attachment.ID, attachments.VariantThumbnail, now)
+		response.ThumbnailURL = &thumbnailURL
+	}
+	return response
+}
+
+func GetTransactionAttachments(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transaction, ok := findOwnedTransaction(db, w, r)
+		if !ok {
+			return
+		}
+
+		var found []models.Attachment
+		if err := db.Where("transaction_id = ?", transaction.ID).Order("created_at").Find(&found).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to fetch attachments",
+			})
+			return
+		}
+
+		now := time.Now()
+		data := make([]attachmentResponse, len(found))
+		for i, attachment := range found {
+			data[i] = newAttachmentResponse(attachment, now)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Attachments fetched successfully",
+			"data":        data,
+		})
+	}
+}
+
+// AddTransactionAttachment stores a receipt uploaded as multipart "file".
+// The type is sniffed from the content: JPEG, PNG, GIF, WebP and PDF are
+// accepted, up to ATTACHMENT_MAX_BYTES.
+func AddTransactionAttachment(db *gorm.DB, store blobstore.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Leave room for the multipart framing around the file.
+		r.Body = http.MaxBytesReader(w, r.Body, attachments.MaxSize()+1<<20)
+		defer r.Body.Close()
+
+		fail := func(statusCode int, message string) {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+		}
+
+		transaction, ok := findOwnedTransaction(db, w, r)
+		if !ok {
+			return
+		}
+
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				fail(http.StatusRequestEntityTooLarge, "File is too large")
+				return
+			}
+			fail(http.StatusBadRequest, "Invalid upload")
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			fail(http.StatusBadRequest, "File is required")
+			return
+		}
+		defer file.Close()
+
+		attachment, err := attachments.Save(r.Context(), db, store, transaction.UserID, transaction.ID, header.Filename, file)
+		switch {
+		case errors.Is(err, attachments.ErrEmpty):
+			fail(http.StatusBadRequest, "File is empty")
+			return
+		case errors.Is(err, attachments.ErrTooLarge):
+			fail(http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		case errors.Is(err, attachments.ErrUnsupportedType):
+			fail(http.StatusUnsupportedMediaType, "File must be a JPEG, PNG, GIF or WebP image or a PDF")
+			return
+		case err != nil:
+			log.Printf("attachments: saving for transaction %s: %v", transaction.ID, err)
+			fail(http.StatusInternalServerError, "Failed to save attachment")
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Attachment added successfully",
+			"data":        newAttachmentResponse(*attachment, time.Now()),
+		})
+	}
+}
+
+func DeleteTransactionAttachment(db *gorm.DB, store blobstore.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transaction, ok := findOwnedTransaction(db, w, r)
+		if !ok {
+			return
+		}
+
+		var attachment models.Attachment
+		if err := db.Where("id = ? AND transaction_id = ?", mux.Vars(r)["attachmentId"], transaction.ID).First(&attachment).Error; err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Attachment not found",
+			})
+			return
+		}
+
+		if err := db.Delete(&attachment).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete attachment",
+			})
+			return
+		}
+		// The row is gone either way; a blob left behind is only wasted
+		// space.
+		if err := attachments.Release(r.Context(), db, store, attachment.SHA256); err != nil {
+			log.Printf("attachments: releasing %s: %v", attachment.SHA256, err)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Attachment deleted successfully",
+		})
+	}
+}
+
+// DownloadAttachment serves an attachment, or its thumbnail, to whoever
+// holds a link signed by SignedURL. It sits outside the authenticated routes
+// so links work in <img> tags; the signature is the authorisation.
+func DownloadAttachment(db *gorm.DB, store blobstore.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fail := func(statusCode int, message string) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+		}
+
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			fail(http.StatusNotFound, "Attachment not found")
+			return
+		}
+		variant, ok := attachments.VerifySignedURL(id, r.URL.Query(), time.Now())
+		if !ok {
+			fail(http.StatusForbidden, "Download link is invalid or has expired")
+			return
+		}
+
+		var attachment models.Attachment
+		if err := db.Where("id = ?", id).First(&attachment).Error; err != nil {
+			fail(http.StatusNotFound, "Attachment not found")
+			return
+		}
+
+		body, contentType, err := attachments.Open(r.Context(), store, &attachment, variant == attachments.VariantThumbnail)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			fail(http.StatusNotFound, "Attachment not found")
+			return
+		}
+		if err != nil {
+			log.Printf("attachments: opening %s: %v", attachment.ID, err)
+			fail(http.StatusInternalServerError, "Failed to read attachment")
+			return
+		}
+		defer body.Close()
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(attachments.URLTTL().Seconds())))
+		if variant == attachments.VariantOriginal {
+			w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename}))
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			log.Printf("attachments: sending %s: %v", attachment.ID, err)
+		}
+	}
+}
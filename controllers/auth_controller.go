@@ -2,7 +2,9 @@ package controllers
 
 import (
 	"encoding/json"
+	"expense-app-backend/middleware"
 	"expense-app-backend/models"
+	"expense-app-backend/templates"
 	"expense-app-backend/utils"
 	"net/http"
 
@@ -27,13 +29,38 @@ func Register(db *gorm.DB) http.HandlerFunc {
 		}
 		defer r.Body.Close()
 
+		user.Role = models.RoleUser
+		user.Disabled = false
+		user.MustResetPassword = false
+		user.BaseCurrency = models.NormalizeCurrency(user.BaseCurrency)
+		if !models.IsValidCurrency(user.BaseCurrency) {
+			user.BaseCurrency = ""
+		}
+
 		_, err := user.HashPassword(user.Password)
 		if err != nil {
 			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 			return
 		}
 
-		if err := db.Create(&user).Error; err != nil {
+		template, err := templates.LoadCategoryTemplate(user.Locale)
+		if err != nil {
+			template, err = templates.LoadCategoryTemplate(templates.DefaultLocale)
+			if err != nil {
+				http.Error(w, "Failed to load category template", http.StatusInternalServerError)
+				return
+			}
+		}
+		user.Locale = template.Locale
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			_, err := applyCategoryTemplate(tx, user.ID, template, false)
+			return err
+		})
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 
 			errorResponse := struct {
@@ -55,6 +82,7 @@ func Register(db *gorm.DB) http.HandlerFunc {
 			ID        string `json:"id"`
 			Name      string `json:"name"`
 			Email     string `json:"email"`
+			Locale    string `json:"locale"`
 			CreatedAt string `json:"created_at"`
 			UpdatedAt string `json:"updated_at"`
 		}
@@ -70,6 +98,7 @@ func Register(db *gorm.DB) http.HandlerFunc {
 				ID:        user.ID.String(),
 				Name:      user.Name,
 				Email:     user.Email,
+				Locale:    user.Locale,
 				CreatedAt: user.CreatedAt.Format("2006-01-02 15:04:05"),
 				UpdatedAt: user.UpdatedAt.Format("2006-01-02 15:04:05"),
 			},
@@ -124,7 +153,37 @@ func Login(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		token, err := utils.GenerateJWT(user.ID, user.Email)
+		if user.Disabled {
+			w.WriteHeader(http.StatusForbidden)
+			errorResponse := struct {
+				StatusCode int    `json:"status_code"`
+				Message    string `json:"message"`
+			}{
+				StatusCode: http.StatusForbidden,
+				Message:    "Account is disabled",
+			}
+			json.NewEncoder(w).Encode(errorResponse)
+			return
+		}
+
+		// Logging in during the grace period cancels a requested deletion.
+		deletionCancelled := user.PendingDeletion()
+		if deletionCancelled {
+			if err := db.Model(&user).Update("delete_after", nil).Error; err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				errorResponse := struct {
+					StatusCode int    `json:"status_code"`
+					Message    string `json:"message"`
+				}{
+					StatusCode: http.StatusInternalServerError,
+					Message:    "Failed to cancel account deletion",
+				}
+				json.NewEncoder(w).Encode(errorResponse)
+				return
+			}
+		}
+
+		token, err := utils.GenerateJWT(user.ID, user.Email, user.Role)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			errorResponse := struct {
@@ -140,14 +199,79 @@ func Login(db *gorm.DB) http.HandlerFunc {
 
 		w.WriteHeader(http.StatusOK)
 		response := struct {
-			StatusCode int    `json:"status_code"`
-			Message    string `json:"message"`
-			Token      string `json:"token"`
+			StatusCode        int    `json:"status_code"`
+			Message           string `json:"message"`
+			Token             string `json:"token"`
+			MustResetPassword bool   `json:"must_reset_password"`
+			DeletionCancelled bool   `json:"deletion_cancelled,omitempty"`
 		}{
-			StatusCode: http.StatusOK,
-			Message:    "Login successful",
-			Token:      token,
+			StatusCode:        http.StatusOK,
+			Message:           "Login successful",
+			Token:             token,
+			MustResetPassword: user.MustResetPassword,
+			DeletionCancelled: deletionCancelled,
 		}
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+func ChangePassword(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var passwordRequest struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&passwordRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		if len(passwordRequest.NewPassword) < 8 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "New password must be at least 8 characters",
+			})
+			return
+		}
+
+		user := middleware.CurrentUser(r)
+		if err := user.CheckPassword(passwordRequest.CurrentPassword); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusUnauthorized,
+				"message":     "Invalid password",
+			})
+			return
+		}
+
+		if _, err := user.HashPassword(passwordRequest.NewPassword); err != nil {
+			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"password":            user.Password,
+			"must_reset_password": false,
+		}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update password",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Password updated successfully",
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-app-backend/backup"
+	"expense-app-backend/blobstore"
+	"expense-app-backend/middleware"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxBackupFileSize = 512 << 20
+
+// DownloadBackup streams a ZIP archive of everything the user owns,
+// attachments included, which RestoreBackup reads back on this or another
+// instance.
+func DownloadBackup(db *gorm.DB, store blobstore.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="backup-`+time.Now().Format(dateLayout)+`.zip"`)
+		if err := backup.Write(db, store, w, middleware.CurrentUserID(r)); err != nil {
+			log.Printf("backup: %v", err)
+		}
+	}
+}
+
+// RestoreBackup restores an archive uploaded as "file" into the current
+// user. "strategy" is fail, skip or rename and decides what happens to
+// archived accounts, rules and import profiles whose name is taken.
+func RestoreBackup(db *gorm.DB, store blobstore.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBackupFileSize)
+		defer r.Body.Close()
+
+		fail := func(statusCode int, message string) {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+		}
+
+		// Parts beyond the first 32MB are spooled to disk.
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			fail(http.StatusBadRequest, "Invalid upload")
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			fail(http.StatusBadRequest, "File is required")
+			return
+		}
+		defer file.Close()
+
+		strategy := r.FormValue("strategy")
+		if strategy != "" && !backup.IsValidStrategy(strategy) {
+			fail(http.StatusBadRequest, "Strategy must be fail, skip or rename")
+			return
+		}
+
+		result, err := backup.Restore(db, store, file, header.Size, backup.Options{UserID: middleware.CurrentUserID(r), Strategy: strategy})
+		var conflict *backup.ConflictError
+		switch {
+		case errors.As(err, &conflict):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "Some archived records conflict with existing ones",
+				"conflicts":   conflict.Conflicts,
+			})
+			return
+		case errors.Is(err, backup.ErrNotBackup):
+			fail(http.StatusBadRequest, "File is not a backup archive")
+			return
+		case errors.Is(err, backup.ErrUnsupportedVersion):
+			fail(http.StatusBadRequest, "Backup archive was made by a newer version")
+			return
+		case err != nil:
+			log.Printf("restore: %v", err)
+			fail(http.StatusInternalServerError, "Failed to restore backup")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Backup restored successfully",
+			"data":        result,
+		})
+	}
+}
@@ -0,0 +1,543 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/ledger"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/recurrence"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type billRequest struct {
+	AccountID  uuid.UUID   `json:"account_id"`
+	CategoryID *uuid.UUID  `json:"category_id"`
+	Name       string      `json:"name"`
+	Amount     json.Number `json:"amount"`
+	DueDate    string      `json:"due_date"`
+	RemindDays *int        `json:"remind_days"`
+	Note       string      `json:"note"`
+
+	// A bill repeats when either an RRULE or a frequency is given, see
+	// recurringRequest.
+	RRule     string `json:"rrule"`
+	Frequency string `json:"frequency"`
+	Interval  int    `json:"interval"`
+}
+
+type billResponse struct {
+	ID           string       `json:"id"`
+	AccountID    string       `json:"account_id"`
+	CategoryID   *uuid.UUID   `json:"category_id"`
+	Name         string       `json:"name"`
+	Amount       models.Money `json:"amount"`
+	DueDate      string       `json:"due_date"`
+	RRule        string       `json:"rrule"`
+	RemindDays   int          `json:"remind_days"`
+	Status       string       `json:"status"`
+	DaysUntilDue int          `json:"days_until_due"`
+	Note         string       `json:"note"`
+	CreatedAt    string       `json:"created_at"`
+	UpdatedAt    string       `json:"updated_at"`
+}
+
+func newBillResponse(bill models.Bill, today time.Time) billResponse {
+	due := time.Date(bill.DueDate.Year(), bill.DueDate.Month(), bill.DueDate.Day(), 0, 0, 0, 0, today.Location())
+	return billResponse{
+		ID:           bill.ID.String(),
+		AccountID:    bill.AccountID.String(),
+		CategoryID:   bill.CategoryID,
+		Name:         bill.Name,
+		Amount:       bill.Amount,
+		DueDate:      bill.DueDate.Format(dateLayout),
+		RRule:        bill.RRule,
+		RemindDays:   bill.RemindDays,
+		Status:       bill.Status(today),
+		DaysUntilDue: int(due.Sub(today).Hours() / 24),
+		Note:         bill.Note,
+		CreatedAt:    bill.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    bill.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func startOfToday() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// toBill validates the request against the user's accounts and expense
+// categories. On failure it returns the status code and message to send back.
+func (in *billRequest) toBill(db *gorm.DB, userID uuid.UUID) (*models.Bill, int, string) {
+	if in.Name == "" {
+		return nil, http.StatusBadRequest, "Name is required"
+	}
+
+	var account models.Account
+	if err := db.Where("id = ? AND user_id = ?", in.AccountID, userID).First(&account).Error; err != nil {
+		return nil, http.StatusNotFound, "Account not found"
+	}
+
+	amount, err := models.ParseMoney(in.Amount.String(), account.Currency)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid amount"
+	}
+	if !amount.IsPositive() {
+		return nil, http.StatusBadRequest, "Amount must be greater than zero"
+	}
+
+	if in.DueDate == "" {
+		return nil, http.StatusBadRequest, "Due date is required"
+	}
+	dueDate, err := parseDate(in.DueDate)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid due date"
+	}
+
+	if in.CategoryID != nil {
+		var category models.Category
+		if err := visibleCategories(db, userID).Where("id = ?", *in.CategoryID).First(&category).Error; err != nil {
+			return nil, http.StatusNotFound, "Category not found"
+		}
+		if category.CategoryType != models.TransactionTypeExpense {
+			return nil, http.StatusBadRequest, "Category must be an expense category"
+		}
+	}
+
+	remindDays := models.DefaultBillReminderDays
+	if in.RemindDays != nil {
+		if *in.RemindDays < 0 {
+			return nil, http.StatusBadRequest, "Reminder days cannot be negative"
+		}
+		remindDays = *in.RemindDays
+	}
+
+	rrule := ""
+	if in.RRule != "" || in.Frequency != "" {
+		schedule := recurringRequest{RRule: in.RRule, Frequency: in.Frequency, Interval: in.Interval}
+		rule, err := schedule.rule()
+		if err != nil {
+			return nil, http.StatusBadRequest, "Invalid recurrence: " + err.Error()
+		}
+		rrule = rule.String()
+	}
+
+	return &models.Bill{
+		UserID:     userID,
+		AccountID:  account.ID,
+		CategoryID: in.CategoryID,
+		Name:       in.Name,
+		Amount:     amount,
+		DueDate:    time.Date(dueDate.Year(), dueDate.Month(), dueDate.Day(), 0, 0, 0, 0, dueDate.Location()),
+		RRule:      rrule,
+		RemindDays: remindDays,
+		Note:       in.Note,
+	}, 0, ""
+}
+
+// nextDueDate returns the occurrence of a repeating bill after its current
+// due date, or false when the bill does not repeat or its rule has ended. The
+// rule is expanded from the bill's start date so COUNT and INTERVAL hold
+// across payments.
+func nextDueDate(bill *models.Bill) (time.Time, bool) {
+	if bill.RRule == "" {
+		return time.Time{}, false
+	}
+	rule, err := recurrence.Parse(bill.RRule)
+	if err != nil {
+		return time.Time{}, false
+	}
+	next := rule.Between(bill.StartDate, bill.DueDate.AddDate(0, 0, 1), time.Time{}, 1)
+	if len(next) == 0 {
+		return time.Time{}, false
+	}
+	return next[0], true
+}
+
+func findOwnedBill(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Bill, bool) {
+	var bill models.Bill
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&bill).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Bill not found",
+		})
+		return nil, false
+	}
+	return &bill, true
+}
+
+// writeBills sends a list of bills in the usual list envelope.
+func writeBills(w http.ResponseWriter, bills []models.Bill, message string) {
+	now := startOfToday()
+	response := []billResponse{}
+	for _, bill := range bills {
+		response = append(response, newBillResponse(bill, now))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	responseJson := struct {
+		StatusCode int            `json:"status_code"`
+		Data       []billResponse `json:"data"`
+		Message    string         `json:"message"`
+	}{
+		StatusCode: http.StatusOK,
+		Data:       response,
+		Message:    message,
+	}
+
+	json.NewEncoder(w).Encode(responseJson)
+}
+
+// GetBills lists the user's bills, optionally only those with ?status=paid,
+// unpaid or overdue.
+func GetBills(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := db.Where("user_id = ?", middleware.CurrentUserID(r))
+		now := startOfToday().Format(dateLayout)
+		switch r.URL.Query().Get("status") {
+		case "":
+		case models.BillStatusPaid:
+			query = query.Where("paid = ?", true)
+		case models.BillStatusUnpaid:
+			query = query.Where("paid = ? AND due_date >= ?", false, now)
+		case models.BillStatusOverdue:
+			query = query.Where("paid = ? AND due_date < ?", false, now)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Status must be paid, unpaid or overdue",
+			})
+			return
+		}
+
+		var bills []models.Bill
+		if err := query.Order("due_date, name").Find(&bills).Error; err != nil {
+			http.Error(w, "Failed to retrieve bills", http.StatusInternalServerError)
+			return
+		}
+		writeBills(w, bills, "Bills successfully retrieved")
+	}
+}
+
+// GetUpcomingBills lists unpaid bills due within the next ?days (30 by
+// default), today included.
+func GetUpcomingBills(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days, err := strconv.Atoi(r.URL.Query().Get("days"))
+		if err != nil || days < 0 || days > 366 {
+			days = 30
+		}
+
+		now := startOfToday()
+		var bills []models.Bill
+		if err := db.Where("user_id = ? AND paid = ? AND due_date >= ? AND due_date <= ?", middleware.CurrentUserID(r), false, now.Format(dateLayout), now.AddDate(0, 0, days).Format(dateLayout)).
+			Order("due_date, name").Find(&bills).Error; err != nil {
+			http.Error(w, "Failed to retrieve bills", http.StatusInternalServerError)
+			return
+		}
+		writeBills(w, bills, "Upcoming bills successfully retrieved")
+	}
+}
+
+func GetOverdueBills(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var bills []models.Bill
+		if err := db.Where("user_id = ? AND paid = ? AND due_date < ?", middleware.CurrentUserID(r), false, startOfToday().Format(dateLayout)).
+			Order("due_date, name").Find(&bills).Error; err != nil {
+			http.Error(w, "Failed to retrieve bills", http.StatusInternalServerError)
+			return
+		}
+		writeBills(w, bills, "Overdue bills successfully retrieved")
+	}
+}
+
+func GetBillById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bill, ok := findOwnedBill(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Bill successfully retrieved",
+			"data":        newBillResponse(*bill, startOfToday()),
+		})
+	}
+}
+
+func CreateBill(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request billRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		bill, statusCode, message := request.toBill(db, middleware.CurrentUserID(r))
+		if bill == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		if err := db.Create(bill).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create bill",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Bill created successfully",
+			"data":        newBillResponse(*bill, startOfToday()),
+		})
+	}
+}
+
+// UpdateBill replaces the bill's details. Moving the due date re-arms the
+// reminder for the new date, and moving it or changing the rule starts the
+// schedule again from the new due date.
+func UpdateBill(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request billRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedBill(db, w, r)
+		if !ok {
+			return
+		}
+
+		updated, statusCode, message := request.toBill(db, middleware.CurrentUserID(r))
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		changes := map[string]interface{}{
+			"account_id":   updated.AccountID,
+			"category_id":  updated.CategoryID,
+			"name":         updated.Name,
+			"amount_minor": updated.Amount,
+			"currency":     updated.Amount.Currency,
+			"due_date":     updated.DueDate,
+			"rrule":        updated.RRule,
+			"remind_days":  updated.RemindDays,
+			"note":         updated.Note,
+		}
+		if updated.DueDate.Format(dateLayout) != existing.DueDate.Format(dateLayout) || updated.RRule != existing.RRule {
+			changes["start_date"] = updated.DueDate
+		}
+		if err := db.Model(existing).Updates(changes).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update bill",
+			})
+			return
+		}
+		db.Where("id = ?", existing.ID).First(existing)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Bill updated successfully",
+			"data":        newBillResponse(*existing, startOfToday()),
+		})
+	}
+}
+
+// DeleteBill removes the bill. Transactions that paid it are kept.
+func DeleteBill(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bill, ok := findOwnedBill(db, w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.Delete(bill).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete bill",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Bill deleted successfully",
+		})
+	}
+}
+
+// PayBill books the expense for the bill's current due date and then moves
+// a repeating bill to its next due date, or marks a one-off bill paid. The
+// amount, date and account default to the bill's. Paying from an account in
+// another currency needs the amount in that currency.
+func PayBill(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payRequest struct {
+			AccountID *uuid.UUID  `json:"account_id"`
+			Amount    json.Number `json:"amount"`
+			Date      string      `json:"date"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&payRequest); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid request body",
+				})
+				return
+			}
+		}
+		defer r.Body.Close()
+
+		bill, ok := findOwnedBill(db, w, r)
+		if !ok {
+			return
+		}
+		if bill.Paid {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "Bill is already paid",
+			})
+			return
+		}
+
+		request := transactionRequest{
+			AccountID:  bill.AccountID,
+			CategoryID: bill.CategoryID,
+			Type:       models.TransactionTypeExpense,
+			Amount:     json.Number(bill.Amount.Decimal()),
+			Date:       payRequest.Date,
+			Note:       bill.Name,
+		}
+		if payRequest.AccountID != nil {
+			request.AccountID = *payRequest.AccountID
+		}
+		if payRequest.Amount != "" {
+			request.Amount = payRequest.Amount
+		}
+		transaction, statusCode, message := request.toTransaction(db, bill.UserID)
+		if transaction == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+		if payRequest.Amount == "" && transaction.Amount.Currency != bill.Amount.Currency {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "The account is in " + transaction.Amount.Currency + " and the bill in " + bill.Amount.Currency + ", so the amount paid is required",
+			})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(transaction).Error; err != nil {
+				return err
+			}
+			if err := ledger.RecordTransaction(tx, transaction); err != nil {
+				return err
+			}
+			payment := models.BillPayment{BillID: bill.ID, DueDate: bill.DueDate, TransactionID: transaction.ID}
+			if err := tx.Create(&payment).Error; err != nil {
+				return err
+			}
+
+			if next, ok := nextDueDate(bill); ok {
+				return tx.Model(bill).Update("due_date", next).Error
+			}
+			return tx.Model(bill).Update("paid", true).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to pay bill",
+			})
+			return
+		}
+		db.Where("id = ?", bill.ID).First(bill)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Bill paid successfully",
+			"data":        newBillResponse(*bill, startOfToday()),
+			"transaction": newTransactionResponse(*transaction),
+		})
+	}
+}
+
+func GetBillPayments(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bill, ok := findOwnedBill(db, w, r)
+		if !ok {
+			return
+		}
+
+		var payments []models.BillPayment
+		if err := db.Where("bill_id = ?", bill.ID).Order("due_date DESC").Find(&payments).Error; err != nil {
+			http.Error(w, "Failed to retrieve bill payments", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                  `json:"status_code"`
+			Data       []models.BillPayment `json:"data"`
+			Message    string               `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       payments,
+			Message:    "Bill payments successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestNextDueDate(t *testing.T) {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		bill   models.Bill
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "one-off", bill: models.Bill{StartDate: date(1, 5), DueDate: date(1, 5)}},
+		{name: "monthly", bill: models.Bill{StartDate: date(1, 5), DueDate: date(1, 5), RRule: "FREQ=MONTHLY"}, want: date(2, 5), wantOK: true},
+		{name: "count keeps counting from the start", bill: models.Bill{StartDate: date(1, 5), DueDate: date(2, 5), RRule: "FREQ=MONTHLY;COUNT=3"}, want: date(3, 5), wantOK: true},
+		{name: "count used up", bill: models.Bill{StartDate: date(1, 5), DueDate: date(3, 5), RRule: "FREQ=MONTHLY;COUNT=3"}},
+		{name: "interval stays on the start's weeks", bill: models.Bill{StartDate: date(1, 1), DueDate: date(1, 15), RRule: "FREQ=WEEKLY;INTERVAL=2"}, want: date(1, 29), wantOK: true},
+		{name: "end of month after a short month", bill: models.Bill{StartDate: date(1, 31), DueDate: date(1, 31), RRule: "FREQ=MONTHLY"}, want: date(3, 31), wantOK: true},
+		{name: "until passed", bill: models.Bill{StartDate: date(1, 5), DueDate: date(2, 5), RRule: "FREQ=MONTHLY;UNTIL=20240301T000000Z"}},
+	}
+
+	for _, tt := range tests {
+		got, ok := nextDueDate(&tt.bill)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("%s: nextDueDate() = %s, %v, want %s, %v", tt.name, got.Format(dateLayout), ok, tt.want.Format(dateLayout), tt.wantOK)
+		}
+	}
+}
+
+func TestPayBillCurrency(t *testing.T) {
+	db := openTestDB(t)
+	userID := uuid.New()
+	dollars := &models.Account{Name: "Dollars", UserID: userID, Currency: "USD"}
+	euros := &models.Account{Name: "Euros", UserID: userID, Currency: "EUR"}
+	mustCreate(t, db, dollars, euros)
+
+	tests := []struct {
+		name       string
+		request    map[string]interface{}
+		want       int
+		wantAmount models.Money
+	}{
+		{name: "bill's account", want: http.StatusOK, wantAmount: models.NewMoney(5000, "USD")},
+		{name: "account in another currency", request: map[string]interface{}{"account_id": euros.ID}, want: http.StatusBadRequest},
+		{name: "account in another currency with amount", request: map[string]interface{}{"account_id": euros.ID, "amount": "46.10"}, want: http.StatusOK, wantAmount: models.NewMoney(4610, "EUR")},
+	}
+
+	for _, tt := range tests {
+		bill := &models.Bill{UserID: userID, AccountID: dollars.ID, Name: "Rent", Amount: models.NewMoney(5000, "USD"), DueDate: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)}
+		mustCreate(t, db, bill)
+		code := serve(t, "/bills/{id}/pay", PayBill(db), http.MethodPost, "/bills/"+bill.ID.String()+"/pay", userID, tt.request)
+		if code != tt.want {
+			t.Errorf("%s: pay status = %d, want %d", tt.name, code, tt.want)
+			continue
+		}
+
+		var transactions []models.Transaction
+		db.Where("id IN (?)", db.Model(&models.BillPayment{}).Select("transaction_id").Where("bill_id = ?", bill.ID)).Find(&transactions)
+		if tt.want != http.StatusOK {
+			if len(transactions) != 0 {
+				t.Errorf("%s: booked %+v, want nothing", tt.name, transactions)
+			}
+			continue
+		}
+		if len(transactions) != 1 || transactions[0].Amount != tt.wantAmount {
+			t.Errorf("%s: booked %+v, want one payment of %+v", tt.name, transactions, tt.wantAmount)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/exchange"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type budgetRequest struct {
+	CategoryID uuid.UUID   `json:"category_id"`
+	Period     string      `json:"period"`
+	Amount     json.Number `json:"amount"`
+	Currency   string      `json:"currency"`
+	StartDate  string      `json:"start_date"`
+	Rollover   bool        `json:"rollover"`
+}
+
+type budgetResponse struct {
+	ID         string       `json:"id"`
+	CategoryID string       `json:"category_id"`
+	Period     string       `json:"period"`
+	Amount     models.Money `json:"amount"`
+	StartDate  string       `json:"start_date"`
+	Rollover   bool         `json:"rollover"`
+	CreatedAt  string       `json:"created_at"`
+	UpdatedAt  string       `json:"updated_at"`
+}
+
+func newBudgetResponse(budget models.Budget) budgetResponse {
+	return budgetResponse{
+		ID:         budget.ID.String(),
+		CategoryID: budget.CategoryID.String(),
+		Period:     budget.Period,
+		Amount:     budget.Amount,
+		StartDate:  budget.StartDate.Format(dateLayout),
+		Rollover:   budget.Rollover,
+		CreatedAt:  budget.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  budget.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+type budgetStatusResponse struct {
+	BudgetID        string       `json:"budget_id"`
+	CategoryID      string       `json:"category_id"`
+	CategoryName    string       `json:"category_name"`
+	Period          string       `json:"period"`
+	PeriodStart     string       `json:"period_start"`
+	PeriodEnd       string       `json:"period_end"`
+	Budgeted        models.Money `json:"budgeted"`
+	CarriedOver     models.Money `json:"carried_over"`
+	Available       models.Money `json:"available"`
+	Spent           models.Money `json:"spent"`
+	Remaining       models.Money `json:"remaining"`
+	Percent         float64      `json:"percent"`
+	Projected       models.Money `json:"projected"`
+	Overspent       bool         `json:"overspent"`
+	MissingRatesFor []string     `json:"missing_rates_for"`
+}
+
+// toBudget validates the request against the categories the user can see.
+// On failure it returns the status code and message to send back.
+func (in *budgetRequest) toBudget(db *gorm.DB, user *models.User) (*models.Budget, int, string) {
+	if !models.IsValidBudgetPeriod(in.Period) {
+		return nil, http.StatusBadRequest, "Period must be weekly, monthly or yearly"
+	}
+
+	currency := models.NormalizeCurrency(in.Currency)
+	if currency == "" {
+		currency = user.Currency()
+	}
+	if !models.IsValidCurrency(currency) {
+		return nil, http.StatusBadRequest, "Currency must be an ISO-4217 code"
+	}
+
+	amount, err := models.ParseMoney(in.Amount.String(), currency)
+	if err != nil || amount.IsNegative() {
+		return nil, http.StatusBadRequest, "Invalid amount"
+	}
+
+	if err := visibleCategories(db, user.ID).Where("id = ?", in.CategoryID).First(&models.Category{}).Error; err != nil {
+		return nil, http.StatusNotFound, "Category not found"
+	}
+
+	start := time.Now()
+	if in.StartDate != "" {
+		if start, err = parseDate(in.StartDate); err != nil {
+			return nil, http.StatusBadRequest, "Invalid start date"
+		}
+	}
+	start, _ = models.PeriodBounds(in.Period, start)
+
+	return &models.Budget{
+		UserID:     user.ID,
+		CategoryID: in.CategoryID,
+		Period:     in.Period,
+		Amount:     amount,
+		StartDate:  start,
+		Rollover:   in.Rollover,
+	}, 0, ""
+}
+
+func findOwnedBudget(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Budget, bool) {
+	var budget models.Budget
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&budget).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Budget not found",
+		})
+		return nil, false
+	}
+	return &budget, true
+}
+
+// budgetStatus compares a budget with what was actually booked to its
+// category subtree in the period containing date. With rollover, every
+// earlier period since the budget started carries its remainder forward,
+// which may be negative after overspending.
+func budgetStatus(db *gorm.DB, tree *models.CategoryTree, converter *exchange.Converter, budget models.Budget, date time.Time) (budgetStatusResponse, error) {
+	periodStart, periodEnd := models.PeriodBounds(budget.Period, date)
+	currency := budget.Amount.Currency
+
+	from := periodStart
+	if budget.Rollover && budget.StartDate.Before(periodStart) {
+		from, _ = models.PeriodBounds(budget.Period, budget.StartDate)
+	}
+
+	category, _ := tree.Get(budget.CategoryID)
+	transactionType := models.TransactionTypeExpense
+	categoryName := ""
+	if category != nil {
+		transactionType = category.CategoryType
+		categoryName = category.Name
+	}
+
+	categoryIDs := tree.Descendants(budget.CategoryID)
+	if len(categoryIDs) == 0 {
+		categoryIDs = []uuid.UUID{budget.CategoryID}
+	}
+
+	activity, err := categoryActivity(db, budget.UserID, categoryIDs, transactionType, from, periodEnd)
+	if err != nil {
+		return budgetStatusResponse{}, err
+	}
+	activity, missing := convertActivity(converter, activity, currency)
+
+	carried := models.NewMoney(0, currency)
+	spent := models.NewMoney(0, currency)
+	start := from
+	for start.Before(periodStart) {
+		_, end := models.PeriodBounds(budget.Period, start)
+		previous := models.NewMoney(0, currency)
+		for _, day := range activity {
+			if !day.Day.Before(start) && day.Day.Before(end) {
+				previous = previous.Add(day.Total)
+			}
+		}
+		carried = carried.Add(budget.Amount).Sub(previous)
+		start = end
+	}
+	for _, day := range activity {
+		if !day.Day.Before(periodStart) {
+			spent = spent.Add(day.Total)
+		}
+	}
+
+	available := budget.Amount.Add(carried)
+	remaining := available.Sub(spent)
+
+	percent := 0.0
+	if available.IsPositive() {
+		percent = math.Round(float64(spent.Amount)/float64(available.Amount)*10000) / 100
+	}
+
+	// Project the spending pace so far onto the whole period.
+	projected := spent
+	today := time.Now()
+	if !today.Before(periodStart) && today.Before(periodEnd) {
+		totalDays := periodEnd.Sub(periodStart).Hours() / 24
+		elapsedDays := math.Floor(today.Sub(periodStart).Hours()/24) + 1
+		projected = models.NewMoney(int64(math.Round(float64(spent.Amount)*totalDays/elapsedDays)), currency)
+	}
+
+	return budgetStatusResponse{
+		BudgetID:        budget.ID.String(),
+		CategoryID:      budget.CategoryID.String(),
+		CategoryName:    categoryName,
+		Period:          budget.Period,
+		PeriodStart:     periodStart.Format(dateLayout),
+		PeriodEnd:       periodEnd.AddDate(0, 0, -1).Format(dateLayout),
+		Budgeted:        budget.Amount,
+		CarriedOver:     carried,
+		Available:       available,
+		Spent:           spent,
+		Remaining:       remaining,
+		Percent:         percent,
+		Projected:       projected,
+		Overspent:       remaining.IsNegative(),
+		MissingRatesFor: missing,
+	}, nil
+}
+
+// statusDate reads the optional ?date parameter, defaulting to today.
+func statusDate(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	value := r.URL.Query().Get("date")
+	if value == "" {
+		return time.Now(), true
+	}
+	date, err := parseDate(value)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusBadRequest,
+			"message":     "Invalid date",
+		})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func GetBudgets(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := db.Where("user_id = ?", middleware.CurrentUserID(r))
+		if period := r.URL.Query().Get("period"); period != "" {
+			query = query.Where("period = ?", period)
+		}
+
+		var budgets []models.Budget
+		if err := query.Order("created_at").Find(&budgets).Error; err != nil {
+			http.Error(w, "Failed to retrieve budgets", http.StatusInternalServerError)
+			return
+		}
+
+		response := []budgetResponse{}
+		for _, budget := range budgets {
+			response = append(response, newBudgetResponse(budget))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int              `json:"status_code"`
+			Data       []budgetResponse `json:"data"`
+			Message    string           `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Budgets successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetBudgetById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		budget, ok := findOwnedBudget(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Budget successfully retrieved",
+			"data":        newBudgetResponse(*budget),
+		})
+	}
+}
+
+func CreateBudget(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request budgetRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		budget, statusCode, message := request.toBudget(db, middleware.CurrentUser(r))
+		if budget == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		var existing int64
+		db.Model(&models.Budget{}).Where("user_id = ? AND category_id = ? AND period = ?", budget.UserID, budget.CategoryID, budget.Period).Count(&existing)
+		if existing > 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "Category already has a budget for this period",
+			})
+			return
+		}
+
+		if err := db.Create(budget).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create budget",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Budget created successfully",
+			"data":        newBudgetResponse(*budget),
+		})
+	}
+}
+
+func UpdateBudget(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request budgetRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedBudget(db, w, r)
+		if !ok {
+			return
+		}
+
+		if request.StartDate == "" {
+			request.StartDate = existing.StartDate.Format(dateLayout)
+		}
+		updated, statusCode, message := request.toBudget(db, middleware.CurrentUser(r))
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		var duplicates int64
+		db.Model(&models.Budget{}).Where("user_id = ? AND category_id = ? AND period = ? AND id <> ?", updated.UserID, updated.CategoryID, updated.Period, existing.ID).Count(&duplicates)
+		if duplicates > 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "Category already has a budget for this period",
+			})
+			return
+		}
+
+		if err := db.Model(existing).Updates(map[string]interface{}{
+			"category_id":  updated.CategoryID,
+			"period":       updated.Period,
+			"amount_minor": updated.Amount,
+			"currency":     updated.Amount.Currency,
+			"start_date":   updated.StartDate,
+			"rollover":     updated.Rollover,
+		}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update budget",
+			})
+			return
+		}
+		db.Where("id = ?", existing.ID).First(existing)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Budget updated successfully",
+			"data":        newBudgetResponse(*existing),
+		})
+	}
+}
+
+func DeleteBudget(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		budget, ok := findOwnedBudget(db, w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.Delete(budget).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete budget",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Budget deleted successfully",
+		})
+	}
+}
+
+func GetBudgetStatus(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date, ok := statusDate(w, r)
+		if !ok {
+			return
+		}
+
+		budget, ok := findOwnedBudget(db, w, r)
+		if !ok {
+			return
+		}
+
+		tree, err := models.LoadCategoryTree(db, budget.UserID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve budget status", http.StatusInternalServerError)
+			return
+		}
+
+		status, err := budgetStatus(db, tree, exchange.NewConverter(db, budget.UserID), *budget, date)
+		if err != nil {
+			http.Error(w, "Failed to retrieve budget status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Budget status successfully retrieved",
+			"data":        status,
+		})
+	}
+}
+
+// GetBudgetsStatus returns budget-vs-actual for every budget of the user.
+func GetBudgetsStatus(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date, ok := statusDate(w, r)
+		if !ok {
+			return
+		}
+
+		userID := middleware.CurrentUserID(r)
+		var budgets []models.Budget
+		if err := db.Where("user_id = ?", userID).Order("created_at").Find(&budgets).Error; err != nil {
+			http.Error(w, "Failed to retrieve budget status", http.StatusInternalServerError)
+			return
+		}
+
+		tree, err := models.LoadCategoryTree(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve budget status", http.StatusInternalServerError)
+			return
+		}
+
+		converter := exchange.NewConverter(db, userID)
+		response := []budgetStatusResponse{}
+		for _, budget := range budgets {
+			status, err := budgetStatus(db, tree, converter, budget, date)
+			if err != nil {
+				http.Error(w, "Failed to retrieve budget status", http.StatusInternalServerError)
+				return
+			}
+			response = append(response, status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                    `json:"status_code"`
+			Data       []budgetStatusResponse `json:"data"`
+			Message    string                 `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Budget status successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
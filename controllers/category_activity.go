@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"expense-app-backend/exchange"
+	"expense-app-backend/models"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// dailyActivity is what was spent or earned on one day, in one currency.
+type dailyActivity struct {
+	Day   time.Time
+	Total models.Money
+}
+
+// categoryActivity sums the user's transactions of the given type booked to
+// the categories between from (inclusive) and to (exclusive), per day and
+// currency. Split transactions count each line under its own category.
+// Transfer legs never match since they are neither type.
+func categoryActivity(db *gorm.DB, userID uuid.UUID, categoryIDs []uuid.UUID, transactionType string, from, to time.Time) ([]dailyActivity, error) {
+	if len(categoryIDs) == 0 {
+		return nil, nil
+	}
+
+	var rows []struct {
+		Currency string
+		Day      string
+		Total    models.Money
+	}
+	if err := db.Table("(?) AS category_lines", models.CategoryLines(db)).
+		Select("currency, DATE_FORMAT(date, '%Y-%m-%d') AS day, SUM(amount_minor) AS total").
+		Where("user_id = ? AND type = ? AND category_id IN ?", userID, transactionType, categoryIDs).
+		Where("date >= ? AND date < ?", from, to).
+		Group("currency, day").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	activity := make([]dailyActivity, 0, len(rows))
+	for _, row := range rows {
+		day, err := time.ParseInLocation(dateLayout, row.Day, from.Location())
+		if err != nil {
+			continue
+		}
+		activity = append(activity, dailyActivity{Day: day, Total: models.NewMoney(row.Total.Amount, row.Currency)})
+	}
+	sort.Slice(activity, func(i, j int) bool { return activity[i].Day.Before(activity[j].Day) })
+	return activity, nil
+}
+
+// convertActivity converts each day's activity with that day's rate. The
+// currencies that could not be converted are returned sorted.
+func convertActivity(converter *exchange.Converter, activity []dailyActivity, currency string) ([]dailyActivity, []string) {
+	converted := make([]dailyActivity, 0, len(activity))
+	missing := map[string]bool{}
+	for _, day := range activity {
+		total, err := converter.Convert(day.Total, currency, day.Day)
+		if err != nil {
+			missing[day.Total.Currency] = true
+			continue
+		}
+		converted = append(converted, dailyActivity{Day: day.Day, Total: total})
+	}
+
+	missingRates := []string{}
+	for missingCurrency := range missing {
+		missingRates = append(missingRates, missingCurrency)
+	}
+	sort.Strings(missingRates)
+	return converted, missingRates
+}
@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"expense-app-backend/middleware"
 	"expense-app-backend/models"
 	"net/http"
 	"time"
@@ -11,30 +13,29 @@ import (
 )
 
 type CategoryRequest struct {
-	Name         string `json:"name"`
-	CategoryType string `json:"category_type"`
+	Name         string     `json:"name"`
+	CategoryType string     `json:"category_type"`
+	ParentID     *uuid.UUID `json:"parent_id"`
 	SubCategory  []struct {
 		Name string `json:"name"`
 	} `json:"sub_category"`
 }
 
+// Category is the read model for the category endpoints. Sub-categories are
+// the direct children of a category in the tree.
 type Category struct {
 	ID           uuid.UUID `gorm:"primaryKey"`
+	UserID       *uuid.UUID
+	ParentID     *uuid.UUID
 	Name         string
 	CategoryType string
-	SubCategory  []SubCategory `gorm:"foreignKey:CategoryID"`
+	Position     int
+	ArchivedAt   *time.Time
+	SubCategory  []Category `gorm:"foreignKey:ParentID"`
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
-type SubCategory struct {
-	ID         uuid.UUID `gorm:"primaryKey"`
-	Name       string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	CategoryID uuid.UUID
-}
-
 type subCategoryResponse struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
@@ -42,20 +43,63 @@ type subCategoryResponse struct {
 
 type categoryResponse struct {
 	ID           uuid.UUID             `json:"id"`
+	ParentID     *uuid.UUID            `json:"parent_id"`
 	Name         string                `json:"name"`
 	CategoryType string                `json:"category_type"`
+	IsDefault    bool                  `json:"is_default"`
+	Archived     bool                  `json:"archived"`
 	SubCategory  []subCategoryResponse `json:"sub_categories"`
 	CreatedAt    string                `json:"created_at"`
 	UpdatedAt    string                `json:"updated_at"`
 }
 
+// categoryOwner returns the owner the category write routes act for. The
+// admin routes manage the global default set, which belongs to nobody.
+func categoryOwner(r *http.Request, global bool) *uuid.UUID {
+	if global {
+		return nil
+	}
+	userID := middleware.CurrentUserID(r)
+	return &userID
+}
+
+func scopeCategoryOwner(query *gorm.DB, ownerID *uuid.UUID) *gorm.DB {
+	if ownerID == nil {
+		return query.Where("user_id IS NULL")
+	}
+	return query.Where("user_id = ?", *ownerID)
+}
+
+func scopeCategoryParent(query *gorm.DB, parentID *uuid.UUID) *gorm.DB {
+	if parentID == nil {
+		return query.Where("parent_id IS NULL")
+	}
+	return query.Where("parent_id = ?", *parentID)
+}
+
+// visibleCategories limits a query to the user's own categories plus the
+// global defaults maintained by admins.
+func visibleCategories(query *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return query.Where("(user_id = ? OR user_id IS NULL)", userID)
+}
+
 func GetCategories(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		name := r.URL.Query().Get("name")
 		categoryType := r.URL.Query().Get("category_type")
+		parentID := r.URL.Query().Get("parent_id")
+		includeArchived := r.URL.Query().Get("include_archived") == "true"
 
-		query := db
+		query := visibleCategories(db, middleware.CurrentUserID(r))
+		if !includeArchived {
+			query = query.Where("archived_at IS NULL")
+		}
+		if parentID != "" {
+			query = query.Where("parent_id = ?", parentID)
+		} else {
+			query = query.Where("parent_id IS NULL")
+		}
 		if name != "" {
 			query = query.Where("name = ?", name)
 		}
@@ -64,7 +108,7 @@ func GetCategories(db *gorm.DB) http.HandlerFunc {
 		}
 
 		var categories []Category
-		result := query.Preload("SubCategory", "deleted_at IS NULL").Where("deleted_at IS NULL").Limit(10).Find(&categories)
+		result := query.Preload("SubCategory", subCategoryLoader(includeArchived)).Where("deleted_at IS NULL").Limit(10).Find(&categories)
 		if result.Error != nil {
 			http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
 			return
@@ -82,8 +126,11 @@ func GetCategories(db *gorm.DB) http.HandlerFunc {
 
 			response = append(response, categoryResponse{
 				ID:           category.ID,
+				ParentID:     category.ParentID,
 				Name:         category.Name,
 				CategoryType: category.CategoryType,
+				IsDefault:    category.UserID == nil,
+				Archived:     category.ArchivedAt != nil,
 				SubCategory:  subCategoryResponses,
 				CreatedAt:    category.CreatedAt.Format(time.RFC3339),
 				UpdatedAt:    category.UpdatedAt.Format(time.RFC3339),
@@ -130,8 +177,10 @@ func GetCategoryById(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
+		includeArchived := r.URL.Query().Get("include_archived") == "true"
+
 		var category Category
-		result := db.Preload("SubCategory", "deleted_at IS NULL").Where("id = ? AND deleted_at IS NULL", id).First(&category)
+		result := visibleCategories(db, middleware.CurrentUserID(r)).Preload("SubCategory", subCategoryLoader(includeArchived)).Where("id = ? AND deleted_at IS NULL", id).First(&category)
 		if result.Error != nil {
 			w.WriteHeader(http.StatusNotFound)
 			errorResponse := struct {
@@ -157,8 +206,11 @@ func GetCategoryById(db *gorm.DB) http.HandlerFunc {
 
 		response = categoryResponse{
 			ID:           category.ID,
+			ParentID:     category.ParentID,
 			Name:         category.Name,
 			CategoryType: category.CategoryType,
+			IsDefault:    category.UserID == nil,
+			Archived:     category.ArchivedAt != nil,
 			SubCategory:  subCategoryResponses,
 			CreatedAt:    category.CreatedAt.Format(time.RFC3339),
 			UpdatedAt:    category.UpdatedAt.Format(time.RFC3339),
@@ -187,7 +239,17 @@ func GetCategoryById(db *gorm.DB) http.HandlerFunc {
 }
 
 func CreateCategory(db *gorm.DB) http.HandlerFunc {
+	return createCategory(db, false)
+}
+
+func CreateDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return createCategory(db, true)
+}
+
+func createCategory(db *gorm.DB, global bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID := categoryOwner(r, global)
+
 		decoder := json.NewDecoder(r.Body)
 		var categoryRequest CategoryRequest
 		if err := decoder.Decode(&categoryRequest); err != nil {
@@ -204,6 +266,23 @@ func CreateCategory(db *gorm.DB) http.HandlerFunc {
 		}
 		defer r.Body.Close()
 
+		if categoryRequest.ParentID != nil {
+			var parent models.Category
+			if err := scopeCategoryOwner(db, ownerID).Where("id = ?", *categoryRequest.ParentID).First(&parent).Error; err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				errorResponse := struct {
+					StatusCode int    `json:"status_code"`
+					Message    string `json:"message"`
+				}{
+					StatusCode: http.StatusNotFound,
+					Message:    "Parent category not found",
+				}
+				json.NewEncoder(w).Encode(errorResponse)
+				return
+			}
+			categoryRequest.CategoryType = parent.CategoryType
+		}
+
 		if categoryRequest.Name == "" || categoryRequest.CategoryType == "" {
 			w.WriteHeader(http.StatusBadRequest)
 			errorResponse := struct {
@@ -218,7 +297,7 @@ func CreateCategory(db *gorm.DB) http.HandlerFunc {
 		}
 
 		var existingCategory models.Category
-		if err := db.Where("name = ?", categoryRequest.Name).First(&existingCategory).Error; err == nil {
+		if err := scopeCategoryParent(scopeCategoryOwner(db, ownerID), categoryRequest.ParentID).Where("name = ?", categoryRequest.Name).First(&existingCategory).Error; err == nil {
 			w.WriteHeader(http.StatusConflict)
 			errorResponse := struct {
 				StatusCode int    `json:"status_code"`
@@ -231,17 +310,26 @@ func CreateCategory(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		category := models.Category{
-			ID:            uuid.New(),
-			Name:          categoryRequest.Name,
-			CategoryType:  categoryRequest.CategoryType,
-			SubCategories: []models.SubCategory{},
-		}
+		var position int64
+		scopeCategoryParent(scopeCategoryOwner(db.Model(&models.Category{}), ownerID), categoryRequest.ParentID).Count(&position)
 
-		for _, subCategory := range categoryRequest.SubCategory {
-			category.SubCategories = append(category.SubCategories, models.SubCategory{
-				ID:   uuid.New(),
-				Name: subCategory.Name,
+		category := models.Category{
+			ID:           uuid.New(),
+			UserID:       ownerID,
+			ParentID:     categoryRequest.ParentID,
+			Name:         categoryRequest.Name,
+			CategoryType: categoryRequest.CategoryType,
+			Position:     int(position),
+			Children:     []models.Category{},
+		}
+
+		for i, subCategory := range categoryRequest.SubCategory {
+			category.Children = append(category.Children, models.Category{
+				ID:           uuid.New(),
+				UserID:       ownerID,
+				Name:         subCategory.Name,
+				CategoryType: category.CategoryType,
+				Position:     i,
 			})
 		}
 
@@ -267,6 +355,7 @@ func CreateCategory(db *gorm.DB) http.HandlerFunc {
 
 		type DataResponse struct {
 			ID            string                `json:"id"`
+			ParentID      *uuid.UUID            `json:"parent_id"`
 			Name          string                `json:"name"`
 			CategoryType  string                `json:"category_type"`
 			SubCategories []subCategoryResponse `json:"sub_categories"`
@@ -275,7 +364,7 @@ func CreateCategory(db *gorm.DB) http.HandlerFunc {
 		}
 
 		var subCategories []subCategoryResponse
-		for _, subCategory := range category.SubCategories {
+		for _, subCategory := range category.Children {
 			subCategories = append(subCategories, subCategoryResponse{ID: subCategory.ID.String(), Name: subCategory.Name})
 		}
 
@@ -287,6 +376,7 @@ func CreateCategory(db *gorm.DB) http.HandlerFunc {
 			StatusCode: http.StatusCreated,
 			Data: DataResponse{
 				ID:            category.ID.String(),
+				ParentID:      category.ParentID,
 				Name:          category.Name,
 				CategoryType:  category.CategoryType,
 				CreatedAt:     category.CreatedAt.Format(time.RFC3339),
@@ -301,7 +391,16 @@ func CreateCategory(db *gorm.DB) http.HandlerFunc {
 }
 
 func UpdateCategory(db *gorm.DB) http.HandlerFunc {
+	return updateCategory(db, false)
+}
+
+func UpdateDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return updateCategory(db, true)
+}
+
+func updateCategory(db *gorm.DB, global bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID := categoryOwner(r, global)
 		id := r.URL.Query().Get("id")
 		if id == "" {
 			w.WriteHeader(http.StatusBadRequest)
@@ -313,11 +412,9 @@ func UpdateCategory(db *gorm.DB) http.HandlerFunc {
 		}
 
 		var categoryRequest struct {
-			Name         string `json:"name"`
-			CategoryType string `json:"category_type"`
-			SubCategory  []struct {
-				Name string `json:"name"`
-			} `json:"sub_category"`
+			Name         string             `json:"name"`
+			CategoryType string             `json:"category_type"`
+			SubCategory  []subCategoryInput `json:"sub_category"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&categoryRequest); err != nil {
@@ -330,7 +427,8 @@ func UpdateCategory(db *gorm.DB) http.HandlerFunc {
 		}
 		defer r.Body.Close()
 
-		if err := db.Where("id = ? AND deleted_at IS NULL", id).First(&models.Category{}).Error; err != nil {
+		var current models.Category
+		if err := scopeCategoryOwner(db, ownerID).Where("id = ? AND deleted_at IS NULL", id).First(&current).Error; err != nil {
 			w.WriteHeader(http.StatusNotFound)
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"status_code": http.StatusNotFound,
@@ -339,6 +437,11 @@ func UpdateCategory(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
+		// Nested categories always share the type of their parent.
+		if current.ParentID != nil {
+			categoryRequest.CategoryType = current.CategoryType
+		}
+
 		if categoryRequest.Name == "" || categoryRequest.CategoryType == "" {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{
@@ -348,6 +451,27 @@ func UpdateCategory(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
+		// Transactions and budgets were entered against the old type.
+		if categoryRequest.CategoryType != current.CategoryType {
+			subtree, err := subtreeIDs(db, ownerID, current.ID)
+			inUse := false
+			if err == nil {
+				inUse, err = categoriesInUse(db, subtree)
+			}
+			if err != nil {
+				http.Error(w, "Failed to check category usage", http.StatusInternalServerError)
+				return
+			}
+			if inUse {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusConflict,
+					"message":     "The category type cannot change while the category or one of its sub-categories is in use",
+				})
+				return
+			}
+		}
+
 		tx := db.Begin()
 
 		if err := tx.Model(&models.Category{}).
@@ -366,39 +490,47 @@ func UpdateCategory(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		if err := tx.Where("category_id = ?", id).Delete(&models.SubCategory{}).Error; err != nil {
-			tx.Rollback()
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status_code": http.StatusInternalServerError,
-				"message":     "Failed to delete existing subcategories",
-			})
-			return
-		}
-
-		var newSubCategories []models.SubCategory
-		for _, subCategory := range categoryRequest.SubCategory {
-			newSubCategories = append(newSubCategories, models.SubCategory{
-				ID:         uuid.New(),
-				Name:       subCategory.Name,
-				CategoryID: uuid.MustParse(id),
-				CreatedAt:  time.Now(),
-				UpdatedAt:  time.Now(),
-			})
-		}
-
-		if len(newSubCategories) > 0 {
-			if err := tx.Create(&newSubCategories).Error; err != nil {
+		if categoryRequest.CategoryType != current.CategoryType {
+			subtree, err := subtreeIDs(tx, ownerID, current.ID)
+			if err == nil {
+				err = tx.Model(&models.Category{}).Where("id IN ?", subtree).Update("category_type", categoryRequest.CategoryType).Error
+			}
+			if err != nil {
 				tx.Rollback()
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]interface{}{
 					"status_code": http.StatusInternalServerError,
-					"message":     "Failed to create new subcategories",
+					"message":     "Failed to update category",
 				})
 				return
 			}
 		}
 
+		var newSubCategories []models.Category
+		var err error
+		if categoryRequest.SubCategory != nil {
+			newSubCategories, err = syncSubCategories(tx, &current, categoryRequest.SubCategory)
+		} else {
+			err = subCategoryLoader(false)(tx).Where("parent_id = ?", current.ID).Find(&newSubCategories).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, errUnknownSubCategory) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Sub-category does not belong to this category",
+				})
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update subcategories",
+			})
+			return
+		}
+
 		tx.Commit()
 
 		type SubCategoryResponse struct {
@@ -448,7 +580,16 @@ func UpdateCategory(db *gorm.DB) http.HandlerFunc {
 }
 
 func DeleteCategory(db *gorm.DB) http.HandlerFunc {
+	return deleteCategory(db, false)
+}
+
+func DeleteDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return deleteCategory(db, true)
+}
+
+func deleteCategory(db *gorm.DB, global bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID := categoryOwner(r, global)
 		var id = r.URL.Query().Get("id")
 
 		if id == "" {
@@ -465,7 +606,7 @@ func DeleteCategory(db *gorm.DB) http.HandlerFunc {
 		}
 
 		var category models.Category
-		if err := db.Preload("SubCategories").Where("id = ? AND deleted_at IS NULL", id).First(&category).Error; err != nil {
+		if err := scopeCategoryOwner(db, ownerID).Where("id = ? AND deleted_at IS NULL", id).First(&category).Error; err != nil {
 			w.WriteHeader(http.StatusNotFound)
 			errorResponse := struct {
 				StatusCode int    `json:"status_code"`
@@ -478,7 +619,11 @@ func DeleteCategory(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		if err := db.Where("category_id = ?", category.ID).Delete(&models.SubCategory{}).Error; err != nil {
+		subtree, err := subtreeIDs(db, ownerID, category.ID)
+		if err == nil {
+			err = db.Where("id IN ? AND id <> ?", subtree, category.ID).Delete(&models.Category{}).Error
+		}
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			errorResponse := struct {
 				StatusCode int    `json:"status_code"`
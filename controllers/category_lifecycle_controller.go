@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type trashedCategoryResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	ParentID     *uuid.UUID `json:"parent_id"`
+	Name         string     `json:"name"`
+	CategoryType string     `json:"category_type"`
+	Descendants  int        `json:"descendants"`
+	DeletedAt    string     `json:"deleted_at"`
+}
+
+func MergeCategory(db *gorm.DB) http.HandlerFunc {
+	return mergeCategory(db, false)
+}
+
+func MergeDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return mergeCategory(db, true)
+}
+
+// mergeCategory folds the category into a target of the same type. Every
+// record pointing at the source is reassigned to the target, the source's
+// children are moved below the target, and the source is soft-deleted so it
+// shows up in the trash. It all happens in one database transaction.
+func mergeCategory(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID := categoryOwner(r, global)
+
+		var mergeRequest struct {
+			TargetID uuid.UUID `json:"target_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&mergeRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		sourceID, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid category ID",
+			})
+			return
+		}
+
+		var categories []models.Category
+		if err := scopeCategoryOwner(db, ownerID).Find(&categories).Error; err != nil {
+			http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+			return
+		}
+		tree := models.NewCategoryTree(categories)
+
+		source, foundSource := tree.Get(sourceID)
+		target, foundTarget := tree.Get(mergeRequest.TargetID)
+		if !foundSource || !foundTarget {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Category not found",
+			})
+			return
+		}
+
+		if tree.IsDescendant(source.ID, target.ID) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "A category cannot be merged into itself or one of its descendants",
+			})
+			return
+		}
+
+		if source.CategoryType != target.CategoryType {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Categories must have the same category type",
+			})
+			return
+		}
+
+		var reassigned int64
+		err = db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.Transaction{}).Where("category_id = ?", source.ID).Update("category_id", target.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			reassigned = result.RowsAffected
+
+			if err := tx.Model(&models.TransactionSplit{}).Where("category_id = ?", source.ID).Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Transfer{}).Where("fee_category_id = ?", source.ID).Update("fee_category_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Posting{}).Where("category_id = ?", source.ID).Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Payee{}).Where("default_category_id = ?", source.ID).Update("default_category_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.RecurringTransaction{}).Where("category_id = ?", source.ID).Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.RecurringException{}).Where("category_id = ?", source.ID).Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Bill{}).Where("category_id = ?", source.ID).Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+			err := updateRuleActions(tx, source.ID, func(actions *models.RuleActions) {
+				if actions.CategoryID != nil && *actions.CategoryID == source.ID {
+					actions.CategoryID = &target.ID
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(&models.Budget{}).Where("category_id = ?", source.ID).Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+
+			var assignments []models.EnvelopeAssignment
+			if err := tx.Where("category_id = ?", source.ID).Find(&assignments).Error; err != nil {
+				return err
+			}
+			for _, assignment := range assignments {
+				if err := addToEnvelope(tx, assignment.UserID, target.ID, assignment.Month, assignment.Amount); err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("category_id = ?", source.ID).Delete(&models.EnvelopeAssignment{}).Error; err != nil {
+				return err
+			}
+
+			position := len(tree.Children(target.ID))
+			for _, child := range tree.Children(source.ID) {
+				if err := tx.Model(&models.Category{}).Where("id = ?", child.ID).Updates(map[string]interface{}{
+					"parent_id": target.ID,
+					"position":  position,
+				}).Error; err != nil {
+					return err
+				}
+				position++
+			}
+
+			return tx.Where("id = ?", source.ID).Delete(&models.Category{}).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to merge category",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Category merged successfully",
+			"data": map[string]interface{}{
+				"source_id":                 source.ID,
+				"target_id":                 target.ID,
+				"transactions_reassigned":   reassigned,
+				"sub_categories_reparented": len(tree.Children(source.ID)),
+			},
+		})
+	}
+}
+
+func ArchiveCategory(db *gorm.DB) http.HandlerFunc {
+	return setCategoryArchived(db, false, true)
+}
+
+func UnarchiveCategory(db *gorm.DB) http.HandlerFunc {
+	return setCategoryArchived(db, false, false)
+}
+
+func ArchiveDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return setCategoryArchived(db, true, true)
+}
+
+func UnarchiveDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return setCategoryArchived(db, true, false)
+}
+
+// setCategoryArchived archives or unarchives a category together with its
+// subtree. Archived categories are hidden from listings but stay attached to
+// the transactions that already use them.
+func setCategoryArchived(db *gorm.DB, global bool, archived bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID := categoryOwner(r, global)
+
+		category, ok := findOwnedCategory(db, w, r, global)
+		if !ok {
+			return
+		}
+
+		subtree, err := subtreeIDs(db, ownerID, category.ID)
+		if err == nil {
+			var archivedAt interface{}
+			if archived {
+				archivedAt = time.Now()
+			}
+			err = db.Model(&models.Category{}).Where("id IN ?", subtree).Update("archived_at", archivedAt).Error
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update category",
+			})
+			return
+		}
+
+		message := "Category restored from archive successfully"
+		if archived {
+			message = "Category archived successfully"
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     message,
+			"data": map[string]interface{}{
+				"id":       category.ID,
+				"archived": archived,
+				"affected": len(subtree),
+			},
+		})
+	}
+}
+
+func GetCategoryTrash(db *gorm.DB) http.HandlerFunc {
+	return getCategoryTrash(db, false)
+}
+
+func GetDefaultCategoryTrash(db *gorm.DB) http.HandlerFunc {
+	return getCategoryTrash(db, true)
+}
+
+// getCategoryTrash lists soft-deleted categories. Categories deleted together
+// with their parent are folded into the parent's entry, since restoring the
+// parent brings them back as well.
+func getCategoryTrash(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var categories []models.Category
+		if err := scopeCategoryOwner(db.Unscoped(), categoryOwner(r, global)).Find(&categories).Error; err != nil {
+			http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+			return
+		}
+		tree := models.NewCategoryTree(categories)
+
+		response := []trashedCategoryResponse{}
+		for _, category := range categories {
+			if !category.DeletedAt.Valid {
+				continue
+			}
+			if category.ParentID != nil {
+				if parent, found := tree.Get(*category.ParentID); found && parent.DeletedAt.Valid {
+					continue
+				}
+			}
+
+			response = append(response, trashedCategoryResponse{
+				ID:           category.ID,
+				ParentID:     category.ParentID,
+				Name:         category.Name,
+				CategoryType: category.CategoryType,
+				Descendants:  len(tree.Descendants(category.ID)) - 1,
+				DeletedAt:    category.DeletedAt.Time.Format(time.RFC3339),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                       `json:"status_code"`
+			Data       []trashedCategoryResponse `json:"data"`
+			Message    string                    `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Deleted categories successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func RestoreCategory(db *gorm.DB) http.HandlerFunc {
+	return restoreCategory(db, false)
+}
+
+func RestoreDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return restoreCategory(db, true)
+}
+
+// restoreCategory brings a soft-deleted category back together with its
+// deleted descendants. When its former parent is still deleted the restored
+// category becomes a root instead.
+func restoreCategory(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid category ID",
+			})
+			return
+		}
+
+		var categories []models.Category
+		if err := scopeCategoryOwner(db.Unscoped(), categoryOwner(r, global)).Find(&categories).Error; err != nil {
+			http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+			return
+		}
+		tree := models.NewCategoryTree(categories)
+
+		category, found := tree.Get(id)
+		if !found || !category.DeletedAt.Valid {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Deleted category not found",
+			})
+			return
+		}
+
+		var restored []uuid.UUID
+		for _, descendantID := range tree.Descendants(id) {
+			if descendant, _ := tree.Get(descendantID); descendant.DeletedAt.Valid {
+				restored = append(restored, descendantID)
+			}
+		}
+
+		detach := false
+		if category.ParentID != nil {
+			parent, found := tree.Get(*category.ParentID)
+			detach = !found || parent.DeletedAt.Valid
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Model(&models.Category{}).Where("id IN ?", restored).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			if detach {
+				return tx.Model(&models.Category{}).Where("id = ?", id).Update("parent_id", nil).Error
+			}
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to restore category",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Category restored successfully",
+			"data": map[string]interface{}{
+				"id":       id,
+				"restored": len(restored),
+			},
+		})
+	}
+}
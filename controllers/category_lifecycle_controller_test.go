@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"expense-app-backend/ledger"
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMergeCategory(t *testing.T) {
+	db := openTestDB(t)
+	userID := uuid.New()
+	date := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+	source := &models.Category{UserID: &userID, Name: "Cafe", CategoryType: models.TransactionTypeExpense}
+	target := &models.Category{UserID: &userID, Name: "Coffee", CategoryType: models.TransactionTypeExpense}
+	wallet := &models.Account{Name: "Wallet", UserID: userID, Currency: "USD"}
+	savings := &models.Account{Name: "Savings", UserID: userID, Currency: "USD"}
+	mustCreate(t, db, source, target, wallet, savings)
+
+	transaction := &models.Transaction{UserID: userID, AccountID: wallet.ID, CategoryID: &source.ID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(450, "USD"), Date: date}
+	split := &models.Transaction{UserID: userID, AccountID: wallet.ID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(1000, "USD"), Date: date}
+	transfer := &models.Transfer{UserID: userID, FromAccountID: wallet.ID, ToAccountID: savings.ID, FromAmount: models.NewMoney(2000, "USD"), ToAmount: models.NewMoney(2000, "USD"), Fee: models.NewMoney(100, "USD"), FeeCategoryID: &source.ID, Date: date}
+	recurring := &models.RecurringTransaction{UserID: userID, AccountID: wallet.ID, CategoryID: &source.ID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(450, "USD"), RRule: "FREQ=WEEKLY", StartDate: date}
+	bill := &models.Bill{UserID: userID, AccountID: wallet.ID, CategoryID: &source.ID, Name: "Beans", Amount: models.NewMoney(1500, "USD"), DueDate: date}
+	rule := &models.Rule{UserID: userID, Name: "Cafe", Conditions: models.RuleConditions{{Field: models.RuleFieldDescription, Operator: "contains", Value: "cafe"}}, Actions: models.RuleActions{CategoryID: &source.ID}}
+	mustCreate(t, db, transaction, split, transfer, recurring, bill, rule)
+	mustCreate(t, db, &models.RecurringException{RecurringID: recurring.ID, OccurrenceDate: date, CategoryID: &source.ID})
+	mustCreate(t, db,
+		&models.TransactionSplit{TransactionID: split.ID, CategoryID: &source.ID, Amount: models.NewMoney(600, "USD")},
+		&models.TransactionSplit{TransactionID: split.ID, CategoryID: &target.ID, Amount: models.NewMoney(400, "USD"), Position: 1},
+	)
+	for _, transaction := range []*models.Transaction{transaction, split} {
+		if err := ledger.RecordTransaction(db, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ledger.RecordTransfer(db, transfer); err != nil {
+		t.Fatal(err)
+	}
+
+	code := serve(t, "/categories/{id}/merge", MergeCategory(db), http.MethodPost, "/categories/"+source.ID.String()+"/merge", userID, map[string]interface{}{"target_id": target.ID})
+	if code != http.StatusOK {
+		t.Fatalf("merge status = %d, want %d", code, http.StatusOK)
+	}
+
+	references := []struct {
+		name   string
+		model  interface{}
+		column string
+		want   int64
+	}{
+		{name: "transactions", model: &models.Transaction{}, column: "category_id", want: 1},
+		{name: "splits", model: &models.TransactionSplit{}, column: "category_id", want: 2},
+		{name: "transfer fees", model: &models.Transfer{}, column: "fee_category_id", want: 1},
+		{name: "postings", model: &models.Posting{}, column: "category_id", want: 4},
+		{name: "recurring transactions", model: &models.RecurringTransaction{}, column: "category_id", want: 1},
+		{name: "recurring exceptions", model: &models.RecurringException{}, column: "category_id", want: 1},
+		{name: "bills", model: &models.Bill{}, column: "category_id", want: 1},
+	}
+	for _, reference := range references {
+		var onSource, onTarget int64
+		db.Model(reference.model).Where(reference.column+" = ?", source.ID).Count(&onSource)
+		db.Model(reference.model).Where(reference.column+" = ?", target.ID).Count(&onTarget)
+		if onSource != 0 || onTarget != reference.want {
+			t.Errorf("%s: %d left on the source, %d on the target, want 0 and %d", reference.name, onSource, onTarget, reference.want)
+		}
+	}
+
+	db.First(rule, "id = ?", rule.ID)
+	if rule.Actions.CategoryID == nil || *rule.Actions.CategoryID != target.ID {
+		t.Errorf("rule sets category %v, want %s", rule.Actions.CategoryID, target.ID)
+	}
+
+	var merged models.Category
+	if err := db.Unscoped().First(&merged, "id = ?", source.ID).Error; err != nil || !merged.DeletedAt.Valid {
+		t.Errorf("source category = %+v, %v, want it in the trash", merged, err)
+	}
+}
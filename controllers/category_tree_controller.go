@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type categoryTreeResponse struct {
+	ID           uuid.UUID              `json:"id"`
+	ParentID     *uuid.UUID             `json:"parent_id"`
+	Name         string                 `json:"name"`
+	CategoryType string                 `json:"category_type"`
+	IsDefault    bool                   `json:"is_default"`
+	Archived     bool                   `json:"archived"`
+	Position     int                    `json:"position"`
+	Depth        int                    `json:"depth"`
+	Children     []categoryTreeResponse `json:"children"`
+	CreatedAt    string                 `json:"created_at"`
+	UpdatedAt    string                 `json:"updated_at"`
+}
+
+func newCategoryTreeResponse(tree *models.CategoryTree, category *models.Category, includeArchived bool) categoryTreeResponse {
+	response := categoryTreeResponse{
+		ID:           category.ID,
+		ParentID:     category.ParentID,
+		Name:         category.Name,
+		CategoryType: category.CategoryType,
+		IsDefault:    category.UserID == nil,
+		Archived:     category.ArchivedAt != nil,
+		Position:     category.Position,
+		Depth:        tree.Depth(category.ID),
+		Children:     []categoryTreeResponse{},
+		CreatedAt:    category.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    category.UpdatedAt.Format(time.RFC3339),
+	}
+	for _, child := range tree.Children(category.ID) {
+		if child.ArchivedAt != nil && !includeArchived {
+			continue
+		}
+		response.Children = append(response.Children, newCategoryTreeResponse(tree, child, includeArchived))
+	}
+	return response
+}
+
+// subtreeIDs returns the category and every category below it, limited to
+// the given owner so a subtree never spills into another user's data.
+func subtreeIDs(db *gorm.DB, ownerID *uuid.UUID, id uuid.UUID) ([]uuid.UUID, error) {
+	var categories []models.Category
+	if err := scopeCategoryOwner(db, ownerID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return models.NewCategoryTree(categories).Descendants(id), nil
+}
+
+// categoriesInUse reports whether anything booked or planned refers to one
+// of the categories. Those records were entered as income or expense, so the
+// categories must keep their type while they are in use.
+func categoriesInUse(db *gorm.DB, ids []uuid.UUID) (bool, error) {
+	queries := []*gorm.DB{
+		db.Model(&models.Transaction{}).Where("category_id IN ?", ids),
+		db.Model(&models.TransactionSplit{}).Where("category_id IN ?", ids),
+		db.Model(&models.RecurringTransaction{}).Where("category_id IN ?", ids),
+		db.Model(&models.RecurringException{}).Where("category_id IN ?", ids),
+		db.Model(&models.Bill{}).Where("category_id IN ?", ids),
+		db.Model(&models.Transfer{}).Where("fee_category_id IN ?", ids),
+		db.Model(&models.Budget{}).Where("category_id IN ?", ids),
+		db.Model(&models.EnvelopeAssignment{}).Where("category_id IN ?", ids),
+		db.Model(&models.EnvelopeMove{}).Where("from_category_id IN ? OR to_category_id IN ?", ids, ids),
+	}
+	for _, query := range queries {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func GetCategoryTree(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		categoryType := r.URL.Query().Get("category_type")
+		includeArchived := r.URL.Query().Get("include_archived") == "true"
+
+		tree, err := models.LoadCategoryTree(db, middleware.CurrentUserID(r))
+		if err != nil {
+			http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+			return
+		}
+
+		response := []categoryTreeResponse{}
+		for _, root := range tree.Roots() {
+			if categoryType != "" && root.CategoryType != categoryType {
+				continue
+			}
+			if root.ArchivedAt != nil && !includeArchived {
+				continue
+			}
+			response = append(response, newCategoryTreeResponse(tree, root, includeArchived))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                    `json:"status_code"`
+			Data       []categoryTreeResponse `json:"data"`
+			Message    string                 `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Category tree successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetCategorySubtree(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid category ID",
+			})
+			return
+		}
+
+		tree, err := models.LoadCategoryTree(db, middleware.CurrentUserID(r))
+		if err != nil {
+			http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+			return
+		}
+
+		category, found := tree.Get(id)
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Category not found",
+			})
+			return
+		}
+
+		var path []categoryPathEntry
+		for _, ancestor := range tree.Path(id) {
+			path = append(path, categoryPathEntry{ID: ancestor.ID, Name: ancestor.Name})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                  `json:"status_code"`
+			Data       categoryTreeResponse `json:"data"`
+			Path       []categoryPathEntry  `json:"path"`
+			Message    string               `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       newCategoryTreeResponse(tree, category, r.URL.Query().Get("include_archived") == "true"),
+			Path:       path,
+			Message:    "Category subtree successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+type categoryPathEntry struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+func MoveCategory(db *gorm.DB) http.HandlerFunc {
+	return moveCategory(db, false)
+}
+
+func MoveDefaultCategory(db *gorm.DB) http.HandlerFunc {
+	return moveCategory(db, true)
+}
+
+// moveCategory re-parents a category, or makes it a root when parent_id is
+// null. Moving a category below itself or one of its descendants is refused
+// so the tree can never contain a cycle. The moved subtree takes on the type
+// of its new parent, which is refused while anything refers to the subtree.
+func moveCategory(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID := categoryOwner(r, global)
+
+		var moveRequest struct {
+			ParentID *uuid.UUID `json:"parent_id"`
+			Position *int       `json:"position"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&moveRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid category ID",
+			})
+			return
+		}
+
+		var categories []models.Category
+		if err := scopeCategoryOwner(db, ownerID).Find(&categories).Error; err != nil {
+			http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+			return
+		}
+		tree := models.NewCategoryTree(categories)
+
+		category, found := tree.Get(id)
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Category not found",
+			})
+			return
+		}
+
+		categoryType := category.CategoryType
+		if moveRequest.ParentID != nil {
+			parent, found := tree.Get(*moveRequest.ParentID)
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusNotFound,
+					"message":     "Parent category not found",
+				})
+				return
+			}
+			if tree.IsDescendant(id, parent.ID) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusConflict,
+					"message":     "A category cannot be moved below itself or one of its descendants",
+				})
+				return
+			}
+			categoryType = parent.CategoryType
+		}
+
+		if categoryType != category.CategoryType {
+			inUse, err := categoriesInUse(db, tree.Descendants(id))
+			if err != nil {
+				http.Error(w, "Failed to check category usage", http.StatusInternalServerError)
+				return
+			}
+			if inUse {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusConflict,
+					"message":     "The category or one of its sub-categories is in use, so it can only move below a parent of the same type",
+				})
+				return
+			}
+		}
+
+		position := len(tree.Children(uuid.Nil))
+		if moveRequest.ParentID != nil {
+			position = len(tree.Children(*moveRequest.ParentID))
+		}
+		if moveRequest.Position != nil && *moveRequest.Position >= 0 {
+			position = *moveRequest.Position
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Category{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"parent_id":  moveRequest.ParentID,
+				"position":   position,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+
+			if categoryType != category.CategoryType {
+				return tx.Model(&models.Category{}).Where("id IN ?", tree.Descendants(id)).Update("category_type", categoryType).Error
+			}
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to move category",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Category moved successfully",
+			"data": map[string]interface{}{
+				"id":            id,
+				"parent_id":     moveRequest.ParentID,
+				"position":      position,
+				"category_type": categoryType,
+			},
+		})
+	}
+}
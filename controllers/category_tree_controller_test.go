@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MySQL has no INSERT ... RETURNING. Leave it out here too, or columns
+	// with a default are read back into Money without their currency.
+	db.Callback().Create().Replace("gorm:create", callbacks.Create(&callbacks.Config{CreateClauses: []string{"INSERT", "VALUES", "ON CONFLICT"}}))
+	if err := db.AutoMigrate(&models.Category{}, &models.User{}, &models.Account{}, &models.Transaction{}, &models.TransactionSplit{}, &models.Tag{}, &models.TransactionTag{}, &models.Payee{}, &models.PayeeAlias{}, &models.Rule{}, &models.ExchangeRate{}, &models.Transfer{}, &models.JournalEntry{}, &models.Posting{}, &models.Budget{}, &models.EnvelopeAssignment{}, &models.EnvelopeMove{}, &models.RecurringTransaction{}, &models.RecurringException{}, &models.Bill{}, &models.BillPayment{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, values ...interface{}) {
+	t.Helper()
+	for _, value := range values {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// serve sends the request through the route as the given user and returns
+// the response status.
+func serve(t *testing.T, route string, handler http.HandlerFunc, method, target string, userID uuid.UUID, body interface{}) int {
+	t.Helper()
+	token, err := utils.GenerateJWT(userID, "user@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Handle(route, middleware.AuthMiddleware(handler)).Methods(method)
+	request := httptest.NewRequest(method, target, bytes.NewReader(payload))
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestCategoryTypeChange(t *testing.T) {
+	db := openTestDB(t)
+	userID := uuid.New()
+	date := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+	newCategory := func(name, categoryType string, parentID *uuid.UUID) *models.Category {
+		category := &models.Category{UserID: &userID, ParentID: parentID, Name: name, CategoryType: categoryType}
+		mustCreate(t, db, category)
+		return category
+	}
+	salary := newCategory("Salary", models.TransactionTypeIncome, nil)
+	food := newCategory("Food", models.TransactionTypeExpense, nil)
+	used := newCategory("Used", models.TransactionTypeExpense, nil)
+	usedChild := newCategory("Used child", models.TransactionTypeExpense, &used.ID)
+	budgeted := newCategory("Budgeted", models.TransactionTypeExpense, nil)
+	unused := newCategory("Unused", models.TransactionTypeExpense, nil)
+	newCategory("Unused child", models.TransactionTypeExpense, &unused.ID)
+	renamed := newCategory("Renamed", models.TransactionTypeExpense, nil)
+
+	mustCreate(t, db,
+		&models.Transaction{UserID: userID, AccountID: uuid.New(), CategoryID: &usedChild.ID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(100, "USD"), Date: date},
+		&models.Budget{UserID: userID, CategoryID: budgeted.ID, Amount: models.NewMoney(100, "USD")},
+	)
+
+	moveTests := []struct {
+		name     string
+		category *models.Category
+		parentID *uuid.UUID
+		want     int
+		wantType string
+	}{
+		{name: "in use, same type", category: used, parentID: &food.ID, want: http.StatusOK, wantType: models.TransactionTypeExpense},
+		{name: "in use below, other type", category: used, parentID: &salary.ID, want: http.StatusConflict, wantType: models.TransactionTypeExpense},
+		{name: "budgeted, other type", category: budgeted, parentID: &salary.ID, want: http.StatusConflict, wantType: models.TransactionTypeExpense},
+		{name: "unused, other type", category: unused, parentID: &salary.ID, want: http.StatusOK, wantType: models.TransactionTypeIncome},
+	}
+	for _, tt := range moveTests {
+		code := serve(t, "/categories/{id}/move", MoveCategory(db), http.MethodPut, "/categories/"+tt.category.ID.String()+"/move", userID, map[string]interface{}{"parent_id": tt.parentID})
+		if code != tt.want {
+			t.Errorf("%s: move status = %d, want %d", tt.name, code, tt.want)
+		}
+		var types []string
+		db.Model(&models.Category{}).Where("id = ? OR parent_id = ?", tt.category.ID, tt.category.ID).Pluck("category_type", &types)
+		for _, categoryType := range types {
+			if categoryType != tt.wantType {
+				t.Errorf("%s: subtree types = %v, want %s", tt.name, types, tt.wantType)
+				break
+			}
+		}
+	}
+
+	updateTests := []struct {
+		name     string
+		category *models.Category
+		want     int
+	}{
+		{name: "budgeted", category: budgeted, want: http.StatusConflict},
+		{name: "unused", category: renamed, want: http.StatusOK},
+	}
+	for _, tt := range updateTests {
+		body := map[string]interface{}{"name": tt.category.Name, "category_type": models.TransactionTypeIncome}
+		if code := serve(t, "/categories/categoriesId", UpdateCategory(db), http.MethodPut, "/categories/categoriesId?id="+tt.category.ID.String(), userID, body); code != tt.want {
+			t.Errorf("%s: update status = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
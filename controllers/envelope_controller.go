@@ -0,0 +1,550 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-app-backend/exchange"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const monthLayout = "2006-01"
+
+type envelopeResponse struct {
+	CategoryID uuid.UUID    `json:"category_id"`
+	ParentID   *uuid.UUID   `json:"parent_id"`
+	Name       string       `json:"name"`
+	Assigned   models.Money `json:"assigned"`
+	Activity   models.Money `json:"activity"`
+	Available  models.Money `json:"available"`
+}
+
+type envelopeSummaryResponse struct {
+	Month                 string             `json:"month"`
+	Income                models.Money       `json:"income"`
+	ReadyToAssign         models.Money       `json:"ready_to_assign"`
+	Assigned              models.Money       `json:"assigned"`
+	Activity              models.Money       `json:"activity"`
+	Available             models.Money       `json:"available"`
+	UncategorizedActivity models.Money       `json:"uncategorized_activity"`
+	Envelopes             []envelopeResponse `json:"envelopes"`
+	MissingRatesFor       []string           `json:"missing_rates_for"`
+}
+
+type envelopeMoveResponse struct {
+	ID             uuid.UUID    `json:"id"`
+	Month          string       `json:"month"`
+	FromCategoryID *uuid.UUID   `json:"from_category_id"`
+	ToCategoryID   *uuid.UUID   `json:"to_category_id"`
+	Amount         models.Money `json:"amount"`
+	Note           string       `json:"note"`
+	CreatedAt      string       `json:"created_at"`
+}
+
+// parseMonth accepts "2006-01" or any date inside the month and returns the
+// first day of that month. An empty value means the current month.
+func parseMonth(value string) (time.Time, error) {
+	if value == "" {
+		return models.MonthStart(time.Now()), nil
+	}
+	if month, err := time.ParseInLocation(monthLayout, value, time.Local); err == nil {
+		return month, nil
+	}
+	date, err := parseDate(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return models.MonthStart(date), nil
+}
+
+// requireEnvelopes writes a conflict response unless the user has switched to
+// envelope budgeting.
+func requireEnvelopes(w http.ResponseWriter, user *models.User) bool {
+	if user.UsesEnvelopes() {
+		return true
+	}
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status_code": http.StatusConflict,
+		"message":     "Envelope budgeting is not enabled",
+	})
+	return false
+}
+
+// addToEnvelope changes the amount assigned to an envelope for a month,
+// creating the assignment when the envelope had none yet.
+func addToEnvelope(tx *gorm.DB, userID uuid.UUID, categoryID uuid.UUID, month time.Time, delta models.Money) error {
+	var assignment models.EnvelopeAssignment
+	err := tx.Where("user_id = ? AND category_id = ? AND month = ?", userID, categoryID, month.Format(dateLayout)).First(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&models.EnvelopeAssignment{
+			UserID:     userID,
+			CategoryID: categoryID,
+			Month:      month,
+			Amount:     delta,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Model(&assignment).Update("amount_minor", gorm.Expr("amount_minor + ?", delta.Amount)).Error
+}
+
+// findEnvelopeCategory resolves an expense category the user can budget with.
+func findEnvelopeCategory(db *gorm.DB, userID uuid.UUID, id uuid.UUID) (*models.Category, bool) {
+	var category models.Category
+	if err := visibleCategories(db, userID).Where("id = ? AND category_type = ?", id, models.TransactionTypeExpense).First(&category).Error; err != nil {
+		return nil, false
+	}
+	return &category, true
+}
+
+// envelopeSummary works out every envelope for a month. Available money rolls
+// over: it is everything assigned to the envelope since envelopes were
+// switched on, less everything spent from it. Ready to assign is all income
+// received since then, less everything assigned up to this month.
+func envelopeSummary(db *gorm.DB, user *models.User, month time.Time) (envelopeSummaryResponse, error) {
+	currency := user.Currency()
+	start := models.MonthStart(*user.EnvelopeStart)
+	end := month.AddDate(0, 1, 0)
+	zero := models.NewMoney(0, currency)
+
+	summary := envelopeSummaryResponse{
+		Month:                 month.Format(monthLayout),
+		Income:                zero,
+		ReadyToAssign:         zero,
+		Assigned:              zero,
+		Activity:              zero,
+		Available:             zero,
+		UncategorizedActivity: zero,
+		Envelopes:             []envelopeResponse{},
+		MissingRatesFor:       []string{},
+	}
+
+	var assignments []models.EnvelopeAssignment
+	if err := db.Where("user_id = ? AND month >= ? AND month <= ?", user.ID, start.Format(dateLayout), month.Format(dateLayout)).Find(&assignments).Error; err != nil {
+		return summary, err
+	}
+
+	var rows []struct {
+		CategoryID *uuid.UUID
+		Type       string
+		Currency   string
+		Day        string
+		Total      models.Money
+	}
+	if err := db.Table("(?) AS category_lines", models.CategoryLines(db)).
+		Select("category_id, type, currency, DATE_FORMAT(date, '%Y-%m-%d') AS day, SUM(amount_minor) AS total").
+		Where("user_id = ? AND type IN ?", user.ID, []string{models.TransactionTypeIncome, models.TransactionTypeExpense}).
+		Where("date >= ? AND date < ?", start, end).
+		Group("category_id, type, currency, day").
+		Scan(&rows).Error; err != nil {
+		return summary, err
+	}
+
+	assignedTotal := map[uuid.UUID]models.Money{}
+	assignedMonth := map[uuid.UUID]models.Money{}
+	readyToAssign := zero
+	for _, assignment := range assignments {
+		amount := models.NewMoney(assignment.Amount.Amount, currency)
+		assignedTotal[assignment.CategoryID] = assignedTotal[assignment.CategoryID].Add(amount)
+		if assignment.Month.Format(monthLayout) == summary.Month {
+			assignedMonth[assignment.CategoryID] = assignedMonth[assignment.CategoryID].Add(amount)
+		}
+		readyToAssign = readyToAssign.Sub(amount)
+	}
+
+	converter := exchange.NewConverter(db, user.ID)
+	spentTotal := map[uuid.UUID]models.Money{}
+	spentMonth := map[uuid.UUID]models.Money{}
+	missing := map[string]bool{}
+	for _, row := range rows {
+		day, err := time.ParseInLocation(dateLayout, row.Day, time.Local)
+		if err != nil {
+			continue
+		}
+		amount, err := converter.Convert(models.NewMoney(row.Total.Amount, row.Currency), currency, day)
+		if err != nil {
+			missing[row.Currency] = true
+			continue
+		}
+
+		if row.Type == models.TransactionTypeIncome {
+			readyToAssign = readyToAssign.Add(amount)
+			if !day.Before(month) {
+				summary.Income = summary.Income.Add(amount)
+			}
+			continue
+		}
+
+		if row.CategoryID == nil {
+			if !day.Before(month) {
+				summary.UncategorizedActivity = summary.UncategorizedActivity.Sub(amount)
+			}
+			continue
+		}
+		spentTotal[*row.CategoryID] = spentTotal[*row.CategoryID].Add(amount)
+		if !day.Before(month) {
+			spentMonth[*row.CategoryID] = spentMonth[*row.CategoryID].Add(amount)
+		}
+	}
+	for missingCurrency := range missing {
+		summary.MissingRatesFor = append(summary.MissingRatesFor, missingCurrency)
+	}
+	sort.Strings(summary.MissingRatesFor)
+	summary.ReadyToAssign = models.NewMoney(readyToAssign.Amount, currency)
+
+	tree, err := models.LoadCategoryTree(db, user.ID)
+	if err != nil {
+		return summary, err
+	}
+
+	var visit func(categories []*models.Category)
+	visit = func(categories []*models.Category) {
+		for _, category := range categories {
+			if category.CategoryType != models.TransactionTypeExpense {
+				continue
+			}
+			assigned := models.NewMoney(assignedMonth[category.ID].Amount, currency)
+			activity := models.NewMoney(-spentMonth[category.ID].Amount, currency)
+			available := models.NewMoney(assignedTotal[category.ID].Amount-spentTotal[category.ID].Amount, currency)
+
+			// Archived envelopes only show up while they still hold money.
+			if category.ArchivedAt == nil || !available.IsZero() || !assigned.IsZero() {
+				summary.Envelopes = append(summary.Envelopes, envelopeResponse{
+					CategoryID: category.ID,
+					ParentID:   category.ParentID,
+					Name:       category.Name,
+					Assigned:   assigned,
+					Activity:   activity,
+					Available:  available,
+				})
+				summary.Assigned = summary.Assigned.Add(assigned)
+				summary.Activity = summary.Activity.Add(activity)
+				summary.Available = summary.Available.Add(available)
+			}
+			visit(tree.Children(category.ID))
+		}
+	}
+	visit(tree.Roots())
+
+	return summary, nil
+}
+
+func GetEnvelopeSummary(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		if !requireEnvelopes(w, user) {
+			return
+		}
+
+		month, err := parseMonth(r.URL.Query().Get("month"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid month",
+			})
+			return
+		}
+
+		summary, err := envelopeSummary(db, user, month)
+		if err != nil {
+			http.Error(w, "Failed to retrieve envelopes", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Envelopes successfully retrieved",
+			"data":        summary,
+		})
+	}
+}
+
+// AssignEnvelope sets how much is assigned to an envelope for a month. The
+// difference to the previous amount is audited as a move from or to the
+// ready to assign pool.
+func AssignEnvelope(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		if !requireEnvelopes(w, user) {
+			return
+		}
+
+		var assignRequest struct {
+			Month  string      `json:"month"`
+			Amount json.Number `json:"amount"`
+			Note   string      `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&assignRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		month, err := parseMonth(assignRequest.Month)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid month",
+			})
+			return
+		}
+
+		amount, err := models.ParseMoney(assignRequest.Amount.String(), user.Currency())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid amount",
+			})
+			return
+		}
+
+		categoryID, err := uuid.Parse(mux.Vars(r)["categoryId"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid category ID",
+			})
+			return
+		}
+		if _, found := findEnvelopeCategory(db, user.ID, categoryID); !found {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Expense category not found",
+			})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var current models.EnvelopeAssignment
+			previous := models.NewMoney(0, amount.Currency)
+			if err := tx.Where("user_id = ? AND category_id = ? AND month = ?", user.ID, categoryID, month.Format(dateLayout)).First(&current).Error; err == nil {
+				previous = models.NewMoney(current.Amount.Amount, amount.Currency)
+			}
+
+			delta := amount.Sub(previous)
+			if delta.IsZero() {
+				return nil
+			}
+			if err := addToEnvelope(tx, user.ID, categoryID, month, delta); err != nil {
+				return err
+			}
+
+			move := models.EnvelopeMove{UserID: user.ID, Month: month, ToCategoryID: &categoryID, Amount: delta, Note: assignRequest.Note}
+			if delta.IsNegative() {
+				move = models.EnvelopeMove{UserID: user.ID, Month: month, FromCategoryID: &categoryID, Amount: delta.Neg(), Note: assignRequest.Note}
+			}
+			return tx.Create(&move).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to assign envelope",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Envelope assigned successfully",
+			"data": map[string]interface{}{
+				"category_id": categoryID,
+				"month":       month.Format(monthLayout),
+				"assigned":    amount,
+			},
+		})
+	}
+}
+
+// MoveEnvelopeMoney moves money between two envelopes, or between an
+// envelope and the ready to assign pool when one side is null, and records
+// the move.
+func MoveEnvelopeMoney(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		if !requireEnvelopes(w, user) {
+			return
+		}
+
+		var moveRequest struct {
+			Month          string      `json:"month"`
+			FromCategoryID *uuid.UUID  `json:"from_category_id"`
+			ToCategoryID   *uuid.UUID  `json:"to_category_id"`
+			Amount         json.Number `json:"amount"`
+			Note           string      `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&moveRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		month, err := parseMonth(moveRequest.Month)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid month",
+			})
+			return
+		}
+
+		amount, err := models.ParseMoney(moveRequest.Amount.String(), user.Currency())
+		if err != nil || !amount.IsPositive() {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Amount must be greater than zero",
+			})
+			return
+		}
+
+		from, to := moveRequest.FromCategoryID, moveRequest.ToCategoryID
+		if (from == nil && to == nil) || (from != nil && to != nil && *from == *to) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Source and destination envelopes must differ",
+			})
+			return
+		}
+		for _, id := range []*uuid.UUID{from, to} {
+			if id == nil {
+				continue
+			}
+			if _, found := findEnvelopeCategory(db, user.ID, *id); !found {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusNotFound,
+					"message":     "Expense category not found",
+				})
+				return
+			}
+		}
+
+		move := models.EnvelopeMove{
+			UserID:         user.ID,
+			Month:          month,
+			FromCategoryID: from,
+			ToCategoryID:   to,
+			Amount:         amount,
+			Note:           moveRequest.Note,
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if from != nil {
+				if err := addToEnvelope(tx, user.ID, *from, month, amount.Neg()); err != nil {
+					return err
+				}
+			}
+			if to != nil {
+				if err := addToEnvelope(tx, user.ID, *to, month, amount); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&move).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to move envelope money",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Envelope money moved successfully",
+			"data":        newEnvelopeMoveResponse(move),
+		})
+	}
+}
+
+func newEnvelopeMoveResponse(move models.EnvelopeMove) envelopeMoveResponse {
+	return envelopeMoveResponse{
+		ID:             move.ID,
+		Month:          move.Month.Format(monthLayout),
+		FromCategoryID: move.FromCategoryID,
+		ToCategoryID:   move.ToCategoryID,
+		Amount:         move.Amount,
+		Note:           move.Note,
+		CreatedAt:      move.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// GetEnvelopeMoves lists the audit trail of a month, newest first.
+func GetEnvelopeMoves(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		if !requireEnvelopes(w, user) {
+			return
+		}
+
+		month, err := parseMonth(r.URL.Query().Get("month"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid month",
+			})
+			return
+		}
+
+		query := db.Where("user_id = ? AND month = ?", user.ID, month.Format(dateLayout))
+		if categoryID := r.URL.Query().Get("category_id"); categoryID != "" {
+			query = query.Where("from_category_id = ? OR to_category_id = ?", categoryID, categoryID)
+		}
+
+		var moves []models.EnvelopeMove
+		if err := query.Order("created_at DESC").Find(&moves).Error; err != nil {
+			http.Error(w, "Failed to retrieve envelope moves", http.StatusInternalServerError)
+			return
+		}
+
+		response := []envelopeMoveResponse{}
+		for _, move := range moves {
+			response = append(response, newEnvelopeMoveResponse(move))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                    `json:"status_code"`
+			Data       []envelopeMoveResponse `json:"data"`
+			Message    string                 `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Envelope moves successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/exchange"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const maxRateFileSize = 10 << 20
+
+type exchangeRateResponse struct {
+	ID            string `json:"id"`
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+	Rate          string `json:"rate"`
+	Date          string `json:"date"`
+	Source        string `json:"source"`
+	IsShared      bool   `json:"is_shared"`
+}
+
+func newExchangeRateResponse(rate models.ExchangeRate) exchangeRateResponse {
+	value := rate.Rate
+	if rat, ok := rate.Rat(); ok {
+		value = strings.TrimRight(strings.TrimRight(rat.FloatString(12), "0"), ".")
+	}
+	return exchangeRateResponse{
+		ID:            rate.ID.String(),
+		BaseCurrency:  rate.BaseCurrency,
+		QuoteCurrency: rate.QuoteCurrency,
+		Rate:          value,
+		Date:          rate.Date.Format(dateLayout),
+		Source:        rate.Source,
+		IsShared:      rate.UserID == nil,
+	}
+}
+
+func GetExchangeRates(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		query := db.Where("(user_id = ? OR user_id IS NULL)", middleware.CurrentUserID(r))
+		if base := params.Get("base"); base != "" {
+			query = query.Where("base_currency = ?", models.NormalizeCurrency(base))
+		}
+		if quote := params.Get("quote"); quote != "" {
+			query = query.Where("quote_currency = ?", models.NormalizeCurrency(quote))
+		}
+		if date := params.Get("date"); date != "" {
+			query = query.Where("date = ?", date)
+		}
+
+		var rates []models.ExchangeRate
+		if err := query.Order("date DESC, base_currency, quote_currency").Limit(500).Find(&rates).Error; err != nil {
+			http.Error(w, "Failed to retrieve exchange rates", http.StatusInternalServerError)
+			return
+		}
+
+		response := []exchangeRateResponse{}
+		for _, rate := range rates {
+			response = append(response, newExchangeRateResponse(rate))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                    `json:"status_code"`
+			Data       []exchangeRateResponse `json:"data"`
+			Message    string                 `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Exchange rates successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+// ConvertAmount previews a conversion with the rates the user would get.
+func ConvertAmount(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		from := models.NormalizeCurrency(params.Get("from"))
+		to := models.NormalizeCurrency(params.Get("to"))
+
+		amount, err := models.ParseMoney(params.Get("amount"), from)
+		if err != nil || !models.IsValidCurrency(from) || !models.IsValidCurrency(to) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Amount, from and to are required",
+			})
+			return
+		}
+
+		date := time.Now()
+		if value := params.Get("date"); value != "" {
+			if date, err = parseDate(value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid date",
+				})
+				return
+			}
+		}
+
+		converted, err := exchange.NewConverter(db, middleware.CurrentUserID(r)).Convert(amount, to, date)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "No exchange rate available for " + from + "/" + to,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Amount converted successfully",
+			"data": map[string]interface{}{
+				"amount":    amount,
+				"converted": converted,
+				"date":      date.Format(dateLayout),
+			},
+		})
+	}
+}
+
+func CreateExchangeRate(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rateRequest struct {
+			BaseCurrency  string      `json:"base_currency"`
+			QuoteCurrency string      `json:"quote_currency"`
+			Rate          json.Number `json:"rate"`
+			Date          string      `json:"date"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&rateRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		base := models.NormalizeCurrency(rateRequest.BaseCurrency)
+		quote := models.NormalizeCurrency(rateRequest.QuoteCurrency)
+		if !models.IsValidCurrency(base) || !models.IsValidCurrency(quote) || base == quote {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Two different ISO-4217 currency codes are required",
+			})
+			return
+		}
+
+		rate, err := models.ParseDecimal(rateRequest.Rate.String())
+		if err != nil || rate.Sign() <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Rate must be a positive number",
+			})
+			return
+		}
+
+		date := time.Now()
+		if rateRequest.Date != "" {
+			parsed, err := parseDate(rateRequest.Date)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid date",
+				})
+				return
+			}
+			date = parsed
+		}
+
+		userID := middleware.CurrentUserID(r)
+		quotes := []exchange.Quote{{Base: base, Quote: quote, Rate: rate.FloatString(12), Date: date}}
+		if _, err := exchange.SaveQuotes(db, &userID, quotes, models.ExchangeRateSourceManual); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to save exchange rate",
+			})
+			return
+		}
+
+		var saved models.ExchangeRate
+		db.Where("user_id = ? AND base_currency = ? AND quote_currency = ? AND date = ?", userID, base, quote, date.Format(dateLayout)).First(&saved)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Exchange rate saved successfully",
+			"data":        newExchangeRateResponse(saved),
+		})
+	}
+}
+
+func DeleteExchangeRate(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).Delete(&models.ExchangeRate{})
+		if result.Error != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete exchange rate",
+			})
+			return
+		}
+		if result.RowsAffected == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Exchange rate not found",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Exchange rate deleted successfully",
+		})
+	}
+}
+
+func ImportExchangeRates(db *gorm.DB) http.HandlerFunc {
+	return importExchangeRates(db, false)
+}
+
+func ImportSharedExchangeRates(db *gorm.DB) http.HandlerFunc {
+	return importExchangeRates(db, true)
+}
+
+// importExchangeRates loads an ECB reference rate file, CSV or XML, sent
+// either as the "file" field of a multipart form or as the raw request body.
+// Admins import shared rates; everyone else imports rates only they see.
+func importExchangeRates(db *gorm.DB, shared bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRateFileSize)
+		defer r.Body.Close()
+
+		var source io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "File is required",
+				})
+				return
+			}
+			defer file.Close()
+			source = file
+		}
+
+		quotes, err := exchange.ParseECB(source)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Unrecognised exchange rate file",
+			})
+			return
+		}
+
+		var owner *uuid.UUID
+		if !shared {
+			userID := middleware.CurrentUserID(r)
+			owner = &userID
+		}
+
+		var saved int
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var saveErr error
+			saved, saveErr = exchange.SaveQuotes(tx, owner, quotes, models.ExchangeRateSourceECB)
+			return saveErr
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to import exchange rates",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Exchange rates imported successfully",
+			"data": map[string]interface{}{
+				"parsed": len(quotes),
+				"saved":  saved,
+			},
+		})
+	}
+}
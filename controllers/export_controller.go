@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"expense-app-backend/export"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/plaintext"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// transactionExportRow is one transaction with the names it refers to, as
+// scanned from the export query.
+type transactionExportRow struct {
+	ID              string
+	Date            time.Time
+	Type            string
+	AmountMinor     int64
+	Currency        string
+	Note            string
+	TransferID      *string
+	AccountName     *string
+	CategoryName    *string
+	SplitCategories *string
+	PayeeName       *string
+	Tags            *string
+}
+
+type accountExportRow struct {
+	ID           string
+	Name         string
+	Currency     string
+	BalanceMinor int64
+	CreatedAt    time.Time
+}
+
+type categoryExportRow struct {
+	ID           string
+	Name         string
+	CategoryType string
+	ParentName   *string
+	UserID       *string
+	ArchivedAt   *time.Time
+}
+
+// startExport picks the format from ?format, CSV by default, and sets the
+// download headers. On failure the response has been written.
+func startExport(w http.ResponseWriter, r *http.Request, name string, columns []string) (export.Writer, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX && format != export.FormatNDJSON {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusBadRequest,
+			"message":     "Format must be csv, xlsx or ndjson",
+		})
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+"-"+time.Now().Format(dateLayout)+"."+format+`"`)
+	writer, err := export.New(format, w, columns)
+	if err != nil {
+		log.Printf("export %s: %v", name, err)
+		return nil, false
+	}
+	return writer, true
+}
+
+// streamExport runs the query and writes one row per result, never holding
+// more than one row in memory. Once the file has started a failure can
+// only be logged; the client sees a truncated file.
+func streamExport(w http.ResponseWriter, r *http.Request, name string, columns []string, query *gorm.DB, cells func(*sql.Rows) ([]interface{}, error)) {
+	rows, err := query.Rows()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusInternalServerError,
+			"message":     "Failed to export " + name,
+		})
+		return
+	}
+	defer rows.Close()
+
+	writer, ok := startExport(w, r, name, columns)
+	if !ok {
+		return
+	}
+	for err == nil && rows.Next() {
+		var row []interface{}
+		if row, err = cells(rows); err == nil {
+			err = writer.Row(row...)
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Printf("export %s: %v", name, err)
+	}
+}
+
+// optional turns a nullable column into a cell.
+func optional(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// ExportTransactions streams the transactions matching the same filters as
+// the transaction list. Amounts are signed: money leaving the account is
+// negative. Split transactions list their split categories.
+func ExportTransactions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filtered, statusCode, message := filterTransactions(db, middleware.CurrentUserID(r), r.URL.Query())
+		if filtered == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		query := db.Table("(?) AS t", filtered).
+			Select(`t.id, t.date, t.type, t.amount_minor, t.currency, t.note, t.transfer_id,
+				accounts.name AS account_name, categories.name AS category_name, payees.name AS payee_name,
+				(SELECT GROUP_CONCAT(split_categories.name ORDER BY transaction_splits.position SEPARATOR ', ')
+					FROM transaction_splits JOIN categories split_categories ON split_categories.id = transaction_splits.category_id
+					WHERE transaction_splits.transaction_id = t.id) AS split_categories,
+				(SELECT GROUP_CONCAT(tags.name ORDER BY tags.name SEPARATOR ', ')
+					FROM transaction_tags JOIN tags ON tags.id = transaction_tags.tag_id
+					WHERE transaction_tags.transaction_id = t.id) AS tags`).
+			Joins("LEFT JOIN accounts ON accounts.id = t.account_id").
+			Joins("LEFT JOIN categories ON categories.id = t.category_id").
+			Joins("LEFT JOIN payees ON payees.id = t.payee_id").
+			Order("t.date, t.created_at")
+
+		columns := []string{"id", "date", "type", "account", "category", "payee", "amount", "currency", "note", "tags", "transfer_id"}
+		streamExport(w, r, "transactions", columns, query, func(rows *sql.Rows) ([]interface{}, error) {
+			var row transactionExportRow
+			if err := db.ScanRows(rows, &row); err != nil {
+				return nil, err
+			}
+			transaction := models.Transaction{Type: row.Type, Amount: models.NewMoney(row.AmountMinor, row.Currency)}
+			category := row.CategoryName
+			if category == nil {
+				category = row.SplitCategories
+			}
+			return []interface{}{
+				row.ID,
+				row.Date.Format(dateLayout),
+				row.Type,
+				optional(row.AccountName),
+				optional(category),
+				optional(row.PayeeName),
+				export.Number(transaction.SignedAmount().Decimal()),
+				row.Currency,
+				row.Note,
+				optional(row.Tags),
+				optional(row.TransferID),
+			}, nil
+		})
+	}
+}
+
+// ExportAccounts streams the user's accounts with their balances.
+func ExportAccounts(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := db.Model(&models.Account{}).
+			Select("id, name, currency, balance_minor, created_at").
+			Where("user_id = ?", middleware.CurrentUserID(r)).
+			Order("name")
+
+		columns := []string{"id", "name", "currency", "balance", "created_at"}
+		streamExport(w, r, "accounts", columns, query, func(rows *sql.Rows) ([]interface{}, error) {
+			var row accountExportRow
+			if err := db.ScanRows(rows, &row); err != nil {
+				return nil, err
+			}
+			return []interface{}{
+				row.ID,
+				row.Name,
+				row.Currency,
+				export.Number(models.NewMoney(row.BalanceMinor, row.Currency).Decimal()),
+				row.CreatedAt.Format(time.RFC3339),
+			}, nil
+		})
+	}
+}
+
+// ExportCategories streams the categories the user sees, the global
+// defaults included, with the name of each parent.
+func ExportCategories(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		visible := visibleCategories(db.Model(&models.Category{}), middleware.CurrentUserID(r))
+		query := db.Table("(?) AS c", visible).
+			Select("c.id, c.name, c.category_type, c.user_id, c.archived_at, parents.name AS parent_name").
+			Joins("LEFT JOIN categories parents ON parents.id = c.parent_id").
+			Order("c.category_type, parents.name, c.position, c.name")
+
+		columns := []string{"id", "name", "type", "parent", "global", "archived"}
+		streamExport(w, r, "categories", columns, query, func(rows *sql.Rows) ([]interface{}, error) {
+			var row categoryExportRow
+			if err := db.ScanRows(rows, &row); err != nil {
+				return nil, err
+			}
+			global, archived := "no", "no"
+			if row.UserID == nil {
+				global = "yes"
+			}
+			if row.ArchivedAt != nil {
+				archived = "yes"
+			}
+			return []interface{}{row.ID, row.Name, row.CategoryType, optional(row.ParentName), global, archived}, nil
+		})
+	}
+}
+
+// journalExtensions are the usual file extensions of the plain-text formats.
+var journalExtensions = map[string]string{
+	plaintext.FormatBeancount: "beancount",
+	plaintext.FormatLedger:    "ledger",
+	plaintext.FormatHledger:   "journal",
+}
+
+// ExportJournal renders the double-entry journal for Beancount, ledger-cli
+// or hledger, picked with ?format. ?from and ?to limit the dates; a partial
+// export still balances but leaves out the opening balances before it.
+func ExportJournal(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		params := r.URL.Query()
+
+		format := params.Get("format")
+		if format == "" {
+			format = plaintext.FormatBeancount
+		}
+		extension, found := journalExtensions[format]
+		if !found {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Format must be beancount, ledger or hledger",
+			})
+			return
+		}
+
+		options := plaintext.Options{UserID: user.ID, Currency: user.Currency()}
+		for name, target := range map[string]**time.Time{"from": &options.From, "to": &options.To} {
+			value := params.Get(name)
+			if value == "" {
+				continue
+			}
+			date, err := parseDate(value)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid " + name + " date",
+				})
+				return
+			}
+			*target = &date
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="journal-`+time.Now().Format(dateLayout)+"."+extension+`"`)
+		if err := plaintext.Write(db, w, format, options); err != nil {
+			log.Printf("export journal: %v", err)
+		}
+	}
+}
@@ -0,0 +1,613 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-app-backend/importer"
+	"expense-app-backend/ledger"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/rules"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const maxImportFileSize = 10 << 20
+
+// statementUpload is a parsed statement file, checked for duplicates
+// against the account it is imported into.
+type statementUpload struct {
+	Account   models.Account
+	Filename  string
+	ProfileID *uuid.UUID
+	Rows      []importer.Checked
+}
+
+type importRowResponse struct {
+	Line        int           `json:"line"`
+	Date        *string       `json:"date,omitempty"`
+	Type        string        `json:"type,omitempty"`
+	Amount      *models.Money `json:"amount,omitempty"`
+	Description string        `json:"description"`
+	Payee       string        `json:"payee"`
+	Category    string        `json:"category,omitempty"`
+	ExternalID  string        `json:"external_id,omitempty"`
+	Status      string        `json:"status"`
+	DuplicateOf *uuid.UUID    `json:"duplicate_of,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+type importBatchResponse struct {
+	ID        string     `json:"id"`
+	AccountID string     `json:"account_id"`
+	ProfileID *uuid.UUID `json:"profile_id"`
+	Format    string     `json:"format"`
+	Filename  string     `json:"filename"`
+	Imported  int        `json:"imported"`
+	Skipped   int        `json:"skipped"`
+	UndoneAt  *string    `json:"undone_at"`
+	CreatedAt string     `json:"created_at"`
+}
+
+func newImportRowResponse(row importer.Checked) importRowResponse {
+	response := importRowResponse{
+		Line:        row.Line,
+		Description: row.Description,
+		Payee:       row.Payee,
+		Category:    row.Category,
+		ExternalID:  row.ExternalID,
+		Status:      row.Status,
+		DuplicateOf: row.DuplicateOf,
+		Error:       row.Error,
+	}
+	if row.Error == "" {
+		date := row.Date.Format(dateLayout)
+		amount := row.Amount
+		response.Date = &date
+		response.Type = row.Type
+		response.Amount = &amount
+	}
+	return response
+}
+
+func newImportBatchResponse(batch models.ImportBatch) importBatchResponse {
+	var undoneAt *string
+	if batch.UndoneAt != nil {
+		value := batch.UndoneAt.Format(time.RFC3339)
+		undoneAt = &value
+	}
+	return importBatchResponse{
+		ID:        batch.ID.String(),
+		AccountID: batch.AccountID.String(),
+		ProfileID: batch.ProfileID,
+		Format:    batch.Format,
+		Filename:  batch.Filename,
+		Imported:  batch.Imported,
+		Skipped:   batch.Skipped,
+		UndoneAt:  undoneAt,
+		CreatedAt: batch.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// readStatement reads the multipart form every import takes: the statement
+// as "file" and the "account_id" to import into. parse turns the file into
+// rows, which are then checked for duplicates. On failure the response has
+// been written.
+func readStatement(db *gorm.DB, w http.ResponseWriter, r *http.Request, parse func(io.Reader, *models.Account) ([]importer.Row, int, string)) (*statementUpload, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize)
+	defer r.Body.Close()
+
+	fail := func(statusCode int, message string) (*statementUpload, bool) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": statusCode,
+			"message":     message,
+		})
+		return nil, false
+	}
+
+	if err := r.ParseMultipartForm(maxImportFileSize); err != nil {
+		return fail(http.StatusBadRequest, "Invalid upload")
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return fail(http.StatusBadRequest, "File is required")
+	}
+	defer file.Close()
+
+	var account models.Account
+	if err := db.Where("id = ? AND user_id = ?", r.FormValue("account_id"), middleware.CurrentUserID(r)).First(&account).Error; err != nil {
+		return fail(http.StatusNotFound, "Account not found")
+	}
+
+	rows, statusCode, message := parse(file, &account)
+	if rows == nil {
+		return fail(statusCode, message)
+	}
+
+	checked, err := importer.Check(db, account.ID, rows)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "Failed to check for duplicates")
+	}
+	return &statementUpload{Account: account, Filename: header.Filename, Rows: checked}, true
+}
+
+// readCSVStatement reads a CSV upload with the saved profile named by
+// "profile_id", or with the column mapping sent as JSON in "mapping".
+func readCSVStatement(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*statementUpload, bool) {
+	var profileID *uuid.UUID
+	upload, ok := readStatement(db, w, r, func(file io.Reader, account *models.Account) ([]importer.Row, int, string) {
+		var profile models.ImportProfile
+		switch {
+		case r.FormValue("profile_id") != "":
+			if err := db.Where("id = ? AND user_id = ?", r.FormValue("profile_id"), account.UserID).First(&profile).Error; err != nil {
+				return nil, http.StatusNotFound, "Import profile not found"
+			}
+			profileID = &profile.ID
+		case r.FormValue("mapping") != "":
+			var request importProfileRequest
+			if err := json.Unmarshal([]byte(r.FormValue("mapping")), &request); err != nil {
+				return nil, http.StatusBadRequest, "Invalid mapping"
+			}
+			mapped, statusCode, message := request.toProfile(account.UserID)
+			if mapped == nil {
+				return nil, statusCode, message
+			}
+			profile = *mapped
+		default:
+			return nil, http.StatusBadRequest, "profile_id or mapping is required"
+		}
+
+		rows, err := importer.ParseCSV(file, profile, account.Currency)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Could not read CSV: " + err.Error()
+		}
+		return rows, 0, ""
+	})
+	if ok {
+		upload.ProfileID = profileID
+	}
+	return upload, ok
+}
+
+// readOFXStatement reads an OFX or QFX upload. Rows keep the bank's FITID so
+// transactions downloaded again are recognised.
+func readOFXStatement(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*statementUpload, bool) {
+	return readStatement(db, w, r, func(file io.Reader, account *models.Account) ([]importer.Row, int, string) {
+		rows, err := importer.ParseOFX(file, account.Currency)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Could not read OFX: " + err.Error()
+		}
+		return rows, 0, ""
+	})
+}
+
+// readQIFStatement reads a QIF upload. "date_format" gives the order of the
+// date parts, e.g. DD/MM/YYYY, and "decimal_separator" and "encoding" work
+// as in a CSV mapping.
+func readQIFStatement(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*statementUpload, bool) {
+	return readStatement(db, w, r, func(file io.Reader, account *models.Account) ([]importer.Row, int, string) {
+		rows, err := importer.ParseQIF(file, r.FormValue("date_format"), r.FormValue("decimal_separator"), r.FormValue("encoding"), account.Currency)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Could not read QIF: " + err.Error()
+		}
+		return rows, 0, ""
+	})
+}
+
+// importCategory finds the visible category a statement names, such as a
+// QIF "Food:Groceries", by its full name or else by its last part. Names
+// that do not match, or match a category of the other type, are ignored.
+// categories caches the lookups of this import.
+func importCategory(tx *gorm.DB, categories map[string]*models.Category, userID uuid.UUID, name, transactionType string) (*uuid.UUID, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.HasPrefix(name, "[") {
+		// [Account] is a QIF transfer, not a category.
+		return nil, nil
+	}
+
+	candidates := []string{name}
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		candidates = append(candidates, strings.TrimSpace(name[i+1:]))
+	}
+	for _, candidate := range candidates {
+		key := strings.ToLower(candidate) + "|" + transactionType
+		category, found := categories[key]
+		if !found {
+			var match models.Category
+			err := visibleCategories(tx, userID).
+				Where("LOWER(name) = ? AND category_type = ? AND archived_at IS NULL", strings.ToLower(candidate), transactionType).
+				Order("user_id IS NULL, created_at").
+				First(&match).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				category = &match
+			}
+			categories[key] = category
+		}
+		if category != nil {
+			return &category.ID, nil
+		}
+	}
+	return nil, nil
+}
+
+// importPayee resolves a payee name from a statement, creating the payee the
+// first time it is seen. payees caches the names already resolved in this
+// import.
+func importPayee(tx *gorm.DB, payees map[string]*models.Payee, userID uuid.UUID, name string) (*models.Payee, error) {
+	key := models.PayeeKey(name)
+	if key == "" {
+		return nil, nil
+	}
+	if payee, found := payees[key]; found {
+		return payee, nil
+	}
+
+	payee, err := models.FindPayee(tx, userID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		payee = &models.Payee{ID: uuid.New(), UserID: userID, Name: strings.Join(strings.Fields(name), " ")}
+	} else if err != nil {
+		return nil, err
+	}
+	payees[key] = payee
+	return payee, nil
+}
+
+// commitStatement books rows into the account as one import batch, in one
+// database transaction. A category named in the file comes first, then
+// payee defaults and the user's rules fill in the rest. Every transaction
+// is posted to the ledger.
+func commitStatement(db *gorm.DB, format string, upload *statementUpload, rows []importer.Checked) (*models.ImportBatch, error) {
+	userID := upload.Account.UserID
+	engine, err := rules.Load(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &models.ImportBatch{
+		UserID:    userID,
+		AccountID: upload.Account.ID,
+		ProfileID: upload.ProfileID,
+		Format:    format,
+		Filename:  upload.Filename,
+		Imported:  len(rows),
+		Skipped:   len(upload.Rows) - len(rows),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+
+		payees := map[string]*models.Payee{}
+		categories := map[string]*models.Category{}
+		for _, row := range rows {
+			transaction := &models.Transaction{
+				UserID:        userID,
+				AccountID:     upload.Account.ID,
+				Type:          row.Type,
+				Amount:        row.Amount,
+				Currency:      row.Amount.Currency,
+				Date:          row.Date,
+				Note:          row.Description,
+				ImportBatchID: &batch.ID,
+				ImportHash:    row.Hash,
+			}
+
+			categoryID, err := importCategory(tx, categories, userID, row.Category, row.Type)
+			if err != nil {
+				return err
+			}
+			transaction.CategoryID = categoryID
+
+			payee, err := importPayee(tx, payees, userID, row.Payee)
+			if err != nil {
+				return err
+			}
+			payeeName := ""
+			if payee != nil {
+				payeeName = payee.Name
+				transaction.PayeeID = &payee.ID
+				if transaction.CategoryID == nil && payee.DefaultCategoryID != nil {
+					if statusCode, _ := checkTransactionCategory(tx, userID, *payee.DefaultCategoryID, row.Type); statusCode == 0 {
+						transaction.CategoryID = payee.DefaultCategoryID
+					}
+				}
+			}
+			tagIDs := rules.Fill(transaction, engine.Evaluate(rules.SubjectOf(transaction, payeeName)))
+
+			if err := usePayee(tx, payee, transaction); err != nil {
+				return err
+			}
+			if err := tx.Create(transaction).Error; err != nil {
+				return err
+			}
+			if _, err := tagTransactions(tx, []uuid.UUID{transaction.ID}, tagIDs); err != nil {
+				return err
+			}
+			if err := ledger.RecordTransaction(tx, transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// writeImportPreview sends the parsed rows with their duplicate status and
+// how many rows have each status.
+func writeImportPreview(w http.ResponseWriter, upload *statementUpload) {
+	rows := []importRowResponse{}
+	summary := map[string]int{
+		importer.StatusNew:               0,
+		importer.StatusDuplicate:         0,
+		importer.StatusPossibleDuplicate: 0,
+		importer.StatusInvalid:           0,
+	}
+	for _, row := range upload.Rows {
+		rows = append(rows, newImportRowResponse(row))
+		summary[row.Status]++
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status_code": http.StatusOK,
+		"message":     "Statement parsed successfully",
+		"data":        rows,
+		"summary":     summary,
+	})
+}
+
+// writeImportCommit books the rows that are new, plus possible duplicates
+// when "include_possible_duplicates" is true, leaving out the line numbers
+// listed in "skip_lines".
+func writeImportCommit(db *gorm.DB, w http.ResponseWriter, r *http.Request, format string, upload *statementUpload) {
+	includePossible := r.FormValue("include_possible_duplicates") == "true"
+	skip := map[int]bool{}
+	for _, value := range strings.Split(r.FormValue("skip_lines"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		line, err := strconv.Atoi(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid skip_lines",
+			})
+			return
+		}
+		skip[line] = true
+	}
+
+	var rows []importer.Checked
+	for _, row := range upload.Rows {
+		if skip[row.Line] {
+			continue
+		}
+		if row.Status == importer.StatusNew || (includePossible && row.Status == importer.StatusPossibleDuplicate) {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusBadRequest,
+			"message":     "Nothing to import",
+		})
+		return
+	}
+
+	batch, err := commitStatement(db, format, upload, rows)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusInternalServerError,
+			"message":     "Failed to import transactions",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status_code": http.StatusCreated,
+		"message":     "Transactions imported successfully",
+		"data":        newImportBatchResponse(*batch),
+	})
+}
+
+// PreviewCSVImport parses a CSV statement and shows every row with its
+// duplicate status, without saving anything.
+func PreviewCSVImport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upload, ok := readCSVStatement(db, w, r)
+		if !ok {
+			return
+		}
+		writeImportPreview(w, upload)
+	}
+}
+
+// ImportCSV parses a CSV statement again and books its new rows into the
+// account as one import batch.
+func ImportCSV(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upload, ok := readCSVStatement(db, w, r)
+		if !ok {
+			return
+		}
+		writeImportCommit(db, w, r, models.ImportFormatCSV, upload)
+	}
+}
+
+// PreviewOFXImport parses an OFX or QFX statement and shows every row with
+// its duplicate status, without saving anything.
+func PreviewOFXImport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upload, ok := readOFXStatement(db, w, r)
+		if !ok {
+			return
+		}
+		writeImportPreview(w, upload)
+	}
+}
+
+// ImportOFX books the new transactions of an OFX or QFX statement into the
+// account as one import batch.
+func ImportOFX(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upload, ok := readOFXStatement(db, w, r)
+		if !ok {
+			return
+		}
+		writeImportCommit(db, w, r, models.ImportFormatOFX, upload)
+	}
+}
+
+// PreviewQIFImport parses a QIF export and shows every row with its
+// duplicate status, without saving anything.
+func PreviewQIFImport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upload, ok := readQIFStatement(db, w, r)
+		if !ok {
+			return
+		}
+		writeImportPreview(w, upload)
+	}
+}
+
+// ImportQIF books the new transactions of a QIF export into the account as
+// one import batch.
+func ImportQIF(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upload, ok := readQIFStatement(db, w, r)
+		if !ok {
+			return
+		}
+		writeImportCommit(db, w, r, models.ImportFormatQIF, upload)
+	}
+}
+
+func findOwnedImportBatch(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.ImportBatch, bool) {
+	var batch models.ImportBatch
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&batch).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Import not found",
+		})
+		return nil, false
+	}
+	return &batch, true
+}
+
+func GetImports(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var batches []models.ImportBatch
+		if err := db.Where("user_id = ?", middleware.CurrentUserID(r)).Order("created_at DESC").Find(&batches).Error; err != nil {
+			http.Error(w, "Failed to retrieve imports", http.StatusInternalServerError)
+			return
+		}
+
+		response := []importBatchResponse{}
+		for _, batch := range batches {
+			response = append(response, newImportBatchResponse(batch))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                   `json:"status_code"`
+			Data       []importBatchResponse `json:"data"`
+			Message    string                `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Imports successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetImportById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batch, ok := findOwnedImportBatch(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Import successfully retrieved",
+			"data":        newImportBatchResponse(*batch),
+		})
+	}
+}
+
+// UndoImport deletes every transaction an import created, including ones
+// edited since, and takes them off the ledger.
+func UndoImport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batch, ok := findOwnedImportBatch(db, w, r)
+		if !ok {
+			return
+		}
+		if batch.UndoneAt != nil {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "Import has already been undone",
+			})
+			return
+		}
+
+		var removed int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var transactions []models.Transaction
+			if err := tx.Where("import_batch_id = ?", batch.ID).Find(&transactions).Error; err != nil {
+				return err
+			}
+			for i := range transactions {
+				if err := tx.Delete(&transactions[i]).Error; err != nil {
+					return err
+				}
+				if err := ledger.Remove(tx, models.JournalSourceTransaction, transactions[i].ID); err != nil {
+					return err
+				}
+			}
+			removed = len(transactions)
+			return tx.Model(batch).Update("undone_at", time.Now()).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to undo import",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Import undone successfully",
+			"removed":     removed,
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/importer"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// importProfileRequest is a CSV column mapping. It is saved as a profile, or
+// sent inline with an import as the "mapping" form field.
+type importProfileRequest struct {
+	Name              string `json:"name"`
+	Delimiter         string `json:"delimiter"`
+	HasHeader         *bool  `json:"has_header"`
+	SkipRows          int    `json:"skip_rows"`
+	Encoding          string `json:"encoding"`
+	DateColumn        string `json:"date_column"`
+	DateFormat        string `json:"date_format"`
+	DescriptionColumn string `json:"description_column"`
+	PayeeColumn       string `json:"payee_column"`
+	AmountColumn      string `json:"amount_column"`
+	DebitColumn       string `json:"debit_column"`
+	CreditColumn      string `json:"credit_column"`
+	DecimalSeparator  string `json:"decimal_separator"`
+	InvertSign        bool   `json:"invert_sign"`
+}
+
+type importProfileResponse struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Delimiter         string `json:"delimiter"`
+	HasHeader         bool   `json:"has_header"`
+	SkipRows          int    `json:"skip_rows"`
+	Encoding          string `json:"encoding"`
+	DateColumn        string `json:"date_column"`
+	DateFormat        string `json:"date_format"`
+	DescriptionColumn string `json:"description_column"`
+	PayeeColumn       string `json:"payee_column"`
+	AmountColumn      string `json:"amount_column"`
+	DebitColumn       string `json:"debit_column"`
+	CreditColumn      string `json:"credit_column"`
+	DecimalSeparator  string `json:"decimal_separator"`
+	InvertSign        bool   `json:"invert_sign"`
+	CreatedAt         string `json:"created_at"`
+	UpdatedAt         string `json:"updated_at"`
+}
+
+func newImportProfileResponse(profile models.ImportProfile) importProfileResponse {
+	return importProfileResponse{
+		ID:                profile.ID.String(),
+		Name:              profile.Name,
+		Delimiter:         profile.Delimiter,
+		HasHeader:         profile.HasHeader,
+		SkipRows:          profile.SkipRows,
+		Encoding:          profile.Encoding,
+		DateColumn:        profile.DateColumn,
+		DateFormat:        profile.DateFormat,
+		DescriptionColumn: profile.DescriptionColumn,
+		PayeeColumn:       profile.PayeeColumn,
+		AmountColumn:      profile.AmountColumn,
+		DebitColumn:       profile.DebitColumn,
+		CreditColumn:      profile.CreditColumn,
+		DecimalSeparator:  profile.DecimalSeparator,
+		InvertSign:        profile.InvertSign,
+		CreatedAt:         profile.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         profile.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toProfile fills in the defaults and checks the mapping. The name is only
+// checked by the handlers that save the profile. On failure it returns the
+// status code and message to send back.
+func (in *importProfileRequest) toProfile(userID uuid.UUID) (*models.ImportProfile, int, string) {
+	profile := &models.ImportProfile{
+		UserID:            userID,
+		Name:              in.Name,
+		Delimiter:         in.Delimiter,
+		HasHeader:         in.HasHeader == nil || *in.HasHeader,
+		SkipRows:          in.SkipRows,
+		Encoding:          in.Encoding,
+		DateColumn:        in.DateColumn,
+		DateFormat:        in.DateFormat,
+		DescriptionColumn: in.DescriptionColumn,
+		PayeeColumn:       in.PayeeColumn,
+		AmountColumn:      in.AmountColumn,
+		DebitColumn:       in.DebitColumn,
+		CreditColumn:      in.CreditColumn,
+		DecimalSeparator:  in.DecimalSeparator,
+		InvertSign:        in.InvertSign,
+	}
+	if profile.Delimiter == "" {
+		profile.Delimiter = ","
+	}
+	if profile.Encoding == "" {
+		profile.Encoding = "utf-8"
+	}
+	if profile.DateFormat == "" {
+		profile.DateFormat = "YYYY-MM-DD"
+	}
+	if profile.DecimalSeparator == "" {
+		profile.DecimalSeparator = "."
+	}
+	if err := importer.CheckProfile(*profile); err != nil {
+		return nil, http.StatusBadRequest, "Invalid mapping: " + err.Error()
+	}
+	return profile, 0, ""
+}
+
+func findOwnedImportProfile(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.ImportProfile, bool) {
+	var profile models.ImportProfile
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&profile).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Import profile not found",
+		})
+		return nil, false
+	}
+	return &profile, true
+}
+
+func GetImportProfiles(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var profiles []models.ImportProfile
+		if err := db.Where("user_id = ?", middleware.CurrentUserID(r)).Order("name").Find(&profiles).Error; err != nil {
+			http.Error(w, "Failed to retrieve import profiles", http.StatusInternalServerError)
+			return
+		}
+
+		response := []importProfileResponse{}
+		for _, profile := range profiles {
+			response = append(response, newImportProfileResponse(profile))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                     `json:"status_code"`
+			Data       []importProfileResponse `json:"data"`
+			Message    string                  `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Import profiles successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetImportProfileById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile, ok := findOwnedImportProfile(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Import profile successfully retrieved",
+			"data":        newImportProfileResponse(*profile),
+		})
+	}
+}
+
+func CreateImportProfile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request importProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		if request.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Name is required",
+			})
+			return
+		}
+
+		profile, statusCode, message := request.toProfile(middleware.CurrentUserID(r))
+		if profile == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		if err := db.Create(profile).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create import profile",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Import profile created successfully",
+			"data":        newImportProfileResponse(*profile),
+		})
+	}
+}
+
+func UpdateImportProfile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request importProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedImportProfile(db, w, r)
+		if !ok {
+			return
+		}
+
+		if request.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Name is required",
+			})
+			return
+		}
+
+		updated, statusCode, message := request.toProfile(existing.UserID)
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		if err := db.Model(existing).Updates(map[string]interface{}{
+			"name":               updated.Name,
+			"delimiter":          updated.Delimiter,
+			"has_header":         updated.HasHeader,
+			"skip_rows":          updated.SkipRows,
+			"encoding":           updated.Encoding,
+			"date_column":        updated.DateColumn,
+			"date_format":        updated.DateFormat,
+			"description_column": updated.DescriptionColumn,
+			"payee_column":       updated.PayeeColumn,
+			"amount_column":      updated.AmountColumn,
+			"debit_column":       updated.DebitColumn,
+			"credit_column":      updated.CreditColumn,
+			"decimal_separator":  updated.DecimalSeparator,
+			"invert_sign":        updated.InvertSign,
+		}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update import profile",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Import profile updated successfully",
+			"data":        newImportProfileResponse(*existing),
+		})
+	}
+}
+
+func DeleteImportProfile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile, ok := findOwnedImportProfile(db, w, r)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.ImportBatch{}).Where("profile_id = ?", profile.ID).Update("profile_id", nil).Error; err != nil {
+				return err
+			}
+			return tx.Delete(profile).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete import profile",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Import profile deleted successfully",
+		})
+	}
+}
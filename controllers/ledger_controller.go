@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/ledger"
+	"expense-app-backend/middleware"
+	"net/http"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func CheckLedger(db *gorm.DB) http.HandlerFunc {
+	return checkLedger(db, false)
+}
+
+func CheckAllLedgers(db *gorm.DB) http.HandlerFunc {
+	return checkLedger(db, true)
+}
+
+// checkLedger reports accounts whose cached balance drifted from the journal,
+// entries that do not balance and records that were never booked.
+func checkLedger(db *gorm.DB, all bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var userID *uuid.UUID
+		if !all {
+			id := middleware.CurrentUserID(r)
+			userID = &id
+		}
+
+		report, err := ledger.Check(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to check ledger", http.StatusInternalServerError)
+			return
+		}
+
+		message := "Ledger is consistent"
+		if !report.Consistent() {
+			message = "Ledger inconsistencies found"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     message,
+			"data":        report,
+		})
+	}
+}
+
+// RepairLedger resets drifting cached balances to the journal's balances.
+func RepairLedger(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repaired, err := ledger.Repair(db, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to repair ledger",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Cached balances repaired successfully",
+			"data": map[string]interface{}{
+				"accounts_repaired": repaired,
+			},
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const maxPayeeSuggestions = 50
+
+type payeeRequest struct {
+	Name              string     `json:"name"`
+	DefaultCategoryID *uuid.UUID `json:"default_category_id"`
+	DefaultAccountID  *uuid.UUID `json:"default_account_id"`
+	Aliases           []string   `json:"aliases"`
+}
+
+type payeeResponse struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	DefaultCategoryID *uuid.UUID `json:"default_category_id"`
+	DefaultAccountID  *uuid.UUID `json:"default_account_id"`
+	Aliases           []aliasRef `json:"aliases"`
+	UsageCount        int64      `json:"usage_count"`
+	LastUsedAt        *string    `json:"last_used_at"`
+	CreatedAt         string     `json:"created_at"`
+	UpdatedAt         string     `json:"updated_at"`
+}
+
+type aliasRef struct {
+	ID    uuid.UUID `json:"id"`
+	Alias string    `json:"alias"`
+}
+
+// payeeSuggestion is a payee with what a client needs to prefill a new
+// transaction.
+type payeeSuggestion struct {
+	payeeResponse
+	Category *categoryRef `json:"category"`
+	Score    float64      `json:"score"`
+}
+
+type categoryRef struct {
+	ID           uuid.UUID  `json:"id"`
+	ParentID     *uuid.UUID `json:"parent_id"`
+	Name         string     `json:"name"`
+	CategoryType string     `json:"category_type"`
+}
+
+func newPayeeResponse(payee models.Payee) payeeResponse {
+	var lastUsedAt *string
+	if payee.LastUsedAt != nil {
+		value := payee.LastUsedAt.Format(time.RFC3339)
+		lastUsedAt = &value
+	}
+	aliases := []aliasRef{}
+	for _, alias := range payee.Aliases {
+		aliases = append(aliases, aliasRef{ID: alias.ID, Alias: alias.Alias})
+	}
+	return payeeResponse{
+		ID:                payee.ID.String(),
+		Name:              payee.Name,
+		DefaultCategoryID: payee.DefaultCategoryID,
+		DefaultAccountID:  payee.DefaultAccountID,
+		Aliases:           aliases,
+		UsageCount:        payee.UsageCount,
+		LastUsedAt:        lastUsedAt,
+		CreatedAt:         payee.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         payee.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toPayee validates the request. On failure it returns the status code and
+// message to send back.
+func (in *payeeRequest) toPayee(db *gorm.DB, userID uuid.UUID) (*models.Payee, int, string) {
+	name := strings.Join(strings.Fields(in.Name), " ")
+	if name == "" || len(name) > 255 {
+		return nil, http.StatusBadRequest, "Name is required and may be at most 255 characters"
+	}
+
+	if in.DefaultCategoryID != nil {
+		var category models.Category
+		if err := visibleCategories(db, userID).Where("id = ?", *in.DefaultCategoryID).First(&category).Error; err != nil {
+			return nil, http.StatusNotFound, "Category not found"
+		}
+	}
+	if in.DefaultAccountID != nil {
+		var account models.Account
+		if err := db.Where("id = ? AND user_id = ?", *in.DefaultAccountID, userID).First(&account).Error; err != nil {
+			return nil, http.StatusNotFound, "Account not found"
+		}
+	}
+
+	return &models.Payee{
+		UserID:            userID,
+		Name:              name,
+		NameKey:           models.PayeeKey(name),
+		DefaultCategoryID: in.DefaultCategoryID,
+		DefaultAccountID:  in.DefaultAccountID,
+	}, 0, ""
+}
+
+// payeeNameConflict reports whether a name is already used by another of the
+// user's payees, either as its name or as an alias.
+func payeeNameConflict(db *gorm.DB, userID, payeeID uuid.UUID, name string) bool {
+	key := models.PayeeKey(name)
+	var count int64
+	db.Model(&models.Payee{}).Where("user_id = ? AND name_key = ? AND id <> ?", userID, key, payeeID).Count(&count)
+	if count > 0 {
+		return true
+	}
+	db.Model(&models.PayeeAlias{}).Where("user_id = ? AND alias_key = ? AND payee_id <> ?", userID, key, payeeID).Count(&count)
+	return count > 0
+}
+
+func findOwnedPayee(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Payee, bool) {
+	var payee models.Payee
+	if err := db.Preload("Aliases").Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&payee).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Payee not found",
+		})
+		return nil, false
+	}
+	return &payee, true
+}
+
+func GetPayees(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payees []models.Payee
+		if err := db.Preload("Aliases").Where("user_id = ?", middleware.CurrentUserID(r)).Order("name").Find(&payees).Error; err != nil {
+			http.Error(w, "Failed to retrieve payees", http.StatusInternalServerError)
+			return
+		}
+
+		response := []payeeResponse{}
+		for _, payee := range payees {
+			response = append(response, newPayeeResponse(payee))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int             `json:"status_code"`
+			Data       []payeeResponse `json:"data"`
+			Message    string          `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Payees successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetPayeeById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payee, ok := findOwnedPayee(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Payee successfully retrieved",
+			"data":        newPayeeResponse(*payee),
+		})
+	}
+}
+
+func CreatePayee(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request payeeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		userID := middleware.CurrentUserID(r)
+		payee, statusCode, message := request.toPayee(db, userID)
+		if payee == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		names := append([]string{payee.Name}, request.Aliases...)
+		for _, name := range names {
+			if payeeNameConflict(db, userID, uuid.Nil, name) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusConflict,
+					"message":     "A payee or alias named " + name + " already exists",
+				})
+				return
+			}
+		}
+
+		// Aliases differing only in case or spacing, such as "Grab" and
+		// "GRAB", share a key, so only the first of them is kept.
+		seen := map[string]bool{payee.NameKey: true}
+		for _, alias := range request.Aliases {
+			key := models.PayeeKey(alias)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			payee.Aliases = append(payee.Aliases, models.PayeeAlias{UserID: userID, Alias: strings.TrimSpace(alias)})
+		}
+
+		if err := db.Create(payee).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create payee",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Payee created successfully",
+			"data":        newPayeeResponse(*payee),
+		})
+	}
+}
+
+// UpdatePayee renames the payee and replaces its defaults. Aliases are
+// managed through their own endpoints.
+func UpdatePayee(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request payeeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedPayee(db, w, r)
+		if !ok {
+			return
+		}
+
+		updated, statusCode, message := request.toPayee(db, existing.UserID)
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+		if payeeNameConflict(db, existing.UserID, existing.ID, updated.Name) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "A payee or alias with this name already exists",
+			})
+			return
+		}
+
+		if err := db.Model(existing).Updates(map[string]interface{}{
+			"name":                updated.Name,
+			"name_key":            updated.NameKey,
+			"default_category_id": updated.DefaultCategoryID,
+			"default_account_id":  updated.DefaultAccountID,
+		}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update payee",
+			})
+			return
+		}
+		db.Preload("Aliases").Where("id = ?", existing.ID).First(existing)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Payee updated successfully",
+			"data":        newPayeeResponse(*existing),
+		})
+	}
+}
+
+// DeletePayee removes the payee and its aliases. Its transactions and the
+// rules that set it are kept without a payee.
+func DeletePayee(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payee, ok := findOwnedPayee(db, w, r)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Transaction{}).Where("payee_id = ?", payee.ID).Update("payee_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("payee_id = ?", payee.ID).Delete(&models.PayeeAlias{}).Error; err != nil {
+				return err
+			}
+			err := updateRuleActions(tx, payee.ID, func(actions *models.RuleActions) {
+				if actions.PayeeID != nil && *actions.PayeeID == payee.ID {
+					actions.PayeeID = nil
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return tx.Delete(payee).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete payee",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Payee deleted successfully",
+		})
+	}
+}
+
+func AddPayeeAlias(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Alias string `json:"alias"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || models.PayeeKey(request.Alias) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Alias is required",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		payee, ok := findOwnedPayee(db, w, r)
+		if !ok {
+			return
+		}
+		if models.PayeeKey(request.Alias) == payee.NameKey || payeeNameConflict(db, payee.UserID, uuid.Nil, request.Alias) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "A payee or alias with this name already exists",
+			})
+			return
+		}
+
+		alias := models.PayeeAlias{UserID: payee.UserID, PayeeID: payee.ID, Alias: strings.TrimSpace(request.Alias)}
+		if err := db.Create(&alias).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to add alias",
+			})
+			return
+		}
+		payee.Aliases = append(payee.Aliases, alias)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Alias added successfully",
+			"data":        newPayeeResponse(*payee),
+		})
+	}
+}
+
+func DeletePayeeAlias(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payee, ok := findOwnedPayee(db, w, r)
+		if !ok {
+			return
+		}
+
+		result := db.Where("id = ? AND payee_id = ?", mux.Vars(r)["aliasId"], payee.ID).Delete(&models.PayeeAlias{})
+		if result.Error != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete alias",
+			})
+			return
+		}
+		if result.RowsAffected == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Alias not found",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Alias deleted successfully",
+		})
+	}
+}
+
+// payeeScore ranks a payee for suggestions: how often it was used, with a
+// boost for recent use that halves every 30 days and one for names starting
+// with what was typed.
+func payeeScore(payee models.Payee, prefix bool, now time.Time) float64 {
+	score := math.Log1p(float64(payee.UsageCount))
+	if payee.LastUsedAt != nil {
+		days := now.Sub(*payee.LastUsedAt).Hours() / 24
+		score += 2 * math.Pow(0.5, math.Max(days, 0)/30)
+	}
+	if prefix {
+		score += 1
+	}
+	return math.Round(score*1000) / 1000
+}
+
+// SuggestPayees returns the payees whose name or alias contains ?q, best
+// first, with their default category so a client can prefill it. Without
+// ?q the most used and recent payees are returned. ?limit caps the list (10
+// by default).
+func SuggestPayees(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.CurrentUserID(r)
+		params := r.URL.Query()
+
+		limit, _ := strconv.Atoi(params.Get("limit"))
+		if limit < 1 || limit > maxPayeeSuggestions {
+			limit = 10
+		}
+
+		key := models.PayeeKey(params.Get("q"))
+		query := db.Preload("Aliases").Where("user_id = ?", userID)
+		if key != "" {
+			pattern := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(key) + "%"
+			query = query.Where("(name_key LIKE ? OR id IN (?))", pattern,
+				db.Model(&models.PayeeAlias{}).Select("payee_id").Where("user_id = ? AND alias_key LIKE ?", userID, pattern))
+		}
+
+		var payees []models.Payee
+		if err := query.Order("usage_count DESC, last_used_at DESC").Limit(200).Find(&payees).Error; err != nil {
+			http.Error(w, "Failed to suggest payees", http.StatusInternalServerError)
+			return
+		}
+
+		categoryIDs := []uuid.UUID{}
+		for _, payee := range payees {
+			if payee.DefaultCategoryID != nil {
+				categoryIDs = append(categoryIDs, *payee.DefaultCategoryID)
+			}
+		}
+		categories := map[uuid.UUID]models.Category{}
+		if len(categoryIDs) > 0 {
+			var found []models.Category
+			if err := visibleCategories(db, userID).Where("id IN ?", categoryIDs).Find(&found).Error; err != nil {
+				http.Error(w, "Failed to suggest payees", http.StatusInternalServerError)
+				return
+			}
+			for _, category := range found {
+				categories[category.ID] = category
+			}
+		}
+
+		now := time.Now()
+		suggestions := []payeeSuggestion{}
+		for _, payee := range payees {
+			prefix := key != "" && strings.HasPrefix(payee.NameKey, key)
+			for _, alias := range payee.Aliases {
+				prefix = prefix || (key != "" && strings.HasPrefix(alias.AliasKey, key))
+			}
+
+			suggestion := payeeSuggestion{payeeResponse: newPayeeResponse(payee), Score: payeeScore(payee, prefix, now)}
+			if payee.DefaultCategoryID != nil {
+				if category, found := categories[*payee.DefaultCategoryID]; found {
+					suggestion.Category = &categoryRef{ID: category.ID, ParentID: category.ParentID, Name: category.Name, CategoryType: category.CategoryType}
+				}
+			}
+			suggestions = append(suggestions, suggestion)
+		}
+		sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].Score > suggestions[j].Score })
+		if len(suggestions) > limit {
+			suggestions = suggestions[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int               `json:"status_code"`
+			Data       []payeeSuggestion `json:"data"`
+			Message    string            `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       suggestions,
+			Message:    "Payee suggestions successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
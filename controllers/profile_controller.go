@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/backup"
+	"expense-app-backend/blobstore"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/templates"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type profileResponse struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	Locale       string `json:"locale"`
+	BaseCurrency string `json:"base_currency"`
+	BudgetMode   string `json:"budget_mode"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+func newProfileResponse(user *models.User) profileResponse {
+	return profileResponse{
+		ID:           user.ID.String(),
+		Name:         user.Name,
+		Email:        user.Email,
+		Role:         user.Role,
+		Locale:       user.Locale,
+		BaseCurrency: user.Currency(),
+		BudgetMode:   user.BudgetMode,
+		CreatedAt:    user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    user.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func GetProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Profile successfully retrieved",
+			"data":        newProfileResponse(middleware.CurrentUser(r)),
+		})
+	}
+}
+
+// UpdateProfile changes the name, locale and base currency. Fields left out
+// of the request keep their current value.
+func UpdateProfile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var profileRequest struct {
+			Name         *string `json:"name"`
+			Locale       *string `json:"locale"`
+			BaseCurrency *string `json:"base_currency"`
+			BudgetMode   *string `json:"budget_mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&profileRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		user := middleware.CurrentUser(r)
+		updates := map[string]interface{}{}
+
+		if profileRequest.Name != nil {
+			if *profileRequest.Name == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Name cannot be empty",
+				})
+				return
+			}
+			updates["name"] = *profileRequest.Name
+			user.Name = *profileRequest.Name
+		}
+
+		if profileRequest.Locale != nil {
+			if _, err := templates.LoadCategoryTemplate(*profileRequest.Locale); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Unsupported locale",
+				})
+				return
+			}
+			updates["locale"] = *profileRequest.Locale
+			user.Locale = *profileRequest.Locale
+		}
+
+		if profileRequest.BaseCurrency != nil {
+			currency := models.NormalizeCurrency(*profileRequest.BaseCurrency)
+			if !models.IsValidCurrency(currency) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Base currency must be an ISO-4217 code",
+				})
+				return
+			}
+			updates["base_currency"] = currency
+			user.BaseCurrency = currency
+		}
+
+		// Envelopes start counting income and spending from the month the
+		// mode is first switched on.
+		if profileRequest.BudgetMode != nil {
+			if !models.IsValidBudgetMode(*profileRequest.BudgetMode) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Budget mode must be category or envelope",
+				})
+				return
+			}
+			updates["budget_mode"] = *profileRequest.BudgetMode
+			user.BudgetMode = *profileRequest.BudgetMode
+			if user.BudgetMode == models.BudgetModeEnvelope && user.EnvelopeStart == nil {
+				start := models.MonthStart(time.Now())
+				updates["envelope_start"] = start
+				user.EnvelopeStart = &start
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := db.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusInternalServerError,
+					"message":     "Failed to update profile",
+				})
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Profile updated successfully",
+			"data":        newProfileResponse(user),
+		})
+	}
+}
+
+// DeleteProfile schedules the account for deletion after the grace period,
+// once the user has confirmed their password. Until then logging in again
+// cancels it; afterwards the scheduler purges the account and everything it
+// owns.
+func DeleteProfile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var deleteRequest struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&deleteRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		user := middleware.CurrentUser(r)
+		if err := user.CheckPassword(deleteRequest.Password); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusUnauthorized,
+				"message":     "Invalid password",
+			})
+			return
+		}
+
+		deleteAfter := time.Now().Add(models.DeletionGracePeriod())
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Update("delete_after", deleteAfter).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to schedule account deletion",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusAccepted,
+			"message":     "Account scheduled for deletion; log in again before then to cancel",
+			"data": map[string]interface{}{
+				"delete_after": deleteAfter.Format(time.RFC3339),
+			},
+		})
+	}
+}
+
+// ExportProfileData streams a ZIP of everything stored about the user as
+// JSON, with the attachment files: the backup sections plus the journal and
+// deleted transactions.
+func ExportProfileData(db *gorm.DB, store blobstore.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="personal-data-`+time.Now().Format(dateLayout)+`.zip"`)
+		if err := backup.WriteDataExport(db, store, w, middleware.CurrentUserID(r)); err != nil {
+			log.Printf("data export: %v", err)
+		}
+	}
+}
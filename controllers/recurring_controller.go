@@ -0,0 +1,634 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/recurrence"
+	"expense-app-backend/scheduler"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const maxPreviewOccurrences = 100
+
+type recurringRequest struct {
+	AccountID  uuid.UUID   `json:"account_id"`
+	CategoryID *uuid.UUID  `json:"category_id"`
+	Type       string      `json:"type"`
+	Amount     json.Number `json:"amount"`
+	Note       string      `json:"note"`
+	StartDate  string      `json:"start_date"`
+	Paused     bool        `json:"paused"`
+
+	// Either a raw RRULE, or the simple form below.
+	RRule     string   `json:"rrule"`
+	Frequency string   `json:"frequency"`
+	Interval  int      `json:"interval"`
+	Weekdays  []string `json:"weekdays"`
+	MonthDay  int      `json:"month_day"`
+	Count     int      `json:"count"`
+	EndDate   string   `json:"end_date"`
+}
+
+type recurringResponse struct {
+	ID                  string       `json:"id"`
+	AccountID           string       `json:"account_id"`
+	CategoryID          *uuid.UUID   `json:"category_id"`
+	Type                string       `json:"type"`
+	Amount              models.Money `json:"amount"`
+	Note                string       `json:"note"`
+	RRule               string       `json:"rrule"`
+	StartDate           string       `json:"start_date"`
+	MaterializedThrough *string      `json:"materialized_through"`
+	Paused              bool         `json:"paused"`
+	CreatedAt           string       `json:"created_at"`
+	UpdatedAt           string       `json:"updated_at"`
+}
+
+type occurrenceResponse struct {
+	OccurrenceDate string       `json:"occurrence_date"`
+	Date           string       `json:"date"`
+	Amount         models.Money `json:"amount"`
+	CategoryID     *uuid.UUID   `json:"category_id"`
+	Note           string       `json:"note"`
+	Skipped        bool         `json:"skipped"`
+	Edited         bool         `json:"edited"`
+}
+
+func newRecurringResponse(recurring models.RecurringTransaction) recurringResponse {
+	var materializedThrough *string
+	if recurring.MaterializedThrough != nil {
+		value := recurring.MaterializedThrough.Format(dateLayout)
+		materializedThrough = &value
+	}
+	return recurringResponse{
+		ID:                  recurring.ID.String(),
+		AccountID:           recurring.AccountID.String(),
+		CategoryID:          recurring.CategoryID,
+		Type:                recurring.Type,
+		Amount:              recurring.Amount,
+		Note:                recurring.Note,
+		RRule:               recurring.RRule,
+		StartDate:           recurring.StartDate.Format(dateLayout),
+		MaterializedThrough: materializedThrough,
+		Paused:              recurring.Paused,
+		CreatedAt:           recurring.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:           recurring.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// rule returns the recurrence rule of the request, built from the simple
+// form when no RRULE is given. "last_business_day" is a shortcut for the last
+// weekday of every month.
+func (in *recurringRequest) rule() (recurrence.Rule, error) {
+	if in.RRule != "" {
+		return recurrence.Parse(in.RRule)
+	}
+
+	parts := []string{}
+	switch strings.ToLower(in.Frequency) {
+	case "daily", "weekly", "monthly", "yearly":
+		parts = append(parts, "FREQ="+strings.ToUpper(in.Frequency))
+	case "last_business_day":
+		parts = append(parts, "FREQ=MONTHLY", "BYDAY=MO,TU,WE,TH,FR", "BYSETPOS=-1")
+	default:
+		return recurrence.Rule{}, errors.New("frequency must be daily, weekly, monthly, yearly or last_business_day")
+	}
+	if in.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(in.Interval))
+	}
+	if len(in.Weekdays) > 0 {
+		parts = append(parts, "BYDAY="+strings.Join(in.Weekdays, ","))
+	}
+	if in.MonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(in.MonthDay))
+	}
+	if in.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(in.Count))
+	}
+	if in.EndDate != "" {
+		end, err := parseDate(in.EndDate)
+		if err != nil {
+			return recurrence.Rule{}, errors.New("invalid end date")
+		}
+		parts = append(parts, "UNTIL="+end.Format("20060102"))
+	}
+	return recurrence.Parse(strings.Join(parts, ";"))
+}
+
+// toRecurring validates the template like a regular transaction and checks
+// the recurrence rule. On failure it returns the status code and message to
+// send back.
+func (in *recurringRequest) toRecurring(db *gorm.DB, userID uuid.UUID) (*models.RecurringTransaction, int, string) {
+	template := transactionRequest{
+		AccountID:  in.AccountID,
+		CategoryID: in.CategoryID,
+		Type:       in.Type,
+		Amount:     in.Amount,
+		Date:       in.StartDate,
+		Note:       in.Note,
+	}
+	transaction, statusCode, message := template.toTransaction(db, userID)
+	if transaction == nil {
+		return nil, statusCode, message
+	}
+
+	rule, err := in.rule()
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid recurrence: " + err.Error()
+	}
+
+	start := transaction.Date
+	return &models.RecurringTransaction{
+		UserID:     userID,
+		AccountID:  transaction.AccountID,
+		CategoryID: transaction.CategoryID,
+		Type:       transaction.Type,
+		Amount:     transaction.Amount,
+		Note:       transaction.Note,
+		RRule:      rule.String(),
+		StartDate:  time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location()),
+		Paused:     in.Paused,
+	}, 0, ""
+}
+
+func findOwnedRecurring(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.RecurringTransaction, bool) {
+	var recurring models.RecurringTransaction
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&recurring).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Recurring transaction not found",
+		})
+		return nil, false
+	}
+	return &recurring, true
+}
+
+func GetRecurringTransactions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var recurring []models.RecurringTransaction
+		if err := db.Where("user_id = ?", middleware.CurrentUserID(r)).Order("created_at").Find(&recurring).Error; err != nil {
+			http.Error(w, "Failed to retrieve recurring transactions", http.StatusInternalServerError)
+			return
+		}
+
+		response := []recurringResponse{}
+		for _, item := range recurring {
+			response = append(response, newRecurringResponse(item))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                 `json:"status_code"`
+			Data       []recurringResponse `json:"data"`
+			Message    string              `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Recurring transactions successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetRecurringTransactionById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recurring, ok := findOwnedRecurring(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Recurring transaction successfully retrieved",
+			"data":        newRecurringResponse(*recurring),
+		})
+	}
+}
+
+// CreateRecurringTransaction stores the rule and books the occurrences that
+// are already due, so a rule starting in the past catches up right away.
+func CreateRecurringTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request recurringRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		recurring, statusCode, message := request.toRecurring(db, middleware.CurrentUserID(r))
+		if recurring == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		if err := db.Create(recurring).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create recurring transaction",
+			})
+			return
+		}
+
+		booked := 0
+		if !recurring.Paused {
+			var err error
+			if booked, err = scheduler.Materialize(db, recurring, time.Now()); err == nil {
+				db.Where("id = ?", recurring.ID).First(recurring)
+			}
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Recurring transaction created successfully",
+			"data":        newRecurringResponse(*recurring),
+			"booked":      booked,
+		})
+	}
+}
+
+// UpdateRecurringTransaction changes the template and rule. Occurrences that
+// were already booked keep their transactions. Resuming a paused one does not
+// book the occurrences that fell due while it was paused.
+func UpdateRecurringTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request recurringRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedRecurring(db, w, r)
+		if !ok {
+			return
+		}
+
+		if request.StartDate == "" {
+			request.StartDate = existing.StartDate.Format(dateLayout)
+		}
+		updated, statusCode, message := request.toRecurring(db, middleware.CurrentUserID(r))
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		changes := map[string]interface{}{
+			"account_id":   updated.AccountID,
+			"category_id":  updated.CategoryID,
+			"type":         updated.Type,
+			"amount_minor": updated.Amount,
+			"currency":     updated.Amount.Currency,
+			"note":         updated.Note,
+			"rrule":        updated.RRule,
+			"start_date":   updated.StartDate,
+			"paused":       updated.Paused,
+		}
+		if existing.Paused && !updated.Paused {
+			yesterday := startOfToday().AddDate(0, 0, -1)
+			if existing.MaterializedThrough == nil || existing.MaterializedThrough.Before(yesterday) {
+				changes["materialized_through"] = yesterday
+			}
+		}
+		if err := db.Model(existing).Updates(changes).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update recurring transaction",
+			})
+			return
+		}
+		db.Where("id = ?", existing.ID).First(existing)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Recurring transaction updated successfully",
+			"data":        newRecurringResponse(*existing),
+		})
+	}
+}
+
+func DeleteRecurringTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recurring, ok := findOwnedRecurring(db, w, r)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("recurring_id = ?", recurring.ID).Delete(&models.RecurringException{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(recurring).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete recurring transaction",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Recurring transaction deleted successfully",
+		})
+	}
+}
+
+// PreviewRecurringTransaction lists the next ?count occurrences (10 by
+// default) that have not been booked yet, with their skips and edits applied.
+func PreviewRecurringTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recurring, ok := findOwnedRecurring(db, w, r)
+		if !ok {
+			return
+		}
+
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		if count < 1 || count > maxPreviewOccurrences {
+			count = 10
+		}
+
+		rule, err := recurrence.Parse(recurring.RRule)
+		if err != nil {
+			http.Error(w, "Failed to preview recurring transaction", http.StatusInternalServerError)
+			return
+		}
+
+		from := recurring.StartDate
+		if recurring.MaterializedThrough != nil {
+			from = recurring.MaterializedThrough.AddDate(0, 0, 1)
+		}
+		dates := rule.Between(recurring.StartDate, from, time.Time{}, count)
+
+		var exceptions []models.RecurringException
+		if err := db.Where("recurring_id = ?", recurring.ID).Find(&exceptions).Error; err != nil {
+			http.Error(w, "Failed to preview recurring transaction", http.StatusInternalServerError)
+			return
+		}
+		byDate := map[string]*models.RecurringException{}
+		for i := range exceptions {
+			byDate[exceptions[i].OccurrenceDate.Format(dateLayout)] = &exceptions[i]
+		}
+
+		response := []occurrenceResponse{}
+		for _, date := range dates {
+			exception := byDate[date.Format(dateLayout)]
+			occurrence := occurrenceResponse{
+				OccurrenceDate: date.Format(dateLayout),
+				Date:           date.Format(dateLayout),
+				Amount:         recurring.Amount,
+				CategoryID:     recurring.CategoryID,
+				Note:           recurring.Note,
+				Skipped:        exception != nil && exception.Skip,
+				Edited:         exception != nil && !exception.Skip,
+			}
+			if transaction := recurring.Occurrence(date, exception); transaction != nil {
+				occurrence.Date = transaction.Date.Format(dateLayout)
+				occurrence.Amount = transaction.Amount
+				occurrence.CategoryID = transaction.CategoryID
+				occurrence.Note = transaction.Note
+			}
+			response = append(response, occurrence)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                  `json:"status_code"`
+			Data       []occurrenceResponse `json:"data"`
+			Message    string               `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Upcoming occurrences successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+// findPendingOccurrence resolves the {date} route variable to an occurrence
+// of the rule that has not been booked yet. Booked occurrences are ordinary
+// transactions and are changed through the transaction endpoints.
+func findPendingOccurrence(db *gorm.DB, w http.ResponseWriter, r *http.Request, recurring *models.RecurringTransaction) (time.Time, bool) {
+	date, err := time.ParseInLocation(dateLayout, mux.Vars(r)["date"], time.Local)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusBadRequest,
+			"message":     "Invalid occurrence date",
+		})
+		return time.Time{}, false
+	}
+
+	rule, err := recurrence.Parse(recurring.RRule)
+	if err != nil || len(rule.Between(recurring.StartDate, date, date.AddDate(0, 0, 1), 1)) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "No occurrence on this date",
+		})
+		return time.Time{}, false
+	}
+
+	var booked int64
+	db.Unscoped().Model(&models.Transaction{}).Where("recurring_id = ? AND occurrence_date = ?", recurring.ID, date.Format(dateLayout)).Count(&booked)
+	if booked > 0 {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusConflict,
+			"message":     "Occurrence was already booked, change its transaction instead",
+		})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// saveException replaces the exception of one occurrence.
+func saveException(db *gorm.DB, exception *models.RecurringException) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("recurring_id = ? AND occurrence_date = ?", exception.RecurringID, exception.OccurrenceDate.Format(dateLayout)).Delete(&models.RecurringException{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(exception).Error
+	})
+}
+
+func SkipOccurrence(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recurring, ok := findOwnedRecurring(db, w, r)
+		if !ok {
+			return
+		}
+		date, ok := findPendingOccurrence(db, w, r, recurring)
+		if !ok {
+			return
+		}
+
+		if err := saveException(db, &models.RecurringException{RecurringID: recurring.ID, OccurrenceDate: date, Skip: true}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to skip occurrence",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Occurrence skipped successfully",
+		})
+	}
+}
+
+// EditOccurrence overrides the amount, date, category or note of a single
+// upcoming occurrence. Fields left out keep the template's value.
+func EditOccurrence(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var occurrenceRequest struct {
+			Amount     json.Number `json:"amount"`
+			Date       string      `json:"date"`
+			CategoryID *uuid.UUID  `json:"category_id"`
+			Note       *string     `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&occurrenceRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		recurring, ok := findOwnedRecurring(db, w, r)
+		if !ok {
+			return
+		}
+		date, ok := findPendingOccurrence(db, w, r, recurring)
+		if !ok {
+			return
+		}
+
+		exception := models.RecurringException{RecurringID: recurring.ID, OccurrenceDate: date, CategoryID: occurrenceRequest.CategoryID, Note: occurrenceRequest.Note}
+		if occurrenceRequest.Amount != "" {
+			amount, err := models.ParseMoney(occurrenceRequest.Amount.String(), recurring.Amount.Currency)
+			if err != nil || !amount.IsPositive() {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Amount must be greater than zero",
+				})
+				return
+			}
+			exception.AmountMinor = &amount.Amount
+		}
+		if occurrenceRequest.Date != "" {
+			moved, err := parseDate(occurrenceRequest.Date)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid date",
+				})
+				return
+			}
+			exception.Date = &moved
+		}
+		if exception.CategoryID != nil {
+			var category models.Category
+			if err := visibleCategories(db, recurring.UserID).Where("id = ?", *exception.CategoryID).First(&category).Error; err != nil || category.CategoryType != recurring.Type {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Category not found or of the wrong type",
+				})
+				return
+			}
+		}
+
+		if err := saveException(db, &exception); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to edit occurrence",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Occurrence edited successfully",
+		})
+	}
+}
+
+// ResetOccurrence removes the skip or edit of an upcoming occurrence.
+func ResetOccurrence(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recurring, ok := findOwnedRecurring(db, w, r)
+		if !ok {
+			return
+		}
+		date, ok := findPendingOccurrence(db, w, r, recurring)
+		if !ok {
+			return
+		}
+
+		if err := db.Where("recurring_id = ? AND occurrence_date = ?", recurring.ID, date.Format(dateLayout)).Delete(&models.RecurringException{}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to reset occurrence",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Occurrence reset successfully",
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"expense-app-backend/models"
+	"expense-app-backend/scheduler"
+
+	"github.com/google/uuid"
+)
+
+func TestResumeRecurringTransaction(t *testing.T) {
+	db := openTestDB(t)
+	userID := uuid.New()
+	wallet := &models.Account{Name: "Wallet", UserID: userID, Currency: "USD"}
+	mustCreate(t, db, wallet)
+
+	today := startOfToday()
+	tests := []struct {
+		name   string
+		paused bool
+		want   int
+	}{
+		{name: "resumed", paused: true, want: 1},
+		{name: "never paused", paused: false, want: 11},
+	}
+
+	for _, tt := range tests {
+		recurring := &models.RecurringTransaction{UserID: userID, AccountID: wallet.ID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(450, "USD"), Note: tt.name, RRule: "FREQ=DAILY", StartDate: today.AddDate(0, 0, -10), Paused: tt.paused}
+		mustCreate(t, db, recurring)
+
+		body := map[string]interface{}{"account_id": wallet.ID, "type": recurring.Type, "amount": "4.50", "note": tt.name, "rrule": recurring.RRule, "paused": false}
+		if code := serve(t, "/recurring/{id}", UpdateRecurringTransaction(db), http.MethodPut, "/recurring/"+recurring.ID.String(), userID, body); code != http.StatusOK {
+			t.Fatalf("%s: update status = %d, want %d", tt.name, code, http.StatusOK)
+		}
+
+		db.First(recurring, "id = ?", recurring.ID)
+		booked, err := scheduler.Materialize(db, recurring, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if booked != tt.want {
+			t.Errorf("%s: booked %d occurrences, want %d", tt.name, booked, tt.want)
+		}
+	}
+}
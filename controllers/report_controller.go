@@ -0,0 +1,794 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/exchange"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Report periods and groupings.
+const (
+	reportPeriodMonth = "month"
+	reportPeriodYear  = "year"
+
+	reportGroupAccount = "account"
+	reportGroupTag     = "tag"
+)
+
+// maxReportPeriods bounds how many months or years one report covers.
+const maxReportPeriods = 120
+
+// reportRequest holds the query parameters every report shares: the
+// inclusive from and to dates, the currency to report in and the optional
+// grouping.
+type reportRequest struct {
+	userID   uuid.UUID
+	from     time.Time
+	to       time.Time
+	currency string
+	groupBy  string
+}
+
+// reportAmount is an aggregated amount converted to the report currency.
+// CategoryID is uuid.Nil for uncategorised lines, and for lines in a
+// category that has since been deleted.
+type reportAmount struct {
+	CategoryID   uuid.UUID
+	CategoryType string
+	GroupID      *uuid.UUID
+	Day          time.Time
+	Amount       int64
+}
+
+// parseReportRequest reads currency, group_by, from and to, where from
+// defaults to defaultFrom and to to today. On failure it returns the status
+// code and message to send back.
+func parseReportRequest(r *http.Request, defaultFrom func(today time.Time) time.Time) (reportRequest, int, string) {
+	user := middleware.CurrentUser(r)
+	params := r.URL.Query()
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	request := reportRequest{userID: user.ID, from: defaultFrom(today), to: today, currency: user.Currency(), groupBy: params.Get("group_by")}
+	if value := params.Get("currency"); value != "" {
+		request.currency = models.NormalizeCurrency(value)
+	}
+	if !models.IsValidCurrency(request.currency) {
+		return request, http.StatusBadRequest, "Currency must be an ISO-4217 code"
+	}
+	if request.groupBy != "" && request.groupBy != reportGroupAccount && request.groupBy != reportGroupTag {
+		return request, http.StatusBadRequest, "Group by must be account or tag"
+	}
+	if from := params.Get("from"); from != "" {
+		date, err := parseDate(from)
+		if err != nil {
+			return request, http.StatusBadRequest, "Invalid from date"
+		}
+		request.from = date
+	}
+	if to := params.Get("to"); to != "" {
+		date, err := parseDate(to)
+		if err != nil {
+			return request, http.StatusBadRequest, "Invalid to date"
+		}
+		request.to = date
+	}
+	if request.to.Before(request.from) {
+		return request, http.StatusBadRequest, "From date must not be after to date"
+	}
+	return request, 0, ""
+}
+
+// parseReportType reads ?type, expense by default.
+func parseReportType(params url.Values) (string, bool) {
+	categoryType := params.Get("type")
+	if categoryType == "" {
+		return models.TransactionTypeExpense, true
+	}
+	return categoryType, models.IsValidTransactionType(categoryType)
+}
+
+// reportAmounts sums the user's categorised amounts between from and to
+// (both inclusive), per category, category type, group, currency and day,
+// and converts each sum with its day's rate. Amounts already in the report
+// currency need no rate and are summed per month, which keeps the result
+// small. A line counts as income or expense by the type of its category;
+// uncategorised lines by the type of their transaction. Transfers are left
+// out. When grouping by tag, a transaction with several tags counts under
+// each and one without tags under a nil group.
+func reportAmounts(db *gorm.DB, request reportRequest, from, to time.Time, categoryType, groupBy string) ([]reportAmount, []string, error) {
+	groupColumn := "NULL"
+	query := db.Table("(?) AS category_lines", models.CategoryLines(db)).
+		Joins("LEFT JOIN categories ON categories.id = category_lines.category_id")
+	switch groupBy {
+	case reportGroupAccount:
+		groupColumn = "category_lines.account_id"
+	case reportGroupTag:
+		query = query.Joins("LEFT JOIN transaction_tags ON transaction_tags.transaction_id = category_lines.transaction_id")
+		groupColumn = "transaction_tags.tag_id"
+	}
+	query = query.
+		Where("category_lines.user_id = ?", request.userID).
+		Where("category_lines.type IN ?", []string{models.TransactionTypeIncome, models.TransactionTypeExpense}).
+		Where("category_lines.date >= ? AND category_lines.date < ?", from, to.AddDate(0, 0, 1))
+	if categoryType != "" {
+		query = query.Where("COALESCE(categories.category_type, category_lines.type) = ?", categoryType)
+	}
+
+	var rows []struct {
+		CategoryID *uuid.UUID
+		Kind       string
+		GroupID    *uuid.UUID
+		Currency   string
+		Day        string
+		Total      models.Money
+	}
+	if err := query.
+		Select("category_lines.category_id, COALESCE(categories.category_type, category_lines.type) AS kind, "+groupColumn+" AS group_id, category_lines.currency, "+
+			"DATE_FORMAT(category_lines.date, IF(category_lines.currency = ?, '%Y-%m-01', '%Y-%m-%d')) AS day, SUM(category_lines.amount_minor) AS total", request.currency).
+		Group("category_lines.category_id, kind, group_id, category_lines.currency, day").
+		Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	converter := exchange.NewConverter(db, request.userID)
+	amounts := make([]reportAmount, 0, len(rows))
+	missing := map[string]bool{}
+	for _, row := range rows {
+		day, err := time.ParseInLocation(dateLayout, row.Day, time.Local)
+		if err != nil {
+			continue
+		}
+		converted, err := converter.Convert(models.NewMoney(row.Total.Amount, row.Currency), request.currency, day)
+		if err != nil {
+			missing[row.Currency] = true
+			continue
+		}
+		amount := reportAmount{CategoryType: row.Kind, GroupID: row.GroupID, Day: day, Amount: converted.Amount}
+		if row.CategoryID != nil {
+			amount.CategoryID = *row.CategoryID
+		}
+		amounts = append(amounts, amount)
+	}
+
+	missingRates := []string{}
+	for missingCurrency := range missing {
+		missingRates = append(missingRates, missingCurrency)
+	}
+	sort.Strings(missingRates)
+	return amounts, missingRates, nil
+}
+
+// reportGroup is one account or tag of a grouped report, with the report
+// for its amounts alone.
+type reportGroup struct {
+	ID     *uuid.UUID  `json:"id"`
+	Name   string      `json:"name"`
+	Report interface{} `json:"report"`
+}
+
+// groupReports splits the amounts by account or tag and builds a report for
+// each, ordered by name with the untagged group last.
+func groupReports(db *gorm.DB, request reportRequest, amounts []reportAmount, build func([]reportAmount) interface{}) ([]reportGroup, error) {
+	byGroup := map[uuid.UUID][]reportAmount{}
+	for _, amount := range amounts {
+		id := uuid.Nil
+		if amount.GroupID != nil {
+			id = *amount.GroupID
+		}
+		byGroup[id] = append(byGroup[id], amount)
+	}
+
+	var named []struct {
+		ID   uuid.UUID
+		Name string
+	}
+	var err error
+	if request.groupBy == reportGroupAccount {
+		err = db.Model(&models.Account{}).Select("id, name").Where("user_id = ?", request.userID).Order("name").Scan(&named).Error
+	} else {
+		err = db.Model(&models.Tag{}).Select("id, name").Where("user_id = ?", request.userID).Order("name").Scan(&named).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []reportGroup{}
+	for _, group := range named {
+		if groupAmounts, found := byGroup[group.ID]; found {
+			id := group.ID
+			groups = append(groups, reportGroup{ID: &id, Name: group.Name, Report: build(groupAmounts)})
+		}
+	}
+	if untagged, found := byGroup[uuid.Nil]; found {
+		groups = append(groups, reportGroup{Name: "Untagged", Report: build(untagged)})
+	}
+	return groups, nil
+}
+
+// sendReport writes a report, adding the grouped reports when group_by was
+// given.
+func sendReport(db *gorm.DB, w http.ResponseWriter, request reportRequest, data map[string]interface{}, grouped func() ([]reportAmount, error), build func([]reportAmount) interface{}) {
+	if request.groupBy != "" {
+		amounts, err := grouped()
+		var groups []reportGroup
+		if err == nil {
+			groups, err = groupReports(db, request, amounts, build)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to build report",
+			})
+			return
+		}
+		data["group_by"] = request.groupBy
+		data["groups"] = groups
+	}
+	data["from"] = request.from.Format(dateLayout)
+	data["to"] = request.to.Format(dateLayout)
+	data["currency"] = request.currency
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status_code": http.StatusOK,
+		"message":     "Report successfully retrieved",
+		"data":        data,
+	})
+}
+
+// categoryTotals sums the amounts per category, directly and with every
+// sub-category rolled up into its parents. Uncategorised amounts are under
+// uuid.Nil in both.
+func categoryTotals(tree *models.CategoryTree, amounts []reportAmount) (direct, total map[uuid.UUID]int64) {
+	direct = map[uuid.UUID]int64{}
+	for _, amount := range amounts {
+		id := amount.CategoryID
+		if _, found := tree.Get(id); !found {
+			id = uuid.Nil
+		}
+		direct[id] += amount.Amount
+	}
+	total = models.RollupCategoryTotals(tree, direct)
+	if uncategorised, found := direct[uuid.Nil]; found {
+		total[uuid.Nil] = uncategorised
+	}
+	return direct, total
+}
+
+// share is part as a percentage of whole, to two decimals.
+func share(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*10000) / 100
+}
+
+func sumAmounts(amounts []reportAmount) int64 {
+	var sum int64
+	for _, amount := range amounts {
+		sum += amount.Amount
+	}
+	return sum
+}
+
+func failReport(w http.ResponseWriter, statusCode int, message string) {
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status_code": statusCode,
+		"message":     message,
+	})
+}
+
+type categoryReportLine struct {
+	CategoryID *uuid.UUID   `json:"category_id"`
+	ParentID   *uuid.UUID   `json:"parent_id"`
+	Name       string       `json:"name"`
+	Depth      int          `json:"depth"`
+	Direct     models.Money `json:"direct"`
+	Total      models.Money `json:"total"`
+	Share      float64      `json:"share"`
+}
+
+// GetCategoryReport totals ?type (expense by default) per category between
+// ?from and ?to, the current month by default. Categories come depth first
+// with their sub-categories; total includes the sub-categories and direct
+// only what was booked to the category itself. Categories without activity
+// are left out and uncategorised amounts come last.
+func GetCategoryReport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request, status, message := parseReportRequest(r, startOfMonth)
+		if status != 0 {
+			failReport(w, status, message)
+			return
+		}
+		categoryType, ok := parseReportType(r.URL.Query())
+		if !ok {
+			failReport(w, http.StatusBadRequest, "Type must be income or expense")
+			return
+		}
+
+		tree, err := models.LoadCategoryTree(db, request.userID)
+		if err != nil {
+			failReport(w, http.StatusInternalServerError, "Failed to load categories")
+			return
+		}
+		amounts, missingRates, err := reportAmounts(db, request, request.from, request.to, categoryType, "")
+		if err != nil {
+			failReport(w, http.StatusInternalServerError, "Failed to build report")
+			return
+		}
+
+		build := func(amounts []reportAmount) interface{} {
+			direct, total := categoryTotals(tree, amounts)
+			whole := sumAmounts(amounts)
+
+			lines := []categoryReportLine{}
+			var walk func(categories []*models.Category, depth int)
+			walk = func(categories []*models.Category, depth int) {
+				for _, category := range categories {
+					if total[category.ID] == 0 {
+						continue
+					}
+					id := category.ID
+					lines = append(lines, categoryReportLine{
+						CategoryID: &id,
+						ParentID:   category.ParentID,
+						Name:       category.Name,
+						Depth:      depth,
+						Direct:     models.NewMoney(direct[category.ID], request.currency),
+						Total:      models.NewMoney(total[category.ID], request.currency),
+						Share:      share(total[category.ID], whole),
+					})
+					walk(tree.Children(category.ID), depth+1)
+				}
+			}
+			walk(tree.Roots(), 1)
+			if uncategorised, found := direct[uuid.Nil]; found && uncategorised != 0 {
+				lines = append(lines, categoryReportLine{
+					Name:   "Uncategorized",
+					Depth:  1,
+					Direct: models.NewMoney(uncategorised, request.currency),
+					Total:  models.NewMoney(uncategorised, request.currency),
+					Share:  share(uncategorised, whole),
+				})
+			}
+			return map[string]interface{}{
+				"total":      models.NewMoney(whole, request.currency),
+				"categories": lines,
+			}
+		}
+
+		data := build(amounts).(map[string]interface{})
+		data["type"] = categoryType
+		data["missing_rates_for"] = missingRates
+		sendReport(db, w, request, data, func() ([]reportAmount, error) {
+			amounts, _, err := reportAmounts(db, request, request.from, request.to, categoryType, request.groupBy)
+			return amounts, err
+		}, build)
+	}
+}
+
+type topCategory struct {
+	Rank       int          `json:"rank"`
+	CategoryID *uuid.UUID   `json:"category_id"`
+	ParentID   *uuid.UUID   `json:"parent_id"`
+	Name       string       `json:"name"`
+	Total      models.Money `json:"total"`
+	Share      float64      `json:"share"`
+}
+
+// GetTopCategories ranks the categories by what was spent, or with
+// ?type=income earned, between ?from and ?to, the current month by default.
+// Top-level categories are ranked with their sub-categories rolled up; with
+// ?sub_categories=true every category is ranked on what was booked to it
+// directly. ?limit caps the list, 5 by default.
+func GetTopCategories(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request, status, message := parseReportRequest(r, startOfMonth)
+		if status != 0 {
+			failReport(w, status, message)
+			return
+		}
+		params := r.URL.Query()
+		categoryType, ok := parseReportType(params)
+		if !ok {
+			failReport(w, http.StatusBadRequest, "Type must be income or expense")
+			return
+		}
+		limit := 5
+		if value := params.Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 100 {
+				failReport(w, http.StatusBadRequest, "Limit must be between 1 and 100")
+				return
+			}
+			limit = parsed
+		}
+		subCategories := params.Get("sub_categories") == "true"
+
+		tree, err := models.LoadCategoryTree(db, request.userID)
+		if err != nil {
+			failReport(w, http.StatusInternalServerError, "Failed to load categories")
+			return
+		}
+		amounts, missingRates, err := reportAmounts(db, request, request.from, request.to, categoryType, "")
+		if err != nil {
+			failReport(w, http.StatusInternalServerError, "Failed to build report")
+			return
+		}
+
+		build := func(amounts []reportAmount) interface{} {
+			direct, total := categoryTotals(tree, amounts)
+			whole := sumAmounts(amounts)
+
+			ranked := []topCategory{}
+			add := func(category *models.Category, amount int64) {
+				if amount == 0 {
+					return
+				}
+				entry := topCategory{Name: "Uncategorized", Total: models.NewMoney(amount, request.currency), Share: share(amount, whole)}
+				if category != nil {
+					id := category.ID
+					entry.CategoryID, entry.ParentID, entry.Name = &id, category.ParentID, category.Name
+				}
+				ranked = append(ranked, entry)
+			}
+			if subCategories {
+				for id, amount := range direct {
+					category, _ := tree.Get(id)
+					add(category, amount)
+				}
+			} else {
+				for _, category := range tree.Roots() {
+					add(category, total[category.ID])
+				}
+				add(nil, direct[uuid.Nil])
+			}
+
+			sort.SliceStable(ranked, func(i, j int) bool {
+				if ranked[i].Total.Amount != ranked[j].Total.Amount {
+					return ranked[i].Total.Amount > ranked[j].Total.Amount
+				}
+				return ranked[i].Name < ranked[j].Name
+			})
+			if len(ranked) > limit {
+				ranked = ranked[:limit]
+			}
+			for i := range ranked {
+				ranked[i].Rank = i + 1
+			}
+			return map[string]interface{}{
+				"total":      models.NewMoney(whole, request.currency),
+				"categories": ranked,
+			}
+		}
+
+		data := build(amounts).(map[string]interface{})
+		data["type"] = categoryType
+		data["missing_rates_for"] = missingRates
+		sendReport(db, w, request, data, func() ([]reportAmount, error) {
+			amounts, _, err := reportAmounts(db, request, request.from, request.to, categoryType, request.groupBy)
+			return amounts, err
+		}, build)
+	}
+}
+
+type periodCategory struct {
+	CategoryID    *uuid.UUID   `json:"category_id"`
+	Name          string       `json:"name"`
+	Total         models.Money `json:"total"`
+	Previous      models.Money `json:"previous"`
+	Change        models.Money `json:"change"`
+	ChangePercent *float64     `json:"change_percent"`
+}
+
+type periodReport struct {
+	Period        string           `json:"period"`
+	From          string           `json:"from"`
+	To            string           `json:"to"`
+	Total         models.Money     `json:"total"`
+	Previous      models.Money     `json:"previous"`
+	Change        models.Money     `json:"change"`
+	ChangePercent *float64         `json:"change_percent"`
+	Categories    []periodCategory `json:"categories"`
+}
+
+// changePercent is how much current differs from previous, in percent, or
+// nil when there was nothing to compare with.
+func changePercent(current, previous int64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	percent := math.Round(float64(current-previous)/math.Abs(float64(previous))*10000) / 100
+	return &percent
+}
+
+// periodStart returns the first day of the month or year date falls in.
+func periodStart(date time.Time, period string) time.Time {
+	if period == reportPeriodYear {
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, date.Location())
+	}
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+}
+
+func nextPeriod(start time.Time, period string) time.Time {
+	if period == reportPeriodYear {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+func periodLabel(start time.Time, period string) string {
+	if period == reportPeriodYear {
+		return start.Format("2006")
+	}
+	return start.Format("2006-01")
+}
+
+// GetPeriodReport compares ?type (expense by default) month over month, or
+// with ?period=year year over year, for every period between ?from and ?to:
+// the last 12 months or 5 years by default. Each period is compared with
+// the one before it, the first one included. Categories are the top-level
+// ones, or the sub-categories of ?parent_id, with everything below them
+// rolled up.
+func GetPeriodReport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		period := params.Get("period")
+		if period == "" {
+			period = reportPeriodMonth
+		}
+		if period != reportPeriodMonth && period != reportPeriodYear {
+			failReport(w, http.StatusBadRequest, "Period must be month or year")
+			return
+		}
+		request, status, message := parseReportRequest(r, func(today time.Time) time.Time {
+			if period == reportPeriodYear {
+				return periodStart(today, period).AddDate(-4, 0, 0)
+			}
+			return periodStart(today, period).AddDate(0, -11, 0)
+		})
+		if status != 0 {
+			failReport(w, status, message)
+			return
+		}
+		categoryType, ok := parseReportType(params)
+		if !ok {
+			failReport(w, http.StatusBadRequest, "Type must be income or expense")
+			return
+		}
+
+		var starts []time.Time
+		for start := periodStart(request.from, period); !start.After(request.to); start = nextPeriod(start, period) {
+			starts = append(starts, start)
+			if len(starts) > maxReportPeriods {
+				failReport(w, http.StatusBadRequest, "Date range covers too many periods")
+				return
+			}
+		}
+		// The period before the first is read too, to compare against.
+		first := starts[0]
+		if period == reportPeriodYear {
+			first = first.AddDate(-1, 0, 0)
+		} else {
+			first = first.AddDate(0, -1, 0)
+		}
+
+		tree, err := models.LoadCategoryTree(db, request.userID)
+		if err != nil {
+			failReport(w, http.StatusInternalServerError, "Failed to load categories")
+			return
+		}
+		var shown []*models.Category
+		if parentID := params.Get("parent_id"); parentID != "" {
+			id, err := uuid.Parse(parentID)
+			if _, found := tree.Get(id); err != nil || !found {
+				failReport(w, http.StatusNotFound, "Category not found")
+				return
+			}
+			shown = tree.Children(id)
+		} else {
+			shown = tree.Roots()
+		}
+
+		// Each period runs to its end, even past ?to, so the last one is
+		// compared like for like only when it is complete.
+		last := nextPeriod(starts[len(starts)-1], period).AddDate(0, 0, -1)
+		amounts, missingRates, err := reportAmounts(db, request, first, last, categoryType, "")
+		if err != nil {
+			failReport(w, http.StatusInternalServerError, "Failed to build report")
+			return
+		}
+
+		build := func(amounts []reportAmount) interface{} {
+			byPeriod := map[time.Time][]reportAmount{}
+			for _, amount := range amounts {
+				start := periodStart(amount.Day, period)
+				byPeriod[start] = append(byPeriod[start], amount)
+			}
+
+			_, previous := categoryTotals(tree, byPeriod[periodStart(first, period)])
+			previousWhole := sumAmounts(byPeriod[periodStart(first, period)])
+			reports := []periodReport{}
+			for _, start := range starts {
+				_, total := categoryTotals(tree, byPeriod[start])
+				whole := sumAmounts(byPeriod[start])
+
+				report := periodReport{
+					Period:        periodLabel(start, period),
+					From:          start.Format(dateLayout),
+					To:            nextPeriod(start, period).AddDate(0, 0, -1).Format(dateLayout),
+					Total:         models.NewMoney(whole, request.currency),
+					Previous:      models.NewMoney(previousWhole, request.currency),
+					Change:        models.NewMoney(whole-previousWhole, request.currency),
+					ChangePercent: changePercent(whole, previousWhole),
+					Categories:    []periodCategory{},
+				}
+				compare := func(id *uuid.UUID, name string, key uuid.UUID) {
+					if total[key] == 0 && previous[key] == 0 {
+						return
+					}
+					report.Categories = append(report.Categories, periodCategory{
+						CategoryID:    id,
+						Name:          name,
+						Total:         models.NewMoney(total[key], request.currency),
+						Previous:      models.NewMoney(previous[key], request.currency),
+						Change:        models.NewMoney(total[key]-previous[key], request.currency),
+						ChangePercent: changePercent(total[key], previous[key]),
+					})
+				}
+				for _, category := range shown {
+					id := category.ID
+					compare(&id, category.Name, category.ID)
+				}
+				if params.Get("parent_id") == "" {
+					compare(nil, "Uncategorized", uuid.Nil)
+				}
+				reports = append(reports, report)
+
+				previous, previousWhole = total, whole
+			}
+			return reports
+		}
+
+		data := map[string]interface{}{
+			"type":              categoryType,
+			"period":            period,
+			"periods":           build(amounts),
+			"missing_rates_for": missingRates,
+		}
+		sendReport(db, w, request, data, func() ([]reportAmount, error) {
+			amounts, _, err := reportAmounts(db, request, first, last, categoryType, request.groupBy)
+			return amounts, err
+		}, build)
+	}
+}
+
+type incomeExpenseTotals struct {
+	Period      string       `json:"period,omitempty"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Income      models.Money `json:"income"`
+	Expense     models.Money `json:"expense"`
+	Net         models.Money `json:"net"`
+	SavingsRate *float64     `json:"savings_rate"`
+}
+
+func newIncomeExpenseTotals(amounts []reportAmount, currency string) incomeExpenseTotals {
+	var income, expense int64
+	for _, amount := range amounts {
+		if amount.CategoryType == models.TransactionTypeIncome {
+			income += amount.Amount
+		} else {
+			expense += amount.Amount
+		}
+	}
+	totals := incomeExpenseTotals{
+		Income:  models.NewMoney(income, currency),
+		Expense: models.NewMoney(expense, currency),
+		Net:     models.NewMoney(income-expense, currency),
+	}
+	if income != 0 {
+		rate := share(income-expense, income)
+		totals.SavingsRate = &rate
+	}
+	return totals
+}
+
+// GetIncomeExpenseReport splits what came in and went out between ?from and
+// ?to, the current month by default, by category type, with the net and the
+// share of income saved. ?period=month or year adds a breakdown per period.
+func GetIncomeExpenseReport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		period := params.Get("period")
+		if period != "" && period != reportPeriodMonth && period != reportPeriodYear {
+			failReport(w, http.StatusBadRequest, "Period must be month or year")
+			return
+		}
+		request, status, message := parseReportRequest(r, startOfMonth)
+		if status != 0 {
+			failReport(w, status, message)
+			return
+		}
+		if period != "" {
+			count := 0
+			for start := periodStart(request.from, period); !start.After(request.to); start = nextPeriod(start, period) {
+				if count++; count > maxReportPeriods {
+					failReport(w, http.StatusBadRequest, "Date range covers too many periods")
+					return
+				}
+			}
+		}
+
+		amounts, missingRates, err := reportAmounts(db, request, request.from, request.to, "", "")
+		if err != nil {
+			failReport(w, http.StatusInternalServerError, "Failed to build report")
+			return
+		}
+
+		build := func(amounts []reportAmount) interface{} {
+			totals := newIncomeExpenseTotals(amounts, request.currency)
+			totals.From = request.from.Format(dateLayout)
+			totals.To = request.to.Format(dateLayout)
+			report := map[string]interface{}{"totals": totals}
+			if period == "" {
+				return report
+			}
+
+			byPeriod := map[time.Time][]reportAmount{}
+			for _, amount := range amounts {
+				start := periodStart(amount.Day, period)
+				byPeriod[start] = append(byPeriod[start], amount)
+			}
+			periods := []incomeExpenseTotals{}
+			for start := periodStart(request.from, period); !start.After(request.to); start = nextPeriod(start, period) {
+				end := nextPeriod(start, period).AddDate(0, 0, -1)
+				periodTotals := newIncomeExpenseTotals(byPeriod[start], request.currency)
+				periodTotals.Period = periodLabel(start, period)
+				periodTotals.From = maxTime(start, request.from).Format(dateLayout)
+				periodTotals.To = minTime(end, request.to).Format(dateLayout)
+				periods = append(periods, periodTotals)
+			}
+			report["periods"] = periods
+			return report
+		}
+
+		data := build(amounts).(map[string]interface{})
+		data["missing_rates_for"] = missingRates
+		sendReport(db, w, request, data, func() ([]reportAmount, error) {
+			amounts, _, err := reportAmounts(db, request, request.from, request.to, "", request.groupBy)
+			return amounts, err
+		}, build)
+	}
+}
+
+func startOfMonth(today time.Time) time.Time {
+	return periodStart(today, reportPeriodMonth)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
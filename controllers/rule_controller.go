@@ -0,0 +1,482 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/rules"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxDryRunMatches caps how many transactions a dry run lists; the count
+// covers all of them.
+const maxDryRunMatches = 100
+
+type ruleRequest struct {
+	Name           string                `json:"name"`
+	Priority       int                   `json:"priority"`
+	Enabled        *bool                 `json:"enabled"`
+	StopProcessing bool                  `json:"stop_processing"`
+	Conditions     models.RuleConditions `json:"conditions"`
+	Actions        models.RuleActions    `json:"actions"`
+}
+
+type ruleResponse struct {
+	ID             string                `json:"id"`
+	Name           string                `json:"name"`
+	Priority       int                   `json:"priority"`
+	Enabled        bool                  `json:"enabled"`
+	StopProcessing bool                  `json:"stop_processing"`
+	Conditions     models.RuleConditions `json:"conditions"`
+	Actions        models.RuleActions    `json:"actions"`
+	CreatedAt      string                `json:"created_at"`
+	UpdatedAt      string                `json:"updated_at"`
+}
+
+// ruleMatch is a transaction a rule would change, before and after.
+type ruleMatch struct {
+	TransactionID uuid.UUID    `json:"transaction_id"`
+	Date          string       `json:"date"`
+	Note          string       `json:"note"`
+	Amount        models.Money `json:"amount"`
+	CategoryID    *uuid.UUID   `json:"category_id"`
+	NewCategoryID *uuid.UUID   `json:"new_category_id,omitempty"`
+	PayeeID       *uuid.UUID   `json:"payee_id"`
+	NewPayeeID    *uuid.UUID   `json:"new_payee_id,omitempty"`
+	AddedTagIDs   []uuid.UUID  `json:"added_tag_ids,omitempty"`
+}
+
+func newRuleResponse(rule models.Rule) ruleResponse {
+	conditions := rule.Conditions
+	if conditions == nil {
+		conditions = models.RuleConditions{}
+	}
+	return ruleResponse{
+		ID:             rule.ID.String(),
+		Name:           rule.Name,
+		Priority:       rule.Priority,
+		Enabled:        rule.Enabled,
+		StopProcessing: rule.StopProcessing,
+		Conditions:     conditions,
+		Actions:        rule.Actions,
+		CreatedAt:      rule.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      rule.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toRule validates the conditions and makes sure every account, category,
+// payee and tag the rule refers to belongs to the user. On failure it
+// returns the status code and message to send back.
+func (in *ruleRequest) toRule(db *gorm.DB, userID uuid.UUID) (*models.Rule, int, string) {
+	if in.Name == "" {
+		return nil, http.StatusBadRequest, "Name is required"
+	}
+	if err := rules.Validate(in.Conditions); err != nil {
+		return nil, http.StatusBadRequest, "Invalid conditions: " + err.Error()
+	}
+	for _, condition := range in.Conditions {
+		if condition.Field != models.RuleFieldAccount {
+			continue
+		}
+		var account models.Account
+		if err := db.Where("id = ? AND user_id = ?", condition.Value, userID).First(&account).Error; err != nil {
+			return nil, http.StatusNotFound, "Account not found"
+		}
+	}
+
+	if in.Actions.IsEmpty() {
+		return nil, http.StatusBadRequest, "At least one action is required"
+	}
+	if in.Actions.CategoryID != nil {
+		var category models.Category
+		if err := visibleCategories(db, userID).Where("id = ?", *in.Actions.CategoryID).First(&category).Error; err != nil {
+			return nil, http.StatusNotFound, "Category not found"
+		}
+	}
+	if in.Actions.PayeeID != nil {
+		var payee models.Payee
+		if err := db.Where("id = ? AND user_id = ?", *in.Actions.PayeeID, userID).First(&payee).Error; err != nil {
+			return nil, http.StatusNotFound, "Payee not found"
+		}
+	}
+	if !ownedTagIDs(db, userID, in.Actions.TagIDs) {
+		return nil, http.StatusNotFound, "Tag not found"
+	}
+	in.Actions.TagIDs = uniqueIDs(in.Actions.TagIDs)
+
+	enabled := true
+	if in.Enabled != nil {
+		enabled = *in.Enabled
+	}
+	return &models.Rule{
+		UserID:         userID,
+		Name:           in.Name,
+		Priority:       in.Priority,
+		Enabled:        enabled,
+		StopProcessing: in.StopProcessing,
+		Conditions:     in.Conditions,
+		Actions:        in.Actions,
+	}, 0, ""
+}
+
+func findOwnedRule(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Rule, bool) {
+	var rule models.Rule
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&rule).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Rule not found",
+		})
+		return nil, false
+	}
+	return &rule, true
+}
+
+// applyRules runs the user's rules on a transaction that is about to be
+// created and returns the tags they add. Rules only fill in what the input
+// left open.
+func applyRules(db *gorm.DB, transaction *models.Transaction, payee string) ([]uuid.UUID, error) {
+	engine, err := rules.Load(db, transaction.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Fill(transaction, engine.Evaluate(rules.SubjectOf(transaction, payee))), nil
+}
+
+// updateRuleActions rewrites the actions of every rule that refers to id.
+// Actions are stored as JSON, so the database cannot follow the reference
+// on its own when a category, payee or tag goes away.
+func updateRuleActions(tx *gorm.DB, id uuid.UUID, update func(*models.RuleActions)) error {
+	var rules []models.Rule
+	if err := tx.Where("actions LIKE ?", "%"+id.String()+"%").Find(&rules).Error; err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		update(&rule.Actions)
+		if err := tx.Model(&models.Rule{}).Where("id = ?", rule.ID).Update("actions", rule.Actions).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachRuleChange runs one rule over the user's income and expenses and
+// calls visit for every transaction it would change. ?from and ?to limit the
+// dates.
+func eachRuleChange(db *gorm.DB, r *http.Request, rule *models.Rule, visit func(*models.Transaction, rules.Change) error) (int, string, error) {
+	engine, err := rules.New(db, []models.Rule{*rule})
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to evaluate rule", err
+	}
+	names, err := models.PayeeNames(db, rule.UserID)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to evaluate rule", err
+	}
+
+	query := db.Preload("Splits").
+		Where("user_id = ? AND type IN ?", rule.UserID, []string{models.TransactionTypeIncome, models.TransactionTypeExpense})
+	if from := r.URL.Query().Get("from"); from != "" {
+		date, err := parseDate(from)
+		if err != nil {
+			return http.StatusBadRequest, "Invalid from date", err
+		}
+		query = query.Where("date >= ?", date)
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		date, err := parseDate(to)
+		if err != nil {
+			return http.StatusBadRequest, "Invalid to date", err
+		}
+		query = query.Where("date < ?", date.AddDate(0, 0, 1))
+	}
+
+	var batch []models.Transaction
+	result := query.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			transaction := &batch[i]
+			payee := ""
+			if transaction.PayeeID != nil {
+				payee = names[*transaction.PayeeID]
+			}
+			outcome := engine.Evaluate(rules.SubjectOf(transaction, payee))
+			if outcome.IsEmpty() {
+				continue
+			}
+			change, err := rules.Diff(db, transaction, outcome)
+			if err != nil {
+				return err
+			}
+			if change.IsEmpty() {
+				continue
+			}
+			if err := visit(transaction, change); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return http.StatusInternalServerError, "Failed to evaluate rule", result.Error
+	}
+	return 0, "", nil
+}
+
+func GetRules(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var list []models.Rule
+		if err := db.Where("user_id = ?", middleware.CurrentUserID(r)).Order("priority, created_at").Find(&list).Error; err != nil {
+			http.Error(w, "Failed to retrieve rules", http.StatusInternalServerError)
+			return
+		}
+
+		response := []ruleResponse{}
+		for _, rule := range list {
+			response = append(response, newRuleResponse(rule))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int            `json:"status_code"`
+			Data       []ruleResponse `json:"data"`
+			Message    string         `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Rules successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetRuleById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := findOwnedRule(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Rule successfully retrieved",
+			"data":        newRuleResponse(*rule),
+		})
+	}
+}
+
+func CreateRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ruleRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		rule, statusCode, message := request.toRule(db, middleware.CurrentUserID(r))
+		if rule == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		if err := db.Create(rule).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create rule",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Rule created successfully",
+			"data":        newRuleResponse(*rule),
+		})
+	}
+}
+
+func UpdateRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ruleRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedRule(db, w, r)
+		if !ok {
+			return
+		}
+
+		updated, statusCode, message := request.toRule(db, existing.UserID)
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		if err := db.Model(existing).Updates(map[string]interface{}{
+			"name":            updated.Name,
+			"priority":        updated.Priority,
+			"enabled":         updated.Enabled,
+			"stop_processing": updated.StopProcessing,
+			"conditions":      updated.Conditions,
+			"actions":         updated.Actions,
+		}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update rule",
+			})
+			return
+		}
+		db.Where("id = ?", existing.ID).First(existing)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Rule updated successfully",
+			"data":        newRuleResponse(*existing),
+		})
+	}
+}
+
+func DeleteRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := findOwnedRule(db, w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.Delete(rule).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete rule",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Rule deleted successfully",
+		})
+	}
+}
+
+// DryRunRule lists the existing transactions the rule would change and how,
+// without changing anything. It works on disabled rules too.
+func DryRunRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := findOwnedRule(db, w, r)
+		if !ok {
+			return
+		}
+
+		matches := []ruleMatch{}
+		count := 0
+		statusCode, message, err := eachRuleChange(db, r, rule, func(transaction *models.Transaction, change rules.Change) error {
+			count++
+			if len(matches) < maxDryRunMatches {
+				matches = append(matches, ruleMatch{
+					TransactionID: transaction.ID,
+					Date:          transaction.Date.Format(dateLayout),
+					Note:          transaction.Note,
+					Amount:        transaction.Amount,
+					CategoryID:    transaction.CategoryID,
+					NewCategoryID: change.CategoryID,
+					PayeeID:       transaction.PayeeID,
+					NewPayeeID:    change.PayeeID,
+					AddedTagIDs:   change.AddTagIDs,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Rule dry run completed",
+			"data":        matches,
+			"count":       count,
+		})
+	}
+}
+
+// ApplyRule runs the rule over existing transactions and saves the changes
+// in one database transaction. Unlike on create, the rule's category and
+// payee replace the current ones.
+func ApplyRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := findOwnedRule(db, w, r)
+		if !ok {
+			return
+		}
+
+		changed := 0
+		var statusCode int
+		var message string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			statusCode, message, err = eachRuleChange(tx, r, rule, func(transaction *models.Transaction, change rules.Change) error {
+				changed++
+				return rules.Apply(tx, transaction, change)
+			})
+			return err
+		})
+		if err != nil {
+			if statusCode == 0 {
+				statusCode, message = http.StatusInternalServerError, "Failed to apply rule"
+			}
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Rule applied successfully",
+			"changed":     changed,
+		})
+	}
+}
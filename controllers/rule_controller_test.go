@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestDeleteUpdatesRuleActions(t *testing.T) {
+	db := openTestDB(t)
+	userID := uuid.New()
+
+	payee := &models.Payee{UserID: userID, Name: "Corner Cafe", NameKey: models.PayeeKey("Corner Cafe")}
+	work := &models.Tag{UserID: userID, Name: "work"}
+	travel := &models.Tag{UserID: userID, Name: "travel"}
+	mustCreate(t, db, payee, work, travel)
+
+	conditions := models.RuleConditions{{Field: models.RuleFieldDescription, Operator: "contains", Value: "cafe"}}
+	rule := &models.Rule{UserID: userID, Name: "Cafe", Conditions: conditions, Actions: models.RuleActions{PayeeID: &payee.ID, TagIDs: []uuid.UUID{work.ID, travel.ID}}}
+	other := &models.Rule{UserID: userID, Name: "Travel", Conditions: conditions, Actions: models.RuleActions{TagIDs: []uuid.UUID{travel.ID}}}
+	mustCreate(t, db, rule, other)
+
+	tests := []struct {
+		name    string
+		route   string
+		handler http.HandlerFunc
+		id      uuid.UUID
+		target  string
+		want    models.RuleActions
+	}{
+		{name: "payee", route: "/payees/{id}", handler: DeletePayee(db), id: payee.ID, target: "/payees/", want: models.RuleActions{TagIDs: []uuid.UUID{work.ID, travel.ID}}},
+		{name: "tag", route: "/tags/{id}", handler: DeleteTag(db), id: work.ID, target: "/tags/", want: models.RuleActions{TagIDs: []uuid.UUID{travel.ID}}},
+	}
+	for _, tt := range tests {
+		if code := serve(t, tt.route, tt.handler, http.MethodDelete, tt.target+tt.id.String(), userID, nil); code != http.StatusOK {
+			t.Fatalf("%s: delete status = %d, want %d", tt.name, code, http.StatusOK)
+		}
+		var stored models.Rule
+		db.First(&stored, "id = ?", rule.ID)
+		if stored.Actions.PayeeID != nil || !reflect.DeepEqual(stored.Actions.TagIDs, tt.want.TagIDs) {
+			t.Errorf("%s: rule actions = %+v, want %+v", tt.name, stored.Actions, tt.want)
+		}
+	}
+
+	db.First(other, "id = ?", other.ID)
+	if !reflect.DeepEqual(other.Actions.TagIDs, []uuid.UUID{travel.ID}) {
+		t.Errorf("unrelated rule actions = %+v, want them unchanged", other.Actions)
+	}
+}
@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-app-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var errUnknownSubCategory = errors.New("sub-category does not belong to category")
+
+type subCategoryInput struct {
+	ID   *uuid.UUID `json:"id"`
+	Name string     `json:"name"`
+}
+
+func orderedSubCategories(db *gorm.DB) *gorm.DB {
+	return db.Where("deleted_at IS NULL").Order("position, created_at")
+}
+
+// subCategoryLoader returns the preload condition for sub-categories, leaving
+// out archived ones unless they were asked for.
+func subCategoryLoader(includeArchived bool) func(*gorm.DB) *gorm.DB {
+	if includeArchived {
+		return orderedSubCategories
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return orderedSubCategories(db).Where("archived_at IS NULL")
+	}
+}
+
+// syncSubCategories reconciles the category's direct children with the
+// requested list. Entries carrying an ID are renamed in place so their IDs
+// stay stable, entries without one are created, and children missing from
+// the list are deleted along with their own subtrees. The list order becomes
+// the new position. Archived children are hidden from clients, so they are
+// left alone rather than treated as missing.
+func syncSubCategories(tx *gorm.DB, parent *models.Category, requested []subCategoryInput) ([]models.Category, error) {
+	var existing []models.Category
+	if err := tx.Where("parent_id = ? AND archived_at IS NULL", parent.ID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	existingByID := make(map[uuid.UUID]models.Category)
+	for _, subCategory := range existing {
+		existingByID[subCategory.ID] = subCategory
+	}
+
+	kept := make(map[uuid.UUID]bool)
+	var result []models.Category
+	for position, input := range requested {
+		if input.ID == nil {
+			parentID := parent.ID
+			subCategory := models.Category{
+				ID:           uuid.New(),
+				UserID:       parent.UserID,
+				ParentID:     &parentID,
+				Name:         input.Name,
+				CategoryType: parent.CategoryType,
+				Position:     position,
+			}
+			if err := tx.Create(&subCategory).Error; err != nil {
+				return nil, err
+			}
+			result = append(result, subCategory)
+			continue
+		}
+
+		subCategory, found := existingByID[*input.ID]
+		if !found || kept[subCategory.ID] {
+			return nil, errUnknownSubCategory
+		}
+
+		if err := tx.Model(&models.Category{}).Where("id = ?", subCategory.ID).Updates(map[string]interface{}{
+			"name":       input.Name,
+			"position":   position,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return nil, err
+		}
+
+		subCategory.Name = input.Name
+		subCategory.Position = position
+		kept[subCategory.ID] = true
+		result = append(result, subCategory)
+	}
+
+	var removed []uuid.UUID
+	for _, subCategory := range existing {
+		if kept[subCategory.ID] {
+			continue
+		}
+		subtree, err := subtreeIDs(tx, parent.UserID, subCategory.ID)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, subtree...)
+	}
+	if len(removed) > 0 {
+		if err := tx.Where("id IN ?", removed).Delete(&models.Category{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// findOwnedCategory resolves the {id} route variable to a category the
+// caller may modify, writing a 404 response when there is none.
+func findOwnedCategory(db *gorm.DB, w http.ResponseWriter, r *http.Request, global bool) (*models.Category, bool) {
+	var category models.Category
+	if err := scopeCategoryOwner(db, categoryOwner(r, global)).Where("id = ? AND deleted_at IS NULL", mux.Vars(r)["id"]).First(&category).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Category not found",
+		})
+		return nil, false
+	}
+	return &category, true
+}
+
+func findSubCategory(db *gorm.DB, w http.ResponseWriter, r *http.Request, categoryID uuid.UUID) (*models.Category, bool) {
+	var subCategory models.Category
+	if err := db.Where("id = ? AND parent_id = ?", mux.Vars(r)["subCategoryId"], categoryID).First(&subCategory).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Sub-category not found",
+		})
+		return nil, false
+	}
+	return &subCategory, true
+}
+
+func newSubCategoryResponse(subCategory models.Category) subCategoryResponse {
+	return subCategoryResponse{
+		ID:   subCategory.ID.String(),
+		Name: subCategory.Name,
+	}
+}
+
+func CreateSubCategory(db *gorm.DB) http.HandlerFunc {
+	return createSubCategory(db, false)
+}
+
+func CreateDefaultSubCategory(db *gorm.DB) http.HandlerFunc {
+	return createSubCategory(db, true)
+}
+
+func createSubCategory(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var subCategoryRequest struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&subCategoryRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		if subCategoryRequest.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Name is required",
+			})
+			return
+		}
+
+		category, ok := findOwnedCategory(db, w, r, global)
+		if !ok {
+			return
+		}
+
+		var position int64
+		db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&position)
+
+		parentID := category.ID
+		subCategory := models.Category{
+			ID:           uuid.New(),
+			UserID:       category.UserID,
+			ParentID:     &parentID,
+			Name:         subCategoryRequest.Name,
+			CategoryType: category.CategoryType,
+			Position:     int(position),
+		}
+		if err := db.Create(&subCategory).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create sub-category",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Sub-category created successfully",
+			"data":        newSubCategoryResponse(subCategory),
+		})
+	}
+}
+
+func RenameSubCategory(db *gorm.DB) http.HandlerFunc {
+	return renameSubCategory(db, false)
+}
+
+func RenameDefaultSubCategory(db *gorm.DB) http.HandlerFunc {
+	return renameSubCategory(db, true)
+}
+
+func renameSubCategory(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var subCategoryRequest struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&subCategoryRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		if subCategoryRequest.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Name is required",
+			})
+			return
+		}
+
+		category, ok := findOwnedCategory(db, w, r, global)
+		if !ok {
+			return
+		}
+		subCategory, ok := findSubCategory(db, w, r, category.ID)
+		if !ok {
+			return
+		}
+
+		if err := db.Model(subCategory).Update("name", subCategoryRequest.Name).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to rename sub-category",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Sub-category renamed successfully",
+			"data":        newSubCategoryResponse(*subCategory),
+		})
+	}
+}
+
+func DeleteSubCategory(db *gorm.DB) http.HandlerFunc {
+	return deleteSubCategory(db, false)
+}
+
+func DeleteDefaultSubCategory(db *gorm.DB) http.HandlerFunc {
+	return deleteSubCategory(db, true)
+}
+
+func deleteSubCategory(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category, ok := findOwnedCategory(db, w, r, global)
+		if !ok {
+			return
+		}
+		subCategory, ok := findSubCategory(db, w, r, category.ID)
+		if !ok {
+			return
+		}
+
+		subtree, err := subtreeIDs(db, category.UserID, subCategory.ID)
+		if err == nil {
+			err = db.Where("id IN ?", subtree).Delete(&models.Category{}).Error
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete sub-category",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Sub-category deleted successfully",
+		})
+	}
+}
+
+func ReorderSubCategories(db *gorm.DB) http.HandlerFunc {
+	return reorderSubCategories(db, false)
+}
+
+func ReorderDefaultSubCategories(db *gorm.DB) http.HandlerFunc {
+	return reorderSubCategories(db, true)
+}
+
+// reorderSubCategories expects every sub-category ID of the category exactly
+// once, in the new display order.
+func reorderSubCategories(db *gorm.DB, global bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var orderRequest struct {
+			IDs []uuid.UUID `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&orderRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		category, ok := findOwnedCategory(db, w, r, global)
+		if !ok {
+			return
+		}
+
+		var subCategories []models.Category
+		if err := db.Where("parent_id = ?", category.ID).Find(&subCategories).Error; err != nil {
+			http.Error(w, "Failed to retrieve sub-categories", http.StatusInternalServerError)
+			return
+		}
+
+		known := make(map[uuid.UUID]models.Category)
+		for _, subCategory := range subCategories {
+			known[subCategory.ID] = subCategory
+		}
+
+		seen := make(map[uuid.UUID]bool)
+		for _, id := range orderRequest.IDs {
+			if _, found := known[id]; !found || seen[id] {
+				seen = nil
+				break
+			}
+			seen[id] = true
+		}
+		if seen == nil || len(seen) != len(known) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "IDs must list every sub-category of the category exactly once",
+			})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for position, id := range orderRequest.IDs {
+				if err := tx.Model(&models.Category{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to reorder sub-categories",
+			})
+			return
+		}
+
+		response := []subCategoryResponse{}
+		for _, id := range orderRequest.IDs {
+			response = append(response, newSubCategoryResponse(known[id]))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Sub-categories reordered successfully",
+			"data":        response,
+		})
+	}
+}
@@ -0,0 +1,630 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/exchange"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tagRequest struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type tagResponse struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Color            string `json:"color"`
+	TransactionCount int64  `json:"transaction_count"`
+	CreatedAt        string `json:"created_at"`
+	UpdatedAt        string `json:"updated_at"`
+}
+
+// tagRef is how a tag is shown on a transaction.
+type tagRef struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Color string    `json:"color"`
+}
+
+type taggingRequest struct {
+	TransactionIDs []uuid.UUID `json:"transaction_ids"`
+	TagIDs         []uuid.UUID `json:"tag_ids"`
+}
+
+type tagTotal struct {
+	TagID            uuid.UUID    `json:"tag_id"`
+	Name             string       `json:"name"`
+	Color            string       `json:"color"`
+	Income           models.Money `json:"income"`
+	Expense          models.Money `json:"expense"`
+	Net              models.Money `json:"net"`
+	TransactionCount int64        `json:"transaction_count"`
+}
+
+func newTagResponse(tag models.Tag, transactionCount int64) tagResponse {
+	return tagResponse{
+		ID:               tag.ID.String(),
+		Name:             tag.Name,
+		Color:            tag.Color,
+		TransactionCount: transactionCount,
+		CreatedAt:        tag.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:        tag.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toTag validates the request. On failure it returns the status code and
+// message to send back.
+func (in *tagRequest) toTag(userID uuid.UUID) (*models.Tag, int, string) {
+	name := models.NormalizeTagName(in.Name)
+	if name == "" || len(name) > 50 {
+		return nil, http.StatusBadRequest, "Name is required and may be at most 50 characters"
+	}
+	color := models.DefaultTagColor
+	if in.Color != "" {
+		if color = models.NormalizeTagColor(in.Color); color == "" {
+			return nil, http.StatusBadRequest, "Color must be a hex colour such as #ff8800"
+		}
+	}
+	return &models.Tag{UserID: userID, Name: name, Color: color}, 0, ""
+}
+
+func findOwnedTag(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Tag, bool) {
+	var tag models.Tag
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&tag).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Tag not found",
+		})
+		return nil, false
+	}
+	return &tag, true
+}
+
+// tagNameTaken reports whether another of the user's tags has the name.
+func tagNameTaken(db *gorm.DB, tag *models.Tag) bool {
+	var count int64
+	db.Model(&models.Tag{}).Where("user_id = ? AND name = ? AND id <> ?", tag.UserID, tag.Name, tag.ID).Count(&count)
+	return count > 0
+}
+
+// ownedTagIDs checks that every tag belongs to the user.
+func ownedTagIDs(db *gorm.DB, userID uuid.UUID, tagIDs []uuid.UUID) bool {
+	if len(tagIDs) == 0 {
+		return true
+	}
+	var count int64
+	db.Model(&models.Tag{}).Where("user_id = ? AND id IN ?", userID, tagIDs).Count(&count)
+	return count == int64(len(uniqueIDs(tagIDs)))
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// tagTransactions links every transaction to every tag. Existing links are
+// left alone.
+func tagTransactions(tx *gorm.DB, transactionIDs, tagIDs []uuid.UUID) (int64, error) {
+	links := []models.TransactionTag{}
+	for _, transactionID := range uniqueIDs(transactionIDs) {
+		for _, tagID := range uniqueIDs(tagIDs) {
+			links = append(links, models.TransactionTag{TransactionID: transactionID, TagID: tagID})
+		}
+	}
+	if len(links) == 0 {
+		return 0, nil
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links)
+	return result.RowsAffected, result.Error
+}
+
+// setTransactionTags replaces the tags of one transaction.
+func setTransactionTags(tx *gorm.DB, transactionID uuid.UUID, tagIDs []uuid.UUID) error {
+	if err := tx.Where("transaction_id = ?", transactionID).Delete(&models.TransactionTag{}).Error; err != nil {
+		return err
+	}
+	_, err := tagTransactions(tx, []uuid.UUID{transactionID}, tagIDs)
+	return err
+}
+
+// attachTags fills in the tags of the given transaction responses.
+func attachTags(db *gorm.DB, responses []transactionResponse) error {
+	if len(responses) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(responses))
+	for _, response := range responses {
+		ids = append(ids, response.ID)
+	}
+
+	var rows []struct {
+		TransactionID string
+		ID            uuid.UUID
+		Name          string
+		Color         string
+	}
+	if err := db.Table("transaction_tags").
+		Select("transaction_tags.transaction_id, tags.id, tags.name, tags.color").
+		Joins("JOIN tags ON tags.id = transaction_tags.tag_id").
+		Where("transaction_tags.transaction_id IN ?", ids).
+		Order("tags.name").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	tags := map[string][]tagRef{}
+	for _, row := range rows {
+		tags[row.TransactionID] = append(tags[row.TransactionID], tagRef{ID: row.ID, Name: row.Name, Color: row.Color})
+	}
+	for i := range responses {
+		responses[i].Tags = tags[responses[i].ID]
+		if responses[i].Tags == nil {
+			responses[i].Tags = []tagRef{}
+		}
+	}
+	return nil
+}
+
+// tagFilter resolves ?tag, a comma-separated list of tag names or IDs, to a
+// subquery of the transaction IDs carrying any of them. An unknown tag
+// matches nothing.
+func tagFilter(db *gorm.DB, userID uuid.UUID, value string) *gorm.DB {
+	var ids, names []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if _, err := uuid.Parse(part); err == nil {
+			ids = append(ids, part)
+		} else {
+			names = append(names, models.NormalizeTagName(part))
+		}
+	}
+
+	tags := db.Model(&models.Tag{}).Select("id").Where("user_id = ?", userID).
+		Where(db.Where("id IN ?", append(ids, "")).Or("name IN ?", append(names, "")))
+	return db.Model(&models.TransactionTag{}).Select("transaction_id").Where("tag_id IN (?)", tags)
+}
+
+func GetTags(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tags []models.Tag
+		if err := db.Where("user_id = ?", middleware.CurrentUserID(r)).Order("name").Find(&tags).Error; err != nil {
+			http.Error(w, "Failed to retrieve tags", http.StatusInternalServerError)
+			return
+		}
+
+		var counts []struct {
+			TagID string
+			Count int64
+		}
+		db.Model(&models.TransactionTag{}).
+			Select("transaction_tags.tag_id, COUNT(*) AS count").
+			Joins("JOIN transactions ON transactions.id = transaction_tags.transaction_id AND transactions.deleted_at IS NULL").
+			Where("transactions.user_id = ?", middleware.CurrentUserID(r)).
+			Group("transaction_tags.tag_id").
+			Scan(&counts)
+		usage := map[string]int64{}
+		for _, count := range counts {
+			usage[count.TagID] = count.Count
+		}
+
+		response := []tagResponse{}
+		for _, tag := range tags {
+			response = append(response, newTagResponse(tag, usage[tag.ID.String()]))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int           `json:"status_code"`
+			Data       []tagResponse `json:"data"`
+			Message    string        `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Tags successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func CreateTag(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request tagRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		tag, statusCode, message := request.toTag(middleware.CurrentUserID(r))
+		if tag == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		if tagNameTaken(db, tag) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "A tag with this name already exists",
+			})
+			return
+		}
+
+		if err := db.Create(tag).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create tag",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Tag created successfully",
+			"data":        newTagResponse(*tag, 0),
+		})
+	}
+}
+
+func UpdateTag(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request tagRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedTag(db, w, r)
+		if !ok {
+			return
+		}
+
+		if request.Color == "" {
+			request.Color = existing.Color
+		}
+		updated, statusCode, message := request.toTag(existing.UserID)
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		updated.ID = existing.ID
+		if tagNameTaken(db, updated) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusConflict,
+				"message":     "A tag with this name already exists",
+			})
+			return
+		}
+
+		if err := db.Model(existing).Updates(map[string]interface{}{"name": updated.Name, "color": updated.Color}).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update tag",
+			})
+			return
+		}
+
+		var count int64
+		db.Model(&models.TransactionTag{}).Where("tag_id = ?", existing.ID).Count(&count)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Tag updated successfully",
+			"data":        newTagResponse(*existing, count),
+		})
+	}
+}
+
+// DeleteTag removes the tag from every transaction and rule and deletes it.
+func DeleteTag(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag, ok := findOwnedTag(db, w, r)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.TransactionTag{}).Error; err != nil {
+				return err
+			}
+			err := updateRuleActions(tx, tag.ID, func(actions *models.RuleActions) {
+				tagIDs := actions.TagIDs[:0]
+				for _, tagID := range actions.TagIDs {
+					if tagID != tag.ID {
+						tagIDs = append(tagIDs, tagID)
+					}
+				}
+				actions.TagIDs = tagIDs
+			})
+			if err != nil {
+				return err
+			}
+			return tx.Delete(tag).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete tag",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Tag deleted successfully",
+		})
+	}
+}
+
+// decodeTagging reads and checks a bulk tagging request: every transaction
+// and every tag must belong to the caller.
+func decodeTagging(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*taggingRequest, bool) {
+	var request taggingRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusBadRequest,
+			"message":     "Invalid request body",
+		})
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	if len(request.TransactionIDs) == 0 || len(request.TagIDs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusBadRequest,
+			"message":     "transaction_ids and tag_ids are required",
+		})
+		return nil, false
+	}
+
+	userID := middleware.CurrentUserID(r)
+	var transactions int64
+	db.Model(&models.Transaction{}).Where("user_id = ? AND id IN ?", userID, request.TransactionIDs).Count(&transactions)
+	if transactions != int64(len(uniqueIDs(request.TransactionIDs))) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Transaction not found",
+		})
+		return nil, false
+	}
+	if !ownedTagIDs(db, userID, request.TagIDs) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Tag not found",
+		})
+		return nil, false
+	}
+	return &request, true
+}
+
+// AddTransactionTags puts every given tag on every given transaction.
+func AddTransactionTags(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request, ok := decodeTagging(db, w, r)
+		if !ok {
+			return
+		}
+
+		added, err := tagTransactions(db, request.TransactionIDs, request.TagIDs)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to tag transactions",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transactions tagged successfully",
+			"added":       added,
+		})
+	}
+}
+
+// RemoveTransactionTags takes every given tag off every given transaction.
+func RemoveTransactionTags(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request, ok := decodeTagging(db, w, r)
+		if !ok {
+			return
+		}
+
+		result := db.Where("transaction_id IN ? AND tag_id IN ?", request.TransactionIDs, request.TagIDs).Delete(&models.TransactionTag{})
+		if result.Error != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to untag transactions",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transactions untagged successfully",
+			"removed":     result.RowsAffected,
+		})
+	}
+}
+
+// GetTagTotals sums income and expenses per tag between ?from and ?to, in
+// the caller's base currency or ?currency, converting each day with that
+// day's rate. A transaction with several tags counts under each of them.
+func GetTagTotals(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		params := r.URL.Query()
+
+		currency := user.Currency()
+		if value := params.Get("currency"); value != "" {
+			currency = models.NormalizeCurrency(value)
+		}
+		if !models.IsValidCurrency(currency) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Currency must be an ISO-4217 code",
+			})
+			return
+		}
+
+		query := db.Table("transaction_tags").
+			Joins("JOIN transactions ON transactions.id = transaction_tags.transaction_id AND transactions.deleted_at IS NULL").
+			Where("transactions.user_id = ?", user.ID).
+			Where("transactions.type IN ?", []string{models.TransactionTypeIncome, models.TransactionTypeExpense})
+		if from := params.Get("from"); from != "" {
+			date, err := parseDate(from)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid from date",
+				})
+				return
+			}
+			query = query.Where("transactions.date >= ?", date)
+		}
+		if to := params.Get("to"); to != "" {
+			date, err := parseDate(to)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid to date",
+				})
+				return
+			}
+			query = query.Where("transactions.date < ?", date.AddDate(0, 0, 1))
+		}
+
+		var rows []struct {
+			TagID    string
+			Type     string
+			Currency string
+			Day      string
+			Total    models.Money
+			Count    int64
+		}
+		if err := query.
+			Select("transaction_tags.tag_id, transactions.type, transactions.currency, DATE_FORMAT(transactions.date, '%Y-%m-%d') AS day, SUM(transactions.amount_minor) AS total, COUNT(*) AS count").
+			Group("transaction_tags.tag_id, transactions.type, transactions.currency, day").
+			Scan(&rows).Error; err != nil {
+			http.Error(w, "Failed to retrieve tag totals", http.StatusInternalServerError)
+			return
+		}
+
+		var tags []models.Tag
+		if err := db.Where("user_id = ?", user.ID).Order("name").Find(&tags).Error; err != nil {
+			http.Error(w, "Failed to retrieve tag totals", http.StatusInternalServerError)
+			return
+		}
+		totals := map[string]*tagTotal{}
+		for _, tag := range tags {
+			zero := models.NewMoney(0, currency)
+			totals[tag.ID.String()] = &tagTotal{TagID: tag.ID, Name: tag.Name, Color: tag.Color, Income: zero, Expense: zero, Net: zero}
+		}
+
+		converter := exchange.NewConverter(db, user.ID)
+		missing := map[string]bool{}
+		for _, row := range rows {
+			total, found := totals[row.TagID]
+			if !found {
+				continue
+			}
+			total.TransactionCount += row.Count
+			day, err := time.ParseInLocation(dateLayout, row.Day, time.Local)
+			if err != nil {
+				continue
+			}
+			converted, err := converter.Convert(models.NewMoney(row.Total.Amount, row.Currency), currency, day)
+			if err != nil {
+				missing[row.Currency] = true
+				continue
+			}
+			if row.Type == models.TransactionTypeIncome {
+				total.Income = total.Income.Add(converted)
+			} else {
+				total.Expense = total.Expense.Add(converted)
+			}
+		}
+
+		response := []tagTotal{}
+		for _, tag := range tags {
+			total := totals[tag.ID.String()]
+			total.Net = total.Income.Sub(total.Expense)
+			response = append(response, *total)
+		}
+
+		missingRates := []string{}
+		for missingCurrency := range missing {
+			missingRates = append(missingRates, missingCurrency)
+		}
+		sort.Strings(missingRates)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code":       http.StatusOK,
+			"message":           "Tag totals successfully retrieved",
+			"data":              response,
+			"missing_rates_for": missingRates,
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"expense-app-backend/templates"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const (
+	templateModeReapply = "reapply"
+	templateModeMerge   = "merge"
+)
+
+type templateApplyResult struct {
+	CategoriesCreated    int `json:"categories_created"`
+	SubCategoriesCreated int `json:"sub_categories_created"`
+}
+
+// applyCategoryTemplate copies a template into the user's categories. Existing
+// categories are matched by name and type and never modified; with merge set,
+// the template's sub-categories missing from them are added as well.
+func applyCategoryTemplate(tx *gorm.DB, userID uuid.UUID, template *templates.CategoryTemplate, merge bool) (templateApplyResult, error) {
+	var result templateApplyResult
+
+	var existing []models.Category
+	if err := tx.Preload("Children").Where("user_id = ? AND parent_id IS NULL", userID).Find(&existing).Error; err != nil {
+		return result, err
+	}
+
+	existingByKey := make(map[string]*models.Category)
+	for i := range existing {
+		existingByKey[templateKey(existing[i].Name, existing[i].CategoryType)] = &existing[i]
+	}
+
+	for _, templateCategory := range template.Categories {
+		current, found := existingByKey[templateKey(templateCategory.Name, templateCategory.CategoryType)]
+		if !found {
+			category := models.Category{
+				ID:           uuid.New(),
+				UserID:       &userID,
+				Name:         templateCategory.Name,
+				CategoryType: templateCategory.CategoryType,
+				Position:     len(existing) + result.CategoriesCreated,
+				Children:     []models.Category{},
+			}
+			for i, name := range templateCategory.SubCategories {
+				category.Children = append(category.Children, models.Category{
+					ID:           uuid.New(),
+					UserID:       &userID,
+					Name:         name,
+					CategoryType: templateCategory.CategoryType,
+					Position:     i,
+				})
+			}
+
+			if err := tx.Create(&category).Error; err != nil {
+				return result, err
+			}
+			result.CategoriesCreated++
+			result.SubCategoriesCreated += len(category.Children)
+			continue
+		}
+
+		if !merge {
+			continue
+		}
+
+		existingNames := make(map[string]bool)
+		for _, subCategory := range current.Children {
+			existingNames[strings.ToLower(subCategory.Name)] = true
+		}
+
+		var missing []models.Category
+		for _, name := range templateCategory.SubCategories {
+			if existingNames[strings.ToLower(name)] {
+				continue
+			}
+			parentID := current.ID
+			missing = append(missing, models.Category{
+				ID:           uuid.New(),
+				UserID:       &userID,
+				ParentID:     &parentID,
+				Name:         name,
+				CategoryType: current.CategoryType,
+				Position:     len(current.Children) + len(missing),
+			})
+		}
+
+		if len(missing) > 0 {
+			if err := tx.Create(&missing).Error; err != nil {
+				return result, err
+			}
+			result.SubCategoriesCreated += len(missing)
+		}
+	}
+
+	return result, nil
+}
+
+func templateKey(name, categoryType string) string {
+	return strings.ToLower(name) + "|" + strings.ToLower(categoryType)
+}
+
+func GetCategoryTemplates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := templates.CategoryTemplates()
+		if err != nil {
+			http.Error(w, "Failed to load category templates", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                          `json:"status_code"`
+			Data       []templates.CategoryTemplate `json:"data"`
+			Message    string                       `json:"message"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       list,
+			Message:    "Category templates successfully retrieved",
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func ApplyCategoryTemplate(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale := mux.Vars(r)["locale"]
+
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = templateModeMerge
+		}
+		if mode != templateModeMerge && mode != templateModeReapply {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Mode must be merge or reapply",
+			})
+			return
+		}
+
+		template, err := templates.LoadCategoryTemplate(locale)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Category template not found",
+			})
+			return
+		}
+
+		var result templateApplyResult
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var applyErr error
+			result, applyErr = applyCategoryTemplate(tx, middleware.CurrentUserID(r), template, mode == templateModeMerge)
+			return applyErr
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to apply category template",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Category template applied successfully",
+			"data":        result,
+		})
+	}
+}
@@ -0,0 +1,745 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-app-backend/exchange"
+	"expense-app-backend/ledger"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const dateLayout = "2006-01-02"
+
+type transactionRequest struct {
+	AccountID  uuid.UUID   `json:"account_id"`
+	CategoryID *uuid.UUID  `json:"category_id"`
+	Type       string      `json:"type"`
+	Amount     json.Number `json:"amount"`
+	Date       string      `json:"date"`
+	Note       string      `json:"note"`
+	// Splits divide the amount over several categories instead of
+	// category_id. The split amounts must add up to amount.
+	Splits []splitRequest `json:"splits"`
+	// TagIDs replaces the transaction's tags; leaving it out keeps them.
+	TagIDs *[]uuid.UUID `json:"tag_ids"`
+	// PayeeID picks a payee, or Payee names one; an unknown name creates
+	// the payee. Its defaults fill in a missing account and category.
+	PayeeID *uuid.UUID `json:"payee_id"`
+	Payee   string     `json:"payee"`
+
+	// payee is the payee resolved by toTransaction, not saved yet when it
+	// is new.
+	payee *models.Payee
+}
+
+type splitRequest struct {
+	CategoryID *uuid.UUID  `json:"category_id"`
+	Amount     json.Number `json:"amount"`
+	Note       string      `json:"note"`
+}
+
+type splitResponse struct {
+	CategoryID *uuid.UUID   `json:"category_id"`
+	Amount     models.Money `json:"amount"`
+	Note       string       `json:"note"`
+}
+
+type transactionResponse struct {
+	ID             string          `json:"id"`
+	AccountID      string          `json:"account_id"`
+	CategoryID     *uuid.UUID      `json:"category_id"`
+	TransferID     *uuid.UUID      `json:"transfer_id"`
+	PayeeID        *uuid.UUID      `json:"payee_id"`
+	RecurringID    *uuid.UUID      `json:"recurring_id"`
+	OccurrenceDate *string         `json:"occurrence_date"`
+	ImportBatchID  *uuid.UUID      `json:"import_batch_id"`
+	Type           string          `json:"type"`
+	Amount         models.Money    `json:"amount"`
+	Date           string          `json:"date"`
+	Note           string          `json:"note"`
+	Splits         []splitResponse `json:"splits,omitempty"`
+	Tags           []tagRef        `json:"tags"`
+	CreatedAt      string          `json:"created_at"`
+	UpdatedAt      string          `json:"updated_at"`
+}
+
+func newTransactionResponse(transaction models.Transaction) transactionResponse {
+	var occurrenceDate *string
+	if transaction.OccurrenceDate != nil {
+		value := transaction.OccurrenceDate.Format(dateLayout)
+		occurrenceDate = &value
+	}
+	var splits []splitResponse
+	for _, split := range transaction.Splits {
+		splits = append(splits, splitResponse{CategoryID: split.CategoryID, Amount: split.Amount, Note: split.Note})
+	}
+	return transactionResponse{
+		ID:             transaction.ID.String(),
+		AccountID:      transaction.AccountID.String(),
+		CategoryID:     transaction.CategoryID,
+		TransferID:     transaction.TransferID,
+		PayeeID:        transaction.PayeeID,
+		RecurringID:    transaction.RecurringID,
+		OccurrenceDate: occurrenceDate,
+		ImportBatchID:  transaction.ImportBatchID,
+		Type:           transaction.Type,
+		Amount:         transaction.Amount,
+		Date:           transaction.Date.Format(dateLayout),
+		Note:           transaction.Note,
+		Splits:         splits,
+		CreatedAt:      transaction.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      transaction.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// transactionResponseWithTags builds the response for a single transaction,
+// tags included.
+func transactionResponseWithTags(db *gorm.DB, transaction models.Transaction) transactionResponse {
+	response := []transactionResponse{newTransactionResponse(transaction)}
+	attachTags(db, response)
+	return response[0]
+}
+
+func splitOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// parseDate accepts either a plain date or a full RFC 3339 timestamp.
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.ParseInLocation(dateLayout, value, time.Local); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// toTransaction validates the request against the user's accounts and
+// visible categories. On failure it returns the status code and message to
+// send back.
+func (in *transactionRequest) toTransaction(db *gorm.DB, userID uuid.UUID) (*models.Transaction, int, string) {
+	if !models.IsValidTransactionType(in.Type) {
+		return nil, http.StatusBadRequest, "Type must be expense or income"
+	}
+	if statusCode, message := in.resolvePayee(db, userID); statusCode != 0 {
+		return nil, statusCode, message
+	}
+	var account models.Account
+	if err := db.Where("id = ? AND user_id = ?", in.AccountID, userID).First(&account).Error; err != nil {
+		return nil, http.StatusNotFound, "Account not found"
+	}
+
+	// Amounts are always entered in the currency of the account they touch.
+	amount, err := models.ParseMoney(in.Amount.String(), account.Currency)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid amount"
+	}
+	if !amount.IsPositive() {
+		return nil, http.StatusBadRequest, "Amount must be greater than zero"
+	}
+
+	date := time.Now()
+	if in.Date != "" {
+		parsed, err := parseDate(in.Date)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Invalid date"
+		}
+		date = parsed
+	}
+
+	if in.CategoryID != nil {
+		if statusCode, message := checkTransactionCategory(db, userID, *in.CategoryID, in.Type); statusCode != 0 {
+			return nil, statusCode, message
+		}
+	}
+
+	if in.TagIDs != nil && !ownedTagIDs(db, userID, *in.TagIDs) {
+		return nil, http.StatusNotFound, "Tag not found"
+	}
+
+	var splits []models.TransactionSplit
+	if len(in.Splits) > 0 {
+		if in.CategoryID != nil {
+			return nil, http.StatusBadRequest, "A split transaction takes its categories from the splits"
+		}
+		total := models.NewMoney(0, account.Currency)
+		for i, line := range in.Splits {
+			splitAmount, err := models.ParseMoney(line.Amount.String(), account.Currency)
+			if err != nil || !splitAmount.IsPositive() {
+				return nil, http.StatusBadRequest, "Split amounts must be greater than zero"
+			}
+			if line.CategoryID != nil {
+				if statusCode, message := checkTransactionCategory(db, userID, *line.CategoryID, in.Type); statusCode != 0 {
+					return nil, statusCode, message
+				}
+			}
+			total = total.Add(splitAmount)
+			splits = append(splits, models.TransactionSplit{CategoryID: line.CategoryID, Amount: splitAmount, Note: line.Note, Position: i})
+		}
+		if total.Amount != amount.Amount {
+			return nil, http.StatusBadRequest, "Splits add up to " + total.Decimal() + " instead of " + amount.Decimal()
+		}
+	}
+
+	transaction := &models.Transaction{
+		UserID:     userID,
+		AccountID:  in.AccountID,
+		CategoryID: in.CategoryID,
+		Type:       in.Type,
+		Amount:     amount,
+		Currency:   amount.Currency,
+		Date:       date,
+		Note:       in.Note,
+		Splits:     splits,
+	}
+	if in.payee != nil {
+		transaction.PayeeID = &in.payee.ID
+	}
+	return transaction, 0, ""
+}
+
+// resolvePayee finds the payee of the request and lets its defaults fill in
+// a missing account and, when it has the right type, a missing category.
+func (in *transactionRequest) resolvePayee(db *gorm.DB, userID uuid.UUID) (int, string) {
+	switch {
+	case in.PayeeID != nil:
+		var payee models.Payee
+		if err := db.Where("id = ? AND user_id = ?", *in.PayeeID, userID).First(&payee).Error; err != nil {
+			return http.StatusNotFound, "Payee not found"
+		}
+		in.payee = &payee
+	case strings.TrimSpace(in.Payee) != "":
+		payee, err := models.FindPayee(db, userID, in.Payee)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			payee = &models.Payee{ID: uuid.New(), UserID: userID, Name: strings.TrimSpace(in.Payee)}
+		} else if err != nil {
+			return http.StatusInternalServerError, "Failed to look up payee"
+		}
+		in.payee = payee
+	default:
+		return 0, ""
+	}
+
+	if in.AccountID == uuid.Nil && in.payee.DefaultAccountID != nil {
+		in.AccountID = *in.payee.DefaultAccountID
+	}
+	if in.CategoryID == nil && len(in.Splits) == 0 && in.payee.DefaultCategoryID != nil {
+		if statusCode, _ := checkTransactionCategory(db, userID, *in.payee.DefaultCategoryID, in.Type); statusCode == 0 {
+			in.CategoryID = in.payee.DefaultCategoryID
+		}
+	}
+	return 0, ""
+}
+
+// usePayee saves a payee that was created from transaction input and counts
+// the use for suggestions. A payee without defaults learns them from the
+// transaction.
+func usePayee(tx *gorm.DB, payee *models.Payee, transaction *models.Transaction) error {
+	if payee == nil {
+		return nil
+	}
+	if payee.CreatedAt.IsZero() {
+		if err := tx.Create(payee).Error; err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{
+		"usage_count":  gorm.Expr("usage_count + 1"),
+		"last_used_at": time.Now(),
+	}
+	if payee.DefaultCategoryID == nil && transaction.CategoryID != nil {
+		updates["default_category_id"] = transaction.CategoryID
+	}
+	if payee.DefaultAccountID == nil {
+		updates["default_account_id"] = transaction.AccountID
+	}
+	return tx.Model(payee).Updates(updates).Error
+}
+
+// checkTransactionCategory makes sure the category is visible to the user
+// and of the transaction's type.
+func checkTransactionCategory(db *gorm.DB, userID uuid.UUID, categoryID uuid.UUID, transactionType string) (int, string) {
+	var category models.Category
+	if err := visibleCategories(db, userID).Where("id = ?", categoryID).First(&category).Error; err != nil {
+		return http.StatusNotFound, "Category not found"
+	}
+	if category.CategoryType != transactionType {
+		return http.StatusBadRequest, "Category type does not match transaction type"
+	}
+	return 0, ""
+}
+
+func findOwnedTransaction(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Transaction, bool) {
+	var transaction models.Transaction
+	if err := db.Preload("Splits", splitOrder).Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&transaction).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Transaction not found",
+		})
+		return nil, false
+	}
+	return &transaction, true
+}
+
+// rejectTransferLeg refuses to change a transaction that belongs to a
+// transfer on its own, since that would unbalance the pair.
+func rejectTransferLeg(w http.ResponseWriter, transaction *models.Transaction) bool {
+	if !transaction.IsTransferLeg() {
+		return false
+	}
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status_code": http.StatusConflict,
+		"message":     "Transaction belongs to a transfer, change the transfer instead",
+	})
+	return true
+}
+
+// filterTransactions selects the user's transactions matching the
+// account_id, type, category_id, tag, from and to query parameters. A
+// category includes its subcategories and split lines in them. On failure it
+// returns the status code and message to send back.
+func filterTransactions(db *gorm.DB, userID uuid.UUID, params url.Values) (*gorm.DB, int, string) {
+	query := db.Model(&models.Transaction{}).Where("user_id = ?", userID)
+	if accountID := params.Get("account_id"); accountID != "" {
+		query = query.Where("account_id = ?", accountID)
+	}
+	if transactionType := params.Get("type"); transactionType != "" {
+		query = query.Where("type = ?", transactionType)
+	}
+	if categoryID := params.Get("category_id"); categoryID != "" {
+		id, err := uuid.Parse(categoryID)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Invalid category ID"
+		}
+		tree, err := models.LoadCategoryTree(db, userID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Failed to load categories"
+		}
+		categoryIDs := tree.Descendants(id)
+		if len(categoryIDs) == 0 {
+			categoryIDs = []uuid.UUID{id}
+		}
+		query = query.Where("(category_id IN ? OR id IN (?))", categoryIDs,
+			db.Model(&models.TransactionSplit{}).Select("transaction_id").Where("category_id IN ?", categoryIDs))
+	}
+	if tag := params.Get("tag"); tag != "" {
+		query = query.Where("id IN (?)", tagFilter(db, userID, tag))
+	}
+	if from := params.Get("from"); from != "" {
+		date, err := parseDate(from)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Invalid from date"
+		}
+		query = query.Where("date >= ?", date)
+	}
+	if to := params.Get("to"); to != "" {
+		date, err := parseDate(to)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Invalid to date"
+		}
+		query = query.Where("date < ?", date.AddDate(0, 0, 1))
+	}
+	return query, 0, ""
+}
+
+func GetTransactions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.CurrentUserID(r)
+		params := r.URL.Query()
+
+		page, _ := strconv.Atoi(params.Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		limit, _ := strconv.Atoi(params.Get("limit"))
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		query, statusCode, message := filterTransactions(db, userID, params)
+		if query == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			http.Error(w, "Failed to retrieve transactions", http.StatusInternalServerError)
+			return
+		}
+
+		var transactions []models.Transaction
+		if err := query.Preload("Splits", splitOrder).Order("date DESC, created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&transactions).Error; err != nil {
+			http.Error(w, "Failed to retrieve transactions", http.StatusInternalServerError)
+			return
+		}
+
+		response := []transactionResponse{}
+		for _, transaction := range transactions {
+			response = append(response, newTransactionResponse(transaction))
+		}
+		if err := attachTags(db, response); err != nil {
+			http.Error(w, "Failed to retrieve transactions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                   `json:"status_code"`
+			Data       []transactionResponse `json:"data"`
+			Message    string                `json:"message"`
+			Count      int64                 `json:"count"`
+			Page       int                   `json:"page"`
+			Limit      int                   `json:"limit"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Transactions successfully retrieved",
+			Count:      count,
+			Page:       page,
+			Limit:      limit,
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetTransactionById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transaction, ok := findOwnedTransaction(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transaction successfully retrieved",
+			"data":        transactionResponseWithTags(db, *transaction),
+		})
+	}
+}
+
+func CreateTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request transactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		transaction, statusCode, message := request.toTransaction(db, middleware.CurrentUserID(r))
+		if transaction == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		payeeName := ""
+		if request.payee != nil {
+			payeeName = request.payee.Name
+		}
+		tagIDs, err := applyRules(db, transaction, payeeName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to apply rules",
+			})
+			return
+		}
+		if request.TagIDs != nil {
+			tagIDs = append(tagIDs, *request.TagIDs...)
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := usePayee(tx, request.payee, transaction); err != nil {
+				return err
+			}
+			if err := tx.Create(transaction).Error; err != nil {
+				return err
+			}
+			if len(tagIDs) > 0 {
+				if _, err := tagTransactions(tx, []uuid.UUID{transaction.ID}, tagIDs); err != nil {
+					return err
+				}
+			}
+			return ledger.RecordTransaction(tx, transaction)
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create transaction",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Transaction created successfully",
+			"data":        transactionResponseWithTags(db, *transaction),
+		})
+	}
+}
+
+func UpdateTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request transactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		existing, ok := findOwnedTransaction(db, w, r)
+		if !ok || rejectTransferLeg(w, existing) {
+			return
+		}
+
+		updated, statusCode, message := request.toTransaction(db, middleware.CurrentUserID(r))
+		if updated == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := ledger.Remove(tx, models.JournalSourceTransaction, existing.ID); err != nil {
+				return err
+			}
+			if err := tx.Where("transaction_id = ?", existing.ID).Delete(&models.TransactionSplit{}).Error; err != nil {
+				return err
+			}
+			for i := range updated.Splits {
+				updated.Splits[i].TransactionID = existing.ID
+			}
+			if len(updated.Splits) > 0 {
+				if err := tx.Create(&updated.Splits).Error; err != nil {
+					return err
+				}
+			}
+			if updated.PayeeID != nil && (existing.PayeeID == nil || *existing.PayeeID != *updated.PayeeID) {
+				if err := usePayee(tx, request.payee, updated); err != nil {
+					return err
+				}
+			}
+			if request.TagIDs != nil {
+				if err := setTransactionTags(tx, existing.ID, *request.TagIDs); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(existing).Updates(map[string]interface{}{
+				"account_id":   updated.AccountID,
+				"category_id":  updated.CategoryID,
+				"payee_id":     updated.PayeeID,
+				"type":         updated.Type,
+				"amount_minor": updated.Amount,
+				"currency":     updated.Currency,
+				"date":         updated.Date,
+				"note":         updated.Note,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Preload("Splits", splitOrder).Where("id = ?", existing.ID).First(existing).Error; err != nil {
+				return err
+			}
+			return ledger.RecordTransaction(tx, existing)
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to update transaction",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transaction updated successfully",
+			"data":        transactionResponseWithTags(db, *existing),
+		})
+	}
+}
+
+func DeleteTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transaction, ok := findOwnedTransaction(db, w, r)
+		if !ok || rejectTransferLeg(w, transaction) {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(transaction).Error; err != nil {
+				return err
+			}
+			return ledger.Remove(tx, models.JournalSourceTransaction, transaction.ID)
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete transaction",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transaction deleted successfully",
+		})
+	}
+}
+
+// GetTransactionTotals sums income and expenses between ?from and ?to in the
+// caller's base currency, or in ?currency. Every day's amounts are converted
+// with the rate of that day, so past totals do not drift with today's rates.
+func GetTransactionTotals(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		params := r.URL.Query()
+
+		currency := user.Currency()
+		if value := params.Get("currency"); value != "" {
+			currency = models.NormalizeCurrency(value)
+		}
+		if !models.IsValidCurrency(currency) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Currency must be an ISO-4217 code",
+			})
+			return
+		}
+
+		// Transfer legs only move money between accounts; a transfer fee is
+		// recorded as an ordinary expense and is counted.
+		query := db.Model(&models.Transaction{}).
+			Where("user_id = ?", user.ID).
+			Where("type IN ?", []string{models.TransactionTypeIncome, models.TransactionTypeExpense})
+		if tag := params.Get("tag"); tag != "" {
+			query = query.Where("id IN (?)", tagFilter(db, user.ID, tag))
+		}
+		if from := params.Get("from"); from != "" {
+			date, err := parseDate(from)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid from date",
+				})
+				return
+			}
+			query = query.Where("date >= ?", date)
+		}
+		if to := params.Get("to"); to != "" {
+			date, err := parseDate(to)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status_code": http.StatusBadRequest,
+					"message":     "Invalid to date",
+				})
+				return
+			}
+			query = query.Where("date < ?", date.AddDate(0, 0, 1))
+		}
+
+		var rows []struct {
+			Type     string
+			Currency string
+			Day      string
+			Total    models.Money
+		}
+		if err := query.
+			Select("type, currency, DATE_FORMAT(date, '%Y-%m-%d') AS day, SUM(amount_minor) AS total").
+			Group("type, currency, day").
+			Scan(&rows).Error; err != nil {
+			http.Error(w, "Failed to retrieve totals", http.StatusInternalServerError)
+			return
+		}
+
+		converter := exchange.NewConverter(db, user.ID)
+		totals := map[string]models.Money{
+			models.TransactionTypeIncome:  models.NewMoney(0, currency),
+			models.TransactionTypeExpense: models.NewMoney(0, currency),
+		}
+		missing := map[string]bool{}
+		for _, row := range rows {
+			total, found := totals[row.Type]
+			if !found {
+				continue
+			}
+			day, err := time.ParseInLocation(dateLayout, row.Day, time.Local)
+			if err != nil {
+				continue
+			}
+			amount := models.NewMoney(row.Total.Amount, row.Currency)
+			converted, err := converter.Convert(amount, currency, day)
+			if err != nil {
+				missing[amount.Currency] = true
+				continue
+			}
+			totals[row.Type] = total.Add(converted)
+		}
+
+		missingRates := []string{}
+		for missingCurrency := range missing {
+			missingRates = append(missingRates, missingCurrency)
+		}
+		sort.Strings(missingRates)
+
+		income := totals[models.TransactionTypeIncome]
+		expense := totals[models.TransactionTypeExpense]
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transaction totals successfully retrieved",
+			"data": map[string]interface{}{
+				"income":            income,
+				"expense":           expense,
+				"net":               income.Sub(expense),
+				"missing_rates_for": missingRates,
+			},
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expense-app-backend/exchange"
+	"expense-app-backend/ledger"
+	"expense-app-backend/middleware"
+	"expense-app-backend/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type transferRequest struct {
+	FromAccountID uuid.UUID   `json:"from_account_id"`
+	ToAccountID   uuid.UUID   `json:"to_account_id"`
+	Amount        json.Number `json:"amount"`
+	ToAmount      json.Number `json:"to_amount"`
+	Fee           json.Number `json:"fee"`
+	FeeCategoryID *uuid.UUID  `json:"fee_category_id"`
+	Date          string      `json:"date"`
+	Note          string      `json:"note"`
+}
+
+type transferResponse struct {
+	ID            string       `json:"id"`
+	FromAccountID string       `json:"from_account_id"`
+	ToAccountID   string       `json:"to_account_id"`
+	FromAmount    models.Money `json:"from_amount"`
+	ToAmount      models.Money `json:"to_amount"`
+	Fee           models.Money `json:"fee"`
+	FeeCategoryID *uuid.UUID   `json:"fee_category_id"`
+	Date          string       `json:"date"`
+	Note          string       `json:"note"`
+	CreatedAt     string       `json:"created_at"`
+	UpdatedAt     string       `json:"updated_at"`
+}
+
+func newTransferResponse(transfer models.Transfer) transferResponse {
+	return transferResponse{
+		ID:            transfer.ID.String(),
+		FromAccountID: transfer.FromAccountID.String(),
+		ToAccountID:   transfer.ToAccountID.String(),
+		FromAmount:    transfer.FromAmount,
+		ToAmount:      transfer.ToAmount,
+		Fee:           transfer.Fee,
+		FeeCategoryID: transfer.FeeCategoryID,
+		Date:          transfer.Date.Format(dateLayout),
+		Note:          transfer.Note,
+		CreatedAt:     transfer.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     transfer.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toTransfer validates the request against the user's accounts. Amount is in
+// the source account's currency; across currencies to_amount is what arrived
+// on the destination account, and when it is left out it is converted with
+// the rate of the transfer date. On failure it returns the status code and
+// message to send back.
+func (in *transferRequest) toTransfer(db *gorm.DB, userID uuid.UUID) (*models.Transfer, int, string) {
+	if in.FromAccountID == in.ToAccountID {
+		return nil, http.StatusBadRequest, "Source and destination accounts must differ"
+	}
+
+	var from, to models.Account
+	if err := db.Where("id = ? AND user_id = ?", in.FromAccountID, userID).First(&from).Error; err != nil {
+		return nil, http.StatusNotFound, "Source account not found"
+	}
+	if err := db.Where("id = ? AND user_id = ?", in.ToAccountID, userID).First(&to).Error; err != nil {
+		return nil, http.StatusNotFound, "Destination account not found"
+	}
+
+	amount, err := models.ParseMoney(in.Amount.String(), from.Currency)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid amount"
+	}
+	if !amount.IsPositive() {
+		return nil, http.StatusBadRequest, "Amount must be greater than zero"
+	}
+
+	fee := models.NewMoney(0, from.Currency)
+	if in.Fee != "" {
+		if fee, err = models.ParseMoney(in.Fee.String(), from.Currency); err != nil || fee.IsNegative() {
+			return nil, http.StatusBadRequest, "Invalid fee"
+		}
+	}
+
+	if in.FeeCategoryID != nil {
+		var category models.Category
+		if err := visibleCategories(db, userID).Where("id = ?", *in.FeeCategoryID).First(&category).Error; err != nil {
+			return nil, http.StatusNotFound, "Fee category not found"
+		}
+		if category.CategoryType != models.TransactionTypeExpense {
+			return nil, http.StatusBadRequest, "Fee category must be an expense category"
+		}
+	}
+
+	date := time.Now()
+	if in.Date != "" {
+		if date, err = parseDate(in.Date); err != nil {
+			return nil, http.StatusBadRequest, "Invalid date"
+		}
+	}
+
+	received := amount
+	if from.Currency != to.Currency {
+		if in.ToAmount != "" {
+			received, err = models.ParseMoney(in.ToAmount.String(), to.Currency)
+			if err != nil || !received.IsPositive() {
+				return nil, http.StatusBadRequest, "Invalid to_amount"
+			}
+		} else if received, err = exchange.NewConverter(db, userID).Convert(amount, to.Currency, date); err != nil {
+			return nil, http.StatusBadRequest, "No exchange rate available, to_amount is required"
+		}
+	}
+
+	return &models.Transfer{
+		UserID:        userID,
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		FromAmount:    amount,
+		ToAmount:      received,
+		Fee:           fee,
+		FeeCategoryID: in.FeeCategoryID,
+		Date:          date,
+		Note:          in.Note,
+	}, 0, ""
+}
+
+// transferLegs returns the transactions that make up a transfer: the debit,
+// the credit and the fee expense when there is one.
+func transferLegs(transfer *models.Transfer) []models.Transaction {
+	legs := []models.Transaction{
+		{
+			UserID:     transfer.UserID,
+			AccountID:  transfer.FromAccountID,
+			TransferID: &transfer.ID,
+			Type:       models.TransactionTypeTransferOut,
+			Amount:     transfer.FromAmount,
+			Date:       transfer.Date,
+			Note:       transfer.Note,
+		},
+		{
+			UserID:     transfer.UserID,
+			AccountID:  transfer.ToAccountID,
+			TransferID: &transfer.ID,
+			Type:       models.TransactionTypeTransferIn,
+			Amount:     transfer.ToAmount,
+			Date:       transfer.Date,
+			Note:       transfer.Note,
+		},
+	}
+	if transfer.Fee.IsPositive() {
+		legs = append(legs, models.Transaction{
+			UserID:     transfer.UserID,
+			AccountID:  transfer.FromAccountID,
+			CategoryID: transfer.FeeCategoryID,
+			TransferID: &transfer.ID,
+			Type:       models.TransactionTypeExpense,
+			Amount:     transfer.Fee,
+			Date:       transfer.Date,
+			Note:       "Transfer fee",
+		})
+	}
+	return legs
+}
+
+func findOwnedTransfer(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.Transfer, bool) {
+	var transfer models.Transfer
+	if err := db.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.CurrentUserID(r)).First(&transfer).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusNotFound,
+			"message":     "Transfer not found",
+		})
+		return nil, false
+	}
+	return &transfer, true
+}
+
+func GetTransfers(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		page, _ := strconv.Atoi(params.Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		limit, _ := strconv.Atoi(params.Get("limit"))
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		query := db.Model(&models.Transfer{}).Where("user_id = ?", middleware.CurrentUserID(r))
+		if accountID := params.Get("account_id"); accountID != "" {
+			query = query.Where("from_account_id = ? OR to_account_id = ?", accountID, accountID)
+		}
+
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			http.Error(w, "Failed to retrieve transfers", http.StatusInternalServerError)
+			return
+		}
+
+		var transfers []models.Transfer
+		if err := query.Order("date DESC, created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&transfers).Error; err != nil {
+			http.Error(w, "Failed to retrieve transfers", http.StatusInternalServerError)
+			return
+		}
+
+		response := []transferResponse{}
+		for _, transfer := range transfers {
+			response = append(response, newTransferResponse(transfer))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		responseJson := struct {
+			StatusCode int                `json:"status_code"`
+			Data       []transferResponse `json:"data"`
+			Message    string             `json:"message"`
+			Count      int64              `json:"count"`
+			Page       int                `json:"page"`
+			Limit      int                `json:"limit"`
+		}{
+			StatusCode: http.StatusOK,
+			Data:       response,
+			Message:    "Transfers successfully retrieved",
+			Count:      count,
+			Page:       page,
+			Limit:      limit,
+		}
+
+		json.NewEncoder(w).Encode(responseJson)
+	}
+}
+
+func GetTransferById(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transfer, ok := findOwnedTransfer(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transfer successfully retrieved",
+			"data":        newTransferResponse(*transfer),
+		})
+	}
+}
+
+// CreateTransfer debits the source account and credits the destination in a
+// single database transaction, so either both legs exist or neither does.
+func CreateTransfer(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request transferRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Invalid request body",
+			})
+			return
+		}
+		defer r.Body.Close()
+
+		transfer, statusCode, message := request.toTransfer(db, middleware.CurrentUserID(r))
+		if transfer == nil {
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": statusCode,
+				"message":     message,
+			})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(transfer).Error; err != nil {
+				return err
+			}
+			legs := transferLegs(transfer)
+			if err := tx.Create(&legs).Error; err != nil {
+				return err
+			}
+			return ledger.RecordTransfer(tx, transfer)
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to create transfer",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusCreated,
+			"message":     "Transfer created successfully",
+			"data":        newTransferResponse(*transfer),
+		})
+	}
+}
+
+// DeleteTransfer removes the transfer with all of its legs and reverses their
+// effect on both account balances.
+func DeleteTransfer(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transfer, ok := findOwnedTransfer(db, w, r)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("transfer_id = ?", transfer.ID).Delete(&models.Transaction{}).Error; err != nil {
+				return err
+			}
+			if err := ledger.Remove(tx, models.JournalSourceTransfer, transfer.ID); err != nil {
+				return err
+			}
+			return tx.Delete(transfer).Error
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status_code": http.StatusInternalServerError,
+				"message":     "Failed to delete transfer",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status_code": http.StatusOK,
+			"message":     "Transfer deleted successfully",
+		})
+	}
+}
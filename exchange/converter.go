@@ -0,0 +1,168 @@
+package exchange
+
+import (
+	"errors"
+	"expense-app-backend/models"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// pivotCurrencies are tried, in order, when no direct rate exists between two
+// currencies. EUR comes first since that is what ECB files are quoted in.
+var pivotCurrencies = []string{ECBBaseCurrency, "USD"}
+
+// Converter converts amounts between currencies using the most recent rate on
+// or before a given date. It caches lookups, so create one per request.
+type Converter struct {
+	db     *gorm.DB
+	userID uuid.UUID
+	cache  map[string]*big.Rat
+}
+
+func NewConverter(db *gorm.DB, userID uuid.UUID) *Converter {
+	return &Converter{db: db, userID: userID, cache: make(map[string]*big.Rat)}
+}
+
+func (c *Converter) Convert(amount models.Money, currency string, date time.Time) (models.Money, error) {
+	currency = models.NormalizeCurrency(currency)
+	if amount.Currency == currency {
+		return amount, nil
+	}
+
+	rate, err := c.Rate(amount.Currency, currency, date)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return amount.Convert(rate, currency)
+}
+
+// Rate returns how many units of to one unit of from buys on date, going
+// through a pivot currency when there is no direct or inverse rate.
+func (c *Converter) Rate(from, to string, date time.Time) (*big.Rat, error) {
+	from = models.NormalizeCurrency(from)
+	to = models.NormalizeCurrency(to)
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	if rate, err := c.pairRate(from, to, date); err == nil {
+		return rate, nil
+	}
+
+	pivots := append([]string{}, pivotCurrencies...)
+	pivots = append(pivots, models.DefaultCurrency())
+	for _, pivot := range pivots {
+		if pivot == from || pivot == to {
+			continue
+		}
+		first, err := c.pairRate(from, pivot, date)
+		if err != nil {
+			continue
+		}
+		second, err := c.pairRate(pivot, to, date)
+		if err != nil {
+			continue
+		}
+		return new(big.Rat).Mul(first, second), nil
+	}
+
+	return nil, ErrRateNotFound
+}
+
+// pairRate looks for a direct rate and falls back to inverting the reverse one.
+func (c *Converter) pairRate(from, to string, date time.Time) (*big.Rat, error) {
+	if rate, err := c.storedRate(from, to, date); err == nil {
+		return rate, nil
+	}
+
+	inverse, err := c.storedRate(to, from, date)
+	if err != nil {
+		return nil, err
+	}
+	if inverse.Sign() == 0 {
+		return nil, ErrRateNotFound
+	}
+	return new(big.Rat).Inv(inverse), nil
+}
+
+func (c *Converter) storedRate(base, quote string, date time.Time) (*big.Rat, error) {
+	day := date.Format("2006-01-02")
+	key := base + quote + day
+	if rate, found := c.cache[key]; found {
+		if rate == nil {
+			return nil, ErrRateNotFound
+		}
+		return rate, nil
+	}
+
+	var stored models.ExchangeRate
+	err := c.db.
+		Where("base_currency = ? AND quote_currency = ? AND date <= ?", base, quote, day).
+		Where("(user_id = ? OR user_id IS NULL)", c.userID).
+		Order("date DESC").
+		Order("user_id IS NULL").
+		First(&stored).Error
+	if err != nil {
+		c.cache[key] = nil
+		return nil, ErrRateNotFound
+	}
+
+	rate, ok := stored.Rat()
+	if !ok {
+		c.cache[key] = nil
+		return nil, ErrRateNotFound
+	}
+	c.cache[key] = rate
+	return rate, nil
+}
+
+// SaveQuotes inserts the quotes, overwriting rates already stored for the
+// same owner, currency pair and date. It returns how many rows were written.
+func SaveQuotes(tx *gorm.DB, userID *uuid.UUID, quotes []Quote, source string) (int, error) {
+	saved := 0
+	for _, quote := range quotes {
+		base := models.NormalizeCurrency(quote.Base)
+		quoteCurrency := models.NormalizeCurrency(quote.Quote)
+		if !models.IsValidCurrency(base) || !models.IsValidCurrency(quoteCurrency) || base == quoteCurrency {
+			continue
+		}
+
+		query := tx.Where("base_currency = ? AND quote_currency = ? AND date = ?", base, quoteCurrency, quote.Date.Format("2006-01-02"))
+		if userID == nil {
+			query = query.Where("user_id IS NULL")
+		} else {
+			query = query.Where("user_id = ?", *userID)
+		}
+
+		var existing models.ExchangeRate
+		if err := query.First(&existing).Error; err == nil {
+			if err := tx.Model(&existing).Updates(map[string]interface{}{
+				"rate":   quote.Rate,
+				"source": source,
+			}).Error; err != nil {
+				return saved, err
+			}
+			saved++
+			continue
+		}
+
+		rate := models.ExchangeRate{
+			UserID:        userID,
+			BaseCurrency:  base,
+			QuoteCurrency: quoteCurrency,
+			Rate:          quote.Rate,
+			Date:          quote.Date,
+			Source:        source,
+		}
+		if err := tx.Create(&rate).Error; err != nil {
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
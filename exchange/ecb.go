@@ -0,0 +1,154 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"expense-app-backend/models"
+	"io"
+	"strings"
+	"time"
+)
+
+// ECBBaseCurrency is the currency every ECB reference rate is quoted against.
+const ECBBaseCurrency = "EUR"
+
+var ErrUnrecognisedFormat = errors.New("unrecognised exchange rate file")
+
+// Quote is a single parsed rate: one unit of Base buys Rate units of Quote.
+type Quote struct {
+	Base  string
+	Quote string
+	Rate  string
+	Date  time.Time
+}
+
+// ParseECB reads either the CSV or the XML flavour of the ECB reference rate
+// files, picking the parser from the first non-blank character.
+func ParseECB(r io.Reader) ([]Quote, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(trimmed) == 0 {
+		return nil, ErrUnrecognisedFormat
+	}
+	if trimmed[0] == '<' {
+		return ParseECBXML(bytes.NewReader(trimmed))
+	}
+	return ParseECBCSV(bytes.NewReader(trimmed))
+}
+
+// ParseECBCSV parses eurofxref.csv and eurofxref-hist.csv: a header row of
+// currency codes followed by one row per date. Missing values ("N/A" or
+// empty) are skipped.
+func ParseECBCSV(r io.Reader) ([]Quote, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ErrUnrecognisedFormat
+	}
+	if len(header) < 2 || !strings.EqualFold(strings.TrimSpace(header[0]), "Date") {
+		return nil, ErrUnrecognisedFormat
+	}
+
+	var quotes []Quote
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		date, err := parseECBDate(record[0])
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 1; i < len(record) && i < len(header); i++ {
+			currency := strings.ToUpper(strings.TrimSpace(header[i]))
+			value := strings.TrimSpace(record[i])
+			if currency == "" || value == "" || strings.EqualFold(value, "N/A") {
+				continue
+			}
+			if !validRate(value) {
+				continue
+			}
+			quotes = append(quotes, Quote{Base: ECBBaseCurrency, Quote: currency, Rate: value, Date: date})
+		}
+	}
+	return quotes, nil
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// ParseECBXML parses the eurofxref gesmes envelope, daily or historical.
+func ParseECBXML(r io.Reader) ([]Quote, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, ErrUnrecognisedFormat
+	}
+
+	var quotes []Quote
+	for _, day := range envelope.Cube.Days {
+		date, err := parseECBDate(day.Time)
+		if err != nil {
+			return nil, err
+		}
+		for _, rate := range day.Rates {
+			value := strings.TrimSpace(rate.Rate)
+			if !validRate(value) {
+				continue
+			}
+			quotes = append(quotes, Quote{
+				Base:  ECBBaseCurrency,
+				Quote: strings.ToUpper(strings.TrimSpace(rate.Currency)),
+				Rate:  value,
+				Date:  date,
+			})
+		}
+	}
+
+	if len(quotes) == 0 {
+		return nil, ErrUnrecognisedFormat
+	}
+	return quotes, nil
+}
+
+func parseECBDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "2 January 2006", "02 January 2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date " + value)
+}
+
+// validRate reports whether value is a plain positive decimal. Anything else,
+// such as a fraction or a huge exponent, is left out of the import.
+func validRate(value string) bool {
+	rate, err := models.ParseDecimal(value)
+	return err == nil && rate.Sign() > 0
+}
@@ -0,0 +1,52 @@
+package exchange
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseECB(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "csv",
+			input: "Date, USD, JPY, GBP, CHF, SEK, NOK, \n2024-01-05, 1.0921, 158.42, N/A, 1/3, 1e9999999, -2, \n",
+			want:  []string{"USD 1.0921", "JPY 158.42"},
+		},
+		{
+			name: "xml",
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<Cube>
+		<Cube time="2024-01-05">
+			<Cube currency="USD" rate=" 1.0921 "/>
+			<Cube currency="CHF" rate="1/3"/>
+			<Cube currency="SEK" rate="1e9999999"/>
+			<Cube currency="NOK" rate="0"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`,
+			want: []string{"USD 1.0921"},
+		},
+	}
+
+	for _, tt := range tests {
+		quotes, err := ParseECB(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("%s: ParseECB() error = %v", tt.name, err)
+		}
+		var got []string
+		for _, quote := range quotes {
+			if quote.Base != ECBBaseCurrency || quote.Date.Format("2006-01-02") != "2024-01-05" {
+				t.Errorf("%s: quote %+v, want EUR on 2024-01-05", tt.name, quote)
+			}
+			got = append(got, quote.Quote+" "+quote.Rate)
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%s: ParseECB() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package export writes tabular data as CSV, XLSX or newline-delimited JSON
+// one row at a time, so exports of any size stream straight to the client.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatNDJSON = "ndjson"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Number is a decimal written as a number rather than as text, e.g. an
+// amount from Money.Decimal.
+type Number string
+
+// Writer writes one table. Cells are strings, Numbers or nil for empty.
+type Writer interface {
+	Row(cells ...interface{}) error
+	Close() error
+}
+
+// New starts a table with the given column names in the given format.
+func New(format string, w io.Writer, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return &ndjsonWriter{encoder: encoder, columns: columns}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType is the MIME type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	writer := &csvWriter{writer: csv.NewWriter(w), record: make([]string, len(columns))}
+	if err := writer.writer.Write(columns); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *csvWriter) Row(cells ...interface{}) error {
+	for i := range w.record {
+		w.record[i] = ""
+		if i >= len(cells) {
+			continue
+		}
+		switch value := cells[i].(type) {
+		case Number:
+			w.record[i] = string(value)
+		case string:
+			w.record[i] = escapeFormula(value)
+		}
+	}
+	return w.writer.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// escapeFormula keeps spreadsheet programs from running text such as a
+// transaction note of "=HYPERLINK(...)" as a formula.
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	columns []string
+}
+
+func (w *ndjsonWriter) Row(cells ...interface{}) error {
+	object := make(map[string]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		var value interface{}
+		if i < len(cells) {
+			value = cells[i]
+		}
+		if number, ok := value.(Number); ok {
+			value = json.Number(number)
+		}
+		object[column] = value
+	}
+	return w.encoder.Encode(object)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,333 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"expense-app-backend/models"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+var ErrNoRows = errors.New("no rows found")
+
+// Row is one parsed statement line. Amount is always positive; Type says
+// which way the money went. ExternalID is the bank's own transaction id
+// where the format has one, and Category a category name from the file.
+// Rows that could not be parsed carry Error and are never imported.
+type Row struct {
+	Line        int
+	Date        time.Time
+	Type        string
+	Amount      models.Money
+	Description string
+	Payee       string
+	ExternalID  string
+	Category    string
+	Error       string
+}
+
+// CheckProfile reports what is wrong with a column mapping, or nil.
+func CheckProfile(profile models.ImportProfile) error {
+	if profile.DateColumn == "" {
+		return errors.New("date_column is required")
+	}
+	if profile.AmountColumn == "" && profile.DebitColumn == "" && profile.CreditColumn == "" {
+		return errors.New("amount_column, or debit_column and credit_column, is required")
+	}
+	if profile.AmountColumn != "" && (profile.DebitColumn != "" || profile.CreditColumn != "") {
+		return errors.New("use either amount_column or debit_column and credit_column")
+	}
+	if utf8.RuneCountInString(profile.Delimiter) > 1 {
+		return errors.New("delimiter must be a single character")
+	}
+	if profile.DecimalSeparator != "" && profile.DecimalSeparator != "." && profile.DecimalSeparator != "," {
+		return errors.New("decimal_separator must be . or ,")
+	}
+	if profile.SkipRows < 0 {
+		return errors.New("skip_rows cannot be negative")
+	}
+	if profile.Encoding != "" {
+		if _, err := htmlindex.Get(profile.Encoding); err != nil {
+			return fmt.Errorf("unknown encoding %q", profile.Encoding)
+		}
+	}
+	return nil
+}
+
+// ParseCSV reads a bank statement with the profile's column mapping. Amounts
+// are read in the given currency. Blank lines are skipped; lines that do not
+// parse are returned with Error set so they can be shown in a preview.
+func ParseCSV(r io.Reader, profile models.ImportProfile, currency string) ([]Row, error) {
+	if err := CheckProfile(profile); err != nil {
+		return nil, err
+	}
+
+	data, err := decode(r, profile.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	if profile.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(profile.Delimiter)
+	}
+
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	if profile.SkipRows >= len(records) {
+		return nil, ErrNoRows
+	}
+	records, lines = records[profile.SkipRows:], lines[profile.SkipRows:]
+
+	var header []string
+	if profile.HasHeader {
+		header = records[0]
+		records, lines = records[1:], lines[1:]
+	}
+
+	columns := map[string]int{}
+	for name, ref := range map[string]string{
+		"date":        profile.DateColumn,
+		"description": profile.DescriptionColumn,
+		"payee":       profile.PayeeColumn,
+		"amount":      profile.AmountColumn,
+		"debit":       profile.DebitColumn,
+		"credit":      profile.CreditColumn,
+	} {
+		if ref == "" {
+			continue
+		}
+		index, err := columnIndex(header, ref)
+		if err != nil {
+			return nil, err
+		}
+		columns[name] = index
+	}
+
+	layout := DateLayout(profile.DateFormat)
+	rows := []Row{}
+	for i, record := range records {
+		if isBlank(record) {
+			continue
+		}
+		row := Row{Line: lines[i]}
+		if err := row.fill(record, columns, layout, profile, currency); err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNoRows
+	}
+	return rows, nil
+}
+
+func (row *Row) fill(record []string, columns map[string]int, layout string, profile models.ImportProfile, currency string) error {
+	field := func(name string) string {
+		index, found := columns[name]
+		if !found || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	row.Description = field("description")
+	row.Payee = field("payee")
+
+	date, err := time.ParseInLocation(layout, field("date"), time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid date %q", field("date"))
+	}
+	row.Date = date
+
+	var amount models.Money
+	if _, found := columns["amount"]; found {
+		amount, err = ParseAmount(field("amount"), profile.DecimalSeparator, currency)
+		if err != nil {
+			return fmt.Errorf("invalid amount %q", field("amount"))
+		}
+	} else {
+		debit, credit := field("debit"), field("credit")
+		amount = models.NewMoney(0, currency)
+		if debit != "" {
+			value, err := ParseAmount(debit, profile.DecimalSeparator, currency)
+			if err != nil {
+				return fmt.Errorf("invalid debit %q", debit)
+			}
+			amount = amount.Sub(value.Abs())
+		}
+		if credit != "" {
+			value, err := ParseAmount(credit, profile.DecimalSeparator, currency)
+			if err != nil {
+				return fmt.Errorf("invalid credit %q", credit)
+			}
+			amount = amount.Add(value.Abs())
+		}
+	}
+	if profile.InvertSign {
+		amount = amount.Neg()
+	}
+	return row.setAmount(amount)
+}
+
+// setAmount splits a signed amount into a type and a positive amount.
+func (row *Row) setAmount(amount models.Money) error {
+	switch {
+	case amount.IsPositive():
+		row.Type = models.TransactionTypeIncome
+		row.Amount = amount
+	case amount.IsNegative():
+		row.Type = models.TransactionTypeExpense
+		row.Amount = amount.Neg()
+	default:
+		return errors.New("amount is zero")
+	}
+	return nil
+}
+
+// ParseAmount reads a statement amount such as "1.234,56", "(12.50)",
+// "12.50-", "12.50 DR" or "Rp 15,000". The decimal separator is "." or ",";
+// the other one is taken as a thousands separator. Currency symbols and
+// spaces are ignored.
+func ParseAmount(value string, decimalSeparator string, currency string) (models.Money, error) {
+	if decimalSeparator == "" {
+		decimalSeparator = "."
+	}
+	thousands := ","
+	if decimalSeparator == "," {
+		thousands = "."
+	}
+
+	value = strings.TrimSpace(value)
+	negative := false
+	switch upper := strings.ToUpper(value); {
+	case strings.HasSuffix(upper, "DR"):
+		negative = true
+		value = strings.TrimSpace(value[:len(value)-2])
+	case strings.HasSuffix(upper, "CR"):
+		value = strings.TrimSpace(value[:len(value)-2])
+	}
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+	if strings.HasSuffix(value, "-") {
+		negative = !negative
+		value = strings.TrimSuffix(value, "-")
+	}
+
+	var digits strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case string(r) == decimalSeparator:
+			digits.WriteByte('.')
+		case r == '-':
+			if digits.Len() > 0 {
+				return models.Money{}, models.ErrInvalidAmount
+			}
+			negative = !negative
+		case string(r) == thousands, r == '+', r == '\'':
+		case r == ' ' || r == '\u00a0' || isCurrencySymbol(r):
+		default:
+			return models.Money{}, models.ErrInvalidAmount
+		}
+	}
+
+	amount, err := models.ParseMoney(digits.String(), currency)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, nil
+}
+
+func isCurrencySymbol(r rune) bool {
+	return (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || strings.ContainsRune("$€£¥₹₩₫฿", r)
+}
+
+// DateLayout turns a format such as "DD/MM/YYYY" into a Go time layout.
+// Supported tokens are YYYY, YY, MMM, MM, M, DD and D; an empty format
+// means YYYY-MM-DD.
+func DateLayout(format string) string {
+	if format == "" {
+		return "2006-01-02"
+	}
+	return strings.NewReplacer(
+		"YYYY", "2006",
+		"YY", "06",
+		"MMM", "Jan",
+		"MM", "01",
+		"M", "1",
+		"DD", "02",
+		"D", "2",
+	).Replace(format)
+}
+
+// decode converts the file to UTF-8 and drops a byte order mark.
+func decode(r io.Reader, name string) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" && !strings.EqualFold(name, "utf-8") && !strings.EqualFold(name, "utf8") {
+		encoding, err := htmlindex.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err = encoding.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+}
+
+// columnIndex finds a column by header name, ignoring case, or by its
+// 1-based position.
+func columnIndex(header []string, ref string) (int, error) {
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(ref)) {
+			return i, nil
+		}
+	}
+	if position, err := strconv.Atoi(ref); err == nil && position >= 1 {
+		return position - 1, nil
+	}
+	return 0, fmt.Errorf("column %q not found", ref)
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,268 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-app-backend/models"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value            string
+		decimalSeparator string
+		currency         string
+		want             int64
+		wantErr          bool
+	}{
+		{value: "1234.56", currency: "USD", want: 123456},
+		{value: "1,234.56", decimalSeparator: ".", currency: "USD", want: 123456},
+		{value: "1.234,56", decimalSeparator: ",", currency: "EUR", want: 123456},
+		{value: "-1.234,56", decimalSeparator: ",", currency: "EUR", want: -123456},
+		{value: "(12.50)", currency: "USD", want: -1250},
+		{value: "12.50-", currency: "USD", want: -1250},
+		{value: "12.50 DR", currency: "USD", want: -1250},
+		{value: "12.50 dr", currency: "USD", want: -1250},
+		{value: "12.50 CR", currency: "USD", want: 1250},
+		{value: "(12.50) DR", currency: "USD", want: -1250},
+		{value: "Rp 15,000", currency: "IDR", want: 1500000},
+		{value: "Rp 15.000,00", decimalSeparator: ",", currency: "IDR", want: 1500000},
+		{value: "$ -3.10", currency: "USD", want: -310},
+		{value: "+3.10", currency: "USD", want: 310},
+		{value: "1'000.00", currency: "CHF", want: 100000},
+		{value: "¥1,500", currency: "JPY", want: 1500},
+		{value: ".50", currency: "USD", want: 50},
+		{value: "", currency: "USD", wantErr: true},
+		{value: "Rp", currency: "IDR", wantErr: true},
+		{value: "12-50", currency: "USD", wantErr: true},
+		{value: "1.2.3", currency: "USD", wantErr: true},
+		{value: "1/3", currency: "USD", wantErr: true},
+		{value: "12#50", currency: "USD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.value, tt.decimalSeparator, tt.currency)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAmount(%q) = %d, want an error", tt.value, got.Amount)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAmount(%q) unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got.Amount != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.value, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestDateLayout(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+		want   string
+	}{
+		{format: "", value: "2024-01-31", want: "2024-01-31"},
+		{format: "DD/MM/YYYY", value: "31/01/2024", want: "2024-01-31"},
+		{format: "MM/DD/YYYY", value: "01/31/2024", want: "2024-01-31"},
+		{format: "D/M/YY", value: "5/2/24", want: "2024-02-05"},
+		{format: "DD MMM YYYY", value: "05 Feb 2024", want: "2024-02-05"},
+	}
+
+	for _, tt := range tests {
+		date, err := time.Parse(DateLayout(tt.format), tt.value)
+		if err != nil {
+			t.Errorf("DateLayout(%q) cannot parse %q: %v", tt.format, tt.value, err)
+			continue
+		}
+		if got := date.Format("2006-01-02"); got != tt.want {
+			t.Errorf("DateLayout(%q) parsed %q as %s, want %s", tt.format, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	type want struct {
+		line        int
+		date        string
+		kind        string
+		amount      int64
+		description string
+		err         bool
+	}
+	tests := []struct {
+		name     string
+		data     string
+		profile  models.ImportProfile
+		currency string
+		want     []want
+		wantErr  error
+	}{
+		{
+			name: "header with named columns",
+			data: "Date,Description,Amount\n" +
+				"2024-01-05,Coffee,-4.50\n" +
+				"2024-01-06,Salary,2500.00\n",
+			profile:  models.ImportProfile{HasHeader: true, DateColumn: "date", DescriptionColumn: "Description", AmountColumn: "AMOUNT"},
+			currency: "USD",
+			want: []want{
+				{line: 2, date: "2024-01-05", kind: models.TransactionTypeExpense, amount: 450, description: "Coffee"},
+				{line: 3, date: "2024-01-06", kind: models.TransactionTypeIncome, amount: 250000, description: "Salary"},
+			},
+		},
+		{
+			name: "skipped preamble, semicolons and DD/MM/YYYY",
+			data: "Kontoauszug\n" +
+				"Konto 123\n" +
+				"Datum;Text;Betrag\n" +
+				"31/01/2024;Miete;-1.234,56\n" +
+				"\n" +
+				"01/02/2024;Gehalt;3.000,00\n",
+			profile: models.ImportProfile{
+				SkipRows: 2, HasHeader: true, Delimiter: ";", DecimalSeparator: ",", DateFormat: "DD/MM/YYYY",
+				DateColumn: "Datum", DescriptionColumn: "Text", AmountColumn: "Betrag",
+			},
+			currency: "EUR",
+			want: []want{
+				{line: 4, date: "2024-01-31", kind: models.TransactionTypeExpense, amount: 123456, description: "Miete"},
+				{line: 6, date: "2024-02-01", kind: models.TransactionTypeIncome, amount: 300000, description: "Gehalt"},
+			},
+		},
+		{
+			name: "debit and credit columns by position",
+			data: "2024-01-05,Groceries,\"15,000\",\n" +
+				"2024-01-06,Refund,,\"2,500\"\n" +
+				"2024-01-07,Both,\"1,000\",\"3,000\"\n",
+			profile:  models.ImportProfile{DateColumn: "1", DescriptionColumn: "2", DebitColumn: "3", CreditColumn: "4"},
+			currency: "IDR",
+			want: []want{
+				{line: 1, date: "2024-01-05", kind: models.TransactionTypeExpense, amount: 1500000, description: "Groceries"},
+				{line: 2, date: "2024-01-06", kind: models.TransactionTypeIncome, amount: 250000, description: "Refund"},
+				{line: 3, date: "2024-01-07", kind: models.TransactionTypeIncome, amount: 200000, description: "Both"},
+			},
+		},
+		{
+			name:     "inverted sign",
+			data:     "2024-01-05,Card payment,12.50\n",
+			profile:  models.ImportProfile{DateColumn: "1", DescriptionColumn: "2", AmountColumn: "3", InvertSign: true},
+			currency: "USD",
+			want: []want{
+				{line: 1, date: "2024-01-05", kind: models.TransactionTypeExpense, amount: 1250, description: "Card payment"},
+			},
+		},
+		{
+			name: "bad rows are kept with an error",
+			data: "not a date,Coffee,-4.50\n" +
+				"2024-01-05,Coffee,abc\n" +
+				"2024-01-05,Nothing,0\n",
+			profile:  models.ImportProfile{DateColumn: "1", DescriptionColumn: "2", AmountColumn: "3"},
+			currency: "USD",
+			want: []want{
+				{line: 1, description: "Coffee", err: true},
+				{line: 2, description: "Coffee", err: true},
+				{line: 3, description: "Nothing", err: true},
+			},
+		},
+		{
+			name:     "byte order mark",
+			data:     "\xef\xbb\xbfDate,Description,Amount\n2024-01-05,Café,-4.50\n",
+			profile:  models.ImportProfile{HasHeader: true, DateColumn: "Date", DescriptionColumn: "Description", AmountColumn: "Amount"},
+			currency: "USD",
+			want: []want{
+				{line: 2, date: "2024-01-05", kind: models.TransactionTypeExpense, amount: 450, description: "Café"},
+			},
+		},
+		{
+			name:     "windows-1252",
+			data:     "Date,Description,Amount\n2024-01-05,Caf\xe9,-4.50\n",
+			profile:  models.ImportProfile{HasHeader: true, Encoding: "windows-1252", DateColumn: "Date", DescriptionColumn: "Description", AmountColumn: "Amount"},
+			currency: "USD",
+			want: []want{
+				{line: 2, date: "2024-01-05", kind: models.TransactionTypeExpense, amount: 450, description: "Café"},
+			},
+		},
+		{
+			name:     "only a header",
+			data:     "Date,Amount\n",
+			profile:  models.ImportProfile{HasHeader: true, DateColumn: "Date", AmountColumn: "Amount"},
+			currency: "USD",
+			wantErr:  ErrNoRows,
+		},
+		{
+			name:     "everything skipped",
+			data:     "a\nb\n",
+			profile:  models.ImportProfile{SkipRows: 2, DateColumn: "1", AmountColumn: "2"},
+			currency: "USD",
+			wantErr:  ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseCSV(strings.NewReader(tt.data), tt.profile, tt.currency)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseCSV() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCSV() unexpected error: %v", err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("ParseCSV() returned %d rows, want %d: %+v", len(rows), len(tt.want), rows)
+			}
+			for i, w := range tt.want {
+				row := rows[i]
+				if row.Line != w.line || row.Description != w.description {
+					t.Errorf("row %d = line %d %q, want line %d %q", i, row.Line, row.Description, w.line, w.description)
+				}
+				if w.err {
+					if row.Error == "" {
+						t.Errorf("row %d has no error, want one", i)
+					}
+					continue
+				}
+				if row.Error != "" {
+					t.Errorf("row %d unexpected error: %s", i, row.Error)
+					continue
+				}
+				if got := row.Date.Format("2006-01-02"); got != w.date {
+					t.Errorf("row %d date = %s, want %s", i, got, w.date)
+				}
+				if row.Type != w.kind || row.Amount.Amount != w.amount || row.Amount.Currency != tt.currency {
+					t.Errorf("row %d = %s %s, want %s %d %s", i, row.Type, row.Amount, w.kind, w.amount, tt.currency)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile models.ImportProfile
+		wantErr bool
+	}{
+		{name: "amount column", profile: models.ImportProfile{DateColumn: "Date", AmountColumn: "Amount"}},
+		{name: "debit column only", profile: models.ImportProfile{DateColumn: "Date", DebitColumn: "Out"}},
+		{name: "no date", profile: models.ImportProfile{AmountColumn: "Amount"}, wantErr: true},
+		{name: "no amount", profile: models.ImportProfile{DateColumn: "Date"}, wantErr: true},
+		{name: "amount and debit", profile: models.ImportProfile{DateColumn: "Date", AmountColumn: "Amount", DebitColumn: "Out"}, wantErr: true},
+		{name: "long delimiter", profile: models.ImportProfile{DateColumn: "Date", AmountColumn: "Amount", Delimiter: ";;"}, wantErr: true},
+		{name: "bad decimal separator", profile: models.ImportProfile{DateColumn: "Date", AmountColumn: "Amount", DecimalSeparator: "'"}, wantErr: true},
+		{name: "negative skip", profile: models.ImportProfile{DateColumn: "Date", AmountColumn: "Amount", SkipRows: -1}, wantErr: true},
+		{name: "unknown encoding", profile: models.ImportProfile{DateColumn: "Date", AmountColumn: "Amount", Encoding: "klingon"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := CheckProfile(tt.profile)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: CheckProfile() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
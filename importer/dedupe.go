@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Statuses of a row in an import preview.
+const (
+	StatusNew               = "new"
+	StatusDuplicate         = "duplicate"
+	StatusPossibleDuplicate = "possible_duplicate"
+	StatusInvalid           = "invalid"
+)
+
+// FuzzyDays is how far apart, in days, a transaction with the same amount
+// may be dated and still count as a possible duplicate. Banks often book a
+// card payment a few days after it was entered by hand.
+const FuzzyDays = 3
+
+// Checked is a row with its duplicate status. DuplicateOf is the existing
+// transaction it matched.
+type Checked struct {
+	Row
+	Hash        string
+	Status      string
+	DuplicateOf *uuid.UUID
+}
+
+// Hash identifies a statement line in an account. A line with a bank id is
+// identified by that id alone. Otherwise identical lines in one file, such
+// as two coffees on the same day, are told apart by their occurrence
+// number.
+func Hash(accountID uuid.UUID, row Row, occurrence int) string {
+	key := fmt.Sprintf("%s|id|%s", accountID, row.ExternalID)
+	if row.ExternalID == "" {
+		key = fmt.Sprintf("%s|%s|%s|%d|%s|%d",
+			accountID,
+			row.Date.Format("2006-01-02"),
+			row.Type,
+			row.Amount.Amount,
+			strings.ToLower(strings.Join(strings.Fields(row.Description+" "+row.Payee), " ")),
+			occurrence,
+		)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Check hashes the rows and compares them with the account's transactions.
+// A row whose hash was imported before, or whose bank id appears earlier in
+// the same file, is a duplicate. A row with the same type and amount as a
+// transaction within FuzzyDays is a possible duplicate; each existing
+// transaction matches at most one row.
+func Check(db *gorm.DB, accountID uuid.UUID, rows []Row) ([]Checked, error) {
+	checked := make([]Checked, len(rows))
+	occurrences := map[string]int{}
+	var from, to time.Time
+	for i, row := range rows {
+		checked[i] = Checked{Row: row, Status: StatusNew}
+		if row.Error != "" {
+			checked[i].Status = StatusInvalid
+			continue
+		}
+		base := Hash(accountID, row, 0)
+		checked[i].Hash = Hash(accountID, row, occurrences[base])
+		occurrences[base]++
+		if row.ExternalID != "" && occurrences[base] > 1 {
+			checked[i].Status = StatusDuplicate
+			continue
+		}
+
+		if from.IsZero() || row.Date.Before(from) {
+			from = row.Date
+		}
+		if to.IsZero() || row.Date.After(to) {
+			to = row.Date
+		}
+	}
+	if from.IsZero() {
+		return checked, nil
+	}
+
+	var existing []models.Transaction
+	if err := db.Select("id, type, amount_minor, currency, date, import_hash").
+		Where("account_id = ? AND date >= ? AND date < ?", accountID, from.AddDate(0, 0, -FuzzyDays), to.AddDate(0, 0, FuzzyDays+1)).
+		Order("date").
+		Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	byHash := map[string]uuid.UUID{}
+	for _, transaction := range existing {
+		if transaction.ImportHash != "" {
+			byHash[transaction.ImportHash] = transaction.ID
+		}
+	}
+
+	matched := map[uuid.UUID]bool{}
+	for i := range checked {
+		if checked[i].Status == StatusInvalid {
+			continue
+		}
+		if id, found := byHash[checked[i].Hash]; found {
+			checked[i].Status = StatusDuplicate
+			checked[i].DuplicateOf = &id
+			matched[id] = true
+		}
+	}
+	for i := range checked {
+		row := &checked[i]
+		if row.Status != StatusNew {
+			continue
+		}
+		if id := closestMatch(existing, matched, row.Row); id != nil {
+			row.Status = StatusPossibleDuplicate
+			row.DuplicateOf = id
+			matched[*id] = true
+		}
+	}
+	return checked, nil
+}
+
+// closestMatch finds the unmatched transaction of the same type and amount
+// dated nearest to the row, within FuzzyDays.
+func closestMatch(existing []models.Transaction, matched map[uuid.UUID]bool, row Row) *uuid.UUID {
+	var best *uuid.UUID
+	bestDistance := time.Duration(FuzzyDays+1) * 24 * time.Hour
+	for i := range existing {
+		transaction := &existing[i]
+		if matched[transaction.ID] || transaction.Type != row.Type || transaction.Amount.Amount != row.Amount.Amount {
+			continue
+		}
+		distance := transaction.Date.Sub(row.Date)
+		if distance < 0 {
+			distance = -distance
+		}
+		if distance < bestDistance {
+			best = &transaction.ID
+			bestDistance = distance
+		}
+	}
+	return best
+}
@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds statements without running them, so queries find nothing.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:password@tcp(localhost:1)/test", SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestHash(t *testing.T) {
+	account := uuid.New()
+	date := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.Local)
+	coffee := Row{Date: date, Type: models.TransactionTypeExpense, Amount: models.NewMoney(450, "USD"), Description: "Coffee"}
+
+	tests := []struct {
+		name  string
+		a, b  Row
+		occA  int
+		occB  int
+		other bool
+		same  bool
+	}{
+		{name: "identical rows", a: coffee, b: coffee, same: true},
+		{name: "same row, next occurrence", a: coffee, b: coffee, occB: 1},
+		{name: "description case and spacing", a: coffee, b: Row{Date: date, Type: coffee.Type, Amount: coffee.Amount, Description: "  COFFEE "}, same: true},
+		{name: "different amount", a: coffee, b: Row{Date: date, Type: coffee.Type, Amount: models.NewMoney(451, "USD"), Description: "Coffee"}},
+		{name: "different day", a: coffee, b: Row{Date: date.AddDate(0, 0, 1), Type: coffee.Type, Amount: coffee.Amount, Description: "Coffee"}},
+		{name: "different account", a: coffee, b: coffee, other: true},
+		{name: "bank id ignores the rest", a: Row{ExternalID: "T1", Description: "Coffee"}, b: Row{ExternalID: "T1", Description: "Tea"}, occB: 3, same: true},
+		{name: "different bank ids", a: Row{ExternalID: "T1"}, b: Row{ExternalID: "T2"}},
+	}
+
+	for _, tt := range tests {
+		accountB := account
+		if tt.other {
+			accountB = uuid.New()
+		}
+		a, b := Hash(account, tt.a, tt.occA), Hash(accountB, tt.b, tt.occB)
+		if (a == b) != tt.same {
+			t.Errorf("%s: hashes equal = %v, want %v", tt.name, a == b, tt.same)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	account := uuid.New()
+	date := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.Local)
+	coffee := Row{Date: date, Type: models.TransactionTypeExpense, Amount: models.NewMoney(450, "USD"), Description: "Coffee"}
+	withID := Row{Date: date, Type: models.TransactionTypeIncome, Amount: models.NewMoney(1000, "USD"), ExternalID: "T1"}
+
+	rows := []Row{coffee, coffee, withID, withID, {Line: 9, Error: "invalid date"}}
+	checked, err := Check(dryRunDB(t), account, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatus := []string{StatusNew, StatusNew, StatusNew, StatusDuplicate, StatusInvalid}
+	for i, status := range wantStatus {
+		if checked[i].Status != status {
+			t.Errorf("row %d status = %s, want %s", i, checked[i].Status, status)
+		}
+	}
+	if checked[0].Hash == checked[1].Hash {
+		t.Errorf("identical rows in one file share hash %s", checked[0].Hash)
+	}
+	if checked[0].Hash != Hash(account, coffee, 0) || checked[1].Hash != Hash(account, coffee, 1) {
+		t.Errorf("identical rows are not hashed by occurrence")
+	}
+	if checked[4].Hash != "" {
+		t.Errorf("invalid row hashed as %s", checked[4].Hash)
+	}
+}
@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"expense-app-backend/models"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+var ErrNotOFX = errors.New("not an OFX file")
+
+var (
+	ofxTransaction = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	ofxLeaf        = regexp.MustCompile(`(?i)<([A-Z0-9.]+)>([^<\r\n]*)`)
+	ofxCurrency    = regexp.MustCompile(`(?i)<CURDEF>\s*([A-Z]{3})`)
+)
+
+// ParseOFX reads OFX 1.x (SGML) and OFX 2.x (XML) statements, including
+// QFX. The statement must be in the account's currency. FITID is kept as
+// ExternalID so a transaction is recognised when it is downloaded again.
+func ParseOFX(r io.Reader, currency string) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(bytes.ToUpper(data), []byte("<OFX>"))
+	if start < 0 {
+		return nil, ErrNotOFX
+	}
+	header := string(data[:start])
+	if strings.Contains(header, "CHARSET:1252") {
+		if data, err = charmap.Windows1252.NewDecoder().Bytes(data); err != nil {
+			return nil, err
+		}
+	}
+	body := string(data)
+
+	for _, match := range ofxCurrency.FindAllStringSubmatch(body, -1) {
+		if statement := models.NormalizeCurrency(match[1]); statement != models.NormalizeCurrency(currency) {
+			return nil, fmt.Errorf("statement is in %s but the account is in %s", statement, currency)
+		}
+	}
+
+	rows := []Row{}
+	for _, bounds := range ofxTransaction.FindAllStringSubmatchIndex(body, -1) {
+		fields := map[string]string{}
+		for _, leaf := range ofxLeaf.FindAllStringSubmatch(body[bounds[2]:bounds[3]], -1) {
+			name := strings.ToUpper(leaf[1])
+			if _, seen := fields[name]; !seen {
+				fields[name] = html.UnescapeString(strings.TrimSpace(leaf[2]))
+			}
+		}
+
+		row := Row{
+			Line:       strings.Count(body[:bounds[0]], "\n") + 1,
+			ExternalID: fields["FITID"],
+			Payee:      fields["NAME"],
+			// Some banks put the whole text in MEMO, others only NAME.
+			Description: fields["MEMO"],
+		}
+		if row.Description == "" {
+			row.Description = row.Payee
+		}
+		if err := row.fillOFX(fields, currency); err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNoRows
+	}
+	return rows, nil
+}
+
+func (row *Row) fillOFX(fields map[string]string, currency string) error {
+	date, err := ofxDate(fields["DTPOSTED"])
+	if err != nil {
+		return fmt.Errorf("invalid DTPOSTED %q", fields["DTPOSTED"])
+	}
+	row.Date = date
+
+	value := fields["TRNAMT"]
+	separator := "."
+	if strings.Contains(value, ",") && !strings.Contains(value, ".") {
+		separator = ","
+	}
+	amount, err := ParseAmount(value, separator, currency)
+	if err != nil {
+		return fmt.Errorf("invalid TRNAMT %q", value)
+	}
+	return row.setAmount(amount)
+}
+
+// ofxDate reads the date part of an OFX timestamp such as
+// "20240131120000.000[-5:EST]". The time and zone are dropped: the posting
+// date is what the bank shows.
+func ofxDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, errors.New("date too short")
+	}
+	return time.ParseInLocation("20060102", value[:8], time.Local)
+}
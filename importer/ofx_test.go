@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"expense-app-backend/models"
+)
+
+// statementRow is what the OFX and QIF tests expect of a parsed row.
+type statementRow struct {
+	date        string
+	kind        string
+	amount      int64
+	payee       string
+	description string
+	externalID  string
+	category    string
+	err         bool
+}
+
+func checkRows(t *testing.T, rows []Row, want []statementRow) {
+	t.Helper()
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		row := rows[i]
+		if w.err {
+			if row.Error == "" {
+				t.Errorf("row %d has no error, want one", i)
+			}
+			continue
+		}
+		if row.Error != "" {
+			t.Errorf("row %d unexpected error: %s", i, row.Error)
+			continue
+		}
+		if got := row.Date.Format("2006-01-02"); got != w.date {
+			t.Errorf("row %d date = %s, want %s", i, got, w.date)
+		}
+		if row.Type != w.kind || row.Amount.Amount != w.amount {
+			t.Errorf("row %d = %s %d, want %s %d", i, row.Type, row.Amount.Amount, w.kind, w.amount)
+		}
+		if row.Payee != w.payee || row.Description != w.description {
+			t.Errorf("row %d payee, description = %q, %q, want %q, %q", i, row.Payee, row.Description, w.payee, w.description)
+		}
+		if row.ExternalID != w.externalID || row.Category != w.category {
+			t.Errorf("row %d id, category = %q, %q, want %q, %q", i, row.ExternalID, row.Category, w.externalID, w.category)
+		}
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		currency string
+		want     []statementRow
+	}{
+		{
+			name:     "OFX 1.x SGML in windows-1252",
+			file:     "testdata/sgml.ofx",
+			currency: "EUR",
+			want: []statementRow{
+				{date: "2024-01-05", kind: models.TransactionTypeExpense, amount: 450, payee: "Café Central", description: "Card payment & tip", externalID: "202401050001"},
+				{date: "2024-01-31", kind: models.TransactionTypeIncome, amount: 250000, payee: "ACME Payroll", description: "ACME Payroll", externalID: "202401310001"},
+				{err: true},
+			},
+		},
+		{
+			name:     "OFX 2.x XML",
+			file:     "testdata/xml.ofx",
+			currency: "usd",
+			want: []statementRow{
+				{date: "2024-01-10", kind: models.TransactionTypeExpense, amount: 12000, payee: "Grocer <Main St>", description: "Grocer <Main St>", externalID: "A1"},
+				{date: "2024-01-15", kind: models.TransactionTypeIncome, amount: 3025, payee: "Refund", description: "Returned item", externalID: "A2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Open(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			rows, err := ParseOFX(file, tt.currency)
+			if err != nil {
+				t.Fatalf("ParseOFX() unexpected error: %v", err)
+			}
+			checkRows(t, rows, tt.want)
+		})
+	}
+}
+
+func TestParseOFXErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		currency string
+		wantErr  error
+	}{
+		{name: "not OFX", data: "Date,Amount\n2024-01-05,1.00\n", currency: "USD", wantErr: ErrNotOFX},
+		{name: "no transactions", data: "<OFX><CURDEF>USD</OFX>", currency: "USD", wantErr: ErrNoRows},
+		{name: "other currency", data: "<OFX><CURDEF>EUR<STMTTRN><TRNAMT>1.00</STMTTRN></OFX>", currency: "USD"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseOFX(strings.NewReader(tt.data), tt.currency)
+		if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+			t.Errorf("%s: ParseOFX() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotQIF = errors.New("not a QIF file")
+
+// qifTransactionTypes are the QIF sections that hold account transactions.
+// Investment, category and memorised-transaction lists are skipped.
+var qifTransactionTypes = []string{"bank", "cash", "ccard", "oth a", "oth l"}
+
+// ParseQIF reads a QIF export. QIF dates carry no format, so dateFormat says
+// the order of day, month and year, e.g. "DD/MM/YYYY"; it defaults to the
+// US order Quicken uses. Two-digit years and Quicken's "1/31'24" style are
+// understood. The category in the L field is kept as Category.
+func ParseQIF(r io.Reader, dateFormat, decimalSeparator, encoding, currency string) ([]Row, error) {
+	data, err := decode(r, encoding)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("!")) {
+		return nil, ErrNotQIF
+	}
+	order := dateOrder(dateFormat)
+
+	rows := []Row{}
+	inTransactions := false
+	fields := map[byte]string{}
+	start := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" {
+			continue
+		}
+		switch {
+		case text[0] == '!':
+			if strings.HasPrefix(strings.ToLower(text), "!type:") {
+				inTransactions = contains(qifTransactionTypes, strings.ToLower(strings.TrimSpace(text[6:])))
+			}
+			fields = map[byte]string{}
+		case text[0] == '^':
+			if inTransactions && len(fields) > 0 {
+				row := Row{Line: start, Payee: fields['P'], Description: fields['M'], Category: fields['L']}
+				if row.Description == "" {
+					row.Description = row.Payee
+				}
+				if err := row.fillQIF(fields, order, decimalSeparator, currency); err != nil {
+					row.Error = err.Error()
+				}
+				rows = append(rows, row)
+			}
+			fields = map[byte]string{}
+		default:
+			if len(fields) == 0 {
+				start = line
+			}
+			// Split lines (S, E and $) repeat; only the first of each is
+			// kept, and the transaction is imported with its total.
+			if _, seen := fields[text[0]]; !seen {
+				fields[text[0]] = strings.TrimSpace(text[1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNoRows
+	}
+	return rows, nil
+}
+
+func (row *Row) fillQIF(fields map[byte]string, order, decimalSeparator, currency string) error {
+	date, err := qifDate(fields['D'], order)
+	if err != nil {
+		return fmt.Errorf("invalid date %q", fields['D'])
+	}
+	row.Date = date
+
+	value := fields['T']
+	if value == "" {
+		value = fields['U']
+	}
+	amount, err := ParseAmount(value, decimalSeparator, currency)
+	if err != nil {
+		return fmt.Errorf("invalid amount %q", value)
+	}
+	return row.setAmount(amount)
+}
+
+// dateOrder reduces a date format to the order of its parts, such as "MDY".
+func dateOrder(format string) string {
+	order := ""
+	for _, r := range strings.ToUpper(format) {
+		if (r == 'D' || r == 'M' || r == 'Y') && !strings.ContainsRune(order, r) {
+			order += string(r)
+		}
+	}
+	if len(order) != 3 {
+		return "MDY"
+	}
+	return order
+}
+
+// qifDate reads a date whose day, month and year come in the given order,
+// separated by anything that is not a digit.
+func qifDate(value, order string) (time.Time, error) {
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("date needs three parts")
+	}
+	var day, month, year int
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch order[i] {
+		case 'D':
+			day = number
+		case 'M':
+			month = number
+		case 'Y':
+			year = number
+		}
+	}
+	if len(parts[strings.IndexByte(order, 'Y')]) <= 2 {
+		// Quicken writes years from 2000 on with an apostrophe and two
+		// digits; older files may still have 19xx years.
+		if year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
+	if date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, errors.New("date out of range")
+	}
+	return date, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
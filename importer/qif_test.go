@@ -0,0 +1,93 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"expense-app-backend/models"
+)
+
+func TestParseQIF(t *testing.T) {
+	file, err := os.Open("testdata/quicken.qif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rows, err := ParseQIF(file, "", ".", "", "USD")
+	if err != nil {
+		t.Fatalf("ParseQIF() unexpected error: %v", err)
+	}
+	// The category list before and the investment account after the bank
+	// transactions are skipped. The split transaction is imported once, with
+	// its total and first category.
+	checkRows(t, rows, []statementRow{
+		{date: "2024-01-31", kind: models.TransactionTypeExpense, amount: 123456, payee: "Landlord", description: "January rent", category: "Housing:Rent"},
+		{date: "2024-02-05", kind: models.TransactionTypeExpense, amount: 15000, payee: "Supermarket", description: "Supermarket", category: "Groceries"},
+		{date: "1999-12-31", kind: models.TransactionTypeIncome, amount: 250000, payee: "Employer", description: "Employer"},
+		{err: true},
+	})
+	if rows[0].Line != 6 || rows[1].Line != 12 {
+		t.Errorf("rows start on lines %d and %d, want 6 and 12", rows[0].Line, rows[1].Line)
+	}
+}
+
+func TestParseQIFErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{name: "not QIF", data: "Date,Amount\n", wantErr: ErrNotQIF},
+		{name: "only categories", data: "!Type:Cat\nNFood\n^\n", wantErr: ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseQIF(strings.NewReader(tt.data), "", ".", "", "USD")
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ParseQIF() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestQIFDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{value: "1/31'24", want: "2024-01-31"},
+		{value: "1/ 5'24", want: "2024-01-05"},
+		{value: "01/31/2024", want: "2024-01-31"},
+		{value: "12/31/99", want: "1999-12-31"},
+		{value: "12/31/69", want: "2069-12-31"},
+		{value: "31/01/2024", format: "DD/MM/YYYY", want: "2024-01-31"},
+		{value: "31.1'24", format: "DD.MM.YY", want: "2024-01-31"},
+		{value: "2024-01-31", format: "YYYY-MM-DD", want: "2024-01-31"},
+		{value: "2/29'24", want: "2024-02-29"},
+		{value: "2/29'23", wantErr: true},
+		{value: "13/01/2024", wantErr: true},
+		{value: "1/31", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		date, err := qifDate(tt.value, dateOrder(tt.format))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("qifDate(%q) = %s, want an error", tt.value, date.Format("2006-01-02"))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("qifDate(%q) unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got := date.Format("2006-01-02"); got != tt.want {
+			t.Errorf("qifDate(%q, %q) = %s, want %s", tt.value, tt.format, got, tt.want)
+		}
+	}
+}
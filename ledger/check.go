@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Drift describes an account whose cached balance disagrees with the sum of
+// its postings.
+type Drift struct {
+	AccountID  uuid.UUID    `json:"account_id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	Cached     models.Money `json:"cached"`
+	Derived    models.Money `json:"derived"`
+	Difference models.Money `json:"difference"`
+}
+
+// Report is the outcome of a consistency check.
+type Report struct {
+	AccountsChecked      int         `json:"accounts_checked"`
+	Drifts               []Drift     `json:"drifts"`
+	UnbalancedEntries    []uuid.UUID `json:"unbalanced_entries"`
+	UnbookedTransactions int64       `json:"unbooked_transactions"`
+	UnbookedTransfers    int64       `json:"unbooked_transfers"`
+}
+
+func (r Report) Consistent() bool {
+	return len(r.Drifts) == 0 && len(r.UnbalancedEntries) == 0 && r.UnbookedTransactions == 0 && r.UnbookedTransfers == 0
+}
+
+// Balances derives the balance of each account from its postings. Accounts
+// without postings are missing from the result and have a zero balance.
+func Balances(db *gorm.DB, accountIDs []uuid.UUID) (map[uuid.UUID]int64, error) {
+	balances := map[uuid.UUID]int64{}
+	if len(accountIDs) == 0 {
+		return balances, nil
+	}
+
+	var rows []struct {
+		AccountID uuid.UUID
+		Total     models.Money
+	}
+	if err := db.Model(&models.Posting{}).
+		Select("account_id, SUM(amount_minor) AS total").
+		Where("account_id IN ?", accountIDs).
+		Group("account_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		balances[row.AccountID] = row.Total.Amount
+	}
+	return balances, nil
+}
+
+// Check compares every account's cached balance with its postings and looks
+// for entries that do not balance and records that were never booked. A nil
+// userID checks every user.
+func Check(db *gorm.DB, userID *uuid.UUID) (Report, error) {
+	report := Report{Drifts: []Drift{}, UnbalancedEntries: []uuid.UUID{}}
+
+	accounts := db.Model(&models.Account{})
+	entries := db.Model(&models.Posting{})
+	transactions := db.Model(&models.Transaction{}).Where("transfer_id IS NULL")
+	transfers := db.Model(&models.Transfer{})
+	if userID != nil {
+		accounts = accounts.Where("user_id = ?", *userID)
+		entries = entries.Where("user_id = ?", *userID)
+		transactions = transactions.Where("user_id = ?", *userID)
+		transfers = transfers.Where("user_id = ?", *userID)
+	}
+
+	var list []models.Account
+	if err := accounts.Find(&list).Error; err != nil {
+		return report, err
+	}
+	report.AccountsChecked = len(list)
+
+	ids := make([]uuid.UUID, 0, len(list))
+	for _, account := range list {
+		ids = append(ids, account.ID)
+	}
+	balances, err := Balances(db, ids)
+	if err != nil {
+		return report, err
+	}
+	for _, account := range list {
+		derived := models.NewMoney(balances[account.ID], account.Currency)
+		if derived.Amount != account.Balance.Amount {
+			report.Drifts = append(report.Drifts, Drift{
+				AccountID:  account.ID,
+				UserID:     account.UserID,
+				Name:       account.Name,
+				Cached:     account.Balance,
+				Derived:    derived,
+				Difference: account.Balance.Sub(derived),
+			})
+		}
+	}
+
+	if err := entries.
+		Group("entry_id, currency").
+		Having("SUM(amount_minor) <> 0").
+		Distinct().
+		Pluck("entry_id", &report.UnbalancedEntries).Error; err != nil {
+		return report, err
+	}
+
+	if err := transactions.
+		Where("NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.source_type = ? AND e.source_id = transactions.id)", models.JournalSourceTransaction).
+		Count(&report.UnbookedTransactions).Error; err != nil {
+		return report, err
+	}
+	if err := transfers.
+		Where("NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.source_type = ? AND e.source_id = transfers.id)", models.JournalSourceTransfer).
+		Count(&report.UnbookedTransfers).Error; err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// Repair resets every drifting cached balance to the balance derived from
+// the journal and returns how many accounts were changed.
+func Repair(db *gorm.DB, userID *uuid.UUID) (int, error) {
+	report, err := Check(db, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, drift := range report.Drifts {
+			if err := tx.Model(&models.Account{}).Where("id = ?", drift.AccountID).Update("balance_minor", drift.Derived.Amount).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(report.Drifts), nil
+}
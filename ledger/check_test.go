@@ -0,0 +1,184 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MySQL has no INSERT ... RETURNING. Leave it out here too, or columns
+	// with a default are read back into Money without their currency.
+	db.Callback().Create().Replace("gorm:create", callbacks.Create(&callbacks.Config{CreateClauses: []string{"INSERT", "VALUES", "ON CONFLICT"}}))
+	if err := db.AutoMigrate(&models.Account{}, &models.Transaction{}, &models.TransactionSplit{}, &models.Transfer{}, &models.JournalEntry{}, &models.Posting{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createAccount(t *testing.T, db *gorm.DB, userID uuid.UUID, currency string, opening int64) *models.Account {
+	t.Helper()
+	account := &models.Account{Name: currency + " account", UserID: userID, Currency: currency}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(account).Error; err != nil {
+			return err
+		}
+		return OpenAccount(tx, account, models.NewMoney(opening, currency))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
+
+func TestCheck(t *testing.T) {
+	db := openTestDB(t)
+	userID, otherUserID := uuid.New(), uuid.New()
+	categoryID := uuid.New()
+	date := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+	wallet := createAccount(t, db, userID, "USD", 10000)
+	savings := createAccount(t, db, userID, "EUR", 0)
+	createAccount(t, db, otherUserID, "USD", 500)
+
+	expense := &models.Transaction{UserID: userID, AccountID: wallet.ID, CategoryID: &categoryID, Type: models.TransactionTypeExpense, Amount: models.NewMoney(2550, "USD"), Date: date}
+	transfer := &models.Transfer{UserID: userID, FromAccountID: wallet.ID, ToAccountID: savings.ID, FromAmount: models.NewMoney(5000, "USD"), ToAmount: models.NewMoney(4600, "EUR"), Fee: models.NewMoney(100, "USD"), FeeCategoryID: &categoryID, Date: date}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(expense).Error; err != nil {
+			return err
+		}
+		if err := RecordTransaction(tx, expense); err != nil {
+			return err
+		}
+		if err := tx.Create(transfer).Error; err != nil {
+			return err
+		}
+		return RecordTransfer(tx, transfer)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(db, &userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent() || report.AccountsChecked != 2 {
+		t.Fatalf("Check() = %+v, want 2 consistent accounts", report)
+	}
+	balances, err := Balances(db, []uuid.UUID{wallet.ID, savings.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balances[wallet.ID] != 10000-2550-5000-100 || balances[savings.ID] != 4600 {
+		t.Errorf("Balances() = %v, want %d and %d", balances, 10000-2550-5000-100, 4600)
+	}
+
+	// Break each invariant in turn.
+	db.Model(&models.Account{}).Where("id = ?", wallet.ID).Update("balance_minor", 1)
+	db.Create(&models.Transaction{UserID: userID, AccountID: wallet.ID, Type: models.TransactionTypeIncome, Amount: models.NewMoney(100, "USD"), Date: date})
+	db.Create(&models.Transfer{UserID: userID, FromAccountID: wallet.ID, ToAccountID: savings.ID, FromAmount: models.NewMoney(1, "USD"), ToAmount: models.NewMoney(1, "EUR"), Date: date})
+	unbalanced := &models.JournalEntry{UserID: userID, SourceType: models.JournalSourceAdjustment, SourceID: uuid.New(), Date: date, Postings: []models.Posting{
+		{UserID: userID, Ledger: models.LedgerAssets, AccountID: &savings.ID, Amount: models.NewMoney(1, "EUR")},
+	}}
+	db.Create(unbalanced)
+
+	report, err = Check(db, &userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Drifts) != 2 {
+		t.Fatalf("Check() drifts = %+v, want the wallet and savings accounts", report.Drifts)
+	}
+	for _, drift := range report.Drifts {
+		if drift.AccountID == wallet.ID && (drift.Cached.Amount != 1 || drift.Derived.Amount != 2350 || drift.Difference.Amount != 1-2350) {
+			t.Errorf("wallet drift = %+v, want cached 1, derived 2350", drift)
+		}
+	}
+	if len(report.UnbalancedEntries) != 1 || report.UnbalancedEntries[0] != unbalanced.ID {
+		t.Errorf("Check() unbalanced entries = %v, want %s", report.UnbalancedEntries, unbalanced.ID)
+	}
+	if report.UnbookedTransactions != 1 || report.UnbookedTransfers != 1 {
+		t.Errorf("Check() unbooked = %d transactions, %d transfers, want 1 and 1", report.UnbookedTransactions, report.UnbookedTransfers)
+	}
+
+	// The other user's books are untouched.
+	if report, err := Check(db, &otherUserID); err != nil || !report.Consistent() {
+		t.Errorf("Check(other user) = %+v, %v, want consistent", report, err)
+	}
+
+	repaired, err := Repair(db, &userID)
+	if err != nil || repaired != 2 {
+		t.Fatalf("Repair() = %d, %v, want 2 accounts", repaired, err)
+	}
+	if report, _ := Check(db, &userID); len(report.Drifts) != 0 {
+		t.Errorf("drifts left after Repair(): %+v", report.Drifts)
+	}
+}
+
+func TestPostAndRemove(t *testing.T) {
+	db := openTestDB(t)
+	userID := uuid.New()
+	account := createAccount(t, db, userID, "USD", 0)
+	categoryID := uuid.New()
+
+	tests := []struct {
+		name     string
+		postings []models.Posting
+		wantErr  error
+	}{
+		{name: "no postings", wantErr: ErrUnbalanced},
+		{name: "one side only", postings: []models.Posting{
+			{Ledger: models.LedgerAssets, AccountID: &account.ID, Amount: models.NewMoney(100, "USD")},
+		}, wantErr: ErrUnbalanced},
+		{name: "balanced in total but not per currency", postings: []models.Posting{
+			{Ledger: models.LedgerAssets, AccountID: &account.ID, Amount: models.NewMoney(100, "USD")},
+			{Ledger: models.LedgerIncome, CategoryID: &categoryID, Amount: models.NewMoney(-100, "EUR")},
+		}, wantErr: ErrUnbalanced},
+		{name: "missing currency", postings: []models.Posting{
+			{Ledger: models.LedgerAssets, AccountID: &account.ID, Amount: models.Money{Amount: 100}},
+			{Ledger: models.LedgerIncome, CategoryID: &categoryID, Amount: models.Money{Amount: -100}},
+		}, wantErr: ErrUnbalanced},
+		{name: "balanced", postings: []models.Posting{
+			{Ledger: models.LedgerAssets, AccountID: &account.ID, Amount: models.NewMoney(100, "USD")},
+			{Ledger: models.LedgerIncome, CategoryID: &categoryID, Amount: models.NewMoney(-100, "USD")},
+		}},
+	}
+
+	sourceID := uuid.New()
+	for _, tt := range tests {
+		entry := &models.JournalEntry{UserID: userID, SourceType: models.JournalSourceAdjustment, SourceID: sourceID, Postings: tt.postings}
+		if err := Post(db, entry); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Post() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	var stored models.Account
+	db.First(&stored, "id = ?", account.ID)
+	if stored.Balance.Amount != 100 {
+		t.Errorf("balance after Post() = %d, want 100", stored.Balance.Amount)
+	}
+
+	if err := Remove(db, models.JournalSourceAdjustment, sourceID); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&stored, "id = ?", account.ID)
+	var postings int64
+	db.Model(&models.Posting{}).Where("account_id = ?", account.ID).Count(&postings)
+	if stored.Balance.Amount != 0 || postings != 0 {
+		t.Errorf("after Remove() balance = %d with %d postings, want 0 and 0", stored.Balance.Amount, postings)
+	}
+}
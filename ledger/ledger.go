@@ -0,0 +1,101 @@
+// Package ledger keeps the double-entry journal. Every change to an account
+// balance is booked as a journal entry whose postings sum to zero in each
+// currency; the balance cached on the account is only updated alongside it.
+package ledger
+
+import (
+	"errors"
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrUnbalanced = errors.New("journal entry does not balance")
+
+// Post validates and stores a journal entry and moves the cached balance of
+// every account it touches. It must run inside the database transaction that
+// changes the source record, so a failure rolls both back.
+func Post(tx *gorm.DB, entry *models.JournalEntry) error {
+	if len(entry.Postings) == 0 || !balanced(entry.Postings) {
+		return ErrUnbalanced
+	}
+	for i := range entry.Postings {
+		entry.Postings[i].UserID = entry.UserID
+	}
+
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+
+	// Check again against what was actually written, so a posting lost on the
+	// way to the database cannot leave a half-booked entry behind.
+	var unbalanced []string
+	if err := tx.Model(&models.Posting{}).
+		Where("entry_id = ?", entry.ID).
+		Group("currency").
+		Having("SUM(amount_minor) <> 0").
+		Pluck("currency", &unbalanced).Error; err != nil {
+		return err
+	}
+	if len(unbalanced) > 0 {
+		return ErrUnbalanced
+	}
+
+	for _, posting := range entry.Postings {
+		if posting.AccountID == nil {
+			continue
+		}
+		if err := moveCachedBalance(tx, *posting.AccountID, posting.Amount.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove deletes the entries booked for a source record and takes their
+// postings back out of the cached balances.
+func Remove(tx *gorm.DB, sourceType string, sourceID uuid.UUID) error {
+	var entries []models.JournalEntry
+	if err := tx.Preload("Postings").Where("source_type = ? AND source_id = ?", sourceType, sourceID).Find(&entries).Error; err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			if posting.AccountID == nil {
+				continue
+			}
+			if err := moveCachedBalance(tx, *posting.AccountID, -posting.Amount.Amount); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("entry_id = ?", entry.ID).Delete(&models.Posting{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&entry).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func balanced(postings []models.Posting) bool {
+	sums := map[string]int64{}
+	for _, posting := range postings {
+		if posting.Amount.Currency == "" {
+			return false
+		}
+		sums[posting.Amount.Currency] += posting.Amount.Amount
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func moveCachedBalance(tx *gorm.DB, accountID uuid.UUID, delta int64) error {
+	return tx.Model(&models.Account{}).Where("id = ?", accountID).Update("balance_minor", gorm.Expr("balance_minor + ?", delta)).Error
+}
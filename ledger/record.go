@@ -0,0 +1,98 @@
+package ledger
+
+import (
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func assetPosting(accountID uuid.UUID, amount models.Money) models.Posting {
+	return models.Posting{Ledger: models.LedgerAssets, AccountID: &accountID, Amount: amount}
+}
+
+// OpenAccount books an account's opening balance against opening equity.
+// A zero opening balance books nothing.
+func OpenAccount(tx *gorm.DB, account *models.Account, opening models.Money) error {
+	if opening.IsZero() {
+		return nil
+	}
+	return Post(tx, &models.JournalEntry{
+		UserID:      account.UserID,
+		SourceType:  models.JournalSourceOpening,
+		SourceID:    account.ID,
+		Date:        account.CreatedAt,
+		Description: "Opening balance",
+		Postings: []models.Posting{
+			assetPosting(account.ID, opening),
+			{Ledger: models.LedgerEquityOpening, Amount: opening.Neg()},
+		},
+	})
+}
+
+// RecordTransaction books an income or expense against its category, or
+// against each split line's category when it is split. Legs of a transfer
+// are skipped; RecordTransfer books them as one entry. The splits are read
+// from the database, so they must be saved first.
+func RecordTransaction(tx *gorm.DB, transaction *models.Transaction) error {
+	if transaction.IsTransferLeg() {
+		return nil
+	}
+
+	var splits []models.TransactionSplit
+	if err := tx.Where("transaction_id = ?", transaction.ID).Order("position").Find(&splits).Error; err != nil {
+		return err
+	}
+	lines := []models.TransactionSplit{{CategoryID: transaction.CategoryID, Amount: transaction.Amount}}
+	if len(splits) > 0 {
+		lines = splits
+	}
+
+	postings := []models.Posting{assetPosting(transaction.AccountID, transaction.SignedAmount())}
+	for _, line := range lines {
+		counter := models.Posting{Ledger: models.LedgerExpenses, CategoryID: line.CategoryID, Amount: line.Amount}
+		if transaction.Type == models.TransactionTypeIncome {
+			counter = models.Posting{Ledger: models.LedgerIncome, CategoryID: line.CategoryID, Amount: line.Amount.Neg()}
+		}
+		postings = append(postings, counter)
+	}
+
+	return Post(tx, &models.JournalEntry{
+		UserID:      transaction.UserID,
+		SourceType:  models.JournalSourceTransaction,
+		SourceID:    transaction.ID,
+		Date:        transaction.Date,
+		Description: transaction.Note,
+		Postings:    postings,
+	})
+}
+
+// RecordTransfer books a transfer as one entry. Across currencies each side
+// is balanced through conversion equity, and a fee is booked as an expense.
+func RecordTransfer(tx *gorm.DB, transfer *models.Transfer) error {
+	postings := []models.Posting{
+		assetPosting(transfer.FromAccountID, transfer.FromAmount.Neg()),
+		assetPosting(transfer.ToAccountID, transfer.ToAmount),
+	}
+	if transfer.IsCrossCurrency() {
+		postings = append(postings,
+			models.Posting{Ledger: models.LedgerEquityConversion, Amount: transfer.FromAmount},
+			models.Posting{Ledger: models.LedgerEquityConversion, Amount: transfer.ToAmount.Neg()},
+		)
+	}
+	if transfer.Fee.IsPositive() {
+		postings = append(postings,
+			assetPosting(transfer.FromAccountID, transfer.Fee.Neg()),
+			models.Posting{Ledger: models.LedgerExpenses, CategoryID: transfer.FeeCategoryID, Amount: transfer.Fee},
+		)
+	}
+
+	return Post(tx, &models.JournalEntry{
+		UserID:      transfer.UserID,
+		SourceType:  models.JournalSourceTransfer,
+		SourceID:    transfer.ID,
+		Date:        transfer.Date,
+		Description: transfer.Note,
+		Postings:    postings,
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,12 +9,19 @@ import (
 
 	"gorm.io/gorm"
 
+	"expense-app-backend/blobstore"
 	"expense-app-backend/config"
+	"expense-app-backend/migrations"
 	"expense-app-backend/models"
+	"expense-app-backend/notifier"
 	"expense-app-backend/routes"
+	"expense-app-backend/scheduler"
 )
 
-var db *gorm.DB
+var (
+	db    *gorm.DB
+	store blobstore.BlobStore
+)
 
 func initDatabase() {
 	var err error
@@ -22,14 +30,56 @@ func initDatabase() {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	db.AutoMigrate(&models.Category{}, &models.SubCategory{}, &models.User{}, &models.Account{})
+	db.AutoMigrate(&models.Category{}, &models.User{}, &models.Account{}, &models.Transaction{}, &models.TransactionSplit{}, &models.Tag{}, &models.TransactionTag{}, &models.Payee{}, &models.PayeeAlias{}, &models.Rule{}, &models.ExchangeRate{}, &models.Transfer{}, &models.JournalEntry{}, &models.Posting{}, &models.Budget{}, &models.EnvelopeAssignment{}, &models.EnvelopeMove{}, &models.RecurringTransaction{}, &models.RecurringException{}, &models.Bill{}, &models.BillPayment{}, &models.ImportProfile{}, &models.ImportBatch{}, &models.Attachment{})
+	if err := migrations.Run(db); err != nil {
+		log.Fatalf("failed to run data migrations: %v", err)
+	}
 	fmt.Println("Database connected and table migrated")
+
+	promoteAdmin()
+}
+
+// promoteAdmin grants the admin role to the account named by ADMIN_EMAIL so a
+// fresh instance has someone who can reach the admin endpoints.
+func promoteAdmin() {
+	email := os.Getenv("ADMIN_EMAIL")
+	if email == "" {
+		return
+	}
+
+	result := db.Model(&models.User{}).Where("email = ?", email).Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		log.Printf("failed to promote admin %s: %v", email, result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("User %s promoted to admin\n", email)
+	}
 }
 
 func main() {
 	initDatabase()
 
-	r := routes.SetupRouter(db)
+	var err error
+	store, err = blobstore.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure blob store: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	notify, err := notifier.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure notifications: %v", err)
+	}
+	scheduler.New(db, scheduler.RecurringJob, scheduler.BillReminderJob(notify), scheduler.AccountDeletionJob(store)).Start(context.Background())
+
+	r := routes.SetupRouter(db, store)
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
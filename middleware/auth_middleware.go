@@ -1,43 +1,135 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
+	"expense-app-backend/models"
 	"expense-app-backend/utils"
 	"net/http"
 	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type contextKey string
+
+const (
+	claimsContextKey contextKey = "claims"
+	userContextKey   contextKey = "user"
 )
 
+// passwordChangePath stays reachable for users that were forced to reset
+// their password, every other protected route is blocked until they do.
+const passwordChangePath = "/api/password"
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 
-		if authHeader == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			errorResponse := struct {
-				StatusCode int    `json:"status_code"`
-				Message    string `json:"message"`
-			}{
-				StatusCode: http.StatusUnauthorized,
-				Message:    "Unauthorized",
-			}
-			json.NewEncoder(w).Encode(errorResponse)
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		token := strings.Split(authHeader, "Bearer ")[1]
-		if _, err := utils.ValidateToken(token); err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			errorResponse := struct {
-				StatusCode int    `json:"status_code"`
-				Message    string `json:"message"`
-			}{
-				StatusCode: http.StatusUnauthorized,
-				Message:    "Unauthorized",
-			}
-			json.NewEncoder(w).Encode(errorResponse)
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		claims, err := utils.ValidateToken(token)
+		if err != nil || claims == nil {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// ActiveUser loads the authenticated user on every request so that role
+// changes, disabled accounts, forced password resets and deletion requests
+// take effect immediately instead of waiting for the token to be re-issued.
+func ActiveUser(db *gorm.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(claimsContextKey).(*utils.JWTClaim)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			var user models.User
+			if err := db.Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			if user.Disabled {
+				writeError(w, http.StatusForbidden, "Account is disabled")
+				return
+			}
+
+			// Logging in again is the way back into an account that is
+			// scheduled for deletion; old tokens stop working.
+			if user.PendingDeletion() {
+				writeError(w, http.StatusForbidden, "Account is scheduled for deletion")
+				return
+			}
+
+			if user.MustResetPassword && r.URL.Path != passwordChangePath {
+				writeError(w, http.StatusForbidden, "Password reset required")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userContextKey, &user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := CurrentUser(r)
+			if user == nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			writeError(w, http.StatusForbidden, "Forbidden")
+		})
+	}
+}
+
+func CurrentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+func CurrentUserID(r *http.Request) uuid.UUID {
+	if user := CurrentUser(r); user != nil {
+		return user.ID
+	}
+	if claims, ok := r.Context().Value(claimsContextKey).(*utils.JWTClaim); ok {
+		return claims.UserID
+	}
+	return uuid.Nil
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	errorResponse := struct {
+		StatusCode int    `json:"status_code"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	}
+	json.NewEncoder(w).Encode(errorResponse)
+}
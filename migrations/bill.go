@@ -0,0 +1,11 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// migrateBillStartDates gives bills created before bills had a start date
+// their current due date, the best anchor left for their schedule.
+func migrateBillStartDates(db *gorm.DB) error {
+	return db.Exec("UPDATE bills SET start_date = due_date WHERE start_date IS NULL").Error
+}
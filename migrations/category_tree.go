@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"expense-app-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	legacySubCategoryTable   = "sub_categories"
+	migratedSubCategoryTable = "sub_categories_migrated"
+)
+
+// legacySubCategory mirrors the sub_categories table used before categories
+// became a self-referencing tree.
+type legacySubCategory struct {
+	ID         uuid.UUID
+	Name       string
+	CategoryID uuid.UUID
+	Position   int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt
+}
+
+// migrateSubCategoriesToTree copies every sub-category into the categories
+// table as a child of its former category, keeping its ID so anything that
+// referenced it still resolves. The old table is renamed rather than dropped
+// so the copy can be checked by hand.
+func migrateSubCategoriesToTree(db *gorm.DB) error {
+	if !db.Migrator().HasTable(legacySubCategoryTable) {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var subCategories []legacySubCategory
+		if err := tx.Table(legacySubCategoryTable).Find(&subCategories).Error; err != nil {
+			return err
+		}
+
+		for _, subCategory := range subCategories {
+			var existing int64
+			if err := tx.Unscoped().Model(&models.Category{}).Where("id = ?", subCategory.ID).Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing > 0 {
+				continue
+			}
+
+			var parent models.Category
+			if err := tx.Unscoped().Where("id = ?", subCategory.CategoryID).First(&parent).Error; err != nil {
+				continue
+			}
+
+			parentID := parent.ID
+			category := models.Category{
+				ID:           subCategory.ID,
+				UserID:       parent.UserID,
+				ParentID:     &parentID,
+				Name:         subCategory.Name,
+				CategoryType: parent.CategoryType,
+				Position:     subCategory.Position,
+				CreatedAt:    subCategory.CreatedAt,
+				UpdatedAt:    subCategory.UpdatedAt,
+			}
+			category.DeletedAt = subCategory.DeletedAt
+			if err := tx.Create(&category).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Migrator().RenameTable(legacySubCategoryTable, migratedSubCategoryTable)
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"expense-app-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// migrateCurrencies fills in the currency of accounts created before
+// accounts had one, and copies each account's currency onto its transactions.
+func migrateCurrencies(db *gorm.DB) error {
+	if err := db.Exec("UPDATE accounts SET currency = ? WHERE currency = ''", models.DefaultCurrency()).Error; err != nil {
+		return err
+	}
+	return db.Exec("UPDATE transactions t JOIN accounts a ON a.id = t.account_id SET t.currency = a.currency WHERE t.currency = ''").Error
+}
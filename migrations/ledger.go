@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"expense-app-backend/ledger"
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// migrateToJournal books the existing transactions and transfers into the
+// journal the first time it runs. Whatever part of a cached balance the
+// history does not explain is booked as the account's opening balance, so
+// the derived balances match the cached ones afterwards.
+func migrateToJournal(db *gorm.DB) error {
+	var entries int64
+	if err := db.Model(&models.JournalEntry{}).Count(&entries).Error; err != nil {
+		return err
+	}
+	if entries > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var accounts []models.Account
+		if err := tx.Find(&accounts).Error; err != nil {
+			return err
+		}
+
+		var transactions []models.Transaction
+		if err := tx.Where("transfer_id IS NULL").Find(&transactions).Error; err != nil {
+			return err
+		}
+		for i := range transactions {
+			if err := ledger.RecordTransaction(tx, &transactions[i]); err != nil {
+				return err
+			}
+		}
+
+		var transfers []models.Transfer
+		if err := tx.Find(&transfers).Error; err != nil {
+			return err
+		}
+		for i := range transfers {
+			if err := ledger.RecordTransfer(tx, &transfers[i]); err != nil {
+				return err
+			}
+		}
+
+		ids := make([]uuid.UUID, 0, len(accounts))
+		for _, account := range accounts {
+			ids = append(ids, account.ID)
+		}
+		balances, err := ledger.Balances(tx, ids)
+		if err != nil {
+			return err
+		}
+
+		for i := range accounts {
+			account := &accounts[i]
+			opening := account.Balance.Sub(models.NewMoney(balances[account.ID], account.Currency))
+			if err := ledger.OpenAccount(tx, account, opening); err != nil {
+				return err
+			}
+			// Booking moved the cached balance; it was right to begin with.
+			if err := tx.Model(&models.Account{}).Where("id = ?", account.ID).Update("balance_minor", account.Balance.Amount).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// Run applies the data migrations that AutoMigrate cannot express. Every
+// step must be safe to run again on an already migrated database.
+func Run(db *gorm.DB) error {
+	steps := []func(*gorm.DB) error{
+		migrateSubCategoriesToTree,
+		migrateFloatAmountsToMoney,
+		migrateCurrencies,
+		migrateToJournal,
+		migrateBillStartDates,
+	}
+
+	for _, step := range steps {
+		if err := step(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
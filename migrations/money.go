@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"expense-app-backend/models"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// migrateFloatAmountsToMoney converts the legacy float columns into integer
+// minor units of the default currency and drops the float columns afterwards.
+func migrateFloatAmountsToMoney(db *gorm.DB) error {
+	factor := math.Pow10(models.CurrencyExponent(models.DefaultCurrency()))
+
+	conversions := []struct {
+		model  interface{}
+		table  string
+		legacy string
+		minor  string
+	}{
+		{&models.Account{}, "accounts", "balance", "balance_minor"},
+		{&models.Transaction{}, "transactions", "amount", "amount_minor"},
+	}
+
+	for _, conversion := range conversions {
+		if !db.Migrator().HasColumn(conversion.model, conversion.legacy) {
+			continue
+		}
+
+		statement := fmt.Sprintf("UPDATE %s SET %s = ROUND(%s * ?)", conversion.table, conversion.minor, conversion.legacy)
+		if err := db.Exec(statement, factor).Error; err != nil {
+			return err
+		}
+		if err := db.Migrator().DropColumn(conversion.model, conversion.legacy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
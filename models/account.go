@@ -11,12 +11,25 @@ type Account struct {
 	ID        uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
 	Name      string    `json:"name"`
 	UserID    uuid.UUID `json:"user_id"`
-	Balance   float64   `json:"balance"`
+	Currency  string    `gorm:"type:char(3);not null;default:''" json:"currency"`
+	Balance   Money     `gorm:"column:balance_minor;not null;default:0" json:"balance"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (a *Account) BeforeCreate(tx *gorm.DB) (err error) {
 	a.ID = uuid.New()
+	if a.Currency == "" {
+		a.Currency = DefaultCurrency()
+	}
+	a.Balance.Currency = a.Currency
+	return
+}
+
+func (a *Account) AfterFind(tx *gorm.DB) (err error) {
+	if a.Currency == "" {
+		a.Currency = DefaultCurrency()
+	}
+	a.Balance.Currency = a.Currency
 	return
 }
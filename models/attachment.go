@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Attachment is a receipt photo or PDF attached to a transaction. The file
+// itself lives in the blob store under its SHA-256, so the same file
+// uploaded twice is stored once.
+type Attachment struct {
+	ID            uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID        uuid.UUID `gorm:"type:char(36);index" json:"user_id"`
+	TransactionID uuid.UUID `gorm:"type:char(36);index" json:"transaction_id"`
+	Filename      string    `gorm:"type:varchar(255);not null" json:"filename"`
+	ContentType   string    `gorm:"type:varchar(100);not null" json:"content_type"`
+	Size          int64     `gorm:"not null" json:"size"`
+	SHA256        string    `gorm:"column:sha256;type:char(64);not null;index" json:"sha256"`
+	HasThumbnail  bool      `gorm:"not null" json:"has_thumbnail"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (a *Attachment) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	BillStatusUnpaid  = "unpaid"
+	BillStatusOverdue = "overdue"
+	BillStatusPaid    = "paid"
+)
+
+const DefaultBillReminderDays = 3
+
+// Bill is an expense due on DueDate. A bill with an RRule repeats from
+// StartDate: paying it moves DueDate to the next occurrence. A one-off bill is
+// marked Paid instead.
+// RemindedFor is the due date the last reminder was sent for, so each due
+// date is reminded once.
+type Bill struct {
+	ID          uuid.UUID      `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID      uuid.UUID      `gorm:"type:char(36);index" json:"user_id"`
+	AccountID   uuid.UUID      `gorm:"type:char(36);index" json:"account_id"`
+	CategoryID  *uuid.UUID     `gorm:"type:char(36)" json:"category_id"`
+	Name        string         `gorm:"type:varchar(255);not null" json:"name"`
+	Amount      Money          `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency    string         `gorm:"type:char(3);not null;default:''" json:"currency"`
+	StartDate   time.Time      `gorm:"type:date" json:"start_date"`
+	DueDate     time.Time      `gorm:"type:date;index" json:"due_date"`
+	RRule       string         `gorm:"column:rrule;type:varchar(255)" json:"rrule"`
+	RemindDays  int            `gorm:"not null;default:3" json:"remind_days"`
+	RemindedFor *time.Time     `gorm:"type:date" json:"reminded_for"`
+	Paid        bool           `gorm:"default:false" json:"paid"`
+	Note        string         `json:"note"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (b *Bill) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	if b.StartDate.IsZero() {
+		b.StartDate = b.DueDate
+	}
+	b.Currency = b.Amount.Currency
+	return
+}
+
+func (b *Bill) AfterFind(tx *gorm.DB) (err error) {
+	b.Amount.Currency = b.Currency
+	return
+}
+
+// Status reports whether the bill is paid, overdue on the given day, or
+// still to be paid.
+func (b *Bill) Status(today time.Time) string {
+	if b.Paid {
+		return BillStatusPaid
+	}
+	if b.DueDate.Before(time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, b.DueDate.Location())) {
+		return BillStatusOverdue
+	}
+	return BillStatusUnpaid
+}
+
+// BillPayment links a paid due date of a bill to the transaction that paid
+// it.
+type BillPayment struct {
+	ID            uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
+	BillID        uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_bill_payment" json:"bill_id"`
+	DueDate       time.Time `gorm:"type:date;uniqueIndex:idx_bill_payment" json:"due_date"`
+	TransactionID uuid.UUID `gorm:"type:char(36);index" json:"transaction_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (p *BillPayment) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return
+}
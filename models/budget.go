@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+	BudgetPeriodYearly  = "yearly"
+)
+
+// Budget caps what may be spent in a category, sub-categories included, per
+// period. With Rollover the unspent or overspent amount of each period is
+// carried into the next one, counting from the period containing StartDate.
+type Budget struct {
+	ID         uuid.UUID      `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID     uuid.UUID      `gorm:"type:char(36);index" json:"user_id"`
+	CategoryID uuid.UUID      `gorm:"type:char(36);index" json:"category_id"`
+	Period     string         `gorm:"type:varchar(10)" json:"period"`
+	Amount     Money          `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency   string         `gorm:"type:char(3);not null;default:''" json:"currency"`
+	StartDate  time.Time      `gorm:"type:date" json:"start_date"`
+	Rollover   bool           `gorm:"default:false" json:"rollover"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (b *Budget) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	b.Currency = b.Amount.Currency
+	return
+}
+
+func (b *Budget) AfterFind(tx *gorm.DB) (err error) {
+	b.Amount.Currency = b.Currency
+	return
+}
+
+func IsValidBudgetPeriod(period string) bool {
+	return period == BudgetPeriodWeekly || period == BudgetPeriodMonthly || period == BudgetPeriodYearly
+}
+
+// PeriodBounds returns the start of the period containing date and the start
+// of the following one. Weeks start on Monday.
+func PeriodBounds(period string, date time.Time) (time.Time, time.Time) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+
+	switch period {
+	case BudgetPeriodWeekly:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case BudgetPeriodYearly:
+		start := time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, day.Location())
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+}
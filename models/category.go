@@ -9,15 +9,21 @@ import (
 
 type Category struct {
 	gorm.Model
-	ID            uuid.UUID     `gorm:"type:char(36);primaryKey;" json:"id"`
-	Name          string        `json:"name"`
-	CategoryType  string        `json:"category_type"`
-	CreatedAt     time.Time     `json:"created_at"`
-	UpdatedAt     time.Time     `json:"updated_at"`
-	SubCategories []SubCategory `gorm:"foreignKey:CategoryID;references:ID" json:"sub_categories"`
+	ID           uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID       *uuid.UUID `gorm:"type:char(36);index" json:"user_id"`
+	ParentID     *uuid.UUID `gorm:"type:char(36);index" json:"parent_id"`
+	Name         string     `json:"name"`
+	CategoryType string     `json:"category_type"`
+	Position     int        `gorm:"default:0" json:"position"`
+	ArchivedAt   *time.Time `gorm:"index" json:"archived_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Children     []Category `gorm:"foreignKey:ParentID;references:ID" json:"children"`
 }
 
 func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
-	c.ID = uuid.New()
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
 	return
 }
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CategoryTree indexes a flat list of categories by parent so callers can
+// walk subtrees without issuing one query per level.
+type CategoryTree struct {
+	byID     map[uuid.UUID]*Category
+	children map[uuid.UUID][]*Category
+}
+
+func NewCategoryTree(categories []Category) *CategoryTree {
+	tree := &CategoryTree{
+		byID:     make(map[uuid.UUID]*Category),
+		children: make(map[uuid.UUID][]*Category),
+	}
+
+	for i := range categories {
+		tree.byID[categories[i].ID] = &categories[i]
+	}
+
+	for i := range categories {
+		category := &categories[i]
+		parentID := uuid.Nil
+		if category.ParentID != nil {
+			if _, found := tree.byID[*category.ParentID]; found {
+				parentID = *category.ParentID
+			}
+		}
+		tree.children[parentID] = append(tree.children[parentID], category)
+	}
+
+	for _, siblings := range tree.children {
+		sort.SliceStable(siblings, func(i, j int) bool {
+			if siblings[i].Position != siblings[j].Position {
+				return siblings[i].Position < siblings[j].Position
+			}
+			return siblings[i].CreatedAt.Before(siblings[j].CreatedAt)
+		})
+	}
+
+	return tree
+}
+
+// LoadCategoryTree loads every category visible to the user, which are their
+// own categories plus the global defaults.
+func LoadCategoryTree(db *gorm.DB, userID uuid.UUID) (*CategoryTree, error) {
+	var categories []Category
+	if err := db.Where("(user_id = ? OR user_id IS NULL)", userID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return NewCategoryTree(categories), nil
+}
+
+func (t *CategoryTree) Get(id uuid.UUID) (*Category, bool) {
+	category, found := t.byID[id]
+	return category, found
+}
+
+func (t *CategoryTree) Roots() []*Category {
+	return t.children[uuid.Nil]
+}
+
+func (t *CategoryTree) Children(id uuid.UUID) []*Category {
+	return t.children[id]
+}
+
+// Descendants returns the ID of the category followed by the IDs of every
+// category below it, depth first.
+func (t *CategoryTree) Descendants(id uuid.UUID) []uuid.UUID {
+	if _, found := t.byID[id]; !found {
+		return nil
+	}
+
+	ids := []uuid.UUID{id}
+	for _, child := range t.children[id] {
+		ids = append(ids, t.Descendants(child.ID)...)
+	}
+	return ids
+}
+
+// IsDescendant reports whether id sits somewhere below ancestor. A category
+// is considered a descendant of itself so moves onto itself are rejected too.
+func (t *CategoryTree) IsDescendant(ancestor, id uuid.UUID) bool {
+	seen := make(map[uuid.UUID]bool)
+	for current, found := t.byID[id]; found; current, found = t.parent(current) {
+		if current.ID == ancestor {
+			return true
+		}
+		if seen[current.ID] {
+			return false
+		}
+		seen[current.ID] = true
+	}
+	return false
+}
+
+// Path returns the chain of categories from the root down to id.
+func (t *CategoryTree) Path(id uuid.UUID) []*Category {
+	var path []*Category
+	seen := make(map[uuid.UUID]bool)
+	for current, found := t.byID[id]; found && !seen[current.ID]; current, found = t.parent(current) {
+		seen[current.ID] = true
+		path = append([]*Category{current}, path...)
+	}
+	return path
+}
+
+func (t *CategoryTree) Depth(id uuid.UUID) int {
+	return len(t.Path(id))
+}
+
+func (t *CategoryTree) parent(category *Category) (*Category, bool) {
+	if category.ParentID == nil {
+		return nil, false
+	}
+	parent, found := t.byID[*category.ParentID]
+	return parent, found
+}
+
+// RollupCategoryTotals adds every category's direct total to all of its
+// ancestors, so a parent reports the sum of its whole subtree.
+func RollupCategoryTotals[T int64 | float64](t *CategoryTree, direct map[uuid.UUID]T) map[uuid.UUID]T {
+	totals := make(map[uuid.UUID]T)
+	for id, amount := range direct {
+		for _, category := range t.Path(id) {
+			totals[category.ID] += amount
+		}
+	}
+	return totals
+}
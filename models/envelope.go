@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EnvelopeAssignment is the amount of income assigned to a category's
+// envelope for one month. Month is always the first day of the month and
+// amounts are in the user's base currency.
+type EnvelopeAssignment struct {
+	ID         uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID     uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_envelope_assignment" json:"user_id"`
+	CategoryID uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_envelope_assignment" json:"category_id"`
+	Month      time.Time `gorm:"type:date;uniqueIndex:idx_envelope_assignment" json:"month"`
+	Amount     Money     `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency   string    `gorm:"type:char(3);not null;default:''" json:"currency"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (e *EnvelopeAssignment) BeforeSave(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	e.Currency = e.Amount.Currency
+	return
+}
+
+func (e *EnvelopeAssignment) AfterFind(tx *gorm.DB) (err error) {
+	e.Amount.Currency = e.Currency
+	return
+}
+
+// EnvelopeMove is the audit trail of money moving between envelopes. A nil
+// category stands for the "ready to assign" pool.
+type EnvelopeMove struct {
+	ID             uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:char(36);index" json:"user_id"`
+	Month          time.Time  `gorm:"type:date;index" json:"month"`
+	FromCategoryID *uuid.UUID `gorm:"type:char(36)" json:"from_category_id"`
+	ToCategoryID   *uuid.UUID `gorm:"type:char(36)" json:"to_category_id"`
+	Amount         Money      `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency       string     `gorm:"type:char(3);not null;default:''" json:"currency"`
+	Note           string     `json:"note"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func (e *EnvelopeMove) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	e.Currency = e.Amount.Currency
+	return
+}
+
+func (e *EnvelopeMove) AfterFind(tx *gorm.DB) (err error) {
+	e.Amount.Currency = e.Currency
+	return
+}
+
+// MonthStart returns the first day of date's month.
+func MonthStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ExchangeRateSourceManual = "manual"
+	ExchangeRateSourceECB    = "ecb"
+)
+
+// ExchangeRate records how many units of QuoteCurrency one unit of
+// BaseCurrency bought on Date. Rates without a user are shared by everyone;
+// a user's own rates take precedence over the shared ones.
+type ExchangeRate struct {
+	ID            uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID        *uuid.UUID `gorm:"type:char(36);index" json:"user_id"`
+	BaseCurrency  string     `gorm:"type:char(3);index:idx_exchange_rate_pair" json:"base_currency"`
+	QuoteCurrency string     `gorm:"type:char(3);index:idx_exchange_rate_pair" json:"quote_currency"`
+	Rate          string     `gorm:"type:decimal(24,12)" json:"rate"`
+	Date          time.Time  `gorm:"type:date;index:idx_exchange_rate_pair" json:"date"`
+	Source        string     `gorm:"type:varchar(20)" json:"source"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (e *ExchangeRate) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
+
+// Rat parses the stored rate. Rates restored from an archive were never
+// validated, so anything but a plain positive decimal is refused.
+func (e *ExchangeRate) Rat() (*big.Rat, bool) {
+	rate, err := ParseDecimal(e.Rate)
+	if err != nil || rate.Sign() <= 0 {
+		return nil, false
+	}
+	return rate, true
+}
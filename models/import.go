@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Statement formats an import batch can come from.
+const (
+	ImportFormatCSV = "csv"
+	ImportFormatOFX = "ofx"
+	ImportFormatQIF = "qif"
+)
+
+// ImportProfile is a saved column mapping for one bank's CSV statements.
+// Columns are named by their header, or by 1-based position when the file
+// has no header row. Either AmountColumn holds signed amounts, or
+// DebitColumn and CreditColumn hold money going out and coming in.
+type ImportProfile struct {
+	ID                uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID            uuid.UUID `gorm:"type:char(36);index" json:"user_id"`
+	Name              string    `gorm:"type:varchar(255);not null" json:"name"`
+	Delimiter         string    `gorm:"type:varchar(4);not null;default:','" json:"delimiter"`
+	HasHeader         bool      `gorm:"not null;default:true" json:"has_header"`
+	SkipRows          int       `gorm:"not null;default:0" json:"skip_rows"`
+	Encoding          string    `gorm:"type:varchar(40);not null;default:'utf-8'" json:"encoding"`
+	DateColumn        string    `gorm:"type:varchar(255);not null" json:"date_column"`
+	DateFormat        string    `gorm:"type:varchar(40);not null;default:'YYYY-MM-DD'" json:"date_format"`
+	DescriptionColumn string    `gorm:"type:varchar(255)" json:"description_column"`
+	PayeeColumn       string    `gorm:"type:varchar(255)" json:"payee_column"`
+	AmountColumn      string    `gorm:"type:varchar(255)" json:"amount_column"`
+	DebitColumn       string    `gorm:"type:varchar(255)" json:"debit_column"`
+	CreditColumn      string    `gorm:"type:varchar(255)" json:"credit_column"`
+	DecimalSeparator  string    `gorm:"type:varchar(1);not null;default:'.'" json:"decimal_separator"`
+	// InvertSign is for statements, typically of credit cards, that show
+	// spending as positive amounts.
+	InvertSign bool      `gorm:"not null;default:false" json:"invert_sign"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (p *ImportProfile) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return
+}
+
+// ImportBatch groups the transactions committed by one import so the whole
+// import can be undone.
+type ImportBatch struct {
+	ID        uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:char(36);index" json:"user_id"`
+	AccountID uuid.UUID  `gorm:"type:char(36);index" json:"account_id"`
+	ProfileID *uuid.UUID `gorm:"type:char(36)" json:"profile_id"`
+	Format    string     `gorm:"type:varchar(10);not null" json:"format"`
+	Filename  string     `gorm:"type:varchar(255)" json:"filename"`
+	Imported  int        `gorm:"not null;default:0" json:"imported"`
+	Skipped   int        `gorm:"not null;default:0" json:"skipped"`
+	UndoneAt  *time.Time `json:"undone_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (b *ImportBatch) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return
+}
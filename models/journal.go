@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	JournalSourceOpening     = "opening"
+	JournalSourceTransaction = "transaction"
+	JournalSourceTransfer    = "transfer"
+	JournalSourceAdjustment  = "adjustment"
+)
+
+// Ledgers a posting can be booked to. Only LedgerAssets postings carry an
+// AccountID and move an account balance; income and expense postings carry
+// the category instead.
+const (
+	LedgerAssets           = "assets"
+	LedgerIncome           = "income"
+	LedgerExpenses         = "expenses"
+	LedgerEquityOpening    = "equity:opening"
+	LedgerEquityConversion = "equity:conversion"
+)
+
+// JournalEntry is one balanced double-entry booking. Its postings sum to zero
+// in every currency. SourceType and SourceID name the record that produced it.
+type JournalEntry struct {
+	ID          uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID      uuid.UUID `gorm:"type:char(36);index" json:"user_id"`
+	SourceType  string    `gorm:"type:varchar(20);index:idx_journal_source" json:"source_type"`
+	SourceID    uuid.UUID `gorm:"type:char(36);index:idx_journal_source" json:"source_id"`
+	Date        time.Time `gorm:"index" json:"date"`
+	Description string    `json:"description"`
+	Postings    []Posting `gorm:"foreignKey:EntryID;references:ID" json:"postings"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (e *JournalEntry) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
+
+// Posting is a single debit (positive) or credit (negative) line of a
+// journal entry.
+type Posting struct {
+	ID         uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	EntryID    uuid.UUID  `gorm:"type:char(36);index" json:"entry_id"`
+	UserID     uuid.UUID  `gorm:"type:char(36);index" json:"user_id"`
+	Ledger     string     `gorm:"type:varchar(30)" json:"ledger"`
+	AccountID  *uuid.UUID `gorm:"type:char(36);index" json:"account_id"`
+	CategoryID *uuid.UUID `gorm:"type:char(36);index" json:"category_id"`
+	Amount     Money      `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency   string     `gorm:"type:char(3);not null;default:''" json:"currency"`
+}
+
+func (p *Posting) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	p.Currency = p.Amount.Currency
+	return
+}
+
+func (p *Posting) AfterFind(tx *gorm.DB) (err error) {
+	p.Amount.Currency = p.Currency
+	return
+}
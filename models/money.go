@@ -0,0 +1,301 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// decimalPattern is what ParseDecimal accepts. big.Rat alone would also take
+// fractions such as "1/3" and exponents such as "1e9999999", which are
+// expensive to expand.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d+)?|\.\d+)$`)
+
+// currencyExponents lists the ISO-4217 minor unit digits for currencies that
+// do not use two decimals. Anything not listed here uses two.
+var currencyExponents = map[string]int{
+	"BHD": 3, "BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3, "ISK": 0,
+	"JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3,
+	"PYG": 0, "RWF": 0, "TND": 3, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// DefaultCurrency is the currency assumed for amounts that do not carry one,
+// taken from DEFAULT_CURRENCY and falling back to IDR.
+func DefaultCurrency() string {
+	if currency := NormalizeCurrency(os.Getenv("DEFAULT_CURRENCY")); currency != "" {
+		return currency
+	}
+	return "IDR"
+}
+
+func NormalizeCurrency(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+func IsValidCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// CurrencyExponent returns how many decimal digits the currency's minor unit
+// has, e.g. 2 for USD and 0 for JPY.
+func CurrencyExponent(currency string) int {
+	if exponent, found := currencyExponents[NormalizeCurrency(currency)]; found {
+		return exponent
+	}
+	return 2
+}
+
+// Money is an exact amount stored as an integer count of the currency's minor
+// units. In the database only the minor units are stored, in a BIGINT column;
+// the currency lives on the owning row and is attached after loading.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: NormalizeCurrency(currency)}
+}
+
+// ParseMoney parses a decimal string such as "-1234.565" into the currency's
+// minor units, rounding half away from zero when the input carries more
+// digits than the currency allows.
+func ParseMoney(value string, currency string) (Money, error) {
+	rat, err := ParseDecimal(value)
+	if err != nil {
+		return Money{}, err
+	}
+
+	minor, err := roundRat(rat, CurrencyExponent(currency))
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(minor, currency), nil
+}
+
+// ParseDecimal parses a plain decimal such as "-1234.565" exactly.
+func ParseDecimal(value string) (*big.Rat, error) {
+	value = strings.TrimSpace(value)
+	if !decimalPattern.MatchString(value) {
+		return nil, ErrInvalidAmount
+	}
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, ErrInvalidAmount
+	}
+	return rat, nil
+}
+
+// MoneyFromFloat converts a float amount, rounding to the currency's minor
+// units. It exists for legacy float data; new input should use ParseMoney.
+func MoneyFromFloat(value float64, currency string) Money {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return NewMoney(0, currency)
+	}
+	money, err := ParseMoney(strconv.FormatFloat(value, 'f', -1, 64), currency)
+	if err != nil {
+		return NewMoney(0, currency)
+	}
+	return money
+}
+
+func roundRat(rat *big.Rat, exponent int) (int64, error) {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+	scaled := new(big.Rat).Mul(rat, new(big.Rat).SetInt(scale))
+
+	num := new(big.Int).Set(scaled.Num())
+	den := scaled.Denom()
+
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(remainder, big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if negative {
+		quotient.Neg(quotient)
+	}
+
+	if !quotient.IsInt64() {
+		return 0, ErrInvalidAmount
+	}
+	return quotient.Int64(), nil
+}
+
+// Decimal formats the amount with exactly as many decimals as the currency
+// uses, e.g. "1500.50" for USD or "1500" for JPY.
+func (m Money) Decimal() string {
+	exponent := CurrencyExponent(m.Currency)
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatUint(absInt64(amount), 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Float returns the amount as a float for display math only, such as
+// percentages. Never feed it back into stored amounts.
+func (m Money) Float() float64 {
+	return float64(m.Amount) / math.Pow10(CurrencyExponent(m.Currency))
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Abs() Money {
+	if m.Amount < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Add and Sub assume both amounts share a currency; callers convert first.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		m.Amount = 0
+	case int64:
+		m.Amount = value
+	case float64:
+		m.Amount = int64(math.Round(value))
+	case []byte:
+		return m.scanString(string(value))
+	case string:
+		return m.scanString(value)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(value string) error {
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		// Aggregates such as SUM come back from MySQL as DECIMAL text.
+		rat, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return fmt.Errorf("cannot scan %q into Money", value)
+		}
+		if amount, err = roundRat(rat, 0); err != nil {
+			return err
+		}
+	}
+	m.Amount = amount
+	return nil
+}
+
+func (Money) GormDataType() string {
+	return "bigint"
+}
+
+type moneyJSON struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{
+		Amount:   m.Decimal(),
+		Currency: m.Currency,
+	})
+}
+
+// UnmarshalJSON accepts {"amount": "12.50", "currency": "USD"}, where the
+// amount may also be a JSON number. A missing currency means the default.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var payload moneyJSON
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	currency := NormalizeCurrency(payload.Currency)
+	if currency == "" {
+		currency = DefaultCurrency()
+	}
+
+	money, err := ParseMoney(payload.Amount.String(), currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+func absInt64(value int64) uint64 {
+	if value < 0 {
+		return uint64(-(value + 1)) + 1
+	}
+	return uint64(value)
+}
+
+// Convert applies an exchange rate, expressed as units of the target currency
+// per one unit of m's currency, and rounds to the target's minor units.
+func (m Money) Convert(rate *big.Rat, currency string) (Money, error) {
+	major := new(big.Rat).SetFrac(big.NewInt(m.Amount), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(CurrencyExponent(m.Currency))), nil))
+	minor, err := roundRat(major.Mul(major, rate), CurrencyExponent(currency))
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(minor, currency), nil
+}
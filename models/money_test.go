@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{name: "two decimals", value: "1234.56", currency: "USD", want: 123456},
+		{name: "two decimals rounds half up", value: "0.125", currency: "USD", want: 13},
+		{name: "two decimals rounds down", value: "0.124", currency: "USD", want: 12},
+		{name: "whole number", value: "15000", currency: "IDR", want: 1500000},
+		{name: "leading dot", value: ".50", currency: "USD", want: 50},
+		{name: "plus sign", value: "+7.5", currency: "USD", want: 750},
+		{name: "surrounding spaces", value: "  12.30 ", currency: "USD", want: 1230},
+		{name: "zero decimals", value: "1500", currency: "JPY", want: 1500},
+		{name: "zero decimals rounds half up", value: "1500.5", currency: "JPY", want: 1501},
+		{name: "zero decimals rounds down", value: "1500.49", currency: "JPY", want: 1500},
+		{name: "three decimals", value: "1.234", currency: "KWD", want: 1234},
+		{name: "three decimals rounds half up", value: "1.2345", currency: "KWD", want: 1235},
+		{name: "negative", value: "-12.34", currency: "USD", want: -1234},
+		{name: "negative rounds half away from zero", value: "-0.125", currency: "USD", want: -13},
+		{name: "negative zero decimals", value: "-2.5", currency: "JPY", want: -3},
+		{name: "largest amount", value: "92233720368547758.07", currency: "USD", want: 9223372036854775807},
+		{name: "overflow", value: "92233720368547758.08", currency: "USD", wantErr: true},
+		{name: "negative overflow", value: "-92233720368547758.09", currency: "USD", wantErr: true},
+		{name: "empty", value: "", currency: "USD", wantErr: true},
+		{name: "fraction", value: "1/3", currency: "USD", wantErr: true},
+		{name: "exponent", value: "1e9999999", currency: "USD", wantErr: true},
+		{name: "thousands separator", value: "1,000", currency: "USD", wantErr: true},
+		{name: "trailing dot", value: "12.", currency: "USD", wantErr: true},
+		{name: "letters", value: "abc", currency: "USD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.value, tt.currency)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("ParseMoney(%q) error = %v, want ErrInvalidAmount", tt.value, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) unexpected error: %v", tt.value, err)
+			}
+			if got.Amount != tt.want || got.Currency != tt.currency {
+				t.Errorf("ParseMoney(%q) = %d %s, want %d %s", tt.value, got.Amount, got.Currency, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: NewMoney(123456, "USD"), want: "1234.56"},
+		{money: NewMoney(5, "USD"), want: "0.05"},
+		{money: NewMoney(-5, "USD"), want: "-0.05"},
+		{money: NewMoney(1500, "JPY"), want: "1500"},
+		{money: NewMoney(1234, "KWD"), want: "1.234"},
+		{money: NewMoney(-9223372036854775808, "USD"), want: "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.want {
+			t.Errorf("%d %s Decimal() = %q, want %q", tt.money.Amount, tt.money.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    int64
+		wantErr bool
+	}{
+		{name: "nil", src: nil, want: 0},
+		{name: "int64", src: int64(1234), want: 1234},
+		{name: "float64", src: float64(1234.6), want: 1235},
+		{name: "integer text", src: []byte("-5"), want: -5},
+		{name: "decimal text", src: []byte("1234.00"), want: 1234},
+		{name: "decimal string", src: "1234.50", want: 1235},
+		{name: "negative decimal text", src: []byte("-1234.50"), want: -1235},
+		{name: "decimal text overflow", src: []byte("99999999999999999999.00"), wantErr: true},
+		{name: "not a number", src: []byte("abc"), wantErr: true},
+		{name: "unsupported type", src: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			err := got.Scan(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Scan(%v) = %d, want an error", tt.src, got.Amount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan(%v) unexpected error: %v", tt.src, err)
+			}
+			if got.Amount != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, got.Amount, tt.want)
+			}
+		})
+	}
+}
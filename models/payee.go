@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Payee is a merchant or person money is paid to or received from. Its
+// defaults prefill new transactions, and UsageCount and LastUsedAt rank it in
+// suggestions. NameKey is the normalised name used for matching.
+type Payee struct {
+	ID                uuid.UUID    `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID            uuid.UUID    `gorm:"type:char(36);uniqueIndex:idx_user_payee" json:"user_id"`
+	Name              string       `gorm:"type:varchar(255);not null" json:"name"`
+	NameKey           string       `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_payee" json:"-"`
+	DefaultCategoryID *uuid.UUID   `gorm:"type:char(36)" json:"default_category_id"`
+	DefaultAccountID  *uuid.UUID   `gorm:"type:char(36)" json:"default_account_id"`
+	UsageCount        int64        `gorm:"not null;default:0" json:"usage_count"`
+	LastUsedAt        *time.Time   `json:"last_used_at"`
+	Aliases           []PayeeAlias `gorm:"foreignKey:PayeeID;references:ID" json:"aliases"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+}
+
+func (p *Payee) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	p.NameKey = PayeeKey(p.Name)
+	return
+}
+
+// PayeeAlias is another spelling of a payee, such as "AMZN Mktp" for Amazon.
+// Aliases are unique per user so a name resolves to one payee.
+type PayeeAlias struct {
+	ID        uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID    uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_user_payee_alias" json:"-"`
+	PayeeID   uuid.UUID `gorm:"type:char(36);index" json:"payee_id"`
+	Alias     string    `gorm:"type:varchar(255);not null" json:"alias"`
+	AliasKey  string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_payee_alias" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (a *PayeeAlias) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	a.AliasKey = PayeeKey(a.Alias)
+	return
+}
+
+// PayeeKey normalises a payee name for matching: case and repeated spaces
+// are ignored.
+func PayeeKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// FindPayee looks a name up among the user's payees and their aliases.
+func FindPayee(db *gorm.DB, userID uuid.UUID, name string) (*Payee, error) {
+	key := PayeeKey(name)
+
+	var payee Payee
+	err := db.Where("user_id = ? AND name_key = ?", userID, key).First(&payee).Error
+	if err == nil {
+		return &payee, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var alias PayeeAlias
+	if err := db.Where("user_id = ? AND alias_key = ?", userID, key).First(&alias).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("id = ?", alias.PayeeID).First(&payee).Error; err != nil {
+		return nil, err
+	}
+	return &payee, nil
+}
+
+// PayeeNames maps the user's payees to their names.
+func PayeeNames(db *gorm.DB, userID uuid.UUID) (map[uuid.UUID]string, error) {
+	var payees []Payee
+	if err := db.Select("id, name").Where("user_id = ?", userID).Find(&payees).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(payees))
+	for _, payee := range payees {
+		names[payee.ID] = payee.Name
+	}
+	return names, nil
+}
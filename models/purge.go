@@ -0,0 +1,76 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// migratedSubCategoryTable is where the sub-category migration moved the
+// sub_categories table of older installations.
+const migratedSubCategoryTable = "sub_categories_migrated"
+
+// PurgeUser deletes a user and every row tied to them for good, soft-deleted
+// rows included. Rows that only point at the user's records, such as split
+// lines and tag links, go first. It must run inside a database transaction.
+// Attachment files stay in the blob store; the caller releases them once the
+// transaction has committed.
+func PurgeUser(tx *gorm.DB, userID uuid.UUID) error {
+	tx = tx.Unscoped().Session(&gorm.Session{})
+	ownedBy := func(model interface{}) *gorm.DB {
+		return tx.Model(model).Select("id").Where("user_id = ?", userID)
+	}
+
+	children := []struct {
+		model  interface{}
+		column string
+		parent interface{}
+	}{
+		{&TransactionSplit{}, "transaction_id", &Transaction{}},
+		{&TransactionTag{}, "transaction_id", &Transaction{}},
+		{&TransactionTag{}, "tag_id", &Tag{}},
+		{&RecurringException{}, "recurring_id", &RecurringTransaction{}},
+		{&BillPayment{}, "bill_id", &Bill{}},
+	}
+	for _, child := range children {
+		if err := tx.Where(child.column+" IN (?)", ownedBy(child.parent)).Delete(child.model).Error; err != nil {
+			return err
+		}
+	}
+
+	// The sub-category migration keeps the old table for inspection; it
+	// still holds the names of the user's former sub-categories.
+	if tx.Migrator().HasTable(migratedSubCategoryTable) {
+		if err := tx.Exec("DELETE FROM "+migratedSubCategoryTable+" WHERE category_id IN (?)", ownedBy(&Category{})).Error; err != nil {
+			return err
+		}
+	}
+
+	owned := []interface{}{
+		&Attachment{},
+		&Posting{},
+		&JournalEntry{},
+		&Transaction{},
+		&Transfer{},
+		&Bill{},
+		&RecurringTransaction{},
+		&EnvelopeMove{},
+		&EnvelopeAssignment{},
+		&Budget{},
+		&Rule{},
+		&ImportBatch{},
+		&ImportProfile{},
+		&PayeeAlias{},
+		&Payee{},
+		&Tag{},
+		&ExchangeRate{},
+		&Category{},
+		&Account{},
+	}
+	for _, model := range owned {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Where("id = ?", userID).Delete(&User{}).Error
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecurringTransaction is a template transaction repeated by an RRULE. The
+// scheduler books every occurrence up to today once; MaterializedThrough is
+// the last occurrence date it has dealt with.
+type RecurringTransaction struct {
+	ID                  uuid.UUID      `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID              uuid.UUID      `gorm:"type:char(36);index" json:"user_id"`
+	AccountID           uuid.UUID      `gorm:"type:char(36);index" json:"account_id"`
+	CategoryID          *uuid.UUID     `gorm:"type:char(36)" json:"category_id"`
+	Type                string         `gorm:"type:varchar(20)" json:"type"`
+	Amount              Money          `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency            string         `gorm:"type:char(3);not null;default:''" json:"currency"`
+	Note                string         `json:"note"`
+	RRule               string         `gorm:"column:rrule;type:varchar(255)" json:"rrule"`
+	StartDate           time.Time      `gorm:"type:date" json:"start_date"`
+	MaterializedThrough *time.Time     `gorm:"type:date" json:"materialized_through"`
+	Paused              bool           `gorm:"default:false" json:"paused"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (r *RecurringTransaction) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	r.Currency = r.Amount.Currency
+	return
+}
+
+func (r *RecurringTransaction) AfterFind(tx *gorm.DB) (err error) {
+	r.Amount.Currency = r.Currency
+	return
+}
+
+// RecurringException changes a single occurrence of a recurring transaction
+// before it is booked: it is either skipped or booked with the overrides that
+// are set.
+type RecurringException struct {
+	ID             uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	RecurringID    uuid.UUID  `gorm:"type:char(36);uniqueIndex:idx_recurring_exception" json:"recurring_id"`
+	OccurrenceDate time.Time  `gorm:"type:date;uniqueIndex:idx_recurring_exception" json:"occurrence_date"`
+	Skip           bool       `gorm:"default:false" json:"skip"`
+	AmountMinor    *int64     `json:"amount_minor"`
+	Date           *time.Time `gorm:"type:date" json:"date"`
+	CategoryID     *uuid.UUID `gorm:"type:char(36)" json:"category_id"`
+	Note           *string    `json:"note"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (e *RecurringException) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
+
+// Occurrence builds the transaction booked for one occurrence, applying the
+// exception when there is one. It returns nil when the occurrence is skipped.
+func (r *RecurringTransaction) Occurrence(date time.Time, exception *RecurringException) *Transaction {
+	occurrence := date
+	transaction := &Transaction{
+		UserID:         r.UserID,
+		AccountID:      r.AccountID,
+		CategoryID:     r.CategoryID,
+		RecurringID:    &r.ID,
+		OccurrenceDate: &occurrence,
+		Type:           r.Type,
+		Amount:         r.Amount,
+		Currency:       r.Amount.Currency,
+		Date:           date,
+		Note:           r.Note,
+	}
+
+	if exception == nil {
+		return transaction
+	}
+	if exception.Skip {
+		return nil
+	}
+	if exception.AmountMinor != nil {
+		transaction.Amount = NewMoney(*exception.AmountMinor, r.Amount.Currency)
+	}
+	if exception.Date != nil {
+		transaction.Date = *exception.Date
+	}
+	if exception.CategoryID != nil {
+		transaction.CategoryID = exception.CategoryID
+	}
+	if exception.Note != nil {
+		transaction.Note = *exception.Note
+	}
+	return transaction
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Fields a rule condition can test.
+const (
+	RuleFieldDescription = "description"
+	RuleFieldPayee       = "payee"
+	RuleFieldAmount      = "amount"
+	RuleFieldAccount     = "account"
+	RuleFieldDate        = "date"
+	RuleFieldType        = "type"
+)
+
+// Rule categorises transactions automatically. A transaction matches when
+// every condition holds; the actions then set its category, payee and tags.
+// Rules run by ascending Priority, and StopProcessing ends the run after a
+// match.
+type Rule struct {
+	ID             uuid.UUID      `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID         uuid.UUID      `gorm:"type:char(36);index" json:"user_id"`
+	Name           string         `gorm:"type:varchar(255);not null" json:"name"`
+	Priority       int            `gorm:"not null;default:0" json:"priority"`
+	Enabled        bool           `gorm:"not null;default:true" json:"enabled"`
+	StopProcessing bool           `gorm:"not null;default:false" json:"stop_processing"`
+	Conditions     RuleConditions `gorm:"type:text" json:"conditions"`
+	Actions        RuleActions    `gorm:"type:text" json:"actions"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+func (r *Rule) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return
+}
+
+// RuleCondition tests one field, e.g. {"field": "description", "operator":
+// "contains", "value": "GRAB"}. Amounts are compared as decimals in the
+// transaction's currency; dates use YYYY-MM-DD.
+type RuleCondition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type RuleConditions []RuleCondition
+
+func (c RuleConditions) Value() (driver.Value, error) {
+	return jsonValue(c)
+}
+
+func (c *RuleConditions) Scan(src interface{}) error {
+	return scanJSON(src, c)
+}
+
+// RuleActions are what a matching rule changes. Unset actions leave the
+// transaction alone; tags are added to the ones it already has.
+type RuleActions struct {
+	CategoryID *uuid.UUID  `json:"category_id,omitempty"`
+	PayeeID    *uuid.UUID  `json:"payee_id,omitempty"`
+	TagIDs     []uuid.UUID `json:"tag_ids,omitempty"`
+}
+
+func (a RuleActions) Value() (driver.Value, error) {
+	return jsonValue(a)
+}
+
+func (a *RuleActions) Scan(src interface{}) error {
+	return scanJSON(src, a)
+}
+
+func (a RuleActions) IsEmpty() bool {
+	return a.CategoryID == nil && a.PayeeID == nil && len(a.TagIDs) == 0
+}
+
+func jsonValue(value interface{}) (driver.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func scanJSON(src interface{}, target interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(value, target)
+	case string:
+		return json.Unmarshal([]byte(value), target)
+	default:
+		return errors.New("unsupported JSON column value")
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TransactionSplit is one line of a split transaction, such as the groceries
+// part of a supermarket receipt. The lines of a transaction add up to its
+// amount, and a split transaction has no category of its own.
+type TransactionSplit struct {
+	ID            uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	TransactionID uuid.UUID  `gorm:"type:char(36);index" json:"transaction_id"`
+	CategoryID    *uuid.UUID `gorm:"type:char(36);index" json:"category_id"`
+	Amount        Money      `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency      string     `gorm:"type:char(3);not null;default:''" json:"currency"`
+	Note          string     `json:"note"`
+	Position      int        `gorm:"not null;default:0" json:"position"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (s *TransactionSplit) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	s.Currency = s.Amount.Currency
+	return
+}
+
+func (s *TransactionSplit) AfterFind(tx *gorm.DB) (err error) {
+	s.Amount.Currency = s.Currency
+	return
+}
+
+// CategoryLines returns a subquery with one row per categorised amount: the
+// transaction itself when it is not split, otherwise each of its split
+// lines. Its columns are user_id, transaction_id, account_id, category_id,
+// type, amount_minor, currency and date. Category reports read from it so a
+// split line counts under its own category.
+func CategoryLines(db *gorm.DB) *gorm.DB {
+	return db.Raw(`SELECT t.user_id, t.id AS transaction_id, t.account_id, t.category_id, t.type, t.amount_minor, t.currency, t.date
+		FROM transactions t
+		WHERE t.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = t.id)
+		UNION ALL
+		SELECT t.user_id, t.id, t.account_id, s.category_id, t.type, s.amount_minor, s.currency, t.date
+		FROM transaction_splits s JOIN transactions t ON t.id = s.transaction_id
+		WHERE t.deleted_at IS NULL`)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const DefaultTagColor = "#9e9e9e"
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// Tag is a user-defined label such as "reimbursable" or "trip-bali-2026"
+// that cuts across categories. Names are unique per user, ignoring case.
+type Tag struct {
+	ID        uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID    uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_user_tag" json:"user_id"`
+	Name      string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_user_tag" json:"name"`
+	Color     string    `gorm:"type:char(7);not null;default:'#9e9e9e'" json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (t *Tag) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return
+}
+
+// NormalizeTagName trims the name and lower-cases it, so "Wedding" and
+// "wedding " are the same tag.
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NormalizeTagColor lower-cases a "#rrggbb" colour and returns "" when it is
+// not one.
+func NormalizeTagColor(color string) string {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if !tagColorPattern.MatchString(color) {
+		return ""
+	}
+	return color
+}
+
+// TransactionTag links a tag to a transaction.
+type TransactionTag struct {
+	TransactionID uuid.UUID `gorm:"type:char(36);primaryKey" json:"transaction_id"`
+	TagID         uuid.UUID `gorm:"type:char(36);primaryKey;index" json:"tag_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
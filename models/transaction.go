@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	TransactionTypeExpense = "expense"
+	TransactionTypeIncome  = "income"
+
+	// Transfer legs are created in pairs by a Transfer and never count as
+	// income or expense.
+	TransactionTypeTransferOut = "transfer_out"
+	TransactionTypeTransferIn  = "transfer_in"
+)
+
+type Transaction struct {
+	gorm.Model
+	ID         uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:char(36);index" json:"user_id"`
+	AccountID  uuid.UUID  `gorm:"type:char(36);index" json:"account_id"`
+	CategoryID *uuid.UUID `gorm:"type:char(36);index" json:"category_id"`
+	TransferID *uuid.UUID `gorm:"type:char(36);index" json:"transfer_id"`
+	PayeeID    *uuid.UUID `gorm:"type:char(36);index" json:"payee_id"`
+	// RecurringID and OccurrenceDate are set on transactions booked from a
+	// recurring transaction; the pair is unique so an occurrence is booked
+	// at most once.
+	RecurringID    *uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_recurring_occurrence" json:"recurring_id"`
+	OccurrenceDate *time.Time `gorm:"type:date;uniqueIndex:idx_recurring_occurrence" json:"occurrence_date"`
+	// ImportBatchID and ImportHash are set on imported transactions. The
+	// hash identifies the statement line so importing it again is caught.
+	ImportBatchID *uuid.UUID `gorm:"type:char(36);index" json:"import_batch_id"`
+	ImportHash    string     `gorm:"type:char(64);index" json:"-"`
+	Type          string     `gorm:"type:varchar(20);index" json:"type"`
+	Amount        Money      `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Currency      string     `gorm:"type:char(3);not null;default:''" json:"currency"`
+	Date          time.Time  `gorm:"index" json:"date"`
+	Note          string     `json:"note"`
+	// Splits divide the amount over several categories; see
+	// TransactionSplit.
+	Splits    []TransactionSplit `gorm:"foreignKey:TransactionID;references:ID" json:"splits,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+func (t *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	if t.Currency == "" {
+		t.Currency = t.Amount.Currency
+	}
+	return
+}
+
+func (t *Transaction) AfterFind(tx *gorm.DB) (err error) {
+	if t.Currency == "" {
+		t.Currency = DefaultCurrency()
+	}
+	t.Amount.Currency = t.Currency
+	return
+}
+
+func IsValidTransactionType(transactionType string) bool {
+	return transactionType == TransactionTypeExpense || transactionType == TransactionTypeIncome
+}
+
+func (t *Transaction) IsSplit() bool {
+	return len(t.Splits) > 0
+}
+
+func (t *Transaction) IsTransferLeg() bool {
+	return t.TransferID != nil
+}
+
+// SignedAmount is the effect the transaction has on its account balance.
+func (t *Transaction) SignedAmount() Money {
+	if t.Type == TransactionTypeExpense || t.Type == TransactionTypeTransferOut {
+		return t.Amount.Neg()
+	}
+	return t.Amount
+}
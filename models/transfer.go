@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Transfer moves money between two of a user's accounts. It owns a debit leg
+// on the source account, a credit leg on the destination account and, when a
+// fee was charged, an expense on the source account. All of them carry the
+// transfer's ID. Across currencies the two legs keep their own amounts.
+type Transfer struct {
+	ID            uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	UserID        uuid.UUID  `gorm:"type:char(36);index" json:"user_id"`
+	FromAccountID uuid.UUID  `gorm:"type:char(36);index" json:"from_account_id"`
+	ToAccountID   uuid.UUID  `gorm:"type:char(36);index" json:"to_account_id"`
+	FromAmount    Money      `gorm:"column:from_amount_minor;not null;default:0" json:"from_amount"`
+	FromCurrency  string     `gorm:"type:char(3);not null;default:''" json:"from_currency"`
+	ToAmount      Money      `gorm:"column:to_amount_minor;not null;default:0" json:"to_amount"`
+	ToCurrency    string     `gorm:"type:char(3);not null;default:''" json:"to_currency"`
+	Fee           Money      `gorm:"column:fee_minor;not null;default:0" json:"fee"`
+	FeeCategoryID *uuid.UUID `gorm:"type:char(36)" json:"fee_category_id"`
+	Date          time.Time  `gorm:"index" json:"date"`
+	Note          string     `json:"note"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (t *Transfer) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	t.FromCurrency = t.FromAmount.Currency
+	t.ToCurrency = t.ToAmount.Currency
+	return
+}
+
+func (t *Transfer) AfterFind(tx *gorm.DB) (err error) {
+	t.FromAmount.Currency = t.FromCurrency
+	t.ToAmount.Currency = t.ToCurrency
+	t.Fee.Currency = t.FromCurrency
+	return
+}
+
+// IsCrossCurrency reports whether the two legs are in different currencies.
+func (t *Transfer) IsCrossCurrency() bool {
+	return t.FromCurrency != t.ToCurrency
+}
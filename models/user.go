@@ -1,6 +1,8 @@
 package models
 
 import (
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,21 +10,88 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	BudgetModeCategory = "category"
+	BudgetModeEnvelope = "envelope"
+)
+
 type User struct {
 	gorm.Model
-	ID        uuid.UUID `gorm:"type:char(36);primaryKey;" json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email" gorm:"unique"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                uuid.UUID  `gorm:"type:char(36);primaryKey;" json:"id"`
+	Name              string     `json:"name"`
+	Email             string     `json:"email" gorm:"unique"`
+	Password          string     `json:"password"`
+	Role              string     `gorm:"type:varchar(20);default:user" json:"role"`
+	Disabled          bool       `gorm:"default:false" json:"disabled"`
+	MustResetPassword bool       `gorm:"default:false" json:"must_reset_password"`
+	Locale            string     `gorm:"type:varchar(10);default:en" json:"locale"`
+	BaseCurrency      string     `gorm:"type:char(3);not null;default:''" json:"base_currency"`
+	BudgetMode        string     `gorm:"type:varchar(20);default:category" json:"budget_mode"`
+	EnvelopeStart     *time.Time `gorm:"type:date" json:"envelope_start"`
+	// DeleteAfter is set when the user asked for their account to be
+	// deleted. Once it has passed, the account and everything it owns are
+	// purged for good; logging in before then cancels the deletion.
+	DeleteAfter *time.Time `gorm:"index" json:"delete_after"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	u.ID = uuid.New()
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
 	return
 }
 
+// Currency is the currency the user's totals are reported in.
+func (u *User) Currency() string {
+	if u.BaseCurrency != "" {
+		return u.BaseCurrency
+	}
+	return DefaultCurrency()
+}
+
+// UsesEnvelopes reports whether the user budgets with envelopes, where
+// income is assigned to categories month by month.
+func (u *User) UsesEnvelopes() bool {
+	return u.BudgetMode == BudgetModeEnvelope && u.EnvelopeStart != nil
+}
+
+// PendingDeletion reports whether the user asked for their account to be
+// deleted.
+func (u *User) PendingDeletion() bool {
+	return u.DeleteAfter != nil
+}
+
+// DeletionGracePeriod is how long a deleted account can still be recovered
+// by logging in, taken from ACCOUNT_DELETION_GRACE_DAYS and 30 days by
+// default.
+func DeletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func IsValidBudgetMode(mode string) bool {
+	return mode == BudgetModeCategory || mode == BudgetModeEnvelope
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
 func (u *User) HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
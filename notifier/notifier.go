@@ -0,0 +1,147 @@
+// Package notifier delivers notifications to users. The channel is chosen
+// with NOTIFIER: "email" sends through SMTP, "webhook" posts JSON to a URL and
+// "log" (the default) only writes to the server log, for local development.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Notification is a message for one user.
+type Notification struct {
+	UserID  string `json:"user_id"`
+	Email   string `json:"email"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// FromEnv builds the notifier configured by the environment:
+//
+//	NOTIFIER=email    SMTP_HOST, SMTP_PORT (587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM
+//	NOTIFIER=webhook  NOTIFIER_WEBHOOK_URL
+//	NOTIFIER=log      nothing
+func FromEnv() (Notifier, error) {
+	switch strings.ToLower(os.Getenv("NOTIFIER")) {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "email":
+		host := os.Getenv("SMTP_HOST")
+		from := os.Getenv("SMTP_FROM")
+		if host == "" || from == "" {
+			return nil, fmt.Errorf("notifier: SMTP_HOST and SMTP_FROM are required for email")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &EmailNotifier{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	case "webhook":
+		url := os.Getenv("NOTIFIER_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("notifier: NOTIFIER_WEBHOOK_URL is required for webhook")
+		}
+		return NewWebhookNotifier(url), nil
+	default:
+		return nil, fmt.Errorf("notifier: unknown NOTIFIER %q", os.Getenv("NOTIFIER"))
+	}
+}
+
+// LogNotifier writes notifications to the server log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, notification Notification) error {
+	log.Printf("notification for %s: %s: %s", notification.Email, notification.Subject, notification.Body)
+	return nil
+}
+
+// EmailNotifier sends notifications as plain-text mail.
+type EmailNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Email == "" {
+		return fmt.Errorf("notifier: user %s has no email address", notification.UserID)
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + n.From,
+		"To: " + notification.Email,
+		"Subject: " + encodeSubject(notification.Subject),
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		notification.Body,
+	}, "\r\n")
+	return smtp.SendMail(n.Host+":"+n.Port, auth, n.From, []string{notification.Email}, []byte(message))
+}
+
+// encodeSubject makes a subject safe for the mail header. Subjects carry
+// user input such as bill names, so line breaks, which would start new
+// headers, become spaces. Non-ASCII text is RFC 2047 encoded.
+func encodeSubject(subject string) string {
+	subject = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(subject)
+	return mime.QEncoding.Encode("UTF-8", subject)
+}
+
+// WebhookNotifier posts each notification as JSON and treats any non-2xx
+// response as a failure.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("notifier: webhook answered %s", response.Status)
+	}
+	return nil
+}
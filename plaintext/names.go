@@ -0,0 +1,196 @@
+package plaintext
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Root accounts. Categories without a name to go by, such as postings that
+// were never categorised, are booked to Uncategorized under their root.
+const (
+	rootAssets        = "Assets"
+	rootExpenses      = "Expenses"
+	rootIncome        = "Income"
+	accountOpening    = "Equity:Opening-Balances"
+	accountConversion = "Equity:Conversions"
+	uncategorized     = "Uncategorized"
+)
+
+type declaration struct {
+	name     string
+	currency string
+}
+
+// names gives every account and category a unique account name that all
+// three formats accept: colon-separated components that start with a
+// capital letter or digit and hold only letters, digits and dashes.
+type names struct {
+	accounts   map[uuid.UUID]declaration
+	categories map[uuid.UUID][]string
+	tree       *models.CategoryTree
+	taken      map[string]bool
+	declared   map[string]bool
+	late       []string
+}
+
+// loadNames names the user's accounts and every category they can see,
+// deleted categories included so old entries keep their names.
+func loadNames(db *gorm.DB, userID uuid.UUID) (*names, error) {
+	var accounts []models.Account
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	tree, err := models.LoadCategoryTree(db.Unscoped(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &names{
+		accounts:   map[uuid.UUID]declaration{},
+		categories: map[uuid.UUID][]string{},
+		tree:       tree,
+		taken:      map[string]bool{},
+		declared:   map[string]bool{},
+	}
+	for _, account := range accounts {
+		n.accounts[account.ID] = declaration{name: n.unique(rootAssets + ":" + component(account.Name)), currency: account.Currency}
+	}
+	return n, nil
+}
+
+// unique appends a number to a name that is already used by another
+// account or category.
+func (n *names) unique(name string) string {
+	candidate := name
+	for i := 2; n.taken[candidate]; i++ {
+		candidate = name + "-" + strconv.Itoa(i)
+	}
+	n.taken[candidate] = true
+	return candidate
+}
+
+// category names a category below the given root, from its path in the
+// tree, e.g. Expenses:Food:Groceries.
+func (n *names) category(root string, id uuid.UUID) string {
+	if path, found := n.categories[id]; found {
+		for _, name := range path {
+			if strings.HasPrefix(name, root+":") {
+				return name
+			}
+		}
+	}
+
+	components := []string{root}
+	for _, category := range n.tree.Path(id) {
+		components = append(components, component(category.Name))
+	}
+	if len(components) == 1 {
+		return root + ":" + uncategorized
+	}
+	name := n.unique(strings.Join(components, ":"))
+	n.categories[id] = append(n.categories[id], name)
+	return name
+}
+
+// declarations lists every account to open up front, sorted by name.
+func (n *names) declarations() []declaration {
+	var all []declaration
+	for _, account := range n.accounts {
+		all = append(all, account)
+	}
+
+	var ids []uuid.UUID
+	for _, root := range n.tree.Roots() {
+		ids = append(ids, n.tree.Descendants(root.ID)...)
+	}
+	for _, id := range ids {
+		category, _ := n.tree.Get(id)
+		root := rootExpenses
+		if category.CategoryType == models.TransactionTypeIncome {
+			root = rootIncome
+		}
+		all = append(all, declaration{name: n.category(root, id)})
+	}
+
+	for _, name := range []string{rootExpenses + ":" + uncategorized, rootIncome + ":" + uncategorized, accountOpening, accountConversion} {
+		all = append(all, declaration{name: name})
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	unique := all[:0]
+	for _, declaration := range all {
+		// A category called Uncategorized shares the fallback's name.
+		if !n.declared[declaration.name] {
+			n.declared[declaration.name] = true
+			unique = append(unique, declaration)
+		}
+	}
+	return unique
+}
+
+// posting names the account a posting is booked to, remembering names that
+// were not declared up front.
+func (n *names) posting(posting models.Posting) string {
+	var name string
+	switch posting.Ledger {
+	case models.LedgerAssets:
+		if posting.AccountID != nil {
+			if account, found := n.accounts[*posting.AccountID]; found {
+				name = account.name
+				break
+			}
+		}
+		name = rootAssets + ":Unknown"
+	case models.LedgerExpenses, models.LedgerIncome:
+		root := rootExpenses
+		if posting.Ledger == models.LedgerIncome {
+			root = rootIncome
+		}
+		name = root + ":" + uncategorized
+		if posting.CategoryID != nil {
+			name = n.category(root, *posting.CategoryID)
+		}
+	case models.LedgerEquityOpening:
+		name = accountOpening
+	default:
+		name = accountConversion
+	}
+
+	if !n.declared[name] {
+		n.declared[name] = true
+		n.late = append(n.late, name)
+	}
+	return name
+}
+
+func (n *names) undeclared() []string {
+	return n.late
+}
+
+// component turns a display name into one account name component: words
+// are capitalised and joined with dashes, so "food & drinks" becomes
+// "Food-Drinks".
+func component(name string) string {
+	var words []string
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words = append(words, string(runes))
+	}
+	if len(words) == 0 {
+		return "Unnamed"
+	}
+	result := strings.Join(words, "-")
+	if first := []rune(result)[0]; !unicode.IsUpper(first) && !unicode.IsDigit(first) {
+		// Scripts without capitals, such as CJK, still need a valid start.
+		result = "X-" + result
+	}
+	return result
+}
@@ -0,0 +1,322 @@
+// Package plaintext renders the journal as a plain-text accounting file for
+// Beancount, ledger-cli or hledger. Entries come straight from the
+// double-entry journal, so every one already balances in each currency.
+package plaintext
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	FormatBeancount = "beancount"
+	FormatLedger    = "ledger"
+	FormatHledger   = "hledger"
+)
+
+var ErrUnknownFormat = errors.New("unknown plain-text format")
+
+// batchSize is how many journal entries are held in memory at a time.
+const batchSize = 500
+
+// Options limits the export to a user and, optionally, a date range.
+type Options struct {
+	UserID   uuid.UUID
+	From     *time.Time
+	To       *time.Time
+	Currency string
+}
+
+// entry is a journal entry with what the transaction behind it adds: its
+// payee, note and tags.
+type entry struct {
+	models.JournalEntry
+	Payee string
+	Tags  []string
+}
+
+type writer struct {
+	out      *bufio.Writer
+	format   string
+	names    *names
+	openDate time.Time
+}
+
+// Write renders the user's journal in the given format. Accounts and
+// categories are declared before the first entry; Beancount gets an open
+// directive for each, dated on or before the first entry that uses it.
+func Write(db *gorm.DB, w io.Writer, format string, options Options) error {
+	if format != FormatBeancount && format != FormatLedger && format != FormatHledger {
+		return ErrUnknownFormat
+	}
+
+	entries := db.Model(&models.JournalEntry{}).Where("user_id = ?", options.UserID)
+	if options.From != nil {
+		entries = entries.Where("date >= ?", *options.From)
+	}
+	if options.To != nil {
+		entries = entries.Where("date < ?", options.To.AddDate(0, 0, 1))
+	}
+
+	var first struct{ Date *time.Time }
+	if err := entries.Session(&gorm.Session{}).Select("MIN(date) AS date").Scan(&first).Error; err != nil {
+		return err
+	}
+	openDate := time.Now()
+	if first.Date != nil {
+		openDate = *first.Date
+	}
+
+	names, err := loadNames(db, options.UserID)
+	if err != nil {
+		return err
+	}
+	payees, err := models.PayeeNames(db, options.UserID)
+	if err != nil {
+		return err
+	}
+
+	out := &writer{out: bufio.NewWriter(w), format: format, names: names, openDate: openDate}
+	out.header(options.Currency)
+
+	rows, err := entries.Order("date, created_at").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batch := make([]models.JournalEntry, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		detailed, err := details(db, batch, payees)
+		if err != nil {
+			return err
+		}
+		for _, e := range detailed {
+			out.entry(e)
+		}
+		batch = batch[:0]
+		return out.out.Flush()
+	}
+	for rows.Next() {
+		var journalEntry models.JournalEntry
+		if err := db.ScanRows(rows, &journalEntry); err != nil {
+			return err
+		}
+		batch = append(batch, journalEntry)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// Postings to a category of the other type, or to a category deleted
+	// for good, use names that were not declared up front. Beancount does
+	// not care where an open directive stands in the file.
+	for _, name := range names.undeclared() {
+		out.declare(name, "")
+	}
+	return out.out.Flush()
+}
+
+// details loads the postings of a batch of entries, and the payee and tags
+// of the transactions behind them.
+func details(db *gorm.DB, batch []models.JournalEntry, payees map[uuid.UUID]string) ([]entry, error) {
+	entryIDs := make([]uuid.UUID, len(batch))
+	var transactionIDs []uuid.UUID
+	for i, journalEntry := range batch {
+		entryIDs[i] = journalEntry.ID
+		if journalEntry.SourceType == models.JournalSourceTransaction {
+			transactionIDs = append(transactionIDs, journalEntry.SourceID)
+		}
+	}
+
+	var postings []models.Posting
+	if err := db.Where("entry_id IN ?", entryIDs).Find(&postings).Error; err != nil {
+		return nil, err
+	}
+	byEntry := map[uuid.UUID][]models.Posting{}
+	for _, posting := range postings {
+		byEntry[posting.EntryID] = append(byEntry[posting.EntryID], posting)
+	}
+
+	payeeOf := map[uuid.UUID]string{}
+	tagsOf := map[uuid.UUID][]string{}
+	if len(transactionIDs) > 0 {
+		var transactions []models.Transaction
+		if err := db.Select("id, payee_id").Where("id IN ?", transactionIDs).Find(&transactions).Error; err != nil {
+			return nil, err
+		}
+		for _, transaction := range transactions {
+			if transaction.PayeeID != nil {
+				payeeOf[transaction.ID] = payees[*transaction.PayeeID]
+			}
+		}
+
+		var tags []struct {
+			TransactionID uuid.UUID
+			Name          string
+		}
+		if err := db.Table("transaction_tags").
+			Select("transaction_tags.transaction_id, tags.name").
+			Joins("JOIN tags ON tags.id = transaction_tags.tag_id").
+			Where("transaction_tags.transaction_id IN ?", transactionIDs).
+			Order("tags.name").
+			Scan(&tags).Error; err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			tagsOf[tag.TransactionID] = append(tagsOf[tag.TransactionID], tag.Name)
+		}
+	}
+
+	detailed := make([]entry, len(batch))
+	for i, journalEntry := range batch {
+		journalEntry.Postings = byEntry[journalEntry.ID]
+		sort.SliceStable(journalEntry.Postings, func(a, b int) bool {
+			return ledgerOrder(journalEntry.Postings[a].Ledger) < ledgerOrder(journalEntry.Postings[b].Ledger)
+		})
+		detailed[i] = entry{JournalEntry: journalEntry, Payee: payeeOf[journalEntry.SourceID], Tags: tagsOf[journalEntry.SourceID]}
+	}
+	return detailed, nil
+}
+
+// ledgerOrder lists asset postings first, then expenses, income and equity.
+func ledgerOrder(ledger string) int {
+	switch ledger {
+	case models.LedgerAssets:
+		return 0
+	case models.LedgerExpenses:
+		return 1
+	case models.LedgerIncome:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (w *writer) header(currency string) {
+	if w.format == FormatBeancount {
+		fmt.Fprintf(w.out, "option \"title\" \"Expense app export\"\n")
+		if currency != "" {
+			fmt.Fprintf(w.out, "option \"operating_currency\" \"%s\"\n", currency)
+		}
+		fmt.Fprintln(w.out)
+	}
+	for _, account := range w.names.declarations() {
+		w.declare(account.name, account.currency)
+	}
+	fmt.Fprintln(w.out)
+}
+
+// declare opens an account. Asset accounts are restricted to the currency
+// they hold.
+func (w *writer) declare(name, currency string) {
+	if w.format == FormatBeancount {
+		line := w.openDate.Format("2006-01-02") + " open " + name
+		if currency != "" {
+			line += " " + currency
+		}
+		fmt.Fprintln(w.out, line)
+		return
+	}
+	fmt.Fprintln(w.out, "account "+name)
+}
+
+func (w *writer) entry(e entry) {
+	note := oneLine(e.Description)
+	payee := oneLine(e.Payee)
+	date := e.Date.Format("2006-01-02")
+
+	switch w.format {
+	case FormatBeancount:
+		line := date + " *"
+		if payee != "" {
+			line += " " + quote(payee)
+		}
+		line += " " + quote(note)
+		for _, tag := range e.Tags {
+			line += " #" + tagName(tag, "-_/.")
+		}
+		fmt.Fprintln(w.out, line)
+		fmt.Fprintf(w.out, "  source: %s\n", quote(e.SourceType))
+		fmt.Fprintf(w.out, "  source_id: %s\n", quote(e.SourceID.String()))
+	default:
+		// ledger and hledger have one description, so the payee takes it
+		// and the note moves to metadata.
+		description := payee
+		if description == "" {
+			description = note
+		}
+		fmt.Fprintln(w.out, strings.TrimSpace(date+" * "+description))
+		if payee != "" && note != "" {
+			fmt.Fprintf(w.out, "    ; note: %s\n", note)
+		}
+		if len(e.Tags) > 0 {
+			tags := make([]string, len(e.Tags))
+			for i, tag := range e.Tags {
+				tags[i] = tagName(tag, "-_")
+			}
+			if w.format == FormatLedger {
+				fmt.Fprintf(w.out, "    ; :%s:\n", strings.Join(tags, ":"))
+			} else {
+				fmt.Fprintf(w.out, "    ; %s:\n", strings.Join(tags, ":, "))
+			}
+		}
+		fmt.Fprintf(w.out, "    ; source: %s\n", e.SourceType)
+		fmt.Fprintf(w.out, "    ; source_id: %s\n", e.SourceID)
+	}
+
+	indent := "    "
+	if w.format == FormatBeancount {
+		indent = "  "
+	}
+	for _, posting := range e.Postings {
+		fmt.Fprintf(w.out, "%s%-50s  %s %s\n", indent, w.names.posting(posting), posting.Amount.Decimal(), posting.Currency)
+	}
+	fmt.Fprintln(w.out)
+}
+
+// oneLine collapses whitespace, newlines included, to single spaces.
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func quote(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
+
+// tagName replaces every character tags may not contain with a dash. Letters,
+// digits and the given punctuation are kept.
+func tagName(name, allowed string) string {
+	tag := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(allowed, r)) {
+			return r
+		}
+		return '-'
+	}, name)
+	if tag == "" {
+		return "tag"
+	}
+	return tag
+}
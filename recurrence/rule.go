@@ -0,0 +1,286 @@
+// Package recurrence implements the subset of RFC 5545 recurrence rules the
+// app needs: FREQ, INTERVAL, BYDAY, BYMONTHDAY, BYSETPOS, COUNT and UNTIL.
+// The last business day of every month, for example, is
+// "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1".
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+const untilLayout = "20060102"
+
+// maxPeriods bounds how far a rule is expanded, so a rule that never matches,
+// such as BYMONTHDAY=31 with BYSETPOS=5, cannot loop forever.
+const maxPeriods = 10000
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	BySetPos   int
+	Count      int
+	Until      *time.Time
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR". An
+// optional "RRULE:" prefix is ignored.
+func Parse(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return rule, ErrInvalidRule
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		key, val, found := strings.Cut(part, "=")
+		if !found {
+			return rule, fmt.Errorf("%w: %q", ErrInvalidRule, part)
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		val = strings.ToUpper(strings.TrimSpace(val))
+
+		var err error
+		switch key {
+		case "FREQ":
+			rule.Freq = val
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(val)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(val)
+		case "BYSETPOS":
+			rule.BySetPos, err = strconv.Atoi(val)
+		case "UNTIL":
+			var until time.Time
+			until, err = time.ParseInLocation(untilLayout, val[:min(len(val), len(untilLayout))], time.Local)
+			rule.Until = &until
+		case "BYDAY":
+			for _, code := range strings.Split(val, ",") {
+				weekday, found := weekdayCodes[code]
+				if !found {
+					return rule, fmt.Errorf("%w: unknown day %q", ErrInvalidRule, code)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				monthDay, convErr := strconv.Atoi(day)
+				if convErr != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return rule, fmt.Errorf("%w: BYMONTHDAY %q", ErrInvalidRule, day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, monthDay)
+			}
+		default:
+			return rule, fmt.Errorf("%w: unsupported part %q", ErrInvalidRule, key)
+		}
+		if err != nil {
+			return rule, fmt.Errorf("%w: %s", ErrInvalidRule, key)
+		}
+	}
+
+	switch rule.Freq {
+	case Daily, Weekly, Monthly, Yearly:
+	default:
+		return rule, fmt.Errorf("%w: FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY", ErrInvalidRule)
+	}
+	if rule.Interval < 1 || rule.Count < 0 {
+		return rule, ErrInvalidRule
+	}
+	return rule, nil
+}
+
+// String formats the rule back into its RRULE form.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, 0, len(r.ByDay))
+		for _, weekday := range r.ByDay {
+			for code, day := range weekdayCodes {
+				if day == weekday {
+					codes = append(codes, code)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.BySetPos != 0 {
+		parts = append(parts, "BYSETPOS="+strconv.Itoa(r.BySetPos))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of a rule starting on start that fall on or
+// after from and before to, at most limit of them. A zero to means no upper
+// bound and a limit of zero means no limit. Occurrences are dates at midnight
+// in start's location.
+func (r Rule) Between(start, from, to time.Time, limit int) []time.Time {
+	start = day(start)
+	var occurrences []time.Time
+	seen := 0
+
+	for period := 0; period < maxPeriods; period++ {
+		for _, candidate := range r.candidates(start, period) {
+			if candidate.Before(start) {
+				continue
+			}
+			if r.Until != nil && candidate.After(day(*r.Until)) {
+				return occurrences
+			}
+			if !to.IsZero() && !candidate.Before(to) {
+				return occurrences
+			}
+			seen++
+			if r.Count > 0 && seen > r.Count {
+				return occurrences
+			}
+			if candidate.Before(from) {
+				continue
+			}
+			occurrences = append(occurrences, candidate)
+			if limit > 0 && len(occurrences) >= limit {
+				return occurrences
+			}
+		}
+	}
+	return occurrences
+}
+
+// candidates lists the dates the rule produces in the given period, counting
+// periods of Interval units from the one containing start.
+func (r Rule) candidates(start time.Time, period int) []time.Time {
+	var days []time.Time
+
+	switch r.Freq {
+	case Daily:
+		date := start.AddDate(0, 0, period*r.Interval)
+		if r.matchesDay(date) && r.matchesMonthDay(date) {
+			days = append(days, date)
+		}
+	case Weekly:
+		monday := start.AddDate(0, 0, -((int(start.Weekday())+6)%7)+period*7*r.Interval)
+		weekdays := r.ByDay
+		if len(weekdays) == 0 {
+			weekdays = []time.Weekday{start.Weekday()}
+		}
+		for offset := 0; offset < 7; offset++ {
+			date := monday.AddDate(0, 0, offset)
+			for _, weekday := range weekdays {
+				if date.Weekday() == weekday {
+					days = append(days, date)
+				}
+			}
+		}
+	case Monthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(period*r.Interval), 1, 0, 0, 0, 0, start.Location())
+		days = r.monthDays(first, start.Day())
+	case Yearly:
+		first := time.Date(start.Year()+period*r.Interval, start.Month(), 1, 0, 0, 0, 0, start.Location())
+		days = r.monthDays(first, start.Day())
+	}
+
+	return r.applySetPos(days)
+}
+
+// monthDays expands BYDAY and BYMONTHDAY within one month. Without either,
+// the rule falls on the start's day of the month, and months too short for
+// it are skipped, as RFC 5545 requires.
+func (r Rule) monthDays(first time.Time, startDay int) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	var days []time.Time
+
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		if startDay <= last {
+			days = append(days, first.AddDate(0, 0, startDay-1))
+		}
+		return days
+	}
+
+	for dayOfMonth := 1; dayOfMonth <= last; dayOfMonth++ {
+		date := first.AddDate(0, 0, dayOfMonth-1)
+		if r.matchesDay(date) && r.matchesMonthDay(date) {
+			days = append(days, date)
+		}
+	}
+	return days
+}
+
+func (r Rule) matchesDay(date time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, weekday := range r.ByDay {
+		if date.Weekday() == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchesMonthDay(date time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, date.Location()).Day()
+	for _, monthDay := range r.ByMonthDay {
+		if monthDay == date.Day() || (monthDay < 0 && last+monthDay+1 == date.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) applySetPos(days []time.Time) []time.Time {
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	if r.BySetPos == 0 {
+		return days
+	}
+
+	index := r.BySetPos - 1
+	if r.BySetPos < 0 {
+		index = len(days) + r.BySetPos
+	}
+	if index < 0 || index >= len(days) {
+		return nil
+	}
+	return []time.Time{days[index]}
+}
+
+func day(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
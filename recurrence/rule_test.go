@@ -0,0 +1,164 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+func formatDates(dates []time.Time) []string {
+	formatted := make([]string, len(dates))
+	for i, d := range dates {
+		formatted[i] = d.Format("2006-01-02")
+	}
+	return formatted
+}
+
+func TestRuleBetween(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		from  time.Time
+		to    time.Time
+		limit int
+		want  []string
+	}{
+		{
+			name:  "monthly on the 31st skips shorter months",
+			rule:  "FREQ=MONTHLY",
+			start: date(2024, time.January, 31),
+			limit: 4,
+			want:  []string{"2024-01-31", "2024-03-31", "2024-05-31", "2024-07-31"},
+		},
+		{
+			name:  "last day of the month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: date(2023, time.December, 15),
+			limit: 4,
+			want:  []string{"2023-12-31", "2024-01-31", "2024-02-29", "2024-03-31"},
+		},
+		{
+			name:  "last day of february outside a leap year",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: date(2023, time.January, 31),
+			limit: 2,
+			want:  []string{"2023-01-31", "2023-02-28"},
+		},
+		{
+			name:  "yearly on february 29 only in leap years",
+			rule:  "FREQ=YEARLY",
+			start: date(2024, time.February, 29),
+			limit: 3,
+			want:  []string{"2024-02-29", "2028-02-29", "2032-02-29"},
+		},
+		{
+			name:  "last business day",
+			rule:  "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+			start: date(2024, time.January, 1),
+			limit: 4,
+			// March 2024 and June 2024 end on a weekend.
+			want: []string{"2024-01-31", "2024-02-29", "2024-03-29", "2024-04-30"},
+		},
+		{
+			name:  "first monday",
+			rule:  "FREQ=MONTHLY;BYDAY=MO;BYSETPOS=1",
+			start: date(2024, time.January, 1),
+			limit: 3,
+			want:  []string{"2024-01-01", "2024-02-05", "2024-03-04"},
+		},
+		{
+			name:  "count includes occurrences before from",
+			rule:  "FREQ=DAILY;COUNT=5",
+			start: date(2024, time.January, 1),
+			from:  date(2024, time.January, 3),
+			want:  []string{"2024-01-03", "2024-01-04", "2024-01-05"},
+		},
+		{
+			name:  "until is inclusive",
+			rule:  "FREQ=WEEKLY;UNTIL=20240115",
+			start: date(2024, time.January, 1),
+			want:  []string{"2024-01-01", "2024-01-08", "2024-01-15"},
+		},
+		{
+			name:  "to is exclusive",
+			rule:  "FREQ=DAILY",
+			start: date(2024, time.January, 1),
+			to:    date(2024, time.January, 4),
+			want:  []string{"2024-01-01", "2024-01-02", "2024-01-03"},
+		},
+		{
+			name:  "every other week on two days",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			start: date(2024, time.January, 3),
+			limit: 4,
+			want:  []string{"2024-01-05", "2024-01-15", "2024-01-19", "2024-01-29"},
+		},
+		{
+			name:  "a rule that never matches ends",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31;BYSETPOS=2",
+			start: date(2024, time.January, 1),
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.rule, err)
+			}
+			got := formatDates(rule.Between(tt.start, tt.from, tt.to, tt.limit))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Between() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Between() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", want: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO"},
+		{value: "freq=monthly;bymonthday=-1;count=12", want: "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12"},
+		{value: "FREQ=DAILY;UNTIL=20241231T235959Z", want: "FREQ=DAILY;UNTIL=20241231"},
+		{value: "", wantErr: true},
+		{value: "FREQ=HOURLY", wantErr: true},
+		{value: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{value: "FREQ=DAILY;COUNT=-1", wantErr: true},
+		{value: "FREQ=WEEKLY;BYDAY=XX", wantErr: true},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: true},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=0", wantErr: true},
+		{value: "FREQ=DAILY;BYHOUR=9", wantErr: true},
+		{value: "FREQ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		rule, err := Parse(tt.value)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Parse(%q) error = %v, want ErrInvalidRule", tt.value, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got := rule.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
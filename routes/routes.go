@@ -1,21 +1,31 @@
 package routes
 
 import (
+	"expense-app-backend/blobstore"
 	"expense-app-backend/controllers"
 	"expense-app-backend/middleware"
+	"expense-app-backend/models"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 )
 
-func SetupRouter(db *gorm.DB) *mux.Router {
+func SetupRouter(db *gorm.DB, store blobstore.BlobStore) *mux.Router {
 	router := mux.NewRouter()
 
 	router.HandleFunc("/api/register", controllers.Register(db)).Methods("POST")
 	router.HandleFunc("/api/login", controllers.Login(db)).Methods("POST")
+	router.HandleFunc("/api/attachments/{id}/download", controllers.DownloadAttachment(db, store)).Methods("GET")
 
 	protected := router.PathPrefix("/api").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
+	protected.Use(middleware.ActiveUser(db))
+
+	protected.HandleFunc("/password", controllers.ChangePassword(db)).Methods("PUT")
+	protected.HandleFunc("/profile", controllers.GetProfile()).Methods("GET")
+	protected.HandleFunc("/profile", controllers.UpdateProfile(db)).Methods("PUT")
+	protected.HandleFunc("/profile", controllers.DeleteProfile(db)).Methods("DELETE")
+	protected.HandleFunc("/profile/export", controllers.ExportProfileData(db, store)).Methods("GET")
 
 	protected.HandleFunc("/categories", controllers.GetCategories(db)).Methods("GET")
 	protected.HandleFunc("/categories", controllers.CreateCategory(db)).Methods("POST")
@@ -23,6 +33,165 @@ func SetupRouter(db *gorm.DB) *mux.Router {
 	protected.HandleFunc("/categories/categoriesId", controllers.UpdateCategory(db)).Methods("PUT")
 	protected.HandleFunc("/categories/categoriesId", controllers.DeleteCategory(db)).Methods("DELETE")
 
+	protected.HandleFunc("/categories/tree", controllers.GetCategoryTree(db)).Methods("GET")
+	protected.HandleFunc("/categories/trash", controllers.GetCategoryTrash(db)).Methods("GET")
+	protected.HandleFunc("/categories/{id}/restore", controllers.RestoreCategory(db)).Methods("POST")
+	protected.HandleFunc("/categories/{id}/merge", controllers.MergeCategory(db)).Methods("POST")
+	protected.HandleFunc("/categories/{id}/archive", controllers.ArchiveCategory(db)).Methods("PUT")
+	protected.HandleFunc("/categories/{id}/unarchive", controllers.UnarchiveCategory(db)).Methods("PUT")
+	protected.HandleFunc("/categories/{id}/subtree", controllers.GetCategorySubtree(db)).Methods("GET")
+	protected.HandleFunc("/categories/{id}/move", controllers.MoveCategory(db)).Methods("PUT")
+	protected.HandleFunc("/categories/{id}/sub-categories", controllers.CreateSubCategory(db)).Methods("POST")
+	protected.HandleFunc("/categories/{id}/sub-categories/order", controllers.ReorderSubCategories(db)).Methods("PUT")
+	protected.HandleFunc("/categories/{id}/sub-categories/{subCategoryId}", controllers.RenameSubCategory(db)).Methods("PUT")
+	protected.HandleFunc("/categories/{id}/sub-categories/{subCategoryId}", controllers.DeleteSubCategory(db)).Methods("DELETE")
+
+	protected.HandleFunc("/category-templates", controllers.GetCategoryTemplates()).Methods("GET")
+	protected.HandleFunc("/category-templates/{locale}/apply", controllers.ApplyCategoryTemplate(db)).Methods("POST")
+
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.RequireRole(models.RoleAdmin))
+
+	admin.HandleFunc("/users", controllers.ListUsers(db)).Methods("GET")
+	admin.HandleFunc("/users/{id}/disable", controllers.DisableUser(db)).Methods("PUT")
+	admin.HandleFunc("/users/{id}/enable", controllers.EnableUser(db)).Methods("PUT")
+	admin.HandleFunc("/users/{id}/role", controllers.UpdateUserRole(db)).Methods("PUT")
+	admin.HandleFunc("/users/{id}/reset-password", controllers.ForcePasswordReset(db)).Methods("POST")
+
+	admin.HandleFunc("/ledger/check", controllers.CheckAllLedgers(db)).Methods("GET")
+	admin.HandleFunc("/ledger/repair", controllers.RepairLedger(db)).Methods("POST")
+	admin.HandleFunc("/exchange-rates/import", controllers.ImportSharedExchangeRates(db)).Methods("POST")
+
+	admin.HandleFunc("/categories", controllers.CreateDefaultCategory(db)).Methods("POST")
+	admin.HandleFunc("/categories/categoriesId", controllers.UpdateDefaultCategory(db)).Methods("PUT")
+	admin.HandleFunc("/categories/categoriesId", controllers.DeleteDefaultCategory(db)).Methods("DELETE")
+	admin.HandleFunc("/categories/trash", controllers.GetDefaultCategoryTrash(db)).Methods("GET")
+	admin.HandleFunc("/categories/{id}/restore", controllers.RestoreDefaultCategory(db)).Methods("POST")
+	admin.HandleFunc("/categories/{id}/merge", controllers.MergeDefaultCategory(db)).Methods("POST")
+	admin.HandleFunc("/categories/{id}/archive", controllers.ArchiveDefaultCategory(db)).Methods("PUT")
+	admin.HandleFunc("/categories/{id}/unarchive", controllers.UnarchiveDefaultCategory(db)).Methods("PUT")
+	admin.HandleFunc("/categories/{id}/move", controllers.MoveDefaultCategory(db)).Methods("PUT")
+	admin.HandleFunc("/categories/{id}/sub-categories", controllers.CreateDefaultSubCategory(db)).Methods("POST")
+	admin.HandleFunc("/categories/{id}/sub-categories/order", controllers.ReorderDefaultSubCategories(db)).Methods("PUT")
+	admin.HandleFunc("/categories/{id}/sub-categories/{subCategoryId}", controllers.RenameDefaultSubCategory(db)).Methods("PUT")
+	admin.HandleFunc("/categories/{id}/sub-categories/{subCategoryId}", controllers.DeleteDefaultSubCategory(db)).Methods("DELETE")
+
+	protected.HandleFunc("/accounts", controllers.GetAccounts(db)).Methods("GET")
+	protected.HandleFunc("/accounts", controllers.CreateAccount(db)).Methods("POST")
+	protected.HandleFunc("/accounts/total", controllers.GetAccountTotal(db)).Methods("GET")
+	protected.HandleFunc("/accounts/{id}", controllers.GetAccountById(db)).Methods("GET")
+	protected.HandleFunc("/accounts/{id}", controllers.UpdateAccount(db)).Methods("PUT")
+	protected.HandleFunc("/accounts/{id}", controllers.DeleteAccount(db)).Methods("DELETE")
+
+	protected.HandleFunc("/transactions", controllers.GetTransactions(db)).Methods("GET")
+	protected.HandleFunc("/transactions", controllers.CreateTransaction(db)).Methods("POST")
+	protected.HandleFunc("/transactions/totals", controllers.GetTransactionTotals(db)).Methods("GET")
+	protected.HandleFunc("/transactions/tags", controllers.AddTransactionTags(db)).Methods("POST")
+	protected.HandleFunc("/transactions/tags", controllers.RemoveTransactionTags(db)).Methods("DELETE")
+	protected.HandleFunc("/transactions/{id}", controllers.GetTransactionById(db)).Methods("GET")
+	protected.HandleFunc("/transactions/{id}", controllers.UpdateTransaction(db)).Methods("PUT")
+	protected.HandleFunc("/transactions/{id}", controllers.DeleteTransaction(db)).Methods("DELETE")
+	protected.HandleFunc("/transactions/{id}/attachments", controllers.GetTransactionAttachments(db)).Methods("GET")
+	protected.HandleFunc("/transactions/{id}/attachments", controllers.AddTransactionAttachment(db, store)).Methods("POST")
+	protected.HandleFunc("/transactions/{id}/attachments/{attachmentId}", controllers.DeleteTransactionAttachment(db, store)).Methods("DELETE")
+
+	protected.HandleFunc("/payees", controllers.GetPayees(db)).Methods("GET")
+	protected.HandleFunc("/payees", controllers.CreatePayee(db)).Methods("POST")
+	protected.HandleFunc("/payees/suggest", controllers.SuggestPayees(db)).Methods("GET")
+	protected.HandleFunc("/payees/{id}", controllers.GetPayeeById(db)).Methods("GET")
+	protected.HandleFunc("/payees/{id}", controllers.UpdatePayee(db)).Methods("PUT")
+	protected.HandleFunc("/payees/{id}", controllers.DeletePayee(db)).Methods("DELETE")
+	protected.HandleFunc("/payees/{id}/aliases", controllers.AddPayeeAlias(db)).Methods("POST")
+	protected.HandleFunc("/payees/{id}/aliases/{aliasId}", controllers.DeletePayeeAlias(db)).Methods("DELETE")
+
+	protected.HandleFunc("/tags", controllers.GetTags(db)).Methods("GET")
+	protected.HandleFunc("/tags", controllers.CreateTag(db)).Methods("POST")
+	protected.HandleFunc("/tags/totals", controllers.GetTagTotals(db)).Methods("GET")
+	protected.HandleFunc("/tags/{id}", controllers.UpdateTag(db)).Methods("PUT")
+	protected.HandleFunc("/tags/{id}", controllers.DeleteTag(db)).Methods("DELETE")
+
+	protected.HandleFunc("/rules", controllers.GetRules(db)).Methods("GET")
+	protected.HandleFunc("/rules", controllers.CreateRule(db)).Methods("POST")
+	protected.HandleFunc("/rules/{id}", controllers.GetRuleById(db)).Methods("GET")
+	protected.HandleFunc("/rules/{id}", controllers.UpdateRule(db)).Methods("PUT")
+	protected.HandleFunc("/rules/{id}", controllers.DeleteRule(db)).Methods("DELETE")
+	protected.HandleFunc("/rules/{id}/dry-run", controllers.DryRunRule(db)).Methods("POST")
+	protected.HandleFunc("/rules/{id}/apply", controllers.ApplyRule(db)).Methods("POST")
+
+	protected.HandleFunc("/imports", controllers.GetImports(db)).Methods("GET")
+	protected.HandleFunc("/imports/profiles", controllers.GetImportProfiles(db)).Methods("GET")
+	protected.HandleFunc("/imports/profiles", controllers.CreateImportProfile(db)).Methods("POST")
+	protected.HandleFunc("/imports/profiles/{id}", controllers.GetImportProfileById(db)).Methods("GET")
+	protected.HandleFunc("/imports/profiles/{id}", controllers.UpdateImportProfile(db)).Methods("PUT")
+	protected.HandleFunc("/imports/profiles/{id}", controllers.DeleteImportProfile(db)).Methods("DELETE")
+	protected.HandleFunc("/imports/csv/preview", controllers.PreviewCSVImport(db)).Methods("POST")
+	protected.HandleFunc("/imports/csv", controllers.ImportCSV(db)).Methods("POST")
+	protected.HandleFunc("/imports/ofx/preview", controllers.PreviewOFXImport(db)).Methods("POST")
+	protected.HandleFunc("/imports/ofx", controllers.ImportOFX(db)).Methods("POST")
+	protected.HandleFunc("/imports/qif/preview", controllers.PreviewQIFImport(db)).Methods("POST")
+	protected.HandleFunc("/imports/qif", controllers.ImportQIF(db)).Methods("POST")
+	protected.HandleFunc("/imports/{id}", controllers.GetImportById(db)).Methods("GET")
+	protected.HandleFunc("/imports/{id}", controllers.UndoImport(db)).Methods("DELETE")
+
+	protected.HandleFunc("/exports/transactions", controllers.ExportTransactions(db)).Methods("GET")
+	protected.HandleFunc("/exports/accounts", controllers.ExportAccounts(db)).Methods("GET")
+	protected.HandleFunc("/exports/categories", controllers.ExportCategories(db)).Methods("GET")
+	protected.HandleFunc("/exports/journal", controllers.ExportJournal(db)).Methods("GET")
+
+	protected.HandleFunc("/backup", controllers.DownloadBackup(db, store)).Methods("GET")
+	protected.HandleFunc("/backup/restore", controllers.RestoreBackup(db, store)).Methods("POST")
+
+	protected.HandleFunc("/reports/categories", controllers.GetCategoryReport(db)).Methods("GET")
+	protected.HandleFunc("/reports/top-categories", controllers.GetTopCategories(db)).Methods("GET")
+	protected.HandleFunc("/reports/periods", controllers.GetPeriodReport(db)).Methods("GET")
+	protected.HandleFunc("/reports/income-expense", controllers.GetIncomeExpenseReport(db)).Methods("GET")
+
+	protected.HandleFunc("/budgets", controllers.GetBudgets(db)).Methods("GET")
+	protected.HandleFunc("/budgets", controllers.CreateBudget(db)).Methods("POST")
+	protected.HandleFunc("/budgets/status", controllers.GetBudgetsStatus(db)).Methods("GET")
+	protected.HandleFunc("/budgets/{id}", controllers.GetBudgetById(db)).Methods("GET")
+	protected.HandleFunc("/budgets/{id}", controllers.UpdateBudget(db)).Methods("PUT")
+	protected.HandleFunc("/budgets/{id}", controllers.DeleteBudget(db)).Methods("DELETE")
+	protected.HandleFunc("/budgets/{id}/status", controllers.GetBudgetStatus(db)).Methods("GET")
+
+	protected.HandleFunc("/envelopes", controllers.GetEnvelopeSummary(db)).Methods("GET")
+	protected.HandleFunc("/envelopes/moves", controllers.GetEnvelopeMoves(db)).Methods("GET")
+	protected.HandleFunc("/envelopes/moves", controllers.MoveEnvelopeMoney(db)).Methods("POST")
+	protected.HandleFunc("/envelopes/{categoryId}/assign", controllers.AssignEnvelope(db)).Methods("PUT")
+
+	protected.HandleFunc("/recurring", controllers.GetRecurringTransactions(db)).Methods("GET")
+	protected.HandleFunc("/recurring", controllers.CreateRecurringTransaction(db)).Methods("POST")
+	protected.HandleFunc("/recurring/{id}", controllers.GetRecurringTransactionById(db)).Methods("GET")
+	protected.HandleFunc("/recurring/{id}", controllers.UpdateRecurringTransaction(db)).Methods("PUT")
+	protected.HandleFunc("/recurring/{id}", controllers.DeleteRecurringTransaction(db)).Methods("DELETE")
+	protected.HandleFunc("/recurring/{id}/preview", controllers.PreviewRecurringTransaction(db)).Methods("GET")
+	protected.HandleFunc("/recurring/{id}/occurrences/{date}", controllers.EditOccurrence(db)).Methods("PUT")
+	protected.HandleFunc("/recurring/{id}/occurrences/{date}", controllers.ResetOccurrence(db)).Methods("DELETE")
+	protected.HandleFunc("/recurring/{id}/occurrences/{date}/skip", controllers.SkipOccurrence(db)).Methods("POST")
+
+	protected.HandleFunc("/bills", controllers.GetBills(db)).Methods("GET")
+	protected.HandleFunc("/bills", controllers.CreateBill(db)).Methods("POST")
+	protected.HandleFunc("/bills/upcoming", controllers.GetUpcomingBills(db)).Methods("GET")
+	protected.HandleFunc("/bills/overdue", controllers.GetOverdueBills(db)).Methods("GET")
+	protected.HandleFunc("/bills/{id}", controllers.GetBillById(db)).Methods("GET")
+	protected.HandleFunc("/bills/{id}", controllers.UpdateBill(db)).Methods("PUT")
+	protected.HandleFunc("/bills/{id}", controllers.DeleteBill(db)).Methods("DELETE")
+	protected.HandleFunc("/bills/{id}/pay", controllers.PayBill(db)).Methods("POST")
+	protected.HandleFunc("/bills/{id}/payments", controllers.GetBillPayments(db)).Methods("GET")
+
+	protected.HandleFunc("/ledger/check", controllers.CheckLedger(db)).Methods("GET")
+
+	protected.HandleFunc("/transfers", controllers.GetTransfers(db)).Methods("GET")
+	protected.HandleFunc("/transfers", controllers.CreateTransfer(db)).Methods("POST")
+	protected.HandleFunc("/transfers/{id}", controllers.GetTransferById(db)).Methods("GET")
+	protected.HandleFunc("/transfers/{id}", controllers.DeleteTransfer(db)).Methods("DELETE")
+
+	protected.HandleFunc("/exchange-rates", controllers.GetExchangeRates(db)).Methods("GET")
+	protected.HandleFunc("/exchange-rates", controllers.CreateExchangeRate(db)).Methods("POST")
+	protected.HandleFunc("/exchange-rates/convert", controllers.ConvertAmount(db)).Methods("GET")
+	protected.HandleFunc("/exchange-rates/import", controllers.ImportExchangeRates(db)).Methods("POST")
+	protected.HandleFunc("/exchange-rates/{id}", controllers.DeleteExchangeRate(db)).Methods("DELETE")
+
 	// 	protected.HandleFunc("/protected", func(w http.ResponseWriter, r *http.Request) {
 	// 		w.Write([]byte("Protected route"))
 	// }).Methods("GET")
@@ -0,0 +1,408 @@
+// Package rules runs the user's categorisation rules against transactions.
+// Rules are evaluated by ascending priority; the first matching rule that
+// sets a category or payee decides it, while tags from every matching rule
+// are combined.
+package rules
+
+import (
+	"errors"
+	"expense-app-backend/ledger"
+	"expense-app-backend/models"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const dateLayout = "2006-01-02"
+
+// Operators lists the operators each field supports.
+var Operators = map[string][]string{
+	models.RuleFieldDescription: {"contains", "not_contains", "equals", "starts_with", "ends_with", "matches"},
+	models.RuleFieldPayee:       {"contains", "not_contains", "equals", "starts_with", "ends_with", "matches"},
+	models.RuleFieldAmount:      {"eq", "gt", "gte", "lt", "lte", "between"},
+	models.RuleFieldAccount:     {"equals", "not_equals"},
+	models.RuleFieldDate:        {"on", "before", "after"},
+	models.RuleFieldType:        {"equals"},
+}
+
+// Subject is what conditions look at.
+type Subject struct {
+	Description string
+	Payee       string
+	Amount      models.Money
+	AccountID   uuid.UUID
+	Date        time.Time
+	Type        string
+}
+
+// Outcome is the combined effect of the matching rules.
+type Outcome struct {
+	CategoryID *uuid.UUID
+	PayeeID    *uuid.UUID
+	TagIDs     []uuid.UUID
+	RuleIDs    []uuid.UUID
+}
+
+func (o Outcome) IsEmpty() bool {
+	return o.CategoryID == nil && o.PayeeID == nil && len(o.TagIDs) == 0
+}
+
+// Validate checks a rule's conditions. Every rule needs at least one.
+func Validate(conditions models.RuleConditions) error {
+	if len(conditions) == 0 {
+		return errors.New("at least one condition is required")
+	}
+	for _, condition := range conditions {
+		operators, found := Operators[condition.Field]
+		if !found {
+			return fmt.Errorf("unknown field %q", condition.Field)
+		}
+		if !contains(operators, condition.Operator) {
+			return fmt.Errorf("field %s does not support operator %q", condition.Field, condition.Operator)
+		}
+
+		var err error
+		switch condition.Field {
+		case models.RuleFieldAmount:
+			_, _, err = amountBounds(condition)
+		case models.RuleFieldAccount:
+			_, err = uuid.Parse(condition.Value)
+		case models.RuleFieldDate:
+			_, err = time.ParseInLocation(dateLayout, condition.Value, time.Local)
+		case models.RuleFieldType:
+			if !models.IsValidTransactionType(condition.Value) {
+				err = errors.New("must be expense or income")
+			}
+		default:
+			if condition.Operator == "matches" {
+				_, err = regexp.Compile("(?i)" + condition.Value)
+			} else if strings.TrimSpace(condition.Value) == "" {
+				err = errors.New("must not be empty")
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for %s %s: %v", condition.Field, condition.Operator, err)
+		}
+	}
+	return nil
+}
+
+// Engine evaluates a fixed list of rules.
+type Engine struct {
+	rules         []models.Rule
+	categoryTypes map[uuid.UUID]string
+	patterns      map[string]*regexp.Regexp
+}
+
+// Load builds an engine from the user's enabled rules.
+func Load(db *gorm.DB, userID uuid.UUID) (*Engine, error) {
+	var rules []models.Rule
+	if err := db.Where("user_id = ? AND enabled = ?", userID, true).Order("priority, created_at").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return New(db, rules)
+}
+
+// New builds an engine for the given rules, in the order given. It looks up
+// the type of every category the rules assign, so an expense category is
+// never put on income.
+func New(db *gorm.DB, rules []models.Rule) (*Engine, error) {
+	engine := &Engine{rules: rules, categoryTypes: map[uuid.UUID]string{}, patterns: map[string]*regexp.Regexp{}}
+
+	categoryIDs := []uuid.UUID{}
+	for _, rule := range rules {
+		if rule.Actions.CategoryID != nil {
+			categoryIDs = append(categoryIDs, *rule.Actions.CategoryID)
+		}
+	}
+	if len(categoryIDs) > 0 {
+		var categories []models.Category
+		if err := db.Where("id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+			return nil, err
+		}
+		for _, category := range categories {
+			engine.categoryTypes[category.ID] = category.CategoryType
+		}
+	}
+	return engine, nil
+}
+
+// Evaluate runs the rules against a subject.
+func (e *Engine) Evaluate(subject Subject) Outcome {
+	var outcome Outcome
+	tags := map[uuid.UUID]bool{}
+
+	for _, rule := range e.rules {
+		if !e.matches(rule, subject) {
+			continue
+		}
+		outcome.RuleIDs = append(outcome.RuleIDs, rule.ID)
+
+		actions := rule.Actions
+		if outcome.CategoryID == nil && actions.CategoryID != nil && e.categoryTypes[*actions.CategoryID] == subject.Type {
+			outcome.CategoryID = actions.CategoryID
+		}
+		if outcome.PayeeID == nil && actions.PayeeID != nil {
+			outcome.PayeeID = actions.PayeeID
+		}
+		for _, tagID := range actions.TagIDs {
+			if !tags[tagID] {
+				tags[tagID] = true
+				outcome.TagIDs = append(outcome.TagIDs, tagID)
+			}
+		}
+
+		if rule.StopProcessing {
+			break
+		}
+	}
+	return outcome
+}
+
+func (e *Engine) matches(rule models.Rule, subject Subject) bool {
+	if len(rule.Conditions) == 0 {
+		return false
+	}
+	for _, condition := range rule.Conditions {
+		if !e.holds(condition, subject) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) holds(condition models.RuleCondition, subject Subject) bool {
+	switch condition.Field {
+	case models.RuleFieldDescription:
+		return e.matchText(condition, subject.Description)
+	case models.RuleFieldPayee:
+		return e.matchText(condition, subject.Payee)
+	case models.RuleFieldAmount:
+		low, high, err := amountBounds(condition)
+		if err != nil {
+			return false
+		}
+		exponent := models.CurrencyExponent(subject.Amount.Currency)
+		amount := new(big.Rat).SetFrac(big.NewInt(subject.Amount.Amount), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil))
+		switch condition.Operator {
+		case "eq":
+			return amount.Cmp(low) == 0
+		case "gt":
+			return amount.Cmp(low) > 0
+		case "gte":
+			return amount.Cmp(low) >= 0
+		case "lt":
+			return amount.Cmp(low) < 0
+		case "lte":
+			return amount.Cmp(low) <= 0
+		case "between":
+			return amount.Cmp(low) >= 0 && amount.Cmp(high) <= 0
+		}
+	case models.RuleFieldAccount:
+		equal := strings.EqualFold(subject.AccountID.String(), condition.Value)
+		return equal == (condition.Operator == "equals")
+	case models.RuleFieldDate:
+		date, err := time.ParseInLocation(dateLayout, condition.Value, subject.Date.Location())
+		if err != nil {
+			return false
+		}
+		day := time.Date(subject.Date.Year(), subject.Date.Month(), subject.Date.Day(), 0, 0, 0, 0, subject.Date.Location())
+		switch condition.Operator {
+		case "on":
+			return day.Equal(date)
+		case "before":
+			return day.Before(date)
+		case "after":
+			return day.After(date)
+		}
+	case models.RuleFieldType:
+		return subject.Type == condition.Value
+	}
+	return false
+}
+
+// matchText compares text ignoring case.
+func (e *Engine) matchText(condition models.RuleCondition, text string) bool {
+	value := strings.ToLower(strings.TrimSpace(condition.Value))
+	text = strings.ToLower(text)
+
+	switch condition.Operator {
+	case "contains":
+		return strings.Contains(text, value)
+	case "not_contains":
+		return !strings.Contains(text, value)
+	case "equals":
+		return strings.TrimSpace(text) == value
+	case "starts_with":
+		return strings.HasPrefix(strings.TrimSpace(text), value)
+	case "ends_with":
+		return strings.HasSuffix(strings.TrimSpace(text), value)
+	case "matches":
+		pattern, found := e.patterns[condition.Value]
+		if !found {
+			var err error
+			if pattern, err = regexp.Compile("(?i)" + condition.Value); err != nil {
+				return false
+			}
+			e.patterns[condition.Value] = pattern
+		}
+		return pattern.MatchString(text)
+	}
+	return false
+}
+
+// amountBounds parses an amount condition. "between" takes "low..high".
+// Commas, underscores and spaces are ignored, so "5,000,000" works; the
+// decimal separator is a point.
+func amountBounds(condition models.RuleCondition) (*big.Rat, *big.Rat, error) {
+	parse := func(value string) (*big.Rat, error) {
+		amount, err := models.ParseDecimal(strings.NewReplacer(",", "", "_", "", " ", "").Replace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return amount, nil
+	}
+
+	if condition.Operator != "between" {
+		low, err := parse(condition.Value)
+		return low, nil, err
+	}
+	lowValue, highValue, found := strings.Cut(condition.Value, "..")
+	if !found {
+		return nil, nil, errors.New(`between takes "low..high"`)
+	}
+	low, err := parse(lowValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	high, err := parse(highValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	if low.Cmp(high) > 0 {
+		return nil, nil, errors.New("low is above high")
+	}
+	return low, high, nil
+}
+
+// SubjectOf describes a transaction paid to the named payee.
+func SubjectOf(transaction *models.Transaction, payee string) Subject {
+	return Subject{
+		Description: transaction.Note,
+		Payee:       payee,
+		Amount:      transaction.Amount,
+		AccountID:   transaction.AccountID,
+		Date:        transaction.Date,
+		Type:        transaction.Type,
+	}
+}
+
+// Fill applies an outcome to a transaction that is about to be saved. Only
+// what is still missing is set: a category the user chose, or the split
+// lines, are kept. It returns the tags to add once the transaction exists.
+func Fill(transaction *models.Transaction, outcome Outcome) []uuid.UUID {
+	if transaction.CategoryID == nil && !transaction.IsSplit() && outcome.CategoryID != nil {
+		transaction.CategoryID = outcome.CategoryID
+	}
+	if transaction.PayeeID == nil && outcome.PayeeID != nil {
+		transaction.PayeeID = outcome.PayeeID
+	}
+	return outcome.TagIDs
+}
+
+// Change describes what applying an outcome does to a stored transaction.
+type Change struct {
+	CategoryID *uuid.UUID
+	PayeeID    *uuid.UUID
+	AddTagIDs  []uuid.UUID
+}
+
+func (c Change) IsEmpty() bool {
+	return c.CategoryID == nil && c.PayeeID == nil && len(c.AddTagIDs) == 0
+}
+
+// Diff works out what an outcome would change on a stored transaction. Split
+// transactions keep their categories.
+func Diff(db *gorm.DB, transaction *models.Transaction, outcome Outcome) (Change, error) {
+	var change Change
+	if outcome.CategoryID != nil && !transaction.IsSplit() &&
+		(transaction.CategoryID == nil || *transaction.CategoryID != *outcome.CategoryID) {
+		change.CategoryID = outcome.CategoryID
+	}
+	if outcome.PayeeID != nil && (transaction.PayeeID == nil || *transaction.PayeeID != *outcome.PayeeID) {
+		change.PayeeID = outcome.PayeeID
+	}
+	if len(outcome.TagIDs) > 0 {
+		var existing []uuid.UUID
+		if err := db.Model(&models.TransactionTag{}).Where("transaction_id = ?", transaction.ID).Pluck("tag_id", &existing).Error; err != nil {
+			return change, err
+		}
+		for _, tagID := range outcome.TagIDs {
+			if !containsID(existing, tagID) {
+				change.AddTagIDs = append(change.AddTagIDs, tagID)
+			}
+		}
+	}
+	return change, nil
+}
+
+// Apply saves a change to a stored transaction and re-books it in the
+// journal when its category changes.
+func Apply(tx *gorm.DB, transaction *models.Transaction, change Change) error {
+	updates := map[string]interface{}{}
+	if change.CategoryID != nil {
+		updates["category_id"] = change.CategoryID
+	}
+	if change.PayeeID != nil {
+		updates["payee_id"] = change.PayeeID
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(transaction).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	if change.CategoryID != nil {
+		transaction.CategoryID = change.CategoryID
+		if err := ledger.Remove(tx, models.JournalSourceTransaction, transaction.ID); err != nil {
+			return err
+		}
+		if err := ledger.RecordTransaction(tx, transaction); err != nil {
+			return err
+		}
+	}
+
+	if len(change.AddTagIDs) > 0 {
+		links := make([]models.TransactionTag, 0, len(change.AddTagIDs))
+		for _, tagID := range change.AddTagIDs {
+			links = append(links, models.TransactionTag{TransactionID: transaction.ID, TagID: tagID})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
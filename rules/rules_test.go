@@ -0,0 +1,236 @@
+package rules
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"expense-app-backend/models"
+
+	"github.com/google/uuid"
+)
+
+func newEngine(rules []models.Rule, categoryTypes map[uuid.UUID]string) *Engine {
+	return &Engine{rules: rules, categoryTypes: categoryTypes, patterns: map[string]*regexp.Regexp{}}
+}
+
+func when(field, operator, value string) models.RuleConditions {
+	return models.RuleConditions{{Field: field, Operator: operator, Value: value}}
+}
+
+func TestEvaluate(t *testing.T) {
+	food, salary := uuid.New(), uuid.New()
+	grab, employer := uuid.New(), uuid.New()
+	travel, work := uuid.New(), uuid.New()
+	categoryTypes := map[uuid.UUID]string{
+		food:   models.TransactionTypeExpense,
+		salary: models.TransactionTypeIncome,
+	}
+
+	coffee := Subject{Description: "GRAB*Food order", Amount: models.NewMoney(4500000, "IDR"), Type: models.TransactionTypeExpense}
+	payday := Subject{Description: "Salary January", Payee: "ACME", Amount: models.NewMoney(500000000, "IDR"), Type: models.TransactionTypeIncome}
+
+	tests := []struct {
+		name     string
+		rules    []models.Rule
+		subject  Subject
+		category *uuid.UUID
+		payee    *uuid.UUID
+		tags     []uuid.UUID
+		matched  int
+	}{
+		{
+			name: "first rule by priority sets the category",
+			rules: []models.Rule{
+				{ID: uuid.New(), Conditions: when("description", "contains", "grab"), Actions: models.RuleActions{CategoryID: &food}},
+				{ID: uuid.New(), Conditions: when("description", "contains", "food"), Actions: models.RuleActions{CategoryID: &salary, PayeeID: &grab}},
+			},
+			subject:  coffee,
+			category: &food,
+			payee:    &grab,
+			matched:  2,
+		},
+		{
+			name: "tags from every matching rule are combined",
+			rules: []models.Rule{
+				{ID: uuid.New(), Conditions: when("description", "starts_with", "grab"), Actions: models.RuleActions{TagIDs: []uuid.UUID{travel}}},
+				{ID: uuid.New(), Conditions: when("description", "ends_with", "ORDER"), Actions: models.RuleActions{TagIDs: []uuid.UUID{travel, work}}},
+			},
+			subject: coffee,
+			tags:    []uuid.UUID{travel, work},
+			matched: 2,
+		},
+		{
+			name: "stop_processing ends the run",
+			rules: []models.Rule{
+				{ID: uuid.New(), StopProcessing: true, Conditions: when("description", "contains", "grab"), Actions: models.RuleActions{TagIDs: []uuid.UUID{travel}}},
+				{ID: uuid.New(), Conditions: when("description", "contains", "grab"), Actions: models.RuleActions{CategoryID: &food, TagIDs: []uuid.UUID{work}}},
+			},
+			subject: coffee,
+			tags:    []uuid.UUID{travel},
+			matched: 1,
+		},
+		{
+			name: "stop_processing on a rule that does not match",
+			rules: []models.Rule{
+				{ID: uuid.New(), StopProcessing: true, Conditions: when("description", "contains", "gojek"), Actions: models.RuleActions{CategoryID: &salary}},
+				{ID: uuid.New(), Conditions: when("description", "contains", "grab"), Actions: models.RuleActions{CategoryID: &food}},
+			},
+			subject:  coffee,
+			category: &food,
+			matched:  1,
+		},
+		{
+			name: "category of the other type is ignored",
+			rules: []models.Rule{
+				{ID: uuid.New(), Conditions: when("description", "contains", "salary"), Actions: models.RuleActions{CategoryID: &food, PayeeID: &employer}},
+				{ID: uuid.New(), Conditions: when("payee", "equals", "acme"), Actions: models.RuleActions{CategoryID: &salary}},
+			},
+			subject:  payday,
+			category: &salary,
+			payee:    &employer,
+			matched:  2,
+		},
+		{
+			name: "unknown category is ignored",
+			rules: []models.Rule{
+				{ID: uuid.New(), Conditions: when("description", "contains", "grab"), Actions: models.RuleActions{CategoryID: &travel}},
+			},
+			subject: coffee,
+			matched: 1,
+		},
+		{
+			name: "every condition must hold",
+			rules: []models.Rule{
+				{ID: uuid.New(), Conditions: models.RuleConditions{
+					{Field: "description", Operator: "contains", Value: "grab"},
+					{Field: "type", Operator: "equals", Value: models.TransactionTypeIncome},
+				}, Actions: models.RuleActions{CategoryID: &food}},
+			},
+			subject: coffee,
+		},
+		{
+			name: "a rule without conditions never matches",
+			rules: []models.Rule{
+				{ID: uuid.New(), Actions: models.RuleActions{CategoryID: &food}},
+			},
+			subject: coffee,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome := newEngine(tt.rules, categoryTypes).Evaluate(tt.subject)
+			if !sameID(outcome.CategoryID, tt.category) {
+				t.Errorf("category = %v, want %v", outcome.CategoryID, tt.category)
+			}
+			if !sameID(outcome.PayeeID, tt.payee) {
+				t.Errorf("payee = %v, want %v", outcome.PayeeID, tt.payee)
+			}
+			if len(outcome.TagIDs) != len(tt.tags) {
+				t.Fatalf("tags = %v, want %v", outcome.TagIDs, tt.tags)
+			}
+			for i := range tt.tags {
+				if outcome.TagIDs[i] != tt.tags[i] {
+					t.Errorf("tags = %v, want %v", outcome.TagIDs, tt.tags)
+				}
+			}
+			if len(outcome.RuleIDs) != tt.matched {
+				t.Errorf("%d rules matched, want %d", len(outcome.RuleIDs), tt.matched)
+			}
+		})
+	}
+}
+
+func TestConditionHolds(t *testing.T) {
+	account := uuid.New()
+	subject := Subject{
+		Description: "Transfer to Savings",
+		Payee:       "Bank BCA",
+		Amount:      models.NewMoney(500000000, "IDR"),
+		AccountID:   account,
+		Date:        time.Date(2024, time.January, 31, 18, 30, 0, 0, time.Local),
+		Type:        models.TransactionTypeExpense,
+	}
+
+	tests := []struct {
+		field    string
+		operator string
+		value    string
+		want     bool
+	}{
+		{field: "amount", operator: "eq", value: "5,000,000", want: true},
+		{field: "amount", operator: "eq", value: "5 000 000.00", want: true},
+		{field: "amount", operator: "eq", value: "5_000_000", want: true},
+		{field: "amount", operator: "gt", value: "4,999,999.99", want: true},
+		{field: "amount", operator: "gt", value: "5,000,000", want: false},
+		{field: "amount", operator: "gte", value: "5,000,000", want: true},
+		{field: "amount", operator: "lt", value: "5,000,000.01", want: true},
+		{field: "amount", operator: "lte", value: "4,999,999", want: false},
+		{field: "amount", operator: "between", value: "5,000,000..6,000,000", want: true},
+		{field: "amount", operator: "between", value: "1,000,000..5,000,000", want: true},
+		{field: "amount", operator: "between", value: "1,000,000..4,999,999.99", want: false},
+		{field: "amount", operator: "between", value: "5,000,000.01..6,000,000", want: false},
+		{field: "amount", operator: "eq", value: "5e6", want: false},
+		{field: "description", operator: "contains", value: "savings", want: true},
+		{field: "description", operator: "not_contains", value: "savings", want: false},
+		{field: "description", operator: "equals", value: " transfer to savings ", want: true},
+		{field: "description", operator: "matches", value: `^transfer\s+to`, want: true},
+		{field: "payee", operator: "starts_with", value: "bank", want: true},
+		{field: "payee", operator: "ends_with", value: "bni", want: false},
+		{field: "account", operator: "equals", value: account.String(), want: true},
+		{field: "account", operator: "not_equals", value: account.String(), want: false},
+		{field: "date", operator: "on", value: "2024-01-31", want: true},
+		{field: "date", operator: "before", value: "2024-01-31", want: false},
+		{field: "date", operator: "after", value: "2024-01-30", want: true},
+		{field: "type", operator: "equals", value: models.TransactionTypeIncome, want: false},
+	}
+
+	engine := newEngine(nil, nil)
+	for _, tt := range tests {
+		condition := models.RuleCondition{Field: tt.field, Operator: tt.operator, Value: tt.value}
+		if got := engine.holds(condition, subject); got != tt.want {
+			t.Errorf("%s %s %q = %v, want %v", tt.field, tt.operator, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions models.RuleConditions
+		wantErr    bool
+	}{
+		{name: "amount with separators", conditions: when("amount", "gte", "5,000,000")},
+		{name: "between", conditions: when("amount", "between", "10..20.50")},
+		{name: "text", conditions: when("payee", "contains", "grab")},
+		{name: "date", conditions: when("date", "after", "2024-01-31")},
+		{name: "no conditions", wantErr: true},
+		{name: "unknown field", conditions: when("memo", "contains", "x"), wantErr: true},
+		{name: "wrong operator", conditions: when("amount", "contains", "5"), wantErr: true},
+		{name: "between without range", conditions: when("amount", "between", "10"), wantErr: true},
+		{name: "between upside down", conditions: when("amount", "between", "20..10"), wantErr: true},
+		{name: "fraction", conditions: when("amount", "eq", "1/3"), wantErr: true},
+		{name: "exponent", conditions: when("amount", "gt", "1e9999999"), wantErr: true},
+		{name: "empty amount", conditions: when("amount", "eq", ""), wantErr: true},
+		{name: "bad pattern", conditions: when("description", "matches", "("), wantErr: true},
+		{name: "empty text", conditions: when("payee", "equals", " "), wantErr: true},
+		{name: "bad account", conditions: when("account", "equals", "savings"), wantErr: true},
+		{name: "bad date", conditions: when("date", "on", "31/01/2024"), wantErr: true},
+		{name: "bad type", conditions: when("type", "equals", "transfer"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := Validate(tt.conditions)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
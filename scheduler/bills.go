@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"expense-app-backend/models"
+	"expense-app-backend/notifier"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BillReminderJob notifies users of unpaid bills that fall due within their
+// reminder window, once per due date. Overdue bills that were never reminded
+// are notified as well.
+func BillReminderJob(n notifier.Notifier) Job {
+	return Job{
+		Name: "bill-reminders",
+		Run: func(ctx context.Context, db *gorm.DB, now time.Time) error {
+			return remindBills(ctx, db, n, now)
+		},
+	}
+}
+
+func remindBills(ctx context.Context, db *gorm.DB, n notifier.Notifier, now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var bills []models.Bill
+	if err := db.Where("paid = ? AND DATE_SUB(due_date, INTERVAL remind_days DAY) <= ?", false, today.Format("2006-01-02")).
+		Where("reminded_for IS NULL OR reminded_for < due_date").
+		Find(&bills).Error; err != nil {
+		return err
+	}
+
+	for i := range bills {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		bill := &bills[i]
+
+		var user models.User
+		if err := db.Where("id = ?", bill.UserID).First(&user).Error; err != nil {
+			log.Printf("scheduler: bill %s: %v", bill.ID, err)
+			continue
+		}
+
+		if err := n.Notify(ctx, billReminder(&user, bill, today)); err != nil {
+			log.Printf("scheduler: reminder for bill %s: %v", bill.ID, err)
+			continue
+		}
+		if err := db.Model(bill).Update("reminded_for", bill.DueDate).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func billReminder(user *models.User, bill *models.Bill, today time.Time) notifier.Notification {
+	due := bill.DueDate.Format("2006-01-02")
+	subject := fmt.Sprintf("%s is due on %s", bill.Name, due)
+	if bill.Status(today) == models.BillStatusOverdue {
+		subject = fmt.Sprintf("%s is overdue since %s", bill.Name, due)
+	}
+	return notifier.Notification{
+		UserID:  user.ID.String(),
+		Email:   user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hi %s,\n\n%s of %s is due on %s.", user.Name, bill.Name, bill.Amount, due),
+	}
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"expense-app-backend/attachments"
+	"expense-app-backend/blobstore"
+	"expense-app-backend/models"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AccountDeletionJob purges the accounts whose deletion grace period has
+// passed, with everything they own, attachment files in store included.
+func AccountDeletionJob(store blobstore.BlobStore) Job {
+	return Job{
+		Name: "account-deletions",
+		Run: func(ctx context.Context, db *gorm.DB, now time.Time) error {
+			return purgeDeletedAccounts(ctx, db, store, now)
+		},
+	}
+}
+
+func purgeDeletedAccounts(ctx context.Context, db *gorm.DB, store blobstore.BlobStore, now time.Time) error {
+	var ids []uuid.UUID
+	if err := db.Unscoped().Model(&models.User{}).Where("delete_after <= ?", now).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var shas []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// The user may have logged in, cancelling the deletion, since
+			// the list was read.
+			var user models.User
+			if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND delete_after <= ?", id, now).First(&user).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Attachment{}).Where("user_id = ?", id).Distinct("sha256").Pluck("sha256", &shas).Error; err != nil {
+				return err
+			}
+			return models.PurgeUser(tx, id)
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("scheduler: purging account %s: %v", id, err)
+			continue
+		}
+		// Files shared with other users' attachments are kept.
+		for _, sha := range shas {
+			if err := attachments.Release(ctx, db, store, sha); err != nil {
+				log.Printf("scheduler: releasing attachment file %s: %v", sha, err)
+			}
+		}
+		log.Printf("scheduler: purged account %s", id)
+	}
+	return nil
+}
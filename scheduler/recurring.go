@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"expense-app-backend/ledger"
+	"expense-app-backend/models"
+	"expense-app-backend/recurrence"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecurringJob books the due occurrences of every recurring transaction.
+var RecurringJob = Job{Name: "recurring-transactions", Run: materializeAll}
+
+func materializeAll(ctx context.Context, db *gorm.DB, now time.Time) error {
+	var recurring []models.RecurringTransaction
+	if err := db.Where("paused = ? AND start_date <= ?", false, now).Find(&recurring).Error; err != nil {
+		return err
+	}
+
+	for i := range recurring {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		booked, err := Materialize(db, &recurring[i], now)
+		if err != nil {
+			log.Printf("scheduler: recurring transaction %s: %v", recurring[i].ID, err)
+			continue
+		}
+		if booked > 0 {
+			log.Printf("scheduler: booked %d occurrence(s) of recurring transaction %s", booked, recurring[i].ID)
+		}
+	}
+	return nil
+}
+
+// Materialize books every occurrence of a recurring transaction due on or
+// before now that has not been dealt with yet, and returns how many it
+// booked. Occurrences that already have a transaction, even a deleted one,
+// are left alone, so running it twice books nothing new.
+func Materialize(db *gorm.DB, recurring *models.RecurringTransaction, now time.Time) (int, error) {
+	rule, err := recurrence.Parse(recurring.RRule)
+	if err != nil {
+		return 0, err
+	}
+
+	from := recurring.StartDate
+	if recurring.MaterializedThrough != nil {
+		from = recurring.MaterializedThrough.AddDate(0, 0, 1)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dates := rule.Between(recurring.StartDate, from, today.AddDate(0, 0, 1), 0)
+
+	booked := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, date := range dates {
+			var existing int64
+			if err := tx.Unscoped().Model(&models.Transaction{}).
+				Where("recurring_id = ? AND occurrence_date = ?", recurring.ID, date.Format("2006-01-02")).
+				Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing > 0 {
+				continue
+			}
+
+			var exception *models.RecurringException
+			var found models.RecurringException
+			if err := tx.Where("recurring_id = ? AND occurrence_date = ?", recurring.ID, date.Format("2006-01-02")).Limit(1).Find(&found).Error; err != nil {
+				return err
+			}
+			if found.RecurringID == recurring.ID {
+				exception = &found
+			}
+
+			transaction := recurring.Occurrence(date, exception)
+			if transaction == nil {
+				continue
+			}
+			if err := tx.Create(transaction).Error; err != nil {
+				return err
+			}
+			if err := ledger.RecordTransaction(tx, transaction); err != nil {
+				return err
+			}
+			booked++
+		}
+
+		return tx.Model(recurring).Update("materialized_through", today).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return booked, nil
+}
@@ -0,0 +1,73 @@
+// Package scheduler runs periodic background jobs inside the API process.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultInterval = time.Hour
+
+// Job is one unit of background work. Jobs must be idempotent: they can run
+// again after a crash or on several instances at once.
+type Job struct {
+	Name string
+	Run  func(ctx context.Context, db *gorm.DB, now time.Time) error
+}
+
+type Scheduler struct {
+	db       *gorm.DB
+	interval time.Duration
+	jobs     []Job
+}
+
+// New creates a scheduler running every SCHEDULER_INTERVAL (a Go duration
+// such as "15m"), hourly by default.
+func New(db *gorm.DB, jobs ...Job) *Scheduler {
+	interval := defaultInterval
+	if value := os.Getenv("SCHEDULER_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			interval = parsed
+		} else {
+			log.Printf("scheduler: ignoring invalid SCHEDULER_INTERVAL %q", value)
+		}
+	}
+	return &Scheduler{db: db, interval: interval, jobs: jobs}
+}
+
+// Start runs every job right away and then once per interval until ctx is
+// cancelled. It returns immediately.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		s.RunOnce(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.RunOnce(ctx)
+			}
+		}
+	}()
+}
+
+// RunOnce runs every job one time. A failing job is logged and does not stop
+// the others.
+func (s *Scheduler) RunOnce(ctx context.Context) {
+	now := time.Now()
+	for _, job := range s.jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := job.Run(ctx, s.db, now); err != nil {
+			log.Printf("scheduler: job %s failed: %v", job.Name, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package templates
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+const DefaultLocale = "en"
+
+//go:embed categories/*.json
+var categoryFiles embed.FS
+
+var ErrTemplateNotFound = errors.New("category template not found")
+
+type CategoryTemplate struct {
+	Locale     string             `json:"locale"`
+	Name       string             `json:"name"`
+	Categories []TemplateCategory `json:"categories"`
+}
+
+type TemplateCategory struct {
+	Name          string   `json:"name"`
+	CategoryType  string   `json:"category_type"`
+	SubCategories []string `json:"sub_categories"`
+}
+
+func LoadCategoryTemplate(locale string) (*CategoryTemplate, error) {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == "" || strings.ContainsAny(locale, "./\\") {
+		return nil, ErrTemplateNotFound
+	}
+
+	data, err := categoryFiles.ReadFile(path.Join("categories", locale+".json"))
+	if err != nil {
+		return nil, ErrTemplateNotFound
+	}
+
+	var template CategoryTemplate
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func CategoryTemplates() ([]CategoryTemplate, error) {
+	entries, err := categoryFiles.ReadDir("categories")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []CategoryTemplate
+	for _, entry := range entries {
+		template, err := LoadCategoryTemplate(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *template)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Locale < list[j].Locale })
+	return list, nil
+}
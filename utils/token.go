@@ -10,13 +10,15 @@ var jwtKey = []byte("your_secret_key") // Use a secure key here
 type JWTClaim struct {
 	UserID uuid.UUID `json:"user_id"`
 	Email  string    `json:"email"`
+	Role   string    `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uuid.UUID, email string) (string, error) {
+func GenerateJWT(userID uuid.UUID, email string, role string) (string, error) {
 	claims := &JWTClaim{
 		UserID: userID,
 		Email:  email,
+		Role:   role,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtKey)